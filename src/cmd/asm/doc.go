@@ -29,6 +29,8 @@ Flags:
 		dump instructions as they are parsed
 	-dynlink
 		support references to Go symbols defined in other shared libraries
+	-gopath string
+		record source file paths in GOPATH directory as $GOPATH
 	-o string
 		output file; default foo.o for /a/b/c/foo.s
 	-shared
@@ -41,6 +41,7 @@ func main() {
 		ctxt.Debugasm = 1
 	}
 	ctxt.LineHist.TrimPathPrefix = *flags.TrimPath
+	ctxt.LineHist.GOPATH = *flags.GOPATH
 	ctxt.Flag_dynlink = *flags.Dynlink
 	if *flags.Shared || *flags.Dynlink {
 		ctxt.Flag_shared = 1
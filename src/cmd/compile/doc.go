@@ -52,6 +52,9 @@ Flags:
 		Allow references to Go symbols in shared libraries (experimental).
 	-e
 		Remove the limit on the number of errors reported (default limit is 10).
+	-gopath dir
+		Record source file paths in the GOPATH directory dir as $GOPATH,
+		for the linker to expand again (see the linker's -gopath flag).
 	-h
 		Halt with a stack trace at the first error detected.
 	-importmap old=new
@@ -801,6 +801,9 @@ func cgen_wbptr(n, res *Node) {
 		Cgenr(n, &src, nil)
 	}
 
+	// The GC may enable the write barrier between the check
+	// and the store, so they must not be preempted in between.
+	gunsafepoint(true)
 	wbVar := syslook("writeBarrier", 0)
 	wbEnabled := Nod(ODOT, wbVar, newname(wbVar.Type.Type.Sym))
 	wbEnabled = typecheck(&wbEnabled, Erv)
@@ -824,6 +827,7 @@ func cgen_wbptr(n, res *Node) {
 	}
 	Ginscall(sys_wbptr, 0)
 	Patch(pjmp, Pc)
+	gunsafepoint(false)
 
 	Regfree(&dst)
 	Regfree(&src)
@@ -2419,8 +2423,8 @@ func Ginscall(f *Node, proc int) {
 		if proc == 1 {
 			Ginscall(Newproc, 0)
 		} else {
-			if !hasdefer {
-				Fatalf("hasdefer=0 but has defer")
+			if !Hasdefer {
+				Fatalf("Hasdefer=0 but has defer")
 			}
 			Ginscall(Deferproc, 0)
 		}
@@ -2618,7 +2622,7 @@ func cgen_ret(n *Node) {
 	if n != nil {
 		Genlist(n.List) // copy out args
 	}
-	if hasdefer {
+	if Hasdefer {
 		Ginscall(Deferreturn, 0)
 	}
 	Genlist(Curfn.Func.Exit)
@@ -29,6 +29,21 @@ func makefuncdatasym(namefmt string, funcdatakind int64) *Sym {
 	return sym
 }
 
+// gunsafepoint inserts a PCDATA instruction marking the code that
+// follows as an unsafe (or safe) point for asynchronous preemption.
+func gunsafepoint(unsafe bool) {
+	var from, to Node
+	Nodconst(&from, Types[TINT32], obj.PCDATA_UnsafePoint)
+	if unsafe {
+		Nodconst(&to, Types[TINT32], obj.PCDATA_UnsafePointUnsafe)
+	} else {
+		Nodconst(&to, Types[TINT32], obj.PCDATA_UnsafePointSafe)
+	}
+	p := Prog(obj.APCDATA)
+	Naddr(&p.From, &from)
+	Naddr(&p.To, &to)
+}
+
 // gvardef inserts a VARDEF for n into the instruction stream.
 // VARDEF is an annotation for the liveness analysis, marking a place
 // where a complete initialization (definition) of a variable begins.
@@ -108,11 +123,11 @@ func Gvardef(n *Node) {
 	gvardefx(n, obj.AVARDEF)
 }
 
-func gvarkill(n *Node) {
+func Gvarkill(n *Node) {
 	gvardefx(n, obj.AVARKILL)
 }
 
-func gvarlive(n *Node) {
+func Gvarlive(n *Node) {
 	gvardefx(n, obj.AVARLIVE)
 }
 
@@ -404,7 +419,7 @@ func compile(fn *Node) {
 		goto ret
 	}
 
-	hasdefer = false
+	Hasdefer = false
 	walk(Curfn)
 	if nerrors != 0 {
 		goto ret
@@ -483,6 +498,12 @@ func compile(fn *Node) {
 		}
 	}
 
+	// The function body is a safe point for asynchronous
+	// preemption, except where the code generator says otherwise.
+	// The prologue, which the assembler inserts before this,
+	// is not.
+	gunsafepoint(false)
+
 	if ssafn != nil {
 		genssa(ssafn, ptxt, gcargs, gclocals)
 		if Curfn.Func.Endlineno != 0 {
@@ -511,7 +532,7 @@ func compile(fn *Node) {
 	// TODO: Determine when the final cgen_ret can be omitted. Perhaps always?
 	cgen_ret(nil)
 
-	if hasdefer {
+	if Hasdefer {
 		// deferreturn pretends to have one uintptr argument.
 		// Reserve space for it so stack scanner is happy.
 		if Maxarg < int64(Widthptr) {
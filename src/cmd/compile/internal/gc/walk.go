@@ -239,7 +239,7 @@ func walkstmt(np **Node) {
 		walkstmt(&n.Right)
 
 	case ODEFER:
-		hasdefer = true
+		Hasdefer = true
 		switch n.Left.Op {
 		case OPRINT, OPRINTN:
 			walkprintfunc(&n.Left, &n.Ninit)
@@ -24,6 +24,7 @@ The commands are:
 	get         download and install packages and dependencies
 	install     compile and install packages and dependencies
 	list        list packages
+	mod         module maintenance
 	run         compile and run Go program
 	test        test packages
 	tool        run specified go tool
@@ -36,10 +37,12 @@ Additional help topics:
 
 	c           calling between Go and C
 	buildmode   description of build modes
+	cache       build and test caching
 	filetype    file types
 	gopath      GOPATH environment variable
 	environment environment variables
 	importpath  import path syntax
+	modules     modules, module versions, and more
 	packages    description of package lists
 	testflag    description of testing flags
 	testfunc    description of testing functions
@@ -125,6 +128,9 @@ and test commands:
 	-linkshared
 		link against shared libraries previously created with
 		-buildmode=shared.
+	-mod mode
+		module download mode to use: vendor.
+		See 'go help modules' for more.
 	-pkgdir dir
 		install and load all packages from dir instead of the usual locations.
 		For example, when building with a non-standard configuration,
@@ -160,7 +166,7 @@ Remove object files
 
 Usage:
 
-	go clean [-i] [-r] [-n] [-x] [build flags] [packages]
+	go clean [-i] [-r] [-n] [-x] [-cache] [build flags] [packages]
 
 Clean removes object files from package source directories.
 The go command builds most objects in a temporary directory,
@@ -198,6 +204,10 @@ dependencies of the packages named by the import paths.
 
 The -x flag causes clean to print remove commands as it executes them.
 
+The -cache flag causes clean to remove the entire build cache
+(see 'go help cache'). If no packages are given, only the cache
+is cleaned.
+
 For more about build flags, see 'go help build'.
 
 For more about specifying packages, see 'go help packages'.
@@ -519,6 +529,17 @@ For more about specifying packages, see 'go help packages'.
 For more about how 'go get' finds source code to
 download, see 'go help importpath'.
 
+In module-aware mode (see 'go help modules'), get instead adjusts the
+requirements in the main module's go.mod file. Each argument names a
+package, optionally followed by @version to request a specific version
+of the module providing it, as in 'go get example.com/pkg@v1.2.3'.
+The version may also be a prefix such as v1 or v1.2, meaning the latest
+matching release, or "latest". Without a version, get requests the latest
+release. Get then downloads the selected modules into the module cache,
+records their checksums in go.sum, and, unless -d is given, installs the
+named packages. The -f, -fix, -insecure, -t and -u flags do not apply
+in module-aware mode.
+
 See also: go build, go install, go clean.
 
 
@@ -541,7 +562,7 @@ List packages
 
 Usage:
 
-	go list [-e] [-f format] [-json] [build flags] [packages]
+	go list [-e] [-f format] [-json] [-m] [build flags] [packages]
 
 List lists the packages named by the import paths, one per line.
 
@@ -577,6 +598,7 @@ syntax of package template.  The default output is equivalent to -f
         CXXFiles       []string // .cc, .cxx and .cpp source files
         MFiles         []string // .m source files
         HFiles         []string // .h, .hh, .hpp and .hxx source files
+        FFiles         []string // .f, .F, .for and .f90 Fortran source files
         SFiles         []string // .s source files
         SwigFiles      []string // .swig files
         SwigCXXFiles   []string // .swigcxx files
@@ -586,6 +608,7 @@ syntax of package template.  The default output is equivalent to -f
         CgoCFLAGS    []string // cgo: flags for C compiler
         CgoCPPFLAGS  []string // cgo: flags for C preprocessor
         CgoCXXFLAGS  []string // cgo: flags for C++ compiler
+        CgoFFLAGS    []string // cgo: flags for Fortran compiler
         CgoLDFLAGS   []string // cgo: flags for linker
         CgoPkgConfig []string // cgo: pkg-config names
 
@@ -593,6 +616,9 @@ syntax of package template.  The default output is equivalent to -f
         Imports []string // import paths used by this package
         Deps    []string // all (recursively) imported dependencies
 
+        // Module information
+        Module *Module // module providing this package (module-aware mode only)
+
         // Error information
         Incomplete bool            // this package or a dependency has an error
         Error      *PackageError   // error loading package
@@ -645,11 +671,67 @@ printing.  Erroneous packages will have a non-empty ImportPath and
 a non-nil Error field; other information may or may not be missing
 (zeroed).
 
+The -m flag causes list to list modules instead of packages.
+It is valid only in module-aware mode (see 'go help modules').
+With no arguments, list -m shows the main module. With the
+argument "all", it shows the build list: the main module followed
+by each dependency at its selected version. Otherwise the arguments
+are module paths, and list -m shows the selected version of each.
+The default output shows the module path and version:
+
+    example.com/hello
+    example.com/greet v1.2.0
+
+When listing modules, the struct passed to the -f template is:
+
+    type Module struct {
+        Path    string // module path
+        Version string // module version
+        Main    bool   // is this the main module?
+        Dir     string // directory holding files for this module, if any
+    }
+
+In module-aware mode, the Module field of Package
+describes the module providing the package.
+
 For more about build flags, see 'go help build'.
 
 For more about specifying packages, see 'go help packages'.
 
 
+Module maintenance
+
+Usage:
+
+	go mod command [arguments]
+
+Mod performs maintenance operations on the main module,
+the module whose go.mod file encloses the current directory.
+See 'go help modules' for an overview of modules.
+
+The commands are:
+
+	go mod init [module]
+		Initialize a new module in the current directory by
+		writing a go.mod file declaring the given module path.
+		If the module path is omitted and the current directory
+		is inside GOPATH/src, the path is derived from the directory.
+
+	go mod download
+		Download every module in the build list into the module cache.
+
+	go mod vendor
+		Reset the main module's vendor directory to hold copies of all
+		packages needed to build and test the packages in the main module,
+		and write vendor/modules.txt recording the module version providing
+		each one. Builds given the -mod=vendor flag use the vendor directory
+		instead of the module cache.
+
+	go mod verify
+		Check that the modules in the module cache have not been modified
+		since they were downloaded, by comparing them against go.sum.
+
+
 Compile and run Go program
 
 Usage:
@@ -846,6 +928,43 @@ are:
 		main are ignored.
 
 
+Build and test caching
+
+The go command caches build outputs for reuse in future builds.
+The default location for cache data is a subdirectory named go-build
+in the standard user cache directory for the current operating system:
+$XDG_CACHE_HOME or $HOME/.cache on Unix systems, $HOME/Library/Caches
+on Mac OS X, %LocalAppData% on Windows and $home/lib/cache on Plan 9.
+Setting the GOCACHE environment variable overrides this default,
+and running 'go env GOCACHE' prints the current cache directory.
+Setting GOCACHE=off disables the cache.
+
+The go command looks up each package it compiles in the cache, keyed
+by a hash of the compiler, the build flags, the target operating system
+and architecture, the package's import path and the content of its source
+files and compiled dependencies. The key does not depend on where the
+package is within GOROOT or GOPATH, so the same package in another
+GOPATH tree or checkout reuses the cached result; only packages outside
+GOROOT and GOPATH are also keyed by their directory. When a matching
+entry exists, the compiled package is copied from the cache instead of
+running the compiler. Packages using cgo or SWIG, and packages being
+built for coverage analysis, are always compiled.
+
+The go test command also caches successful test results. When a test
+binary is unchanged from an earlier successful run, and it is run in
+the same directory with the same environment, the same files in its
+testdata directory and only the flags -cpu, -parallel, -run, -short,
+-timeout and -v, go test redisplays the earlier output instead of
+running the test again, with "(cached)" in place of the elapsed time
+in the summary line. Test results are never cached when go test is
+run without package arguments, in the current directory. Changes to
+files outside the package's testdata directory are not detected;
+to force a test to run, use any other flag, such as -count=1.
+
+The cache grows as needed. Run 'go clean -cache' to remove all
+cached data.
+
+
 File types
 
 The go command examines the contents of a restricted set of files
@@ -1041,11 +1160,17 @@ General-purpose environment variables:
 		Examples are amd64, 386, arm, ppc64.
 	GOBIN
 		The directory where 'go install' will install a command.
+	GO111MODULE
+		Controls module-aware mode: on, off or auto.
+		See 'go help modules'.
 	GOOS
 		The operating system for which to compile code.
 		Examples are linux, darwin, windows, netbsd.
 	GOPATH
 		See 'go help gopath'.
+	GOPROXY
+		URL of the module proxy from which to download modules.
+		See 'go help modules'.
 	GORACE
 		Options for the race detector.
 		See https://golang.org/doc/articles/race_detector.html.
@@ -1271,6 +1396,62 @@ comments.
 See https://golang.org/s/go14customimport for details.
 
 
+Modules, module versions, and more
+
+A module is a collection of related Go packages that are versioned
+together. A module is defined by a tree of Go source files with a go.mod
+file in the tree's root directory. The go.mod file declares the module
+path, which is the import path prefix for all packages in the module,
+and lists the other modules the module requires, each at a minimum
+semantic version (see http://semver.org/):
+
+	module example.com/hello
+
+	require (
+		example.com/greet v1.2.0
+		example.com/other v0.3.1
+	)
+
+The go command operates in module-aware mode or in GOPATH mode,
+as controlled by the GO111MODULE environment variable. With
+GO111MODULE=off, the go command never uses modules. With
+GO111MODULE=on, it always uses modules. With GO111MODULE unset
+or set to auto, it uses modules when the current directory is
+outside GOPATH/src and is in, or below, a directory holding a
+go.mod file.
+
+In module-aware mode, the main module is the module containing the
+current directory. Import paths are resolved using the build list:
+the main module plus the selected version of each module reachable
+through requirements. For each module path, the selected version is
+the highest version required by the main module or by any module
+version in the build list (minimal version selection). A build is thus
+determined entirely by go.mod files, and upgrades happen only when
+go.mod is changed, for example by 'go get path@version'. GOPATH is no
+longer consulted for imports, and vendor directories are ignored
+unless the build is run with -mod=vendor.
+
+Modules are downloaded from the module proxy named by the GOPROXY
+environment variable, which is an http or https URL, or a file URL
+naming a directory such as file:///home/user/proxy. For a module path
+and version, the proxy serves <path>/@v/list, listing the available
+versions one per line, and <path>/@v/<version>.mod and
+<path>/@v/<version>.zip, holding the go.mod file and the module source.
+Upper-case letters in module paths are written as '!' followed by the
+lower-case letter. Downloaded modules are kept in the module cache,
+GOPATH/pkg/mod, and later builds use the cache without network access.
+
+The go command records the expected cryptographic checksum of each
+module version and go.mod file it downloads in go.sum, next to go.mod.
+If a later download does not match the recorded checksum, the go
+command reports a checksum mismatch and refuses to use the module.
+Both go.mod and go.sum should be checked into version control.
+
+See 'go get' for changing requirements, 'go list -m' for listing
+the build list, and 'go mod' for creating go.mod files, downloading
+modules, verifying the module cache and populating vendor directories.
+
+
 Description of package lists
 
 Many commands apply to a set of packages:
@@ -1353,7 +1534,10 @@ The following flags are recognized by the 'go test' command and
 control the execution of any test:
 
 	-bench regexp
-	    Run benchmarks matching the regular expression.
+	    Run (sub)benchmarks matching a regular expression.
+	    The given regular expression is split into smaller ones by
+	    top-level '/', where each must match the corresponding part of a
+	    benchmark's identifier.
 	    By default, no benchmarks run. To run all benchmarks,
 	    use '-bench .' or '-bench=.'.
 
@@ -1417,6 +1601,25 @@ control the execution of any test:
 	    Write a CPU profile to the specified file before exiting.
 	    Writes test binary as -c would.
 
+	-fuzz regexp
+	    Run the fuzz target matching the regular expression. When specified,
+	    the command line argument must match exactly one package, and regexp
+	    must match exactly one fuzz target within that package. Fuzzing
+	    generates new inputs from the seed corpus until an input fails or
+	    the -fuzztime limit is reached. The failing input is minimized and
+	    written to the testdata/fuzz directory of the package, where later
+	    runs of 'go test' will find it. Sets -cover, which guides the
+	    generation of inputs. See 'go help testfunc'.
+
+	-fuzzminimizetime t
+	    Spend at most t minimizing a failing input found by -fuzz.
+	    The default is 60 seconds (60s).
+
+	-fuzztime t
+	    Spend at most t running fuzz inputs, specified as a time.Duration
+	    (for example, -fuzztime 1h30s). By default, fuzzing runs until
+	    it finds a failure. Fuzzing is not subject to -timeout.
+
 	-memprofile mem.out
 	    Write a memory profile to the file after all tests have passed.
 	    Writes test binary as -c would.
@@ -1427,6 +1630,15 @@ control the execution of any test:
 	    To profile all memory allocations, use -test.memprofilerate=1
 	    and pass --alloc_space flag to the pprof tool.
 
+	-mutexprofile mutex.out
+	    Write a mutex contention profile to the specified file
+	    when all tests are complete.
+	    Writes test binary as -c would.
+
+	-mutexprofilefraction n
+	    Sample 1 in n stack traces of goroutines holding a
+	    contended mutex.
+
 	-outputdir directory
 	    Place output files from profiling in the specified directory,
 	    by default the directory in which "go test" is running.
@@ -1442,7 +1654,9 @@ control the execution of any test:
 
 	-run regexp
 	    Run only those tests and examples matching the regular
-	    expression.
+	    expression. For tests the regular expression is split into
+	    smaller ones by top-level '/', where each must match the
+	    corresponding part of a test's identifier.
 
 	-short
 	    Tell long-running tests to shorten their run time.
@@ -1523,8 +1737,8 @@ binary, instead of being interpreted as the package list.
 
 Description of testing functions
 
-The 'go test' command expects to find test, benchmark, and example functions
-in the "*_test.go" files corresponding to the package under test.
+The 'go test' command expects to find test, benchmark, fuzz target, and example
+functions in the "*_test.go" files corresponding to the package under test.
 
 A test function is one named TestXXX (where XXX is any alphanumeric string
 not starting with a lower case letter) and should have the signature,
@@ -1535,6 +1749,14 @@ A benchmark function is one named BenchmarkXXX and should have the signature,
 
 	func BenchmarkXXX(b *testing.B) { ... }
 
+A fuzz target is one named FuzzXXX and should have the signature,
+
+	func FuzzXXX(f *testing.F) { ... }
+
+It runs as a test on its seed corpus: the inputs it adds with f.Add and
+the files in testdata/fuzz/FuzzXXX. With the -fuzz flag, it generates
+new inputs as well (see 'go help testflag').
+
 An example function is similar to a test function but, instead of using
 *testing.T to report success or failure, prints output to os.Stdout.
 That output is compared against the function's "Output:" comment, which
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"container/heap"
+	"crypto/sha256"
 	"debug/elf"
 	"errors"
 	"flag"
@@ -104,6 +105,9 @@ and test commands:
 	-linkshared
 		link against shared libraries previously created with
 		-buildmode=shared.
+	-mod mode
+		module download mode to use: vendor.
+		See 'go help modules' for more.
 	-pkgdir dir
 		install and load all packages from dir instead of the usual locations.
 		For example, when building with a non-standard configuration,
@@ -176,6 +180,7 @@ var buildMSan bool           // -msan flag
 var buildToolExec []string   // -toolexec flag
 var buildBuildmode string    // -buildmode flag
 var buildLinkshared bool     // -linkshared flag
+var buildMod string          // -mod flag
 var buildPkgdir string       // -pkgdir flag
 
 var buildContext = build.Default
@@ -230,6 +235,7 @@ func addBuildFlags(cmd *Command) {
 	cmd.Flag.StringVar(&buildContext.InstallSuffix, "installsuffix", "", "")
 	cmd.Flag.Var((*stringsFlag)(&buildLdflags), "ldflags", "")
 	cmd.Flag.BoolVar(&buildLinkshared, "linkshared", false, "")
+	cmd.Flag.StringVar(&buildMod, "mod", "", "")
 	cmd.Flag.StringVar(&buildPkgdir, "pkgdir", "", "")
 	cmd.Flag.BoolVar(&buildRace, "race", false, "")
 	cmd.Flag.BoolVar(&buildMSan, "msan", false, "")
@@ -1367,6 +1373,23 @@ func (b *builder) build(a *action) (err error) {
 		b.print("\n#\n# " + a.p.ImportPath + "\n#\n\n")
 	}
 
+	// Reuse the compiled package from the build cache if possible,
+	// and otherwise save it there once it is built.
+	if key, ok := b.buildCacheKey(a); ok {
+		c := openBuildCache()
+		if file, ok := c.get(key); ok {
+			if err := b.mkdir(a.objdir); err != nil {
+				return err
+			}
+			return b.copyFile(a, a.objpkg, file, 0666, true)
+		}
+		defer func() {
+			if err == nil {
+				c.put(key, a.objpkg)
+			}
+		}()
+	}
+
 	if buildV {
 		b.print(a.p.ImportPath + "\n")
 	}
@@ -1581,6 +1604,116 @@ func (b *builder) build(a *action) (err error) {
 	return nil
 }
 
+// buildCacheKey returns the build cache key for the package archive
+// built by action a, reporting whether the archive may be cached.
+// The key covers everything the compiler and assembler see:
+// the tools themselves, the flags, the source files, and the
+// archives of the imported packages.
+//
+// The key does not include the package directory when it is in $GOROOT,
+// in $GOPATH or in the work directory: the compiler records source file
+// names relative to those (see recordsRelativePaths), so that the same
+// package in another tree or checkout compiles to the same archive.
+func (b *builder) buildCacheKey(a *action) (cacheID, bool) {
+	p := a.p
+	if buildN || a.link || len(buildToolExec) > 0 || buildContext.Compiler != "gc" ||
+		p.usesCgo() || p.usesSwig() || p.coverMode != "" || openBuildCache() == nil {
+		return cacheID{}, false
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "go build cache v1\n")
+	for _, name := range []string{"compile", "asm"} {
+		id, err := hashFile(tool(name))
+		if err != nil {
+			return cacheID{}, false
+		}
+		fmt.Fprintf(h, "tool %s %v\n", name, id)
+	}
+	fmt.Fprintf(h, "goos %s goarch %s goarm %s go386 %s\n", goos, goarch, os.Getenv("GOARM"), os.Getenv("GO386"))
+	fmt.Fprintf(h, "buildmode %s linkshared %v race %v msan %v installsuffix %q\n",
+		buildBuildmode, buildLinkshared, buildRace, buildMSan, buildContext.InstallSuffix)
+	fmt.Fprintf(h, "gcflags %q asmflags %q\n", buildGcflags, buildAsmflags)
+	fmt.Fprintf(h, "package %s %s\n", p.ImportPath, p.Name)
+	fmt.Fprintf(h, "standard %v buildid %s\n", p.Standard, p.buildID)
+	if !b.recordsRelativePaths(p.Dir) {
+		// Only such packages may use local imports,
+		// which the compiler resolves using localPrefix.
+		fmt.Fprintf(h, "dir %q localprefix %s\n", p.Dir, p.localPrefix)
+	}
+	fmt.Fprintf(h, "imports %q\n", p.Imports)
+	for _, file := range stringList(p.GoFiles, p.SFiles, p.HFiles, p.SysoFiles) {
+		id, err := hashFile(filepath.Join(p.Dir, file))
+		if err != nil {
+			return cacheID{}, false
+		}
+		fmt.Fprintf(h, "file %s %v\n", file, id)
+	}
+	for _, a1 := range allArchiveActions(a) {
+		id, err := hashFile(a1.target)
+		if err != nil {
+			return cacheID{}, false
+		}
+		fmt.Fprintf(h, "import %s %v\n", a1.p.ImportPath, id)
+	}
+	var key cacheID
+	copy(key[:], h.Sum(nil))
+	return key, true
+}
+
+// recordsRelativePaths reports whether the compiler and assembler record
+// the names of source files in dir without the location of dir itself:
+// dir is in the work directory, which they trim, or in $GOROOT or $GOPATH,
+// which they record as literal $GOROOT or $GOPATH (see gopathArgs) for
+// the linker to expand again.
+func (b *builder) recordsRelativePaths(dir string) bool {
+	return hasFilePathPrefix(dir, b.work) || hasFilePathPrefix(dir, goroot) || gopathDir(dir) != ""
+}
+
+// gopathDir returns the $GOPATH directory holding dir, or "" if there is none.
+func gopathDir(dir string) string {
+	for _, root := range gopath {
+		// Like the rest of the go command, ignore relative GOPATH entries.
+		if filepath.IsAbs(root) && hasFilePathPrefix(dir, filepath.Clean(root)) {
+			return filepath.Clean(root)
+		}
+	}
+	return ""
+}
+
+// gopathArgs returns the -gopath flags telling the compiler or assembler
+// to record the names of p's source files relative to its $GOPATH directory.
+func gopathArgs(p *Package) []string {
+	if root := gopathDir(p.Dir); root != "" {
+		return []string{"-gopath", root}
+	}
+	return nil
+}
+
+// linkGopathArgs returns the -gopath flags telling the linker which $GOPATH
+// directory holds each package built with gopathArgs, so that it can expand
+// the recorded names again. Passing the directories explicitly keeps the
+// link independent of the environment and of the contents of $GOPATH.
+func linkGopathArgs(all []*action) []string {
+	var args []string
+	seen := make(map[string]bool)
+	for _, a := range all {
+		if a.p == nil || seen[a.p.Dir] {
+			continue
+		}
+		seen[a.p.Dir] = true
+		root := gopathDir(a.p.Dir)
+		if root == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, a.p.Dir)
+		if err != nil {
+			continue
+		}
+		args = append(args, "-gopath", filepath.ToSlash(rel)+"="+root)
+	}
+	return args
+}
+
 // Calls pkg-config if needed and returns the cflags/ldflags needed to build the package.
 func (b *builder) getPkgConfigFlags(p *Package) (cflags, ldflags []string, err error) {
 	if pkgs := p.CgoPkgConfig; len(pkgs) > 0 {
@@ -2280,7 +2413,7 @@ func (gcToolchain) gc(b *builder, p *Package, archive, obj string, asmhdr bool,
 	extFiles := len(p.CgoFiles) + len(p.CFiles) + len(p.CXXFiles) + len(p.MFiles) + len(p.FFiles) + len(p.SFiles) + len(p.SysoFiles) + len(p.SwigFiles) + len(p.SwigCXXFiles)
 	if p.Standard {
 		switch p.ImportPath {
-		case "bytes", "net", "os", "runtime/pprof", "sync", "time":
+		case "bytes", "net", "os", "runtime/metrics", "runtime/pprof", "runtime/trace", "sync", "time":
 			extFiles++
 		}
 	}
@@ -2302,7 +2435,7 @@ func (gcToolchain) gc(b *builder, p *Package, archive, obj string, asmhdr bool,
 		}
 	}
 
-	args := []interface{}{buildToolExec, tool("compile"), "-o", ofile, "-trimpath", b.work, buildGcflags, gcargs, "-D", p.localPrefix, importArgs}
+	args := []interface{}{buildToolExec, tool("compile"), "-o", ofile, "-trimpath", b.work, gopathArgs(p), buildGcflags, gcargs, "-D", p.localPrefix, importArgs}
 	if ofile == archive {
 		args = append(args, "-pack")
 	}
@@ -2321,7 +2454,7 @@ func (gcToolchain) asm(b *builder, p *Package, obj, ofile, sfile string) error {
 	// Add -I pkg/GOOS_GOARCH so #include "textflag.h" works in .s files.
 	inc := filepath.Join(goroot, "pkg", "include")
 	sfile = mkAbs(p.Dir, sfile)
-	args := []interface{}{buildToolExec, tool("asm"), "-o", ofile, "-trimpath", b.work, "-I", obj, "-I", inc, "-D", "GOOS_" + goos, "-D", "GOARCH_" + goarch, buildAsmflags, sfile}
+	args := []interface{}{buildToolExec, tool("asm"), "-o", ofile, "-trimpath", b.work, gopathArgs(p), "-I", obj, "-I", inc, "-D", "GOOS_" + goos, "-D", "GOARCH_" + goarch, buildAsmflags, sfile}
 	if err := b.run(p.Dir, p.ImportPath, nil, args...); err != nil {
 		return err
 	}
@@ -2468,6 +2601,7 @@ func setextld(ldflags []string, compiler []string) []string {
 
 func (gcToolchain) ld(b *builder, root *action, out string, allactions []*action, mainpkg string, ofiles []string) error {
 	importArgs := b.includeArgs("-L", allactions)
+	importArgs = append(importArgs, linkGopathArgs(allactions)...)
 	cxx := len(root.p.CXXFiles) > 0 || len(root.p.SwigCXXFiles) > 0
 	for _, a := range allactions {
 		if a.p != nil && (len(a.p.CXXFiles) > 0 || len(a.p.SwigCXXFiles) > 0) {
@@ -2516,6 +2650,7 @@ func (gcToolchain) ld(b *builder, root *action, out string, allactions []*action
 
 func (gcToolchain) ldShared(b *builder, toplevelactions []*action, out string, allactions []*action) error {
 	importArgs := b.includeArgs("-L", allactions)
+	importArgs = append(importArgs, linkGopathArgs(allactions)...)
 	ldflags := []string{"-installsuffix", buildContext.InstallSuffix}
 	ldflags = append(ldflags, "-buildmode=shared")
 	ldflags = append(ldflags, buildLdflags...)
@@ -0,0 +1,245 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// The build cache.
+//
+// The build cache holds the results of earlier compilations and test
+// runs, keyed by a hash of everything that went into producing them:
+// the compiler, the flags, the source files and the compiled form of
+// every dependency. Because the key depends only on content, a result
+// can be reused whenever the same inputs reappear, even after switching
+// branches back and forth or after building the same package in another
+// GOPATH tree. (The compiler records source file names relative to
+// $GOROOT and $GOPATH, so the archives do not depend on those locations.)
+//
+// The cache lives in the directory named by $GOCACHE; see 'go help cache'.
+// Each entry is stored in a subdirectory named for the first byte of
+// its key, in a file named for the full key:
+//
+//	<key>-a   action entry: "<output id> <size>\n"
+//	<id>-d    output data, named by the hash of its content
+//
+// Writing the data before the action entry that refers to it means
+// that concurrent go commands never observe a partial entry.
+
+// A cacheID is a SHA-256 hash identifying a cache entry or its content.
+type cacheID [sha256.Size]byte
+
+func (k cacheID) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+// A buildCache is an open build cache directory.
+type buildCache struct {
+	dir string
+}
+
+var (
+	theCacheOnce sync.Once
+	theCache     *buildCache
+)
+
+// defaultGOCACHE returns the default location of the build cache,
+// or "off" if there is no suitable location.
+func defaultGOCACHE() string {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("LocalAppData")
+	case "darwin":
+		if home := os.Getenv("HOME"); home != "" {
+			dir = filepath.Join(home, "Library", "Caches")
+		}
+	case "plan9":
+		if home := os.Getenv("home"); home != "" {
+			dir = filepath.Join(home, "lib", "cache")
+		}
+	default:
+		dir = os.Getenv("XDG_CACHE_HOME")
+		if dir == "" {
+			if home := os.Getenv("HOME"); home != "" {
+				dir = filepath.Join(home, ".cache")
+			}
+		}
+	}
+	if dir == "" {
+		return "off"
+	}
+	return filepath.Join(dir, "go-build")
+}
+
+// getGOCACHE returns the build cache directory: $GOCACHE if set,
+// otherwise the default location.
+func getGOCACHE() string {
+	if dir := os.Getenv("GOCACHE"); dir != "" {
+		return dir
+	}
+	return defaultGOCACHE()
+}
+
+// openBuildCache returns the build cache, or nil if
+// caching is disabled or the cache directory is unusable.
+func openBuildCache() *buildCache {
+	theCacheOnce.Do(func() {
+		dir := getGOCACHE()
+		if dir == "off" {
+			return
+		}
+		if !filepath.IsAbs(dir) {
+			fmt.Fprintf(os.Stderr, "go: GOCACHE is not an absolute path: %s; build cache disabled\n", dir)
+			return
+		}
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			fmt.Fprintf(os.Stderr, "go: disabling build cache: %v\n", err)
+			return
+		}
+		readme := filepath.Join(dir, "README")
+		if _, err := os.Stat(readme); err != nil {
+			ioutil.WriteFile(readme, []byte(cacheREADME), 0666)
+		}
+		theCache = &buildCache{dir: dir}
+	})
+	return theCache
+}
+
+const cacheREADME = `This directory holds cached build artifacts from the Go build system.
+Run "go clean -cache" if the directory is getting too large.
+See golang.org to learn more about Go.
+`
+
+// fileName returns the name of the cache file for key with the given suffix.
+func (c *buildCache) fileName(key cacheID, suffix string) string {
+	s := key.String()
+	return filepath.Join(c.dir, s[:2], s+"-"+suffix)
+}
+
+// get returns the name of the file holding the output for key.
+func (c *buildCache) get(key cacheID) (string, bool) {
+	entry, err := ioutil.ReadFile(c.fileName(key, "a"))
+	if err != nil {
+		return "", false
+	}
+	f := strings.Fields(string(entry))
+	if len(f) != 2 || len(f[0]) != 2*sha256.Size {
+		return "", false
+	}
+	var size int64
+	if _, err := fmt.Sscanf(f[1], "%d", &size); err != nil {
+		return "", false
+	}
+	var id cacheID
+	if _, err := hex.Decode(id[:], []byte(f[0])); err != nil {
+		return "", false
+	}
+	file := c.fileName(id, "d")
+	fi, err := os.Stat(file)
+	if err != nil || fi.Size() != size {
+		return "", false
+	}
+	return file, true
+}
+
+// getBytes returns the output for key.
+func (c *buildCache) getBytes(key cacheID) ([]byte, bool) {
+	file, ok := c.get(key)
+	if !ok {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// put stores the content of file as the output for key.
+func (c *buildCache) put(key cacheID, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return c.putBytes(key, data)
+}
+
+// putBytes stores data as the output for key.
+func (c *buildCache) putBytes(key cacheID, data []byte) error {
+	id := cacheID(sha256.Sum256(data))
+	if err := c.writeFile(c.fileName(id, "d"), data); err != nil {
+		return err
+	}
+	entry := fmt.Sprintf("%v %d\n", id, len(data))
+	return c.writeFile(c.fileName(key, "a"), []byte(entry))
+}
+
+// writeFile atomically writes data to file.
+func (c *buildCache) writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// fileHashes memoizes hashFile.
+var fileHashes struct {
+	sync.Mutex
+	m map[string]cacheID
+}
+
+// hashFile returns the SHA-256 hash of the content of file.
+// Files are assumed not to change during a single go command,
+// so the result is computed once per file.
+func hashFile(file string) (cacheID, error) {
+	fileHashes.Lock()
+	h, ok := fileHashes.m[file]
+	fileHashes.Unlock()
+	if ok {
+		return h, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return cacheID{}, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return cacheID{}, err
+	}
+	copy(h[:], hash.Sum(nil))
+	fileHashes.Lock()
+	if fileHashes.m == nil {
+		fileHashes.m = make(map[string]cacheID)
+	}
+	fileHashes.m[file] = h
+	fileHashes.Unlock()
+	return h, nil
+}
@@ -13,7 +13,7 @@ import (
 )
 
 var cmdClean = &Command{
-	UsageLine: "clean [-i] [-r] [-n] [-x] [build flags] [packages]",
+	UsageLine: "clean [-i] [-r] [-n] [-x] [-cache] [build flags] [packages]",
 	Short:     "remove object files",
 	Long: `
 Clean removes object files from package source directories.
@@ -52,14 +52,19 @@ dependencies of the packages named by the import paths.
 
 The -x flag causes clean to print remove commands as it executes them.
 
+The -cache flag causes clean to remove the entire build cache
+(see 'go help cache'). If no packages are given, only the cache
+is cleaned.
+
 For more about build flags, see 'go help build'.
 
 For more about specifying packages, see 'go help packages'.
 	`,
 }
 
-var cleanI bool // clean -i flag
-var cleanR bool // clean -r flag
+var cleanI bool     // clean -i flag
+var cleanR bool     // clean -r flag
+var cleanCache bool // clean -cache flag
 
 func init() {
 	// break init cycle
@@ -67,6 +72,7 @@ func init() {
 
 	cmdClean.Flag.BoolVar(&cleanI, "i", false, "")
 	cmdClean.Flag.BoolVar(&cleanR, "r", false, "")
+	cmdClean.Flag.BoolVar(&cleanCache, "cache", false, "")
 	// -n and -x are important enough to be
 	// mentioned explicitly in the docs but they
 	// are part of the build flags.
@@ -75,11 +81,40 @@ func init() {
 }
 
 func runClean(cmd *Command, args []string) {
+	if cleanCache {
+		cleanBuildCache()
+		if len(args) == 0 {
+			return
+		}
+	}
 	for _, pkg := range packagesAndErrors(args) {
 		clean(pkg)
 	}
 }
 
+// cleanBuildCache removes the contents of the build cache directory,
+// leaving the directory itself and its README in place.
+func cleanBuildCache() {
+	dir := getGOCACHE()
+	if dir == "off" || !filepath.IsAbs(dir) {
+		return
+	}
+	var b builder
+	b.print = fmt.Print
+	if buildN || buildX {
+		b.showcmd("", "rm -r %s", filepath.Join(dir, "*"))
+	}
+	if buildN {
+		return
+	}
+	subdirs, _ := filepath.Glob(filepath.Join(dir, "[0-9a-f][0-9a-f]"))
+	for _, d := range subdirs {
+		if err := os.RemoveAll(d); err != nil {
+			errorf("go clean -cache: %v", err)
+		}
+	}
+}
+
 var cleaned = map[*Package]bool{}
 
 // TODO: These are dregs left by Makefile-based builds.
@@ -66,6 +66,17 @@ For more about specifying packages, see 'go help packages'.
 For more about how 'go get' finds source code to
 download, see 'go help importpath'.
 
+In module-aware mode (see 'go help modules'), get instead adjusts the
+requirements in the main module's go.mod file. Each argument names a
+package, optionally followed by @version to request a specific version
+of the module providing it, as in 'go get example.com/pkg@v1.2.3'.
+The version may also be a prefix such as v1 or v1.2, meaning the latest
+matching release, or "latest". Without a version, get requests the latest
+release. Get then downloads the selected modules into the module cache,
+records their checksums in go.sum, and, unless -d is given, installs the
+named packages. The -f, -fix, -insecure, -t and -u flags do not apply
+in module-aware mode.
+
 See also: go build, go install, go clean.
 	`,
 }
@@ -87,6 +98,15 @@ func runGet(cmd *Command, args []string) {
 		fatalf("go get: cannot use -f flag without -u")
 	}
 
+	if modEnabled {
+		args = modGet(args)
+		if *getD {
+			return
+		}
+		runInstall(cmd, args)
+		return
+	}
+
 	// Disable any prompting for passwords by Git.
 	// Only has an effect for 2.3.0 or later, but avoiding
 	// the prompt in earlier versions is just too hard.
@@ -141,6 +161,71 @@ func runGet(cmd *Command, args []string) {
 	runInstall(cmd, args)
 }
 
+// modGet updates the main module's requirements for the
+// path@version arguments, downloads the selected modules and
+// returns the package paths named by args.
+func modGet(args []string) []string {
+	if len(args) == 0 {
+		fatalf("go get: no packages named; in module-aware mode, use go get path@version")
+	}
+	if _, err := proxyURL(); err != nil {
+		fatalf("go get: %v", err)
+	}
+	modLoad()
+	var pkgs, mods []string
+	for _, arg := range args {
+		path, vers := arg, "latest"
+		if i := strings.Index(arg, "@"); i >= 0 {
+			path, vers = arg[:i], arg[i+1:]
+		}
+		if build.IsLocalImport(path) || strings.Contains(path, "...") {
+			errorf("go get: %s: module-aware get requires full import paths", arg)
+			continue
+		}
+		if modInMain(path) {
+			errorf("go get: %s: cannot get package in main module", arg)
+			continue
+		}
+		mod, v, err := modQueryPackage(path, vers)
+		if err != nil {
+			errorf("go get %s: %v", arg, err)
+			continue
+		}
+		modMain.setRequire(mod, v)
+		pkgs = append(pkgs, path)
+		mods = append(mods, mod)
+	}
+	exitIfErrors()
+
+	modLoadBuildList()
+	for _, mod := range mods {
+		if _, err := modDir(modVersion{mod, modSelected(mod)}); err != nil {
+			errorf("go get: %v", err)
+		}
+	}
+	exitIfErrors()
+	modWriteGoMod()
+	return pkgs
+}
+
+// modQueryPackage finds the module providing the package path,
+// trying each path prefix in turn, and resolves the version query
+// for that module.
+func modQueryPackage(path, query string) (mod, version string, err error) {
+	for p := path; ; {
+		if list, err := modVersions(p); err == nil && len(list) > 0 {
+			v, err := modQuery(p, query)
+			return p, v, err
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return "", "", fmt.Errorf("cannot find module providing package %s", path)
+}
+
 // downloadPaths prepares the list of paths to pass to download.
 // It expands ... patterns that can be expanded. If there is no match
 // for a particular pattern, downloadPaths leaves it in the result list,
@@ -99,6 +99,9 @@ func TestMain(m *testing.M) {
 	// Don't let these environment variables confuse the test.
 	os.Unsetenv("GOBIN")
 	os.Unsetenv("GOPATH")
+	os.Unsetenv("GO111MODULE")
+	os.Unsetenv("GOPROXY")
+	os.Setenv("GOCACHE", "off")
 
 	r := m.Run()
 
@@ -508,6 +511,13 @@ func (tg *testgoData) mustNotExist(path string) {
 	}
 }
 
+// mustExist fails if path does not exist.
+func (tg *testgoData) mustExist(path string) {
+	if _, err := os.Stat(path); err != nil {
+		tg.t.Fatalf("%s should exist but does not (%v)", path, err)
+	}
+}
+
 // wantExecutable fails with msg if path is not executable.
 func (tg *testgoData) wantExecutable(path, msg string) {
 	if st, err := os.Stat(path); err != nil {
@@ -2832,3 +2842,165 @@ func TestFatalInBenchmarkCauseNonZeroExitStatus(t *testing.T) {
 	tg.grepBothNot("^ok", "test passed unexpectedly")
 	tg.grepBoth("FAIL.*benchfatal", "test did not run everything")
 }
+
+func TestBuildCache(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.parallel()
+	tg.makeTempdir()
+	tg.tempFile("src/p/p.go", "package p\n\nfunc F() int { return 1 }\n")
+	tg.tempFile("src/p/p_test.go", "package p\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { t.Log(F()) }\n")
+	tg.setenv("GOPATH", tg.path("."))
+	tg.setenv("GOCACHE", tg.path("cache"))
+
+	tg.run("build", "-x", "p")
+	tg.grepStderr(`compile.* -p p `, "first build did not compile p")
+	tg.run("build", "-x", "p")
+	tg.grepStderrNot(`compile.* -p p `, "second build compiled p again")
+
+	tg.run("test", "p")
+	tg.grepStdout(`^ok  \tp\t[0-9.]+s$`, "first test did not run")
+	tg.run("test", "p")
+	tg.grepStdout(`^ok  \tp\t\(cached\)$`, "second test did not use cached result")
+	tg.run("test", "-count=1", "p")
+	tg.grepStdoutNot(`\(cached\)`, "go test -count=1 used cached result")
+
+	// A source change invalidates both results.
+	tg.tempFile("src/p/p.go", "package p\n\nfunc F() int { return 2 }\n")
+	tg.run("test", "p")
+	tg.grepStdoutNot(`\(cached\)`, "go test used stale cached result")
+
+	tg.run("clean", "-cache")
+	tg.mustExist(tg.path("cache/README"))
+	tg.run("build", "-x", "p")
+	tg.grepStderr(`compile.* -p p `, "build after go clean -cache did not compile p")
+}
+
+func TestFuzz(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.parallel()
+	tg.makeTempdir()
+	tg.tempFile("src/p/p.go", `package p
+
+func F(b []byte) {
+	if len(b) > 1 && b[0] == 'F' {
+		if b[1] == 'U' {
+			panic("found it")
+		}
+	}
+}
+`)
+	tg.tempFile("src/p/p_test.go", `package p
+
+import "testing"
+
+func FuzzF(f *testing.F) {
+	f.Add([]byte("hello"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		F(b)
+	})
+}
+`)
+	tg.setenv("GOPATH", tg.path("."))
+	tg.setenv("GOCACHE", tg.path("cache"))
+
+	// Without -fuzz, only the seed corpus runs.
+	tg.run("test", "-v", "p")
+	tg.grepStdout(`--- PASS: FuzzF/seed#0`, "go test did not run seed corpus")
+
+	tg.runFail("test", "-fuzz=FuzzF", "-fuzztime=60s", "p")
+	tg.grepStdout(`panic: found it`, "go test -fuzz did not report failure")
+	tg.grepStdout(`Failing input written to testdata/fuzz/FuzzF/`, "go test -fuzz did not write failing input")
+	tg.grepStdout(`coverage: `, "go test -fuzz did not enable coverage")
+	tg.mustExist(tg.path("cache/fuzz/p/FuzzF"))
+
+	// The minimized failing input is now part of the seed corpus.
+	d, err := ioutil.ReadDir(tg.path("src/p/testdata/fuzz/FuzzF"))
+	tg.must(err)
+	if len(d) != 1 {
+		t.Fatalf("found %d failing inputs, want 1", len(d))
+	}
+	data, err := ioutil.ReadFile(tg.path("src/p/testdata/fuzz/FuzzF/" + d[0].Name()))
+	tg.must(err)
+	if want := "go test fuzz v1\n[]byte(\"FU\")\n"; string(data) != want {
+		t.Errorf("failing input is %q, want %q", data, want)
+	}
+	tg.runFail("test", "p")
+	tg.grepBoth(`--- FAIL: FuzzF/`+d[0].Name(), "go test did not run failing input")
+
+	tg.runFail("test", "-fuzz=Fuzz", "p", "fmt")
+	tg.grepStderr(`cannot use -fuzz flag with multiple packages`, "go test -fuzz accepted multiple packages")
+}
+
+func TestBuildCacheSharedAcrossGOPATHTrees(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.parallel()
+	tg.makeTempdir()
+	for _, tree := range []string{"a", "b"} {
+		tg.tempFile(tree+"/src/p/p.go", "package p\n\nimport \"runtime\"\n\nfunc File() string {\n\t_, file, _, _ := runtime.Caller(0)\n\treturn file\n}\n")
+		tg.tempFile(tree+"/src/m/m.go", "package main\n\nimport \"p\"\n\nfunc main() { println(p.File()) }\n")
+	}
+	tg.setenv("GOCACHE", tg.path("cache"))
+
+	tg.setenv("GOPATH", tg.path("a"))
+	tg.run("run", "-x", tg.path("a/src/m/m.go"))
+	tg.grepStderr(`compile.* -p p `, "first build did not compile p")
+	tg.grepStderr(regexp.QuoteMeta(filepath.ToSlash(tg.path("a/src/p/p.go"))), "wrong file name recorded for p in tree a")
+
+	// The same package in another tree, found through the second
+	// GOPATH entry, reuses the archive but reports its own files.
+	tg.setenv("GOPATH", tg.path("x")+string(filepath.ListSeparator)+tg.path("b"))
+	tg.run("run", "-x", tg.path("b/src/m/m.go"))
+	tg.grepStderrNot(`compile.* -p p `, "build in tree b compiled p again")
+	tg.grepStderr(regexp.QuoteMeta(filepath.ToSlash(tg.path("b/src/p/p.go"))), "wrong file name recorded for p in tree b")
+}
+
+func TestLinkWithoutGOPATH(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.parallel()
+	tg.makeTempdir()
+	tg.tempFile("src/m/m.go", "package main\n\nimport \"runtime\"\n\nfunc main() {\n\t_, file, _, _ := runtime.Caller(0)\n\tprint(file)\n}\n")
+	want := filepath.ToSlash(tg.path("src/m/m.go"))
+
+	// File names recorded by the compiler and linker must not
+	// depend on their environment, only on their flags.
+	for _, tt := range []struct {
+		compile, link []string
+	}{
+		{nil, nil},
+		{[]string{"-gopath", tg.path(".")}, []string{"-gopath", "src/m=" + tg.path(".")}},
+	} {
+		tg.setenv("GOPATH", tg.path("."))
+		tg.run(append(append([]string{"tool", "compile"}, tt.compile...), "-o", tg.path("m.o"), tg.path("src/m/m.go"))...)
+		tg.unsetenv("GOPATH")
+		tg.run(append(append([]string{"tool", "link"}, tt.link...), "-o", tg.path("m"+exeSuffix), tg.path("m.o"))...)
+		out, err := exec.Command(tg.path("m" + exeSuffix)).CombinedOutput()
+		if err != nil {
+			t.Fatalf("running linked program: %v\n%s", err, out)
+		}
+		if string(out) != want {
+			t.Errorf("compile %q, link %q: recorded file name = %q, want %q", tt.compile, tt.link, out, want)
+		}
+	}
+}
+
+func TestTestCacheKeepsStderrSeparate(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.parallel()
+	tg.makeTempdir()
+	tg.tempFile("src/p/p_test.go", "package p\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestOutput(t *testing.T) {\n\tfmt.Println(\"to stdout\")\n\tfmt.Fprintln(os.Stderr, \"to stderr\")\n}\n")
+	tg.setenv("GOPATH", tg.path("."))
+	tg.setenv("GOCACHE", tg.path("cache"))
+
+	for _, want := range []string{`[0-9.]+s`, `\(cached\)`} {
+		tg.run("test", "-v", "p")
+		tg.grepStdout(`^ok  \tp\t`+want+`$`, "unexpected test summary")
+		tg.grepStdout("^to stdout$", "standard output missing")
+		tg.grepStdoutNot("to stderr", "standard error written to standard output")
+		tg.grepStderr("^to stderr$", "standard error missing")
+	}
+}
@@ -425,6 +425,105 @@ See https://golang.org/s/go15vendor for details.
 	`,
 }
 
+var helpCache = &Command{
+	UsageLine: "cache",
+	Short:     "build and test caching",
+	Long: `
+The go command caches build outputs for reuse in future builds.
+The default location for cache data is a subdirectory named go-build
+in the standard user cache directory for the current operating system:
+$XDG_CACHE_HOME or $HOME/.cache on Unix systems, $HOME/Library/Caches
+on Mac OS X, %LocalAppData% on Windows and $home/lib/cache on Plan 9.
+Setting the GOCACHE environment variable overrides this default,
+and running 'go env GOCACHE' prints the current cache directory.
+Setting GOCACHE=off disables the cache.
+
+The go command looks up each package it compiles in the cache, keyed
+by a hash of the compiler, the build flags, the target operating system
+and architecture, the package's import path and the content of its source
+files and compiled dependencies. The key does not depend on where the
+package is within GOROOT or GOPATH, so the same package in another
+GOPATH tree or checkout reuses the cached result; only packages outside
+GOROOT and GOPATH are also keyed by their directory. When a matching
+entry exists, the compiled package is copied from the cache instead of
+running the compiler. Packages using cgo or SWIG, and packages being
+built for coverage analysis, are always compiled.
+
+The go test command also caches successful test results. When a test
+binary is unchanged from an earlier successful run, and it is run in
+the same directory with the same environment, the same files in its
+testdata directory and only the flags -cpu, -parallel, -run, -short,
+-timeout and -v, go test redisplays the earlier output instead of
+running the test again, with "(cached)" in place of the elapsed time
+in the summary line. Test results are never cached when go test is
+run without package arguments, in the current directory. Changes to
+files outside the package's testdata directory are not detected;
+to force a test to run, use any other flag, such as -count=1.
+
+The cache grows as needed. Run 'go clean -cache' to remove all
+cached data.
+	`,
+}
+
+var helpModules = &Command{
+	UsageLine: "modules",
+	Short:     "modules, module versions, and more",
+	Long: `
+A module is a collection of related Go packages that are versioned
+together. A module is defined by a tree of Go source files with a go.mod
+file in the tree's root directory. The go.mod file declares the module
+path, which is the import path prefix for all packages in the module,
+and lists the other modules the module requires, each at a minimum
+semantic version (see http://semver.org/):
+
+	module example.com/hello
+
+	require (
+		example.com/greet v1.2.0
+		example.com/other v0.3.1
+	)
+
+The go command operates in module-aware mode or in GOPATH mode,
+as controlled by the GO111MODULE environment variable. With
+GO111MODULE=off, the go command never uses modules. With
+GO111MODULE=on, it always uses modules. With GO111MODULE unset
+or set to auto, it uses modules when the current directory is
+outside GOPATH/src and is in, or below, a directory holding a
+go.mod file.
+
+In module-aware mode, the main module is the module containing the
+current directory. Import paths are resolved using the build list:
+the main module plus the selected version of each module reachable
+through requirements. For each module path, the selected version is
+the highest version required by the main module or by any module
+version in the build list (minimal version selection). A build is thus
+determined entirely by go.mod files, and upgrades happen only when
+go.mod is changed, for example by 'go get path@version'. GOPATH is no
+longer consulted for imports, and vendor directories are ignored
+unless the build is run with -mod=vendor.
+
+Modules are downloaded from the module proxy named by the GOPROXY
+environment variable, which is an http or https URL, or a file URL
+naming a directory such as file:///home/user/proxy. For a module path
+and version, the proxy serves <path>/@v/list, listing the available
+versions one per line, and <path>/@v/<version>.mod and
+<path>/@v/<version>.zip, holding the go.mod file and the module source.
+Upper-case letters in module paths are written as '!' followed by the
+lower-case letter. Downloaded modules are kept in the module cache,
+GOPATH/pkg/mod, and later builds use the cache without network access.
+
+The go command records the expected cryptographic checksum of each
+module version and go.mod file it downloads in go.sum, next to go.mod.
+If a later download does not match the recorded checksum, the go
+command reports a checksum mismatch and refuses to use the module.
+Both go.mod and go.sum should be checked into version control.
+
+See 'go get' for changing requirements, 'go list -m' for listing
+the build list, and 'go mod' for creating go.mod files, downloading
+modules, verifying the module cache and populating vendor directories.
+	`,
+}
+
 var helpEnvironment = &Command{
 	UsageLine: "environment",
 	Short:     "environment variables",
@@ -444,11 +543,17 @@ General-purpose environment variables:
 		Examples are amd64, 386, arm, ppc64.
 	GOBIN
 		The directory where 'go install' will install a command.
+	GO111MODULE
+		Controls module-aware mode: on, off or auto.
+		See 'go help modules'.
 	GOOS
 		The operating system for which to compile code.
 		Examples are linux, darwin, windows, netbsd.
 	GOPATH
 		See 'go help gopath'.
+	GOPROXY
+		URL of the module proxy from which to download modules.
+		See 'go help modules'.
 	GORACE
 		Options for the race detector.
 		See https://golang.org/doc/articles/race_detector.html.
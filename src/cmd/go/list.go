@@ -14,7 +14,7 @@ import (
 )
 
 var cmdList = &Command{
-	UsageLine: "list [-e] [-f format] [-json] [build flags] [packages]",
+	UsageLine: "list [-e] [-f format] [-json] [-m] [build flags] [packages]",
 	Short:     "list packages",
 	Long: `
 List lists the packages named by the import paths, one per line.
@@ -69,6 +69,9 @@ syntax of package template.  The default output is equivalent to -f
         Imports []string // import paths used by this package
         Deps    []string // all (recursively) imported dependencies
 
+        // Module information
+        Module *Module // module providing this package (module-aware mode only)
+
         // Error information
         Incomplete bool            // this package or a dependency has an error
         Error      *PackageError   // error loading package
@@ -121,6 +124,29 @@ printing.  Erroneous packages will have a non-empty ImportPath and
 a non-nil Error field; other information may or may not be missing
 (zeroed).
 
+The -m flag causes list to list modules instead of packages.
+It is valid only in module-aware mode (see 'go help modules').
+With no arguments, list -m shows the main module. With the
+argument "all", it shows the build list: the main module followed
+by each dependency at its selected version. Otherwise the arguments
+are module paths, and list -m shows the selected version of each.
+The default output shows the module path and version:
+
+    example.com/hello
+    example.com/greet v1.2.0
+
+When listing modules, the struct passed to the -f template is:
+
+    type Module struct {
+        Path    string // module path
+        Version string // module version
+        Main    bool   // is this the main module?
+        Dir     string // directory holding files for this module, if any
+    }
+
+In module-aware mode, the Module field of Package
+describes the module providing the package.
+
 For more about build flags, see 'go help build'.
 
 For more about specifying packages, see 'go help packages'.
@@ -135,6 +161,7 @@ func init() {
 var listE = cmdList.Flag.Bool("e", false, "")
 var listFmt = cmdList.Flag.String("f", "{{.ImportPath}}", "")
 var listJson = cmdList.Flag.Bool("json", false, "")
+var listM = cmdList.Flag.Bool("m", false, "")
 var nl = []byte{'\n'}
 
 func runList(cmd *Command, args []string) {
@@ -142,10 +169,14 @@ func runList(cmd *Command, args []string) {
 	out := newTrackingWriter(os.Stdout)
 	defer out.w.Flush()
 
-	var do func(*Package)
+	if *listM && *listFmt == "{{.ImportPath}}" {
+		*listFmt = "{{.Path}}{{if .Version}} {{.Version}}{{end}}"
+	}
+
+	var do func(interface{})
 	if *listJson {
-		do = func(p *Package) {
-			b, err := json.MarshalIndent(p, "", "\t")
+		do = func(x interface{}) {
+			b, err := json.MarshalIndent(x, "", "\t")
 			if err != nil {
 				out.Flush()
 				fatalf("%s", err)
@@ -169,8 +200,8 @@ func runList(cmd *Command, args []string) {
 		if err != nil {
 			fatalf("%s", err)
 		}
-		do = func(p *Package) {
-			if err := tmpl.Execute(out, p); err != nil {
+		do = func(x interface{}) {
+			if err := tmpl.Execute(out, x); err != nil {
 				out.Flush()
 				fatalf("%s", err)
 			}
@@ -180,6 +211,13 @@ func runList(cmd *Command, args []string) {
 		}
 	}
 
+	if *listM {
+		for _, m := range listModules(args) {
+			do(m)
+		}
+		return
+	}
+
 	load := packages
 	if *listE {
 		load = packagesAndErrors
@@ -194,6 +232,39 @@ func runList(cmd *Command, args []string) {
 	}
 }
 
+// listModules returns the modules named by args for go list -m.
+func listModules(args []string) []*moduleInfo {
+	if !modEnabled {
+		fatalf("go list -m: not using modules; see 'go help modules'")
+	}
+	modLoad()
+	if len(args) == 0 {
+		return []*moduleInfo{modInfo(modBuildList[0])}
+	}
+	var list []*moduleInfo
+	for _, arg := range args {
+		if arg == "all" {
+			for _, m := range modBuildList {
+				list = append(list, modInfo(m))
+			}
+			continue
+		}
+		found := false
+		for _, m := range modBuildList {
+			if m.Path == arg {
+				list = append(list, modInfo(m))
+				found = true
+				break
+			}
+		}
+		if !found {
+			errorf("go list -m: module %s not in build list", arg)
+		}
+	}
+	exitIfErrors()
+	return list
+}
+
 // TrackingWriter tracks the last byte written on every write so
 // we can avoid printing a newline if one was already written or
 // if there is no output at all.
@@ -85,6 +85,7 @@ var commands = []*Command{
 	cmdGet,
 	cmdInstall,
 	cmdList,
+	cmdMod,
 	cmdRun,
 	cmdTest,
 	cmdTool,
@@ -93,10 +94,12 @@ var commands = []*Command{
 
 	helpC,
 	helpBuildmode,
+	helpCache,
 	helpFileType,
 	helpGopath,
 	helpEnvironment,
 	helpImportPath,
+	helpModules,
 	helpPackages,
 	helpTestflag,
 	helpTestfunc,
@@ -169,6 +172,8 @@ func main() {
 		}
 	}
 
+	modInit()
+
 	for _, cmd := range commands {
 		if cmd.Name() == args[0] && cmd.Runnable() {
 			cmd.Flag.Usage = func() { cmd.Usage() }
@@ -0,0 +1,287 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var cmdMod = &Command{
+	Run:       runMod,
+	UsageLine: "mod command [arguments]",
+	Short:     "module maintenance",
+	Long: `
+Mod performs maintenance operations on the main module,
+the module whose go.mod file encloses the current directory.
+See 'go help modules' for an overview of modules.
+
+The commands are:
+
+	go mod init [module]
+		Initialize a new module in the current directory by
+		writing a go.mod file declaring the given module path.
+		If the module path is omitted and the current directory
+		is inside GOPATH/src, the path is derived from the directory.
+
+	go mod download
+		Download every module in the build list into the module cache.
+
+	go mod vendor
+		Reset the main module's vendor directory to hold copies of all
+		packages needed to build and test the packages in the main module,
+		and write vendor/modules.txt recording the module version providing
+		each one. Builds given the -mod=vendor flag use the vendor directory
+		instead of the module cache.
+
+	go mod verify
+		Check that the modules in the module cache have not been modified
+		since they were downloaded, by comparing them against go.sum.
+	`,
+}
+
+func runMod(cmd *Command, args []string) {
+	if len(args) == 0 {
+		cmd.Usage()
+	}
+	if os.Getenv("GO111MODULE") == "off" {
+		fatalf("go mod: modules disabled by GO111MODULE=off; see 'go help modules'")
+	}
+	switch args[0] {
+	case "init":
+		if len(args) > 2 {
+			fatalf("go mod init: too many arguments")
+		}
+		modInitFile(args[1:])
+		return
+	case "download":
+		modDownloadAll()
+	case "vendor":
+		modVendorAll()
+	case "verify":
+		modVerifyAll()
+	default:
+		fatalf("go mod %s: unknown command\nRun 'go help mod' for usage.", args[0])
+	}
+	if len(args) > 1 {
+		fatalf("go mod %s: too many arguments", args[0])
+	}
+}
+
+// modInitFile writes a new go.mod file in the current directory.
+func modInitFile(args []string) {
+	file := filepath.Join(cwd, "go.mod")
+	if _, err := os.Stat(file); err == nil {
+		fatalf("go mod init: %s already exists", file)
+	}
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	} else {
+		for _, root := range filepath.SplitList(buildContext.GOPATH) {
+			if rel, ok := hasSubdir(filepath.Join(root, "src"), cwd); ok && rel != "" && rel != "." {
+				path = rel
+				break
+			}
+		}
+		if path == "" {
+			fatalf("go mod init: cannot determine module path for directory %s\n\tSpecify it explicitly: go mod init module/path", cwd)
+		}
+	}
+	f := &modFile{Module: path}
+	if err := ioutil.WriteFile(file, f.format(), 0666); err != nil {
+		fatalf("go mod init: %v", err)
+	}
+}
+
+// modDownloadAll downloads every module in the build list.
+func modDownloadAll() {
+	modLoad()
+	for _, m := range modBuildList[1:] {
+		if _, err := modDir(m); err != nil {
+			errorf("go mod download: %v", err)
+		}
+	}
+	exitIfErrors()
+}
+
+// modVerifyAll checks the downloaded modules against go.sum.
+func modVerifyAll() {
+	modLoad()
+	root, err := modCacheRoot()
+	if err != nil {
+		fatalf("go mod verify: %v", err)
+	}
+	ok := true
+	for _, m := range modBuildList[1:] {
+		want := modSum.hash[m]
+		if len(want) == 0 {
+			continue
+		}
+		zipFile := filepath.Join(root, "cache", "download", filepath.FromSlash(modEscapePath(m.Path)), "@v", m.Version+".zip")
+		if _, err := os.Stat(zipFile); err == nil {
+			h, err := hashZip(zipFile)
+			if err != nil {
+				fatalf("go mod verify: %v", err)
+			}
+			if !hasString(want, h) {
+				fmt.Fprintf(os.Stderr, "%s: zip has been modified (%v)\n", m, zipFile)
+				ok = false
+			}
+		}
+		dir := filepath.Join(root, filepath.FromSlash(modEscapePath(m.Path))+"@"+m.Version)
+		if _, err := os.Stat(dir); err == nil {
+			h, err := hashDir(dir, m.Path+"@"+m.Version)
+			if err != nil {
+				fatalf("go mod verify: %v", err)
+			}
+			if !hasString(want, h) {
+				fmt.Fprintf(os.Stderr, "%s: dir has been modified (%v)\n", m, dir)
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		setExitStatus(1)
+		return
+	}
+	fmt.Printf("all modules verified\n")
+}
+
+// modVendorAll copies the packages needed by the main module
+// into its vendor directory.
+func modVendorAll() {
+	modLoad()
+	if modVendor() {
+		fatalf("go mod vendor: cannot use -mod=vendor")
+	}
+
+	// Load every package in the main module,
+	// then everything they import, including for tests.
+	var stk importStack
+	var queue []*Package
+	for _, dir := range modPackageDirs() {
+		queue = append(queue, loadImport(modImportPathForDir(dir), modRoot, nil, &stk, nil, 0))
+	}
+	seen := make(map[string]bool)
+	deps := make(map[string][]*Package) // module path -> packages
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p.Error != nil {
+			errorf("go mod vendor: %v", p.Error)
+			continue
+		}
+		imports := p.Imports
+		if p.Module != nil && p.Module.Main {
+			imports = stringList(imports, p.TestImports, p.XTestImports)
+		} else if p.Module != nil {
+			deps[p.Module.Path] = append(deps[p.Module.Path], p)
+		}
+		for _, path := range imports {
+			if path == "C" || seen[path] || isStandardImportPath(path) && !modInMain(path) {
+				continue
+			}
+			seen[path] = true
+			queue = append(queue, loadImport(path, p.Dir, p, &stk, nil, 0))
+		}
+	}
+	exitIfErrors()
+
+	vdir := filepath.Join(modRoot, "vendor")
+	if err := os.RemoveAll(vdir); err != nil {
+		fatalf("go mod vendor: %v", err)
+	}
+	var buf bytes.Buffer
+	for _, m := range modBuildList[1:] {
+		pkgs := deps[m.Path]
+		if len(pkgs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "# %s %s\n", m.Path, m.Version)
+		var paths []string
+		for _, p := range pkgs {
+			paths = append(paths, p.ImportPath)
+			if err := copyVendorFiles(filepath.Join(vdir, filepath.FromSlash(p.ImportPath)), p.Dir); err != nil {
+				fatalf("go mod vendor: %v", err)
+			}
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(&buf, "%s\n", path)
+		}
+	}
+	if buf.Len() == 0 {
+		// Nothing to vendor.
+		return
+	}
+	if err := os.MkdirAll(vdir, 0777); err != nil {
+		fatalf("go mod vendor: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(vdir, "modules.txt"), buf.Bytes(), 0666); err != nil {
+		fatalf("go mod vendor: %v", err)
+	}
+}
+
+// modPackageDirs returns the directories of the packages in the
+// main module, skipping vendor and testdata directories and any
+// nested modules.
+func modPackageDirs() []string {
+	var dirs []string
+	filepath.Walk(modRoot, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if path != modRoot {
+			elem := fi.Name()
+			if elem == "vendor" || elem == "testdata" || strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		files, _ := ioutil.ReadDir(path)
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), ".go") {
+				dirs = append(dirs, path)
+				break
+			}
+		}
+		return nil
+	})
+	return dirs
+}
+
+// copyVendorFiles copies the files of the package in src into dst,
+// omitting tests and subdirectories.
+func copyVendorFiles(dst, src string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if !f.Mode().IsRegular() || strings.HasSuffix(name, "_test.go") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dst, name), data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Module downloads.
+//
+// Modules are fetched from the module proxy named by $GOPROXY,
+// which is either an http:// or https:// URL or a file:// URL
+// naming a directory in the local file system. For a module path
+// and version, the proxy serves
+//
+//	<path>/@v/list          list of known versions, one per line
+//	<path>/@v/<version>.mod go.mod file for that version
+//	<path>/@v/<version>.zip zip archive of the module source
+//
+// Upper-case letters in the path are written as an exclamation
+// mark followed by the lower-case letter, so that the layout is
+// safe on case-insensitive file systems.
+//
+// Downloaded files are kept in $GOPATH/pkg/mod/cache/download, using
+// the same layout as the proxy, and module source is extracted into
+// $GOPATH/pkg/mod/<path>@<version>. Once a module version is in the
+// cache, using it requires no network access.
+
+// modCacheRoot returns the root of the module cache, $GOPATH/pkg/mod,
+// using the first entry of $GOPATH.
+func modCacheRoot() (string, error) {
+	list := filepath.SplitList(buildContext.GOPATH)
+	if len(list) == 0 || list[0] == "" {
+		return "", fmt.Errorf("module cache requires $GOPATH to be set. For more details see: go help gopath")
+	}
+	if list[0] == goroot {
+		return "", fmt.Errorf("module cache requires $GOPATH not be set to $GOROOT. For more details see: go help gopath")
+	}
+	return filepath.Join(list[0], "pkg", "mod"), nil
+}
+
+// modEscapePath returns the escaped form of the module path,
+// for use in file names and proxy URLs.
+func modEscapePath(path string) string {
+	var buf bytes.Buffer
+	for _, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			buf.WriteByte('!')
+			buf.WriteRune(r + 'a' - 'A')
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// proxyURL returns the module proxy URL set by $GOPROXY.
+func proxyURL() (string, error) {
+	proxy := strings.TrimSuffix(os.Getenv("GOPROXY"), "/")
+	switch {
+	case proxy == "":
+		return "", fmt.Errorf("module download requires $GOPROXY to be set. For more details see: go help modules")
+	case strings.HasPrefix(proxy, "file://"),
+		strings.HasPrefix(proxy, "http://"),
+		strings.HasPrefix(proxy, "https://"):
+		return proxy, nil
+	}
+	return "", fmt.Errorf("invalid $GOPROXY %q: must be http, https or file URL", proxy)
+}
+
+// proxyGet returns the content of the proxy file named by rel,
+// a slash-separated path relative to the root of $GOPROXY.
+func proxyGet(rel string) ([]byte, error) {
+	proxy, err := proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(proxy, "file://") {
+		dir := filepath.FromSlash(strings.TrimPrefix(proxy, "file://"))
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s/%s: not found", proxy, rel)
+		}
+		return data, err
+	}
+	return httpGET(proxy + "/" + rel)
+}
+
+// modVersions returns the versions of the module path
+// known to the proxy, in increasing semver order.
+func modVersions(path string) ([]string, error) {
+	data, err := proxyGet(modEscapePath(path) + "/@v/list")
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, v := range strings.Fields(string(data)) {
+		if semverIsValid(v) {
+			list = append(list, v)
+		}
+	}
+	sort.Sort(byVersion(list))
+	return list, nil
+}
+
+// modQuery resolves the version query for the module path
+// to a specific version. The query is one of:
+//
+//	latest  the highest release version, or the highest
+//	        prerelease if there are no releases
+//	v1.2.3  exactly that version
+//	v1.2    the highest release version with that prefix
+//	v1      the highest release version with that prefix
+//
+func modQuery(path, query string) (string, error) {
+	list, err := modVersions(path)
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("no versions of module %s available", path)
+	}
+	if query == "latest" {
+		for i := len(list) - 1; i >= 0; i-- {
+			if !semverIsPrerelease(list[i]) {
+				return list[i], nil
+			}
+		}
+		return list[len(list)-1], nil
+	}
+	if semverIsValid(query) {
+		for _, v := range list {
+			if v == query {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("module %s has no version %s", path, query)
+	}
+	if !semverIsValid(query+".0") && !semverIsValid(query+".0.0") {
+		return "", fmt.Errorf("invalid version query %q for module %s", query, path)
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		v := list[i]
+		if !semverIsPrerelease(v) && strings.HasPrefix(v, query+".") {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("module %s has no version matching %s", path, query)
+}
+
+// modDownloadFile returns the content of the file for mv with the given
+// suffix (".mod" or ".zip"), reading it from the download cache if
+// present and otherwise fetching it from the proxy and caching it.
+func modDownloadFile(mv modVersion, suffix string) (string, []byte, error) {
+	root, err := modCacheRoot()
+	if err != nil {
+		return "", nil, err
+	}
+	rel := modEscapePath(mv.Path) + "/@v/" + mv.Version + suffix
+	file := filepath.Join(root, "cache", "download", filepath.FromSlash(rel))
+	if data, err := ioutil.ReadFile(file); err == nil {
+		return file, data, nil
+	}
+	if buildV && suffix == ".zip" {
+		fmt.Fprintf(os.Stderr, "%s (download)\n", mv)
+	}
+	data, err := proxyGet(rel)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return "", nil, err
+	}
+	// Write to a temporary file and rename it into place
+	// so that a concurrent go command never sees a partial file.
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0666); err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", nil, err
+	}
+	return file, data, nil
+}
+
+// modGoMod returns the go.mod file for the module version mv,
+// after checking it against go.sum.
+func modGoMod(mv modVersion) ([]byte, error) {
+	_, data, err := modDownloadFile(mv, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModSum(modVersion{mv.Path, mv.Version + "/go.mod"}, hashGoMod(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// modDir returns the directory holding the extracted source of mv,
+// downloading and verifying the module first if necessary.
+func modDir(mv modVersion) (string, error) {
+	root, err := modCacheRoot()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, filepath.FromSlash(modEscapePath(mv.Path))+"@"+mv.Version)
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		return dir, nil
+	}
+	file, _, err := modDownloadFile(mv, ".zip")
+	if err != nil {
+		return "", err
+	}
+	sum, err := hashZip(file)
+	if err != nil {
+		return "", err
+	}
+	if err := checkModSum(mv, sum); err != nil {
+		// Remove the bad download so that the next attempt fetches it again.
+		os.Remove(file)
+		return "", err
+	}
+	if err := unzipModule(file, mv, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// unzipModule extracts the module zip file into dir.
+// Every file in the archive must be under the <path>@<version>/ prefix.
+func unzipModule(file string, mv modVersion, dir string) error {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	prefix := mv.Path + "@" + mv.Version + "/"
+	for _, f := range z.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return fmt.Errorf("%s: unexpected file name %s", file, f.Name)
+		}
+		name := f.Name[len(prefix):]
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if strings.Contains("/"+name+"/", "/../") || strings.Contains(name, `\`) {
+			return fmt.Errorf("%s: invalid file name %s", file, f.Name)
+		}
+		target := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		w, err := os.Create(target)
+		if err != nil {
+			r.Close()
+			return err
+		}
+		_, err = io.Copy(w, r)
+		r.Close()
+		if err1 := w.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(tmp, 0777); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// hashGoMod returns the go.sum hash of a go.mod file.
+func hashGoMod(data []byte) string {
+	return hash1(map[string][]byte{"go.mod": data})
+}
+
+// hashZip returns the go.sum hash of the files in a module zip file.
+func hashZip(file string) (string, error) {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+	files := make(map[string][]byte)
+	for _, f := range z.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		files[f.Name] = data
+	}
+	return hash1(files), nil
+}
+
+// hashDir returns the go.sum hash of the files in the directory dir,
+// naming them as in a module zip file with the given prefix.
+func hashDir(dir, prefix string) (string, error) {
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		files[prefix+"/"+filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash1(files), nil
+}
+
+// hash1 returns the "h1:" hash of a set of files: the base64-encoded
+// SHA-256 hash of a summary listing the SHA-256 hash and name of each
+// file, sorted by name.
+func hash1(files map[string][]byte) string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%x  %s\n", sha256.Sum256(files[name]), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// The go.sum file records the expected hash of each module version
+// (and of each go.mod file, keyed as version/go.mod) used by the main
+// module. A download whose hash does not match is rejected.
+var modSum struct {
+	mu    sync.Mutex
+	file  string                  // go.sum file name; "" if not loaded
+	hash  map[modVersion][]string // hashes from go.sum and new downloads
+	dirty bool                    // hash contains entries not yet written
+}
+
+// readModSum reads the go.sum file, if any.
+func readModSum(file string) error {
+	modSum.mu.Lock()
+	defer modSum.mu.Unlock()
+	modSum.file = file
+	modSum.hash = make(map[modVersion][]string)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return fmt.Errorf("%s:%d: malformed line", file, i+1)
+		}
+		mv := modVersion{f[0], f[1]}
+		modSum.hash[mv] = append(modSum.hash[mv], f[2])
+	}
+	return nil
+}
+
+// checkModSum checks that h is the expected hash for mv,
+// recording it for go.sum if mv has no known hash.
+func checkModSum(mv modVersion, h string) error {
+	modSum.mu.Lock()
+	defer modSum.mu.Unlock()
+	if modSum.hash == nil {
+		return nil
+	}
+	known := modSum.hash[mv]
+	for _, k := range known {
+		if k == h {
+			return nil
+		}
+	}
+	if len(known) > 0 {
+		return fmt.Errorf("verifying %s: checksum mismatch\n\tdownloaded: %v\n\tgo.sum:     %v", mv, h, strings.Join(known, ", "))
+	}
+	modSum.hash[mv] = []string{h}
+	modSum.dirty = true
+	return nil
+}
+
+// writeModSum writes the go.sum file if it needs updating.
+func writeModSum() {
+	modSum.mu.Lock()
+	defer modSum.mu.Unlock()
+	if !modSum.dirty || modSum.file == "" {
+		return
+	}
+	var list []modVersion
+	for mv := range modSum.hash {
+		list = append(list, mv)
+	}
+	sort.Sort(byModulePath(list))
+	var buf bytes.Buffer
+	for _, mv := range list {
+		for _, h := range modSum.hash[mv] {
+			fmt.Fprintf(&buf, "%s %s %s\n", mv.Path, mv.Version, h)
+		}
+	}
+	if err := ioutil.WriteFile(modSum.file, buf.Bytes(), 0666); err != nil {
+		errorf("go: writing go.sum: %v", err)
+		return
+	}
+	modSum.dirty = false
+}
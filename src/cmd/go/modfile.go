@@ -0,0 +1,196 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A modFile is the parsed form of a go.mod file.
+//
+// A go.mod file is line-oriented. Each line holds a single
+// directive followed by its arguments, and // starts a comment
+// that runs to the end of the line:
+//
+//	module example.com/hello
+//
+//	require example.com/greet v1.2.0
+//
+//	require (
+//		example.com/other v0.3.1
+//		example.com/more v1.0.0
+//	)
+//
+type modFile struct {
+	Module  string       // module path, from the module directive
+	Require []modVersion // required modules, in file order
+}
+
+// A modVersion identifies a single version of a module.
+type modVersion struct {
+	Path    string
+	Version string
+}
+
+func (m modVersion) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// parseModFile parses the content of the go.mod file named file.
+func parseModFile(file string, data []byte) (*modFile, error) {
+	f := new(modFile)
+	inRequire := false
+	for i, line := range strings.Split(string(data), "\n") {
+		lineno := i + 1
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", file, lineno, fmt.Sprintf(format, args...))
+		}
+		if inRequire {
+			if len(fields) == 1 && fields[0] == ")" {
+				inRequire = false
+				continue
+			}
+			mv, err := parseModRequire(fields)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			f.Require = append(f.Require, mv)
+			continue
+		}
+		switch fields[0] {
+		default:
+			return nil, errorf("unknown directive: %s", fields[0])
+		case "module":
+			if f.Module != "" {
+				return nil, errorf("repeated module directive")
+			}
+			if len(fields) != 2 {
+				return nil, errorf("usage: module module/path")
+			}
+			path, err := modUnquote(fields[1])
+			if err != nil {
+				return nil, errorf("invalid module path %s", fields[1])
+			}
+			f.Module = path
+		case "require":
+			if len(fields) == 2 && fields[1] == "(" {
+				inRequire = true
+				continue
+			}
+			mv, err := parseModRequire(fields[1:])
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			f.Require = append(f.Require, mv)
+		}
+	}
+	if inRequire {
+		return nil, fmt.Errorf("%s: unterminated require block", file)
+	}
+	if f.Module == "" {
+		return nil, fmt.Errorf("%s: missing module directive", file)
+	}
+	return f, nil
+}
+
+// parseModRequire parses the arguments of a single requirement:
+// a module path followed by a version.
+func parseModRequire(args []string) (modVersion, error) {
+	if len(args) != 2 {
+		return modVersion{}, fmt.Errorf("usage: require module/path v1.2.3")
+	}
+	path, err := modUnquote(args[0])
+	if err != nil {
+		return modVersion{}, fmt.Errorf("invalid module path %s", args[0])
+	}
+	if !semverIsValid(args[1]) {
+		return modVersion{}, fmt.Errorf("invalid version %s for %s", args[1], path)
+	}
+	return modVersion{Path: path, Version: args[1]}, nil
+}
+
+func modUnquote(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	if s == "" || strings.ContainsAny(s, `"'`) {
+		return "", fmt.Errorf("invalid path")
+	}
+	return s, nil
+}
+
+// setRequire sets the required version of path to version,
+// adding a new requirement if path is not yet listed.
+func (f *modFile) setRequire(path, version string) {
+	for i := range f.Require {
+		if f.Require[i].Path == path {
+			f.Require[i].Version = version
+			return
+		}
+	}
+	f.Require = append(f.Require, modVersion{Path: path, Version: version})
+}
+
+// format returns the canonical text of the go.mod file.
+// Requirements are sorted by module path.
+func (f *modFile) format() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "module %s\n", modQuote(f.Module))
+	reqs := make([]modVersion, len(f.Require))
+	copy(reqs, f.Require)
+	sort.Sort(byModulePath(reqs))
+	switch len(reqs) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&buf, "\nrequire %s %s\n", modQuote(reqs[0].Path), reqs[0].Version)
+	default:
+		fmt.Fprintf(&buf, "\nrequire (\n")
+		for _, r := range reqs {
+			fmt.Fprintf(&buf, "\t%s %s\n", modQuote(r.Path), r.Version)
+		}
+		fmt.Fprintf(&buf, ")\n")
+	}
+	return buf.Bytes()
+}
+
+func modQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"'\\") || strings.Contains(s, "//") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// byModulePath sorts module versions by path, then version.
+// A go.sum key for a go.mod file (version/go.mod) sorts
+// immediately after the key for the version itself.
+type byModulePath []modVersion
+
+func (x byModulePath) Len() int      { return len(x) }
+func (x byModulePath) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x byModulePath) Less(i, j int) bool {
+	if x[i].Path != x[j].Path {
+		return x[i].Path < x[j].Path
+	}
+	vi := strings.TrimSuffix(x[i].Version, "/go.mod")
+	vj := strings.TrimSuffix(x[j].Version, "/go.mod")
+	if c := semverCompare(vi, vj); c != 0 {
+		return c < 0
+	}
+	return x[i].Version < x[j].Version
+}
@@ -0,0 +1,306 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Module-aware mode.
+//
+// In module-aware mode, the go command resolves non-standard import
+// paths using the modules listed in the build list, instead of
+// searching GOPATH. The build list is computed by minimal version
+// selection (see mvs.go) from the go.mod file of the main module,
+// the module whose root directory contains go.mod and encloses the
+// current directory.
+
+var (
+	modEnabled bool     // module-aware mode is on
+	modRoot    string   // directory holding the main module's go.mod; "" if none
+	modMain    *modFile // parsed go.mod of the main module
+
+	// modBuildList is the build list: the main module
+	// followed by the selected version of every other
+	// module, sorted by path. It is computed on first use.
+	modBuildList []modVersion
+)
+
+// modInit decides whether module-aware mode is in use, based on
+// $GO111MODULE and the location of the current directory.
+// It does no I/O beyond looking for the go.mod file.
+func modInit() {
+	env := os.Getenv("GO111MODULE")
+	switch env {
+	default:
+		fatalf("go: unknown environment setting GO111MODULE=%s", env)
+	case "", "auto", "on", "off":
+	}
+	if env == "off" {
+		return
+	}
+	modRoot = findModRoot(cwd)
+	if env != "on" {
+		// In auto mode, use modules only outside GOPATH/src,
+		// and only if there is a go.mod to use.
+		if modRoot == "" || inGOPATHSrc(cwd) {
+			return
+		}
+	}
+	modEnabled = true
+	if modRoot != "" {
+		if err := readModSum(filepath.Join(modRoot, "go.sum")); err != nil {
+			fatalf("go: %v", err)
+		}
+		atexit(writeModSum)
+	}
+}
+
+// findModRoot returns the nearest directory at or above dir
+// that contains a go.mod file, or "" if there is none.
+func findModRoot(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// inGOPATHSrc reports whether dir is inside a GOPATH src directory.
+func inGOPATHSrc(dir string) bool {
+	for _, root := range filepath.SplitList(buildContext.GOPATH) {
+		if root == "" {
+			continue
+		}
+		if _, ok := hasSubdir(filepath.Join(root, "src"), dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// modVendor reports whether packages are loaded from the main
+// module's vendor directory, as requested by -mod=vendor.
+func modVendor() bool {
+	switch buildMod {
+	case "":
+		return false
+	case "vendor":
+		return true
+	}
+	fatalf("go: invalid -mod=%s; must be vendor", buildMod)
+	return false
+}
+
+// modLoadMain reads the go.mod file of the main module.
+func modLoadMain() {
+	if modMain != nil {
+		return
+	}
+	if modRoot == "" {
+		fatalf("go: cannot find main module; see 'go help modules'")
+	}
+	file := filepath.Join(modRoot, "go.mod")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatalf("go: %v", err)
+	}
+	f, err := parseModFile(file, data)
+	if err != nil {
+		fatalf("go: %v", err)
+	}
+	modMain = f
+}
+
+// modLoad reads the main module's go.mod and computes the build list.
+func modLoad() {
+	modLoadMain()
+	if modBuildList == nil {
+		modLoadBuildList()
+	}
+}
+
+// modLoadBuildList (re)computes the build list from the main module's
+// requirements, downloading go.mod files for dependencies as needed.
+func modLoadBuildList() {
+	list, err := mvsBuildList(modVersion{Path: modMain.Module}, modReqs)
+	if err != nil {
+		fatalf("go: %v", err)
+	}
+	modBuildList = list
+}
+
+// modReqs returns the requirements of the module version mv.
+func modReqs(mv modVersion) ([]modVersion, error) {
+	if mv.Path == modMain.Module && mv.Version == "" {
+		return modMain.Require, nil
+	}
+	data, err := modGoMod(mv)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %v", mv, err)
+	}
+	f, err := parseModFile(mv.String()+"/go.mod", data)
+	if err != nil {
+		return nil, err
+	}
+	if f.Module != mv.Path {
+		return nil, fmt.Errorf("%s: go.mod declares module path %s", mv, f.Module)
+	}
+	return f.Require, nil
+}
+
+// modWriteGoMod writes the main module's go.mod file.
+func modWriteGoMod() {
+	if err := ioutil.WriteFile(filepath.Join(modRoot, "go.mod"), modMain.format(), 0666); err != nil {
+		fatalf("go: %v", err)
+	}
+}
+
+// modSelected returns the selected version of the module path,
+// or "" if it is not in the build list.
+func modSelected(path string) string {
+	for _, m := range modBuildList {
+		if m.Path == path {
+			return m.Version
+		}
+	}
+	return ""
+}
+
+// modInMain reports whether the import path is in the main module.
+func modInMain(path string) bool {
+	if modRoot == "" {
+		return false
+	}
+	modLoadMain()
+	return path == modMain.Module || strings.HasPrefix(path, modMain.Module+"/")
+}
+
+// modImportPathForDir returns the import path of the directory dir
+// in the main module, or "" if dir is outside the main module.
+func modImportPathForDir(dir string) string {
+	if modRoot == "" {
+		return ""
+	}
+	rel, ok := hasSubdir(modRoot, dir)
+	if !ok {
+		if filepath.Clean(dir) != modRoot {
+			return ""
+		}
+		rel = ""
+	}
+	if rel == "vendor" || strings.HasPrefix(rel, "vendor/") {
+		return ""
+	}
+	modLoadMain()
+	if rel == "" || rel == "." {
+		return modMain.Module
+	}
+	return modMain.Module + "/" + rel
+}
+
+// modImport finds the package with the given import path
+// in the build list and imports it from its module's directory.
+// It also returns the module providing the package, if known.
+func modImport(path string, mode build.ImportMode) (*build.Package, *moduleInfo, error) {
+	dir, m, err := modImportDir(path)
+	if err != nil {
+		return &build.Package{ImportPath: path}, nil, err
+	}
+	bp, err := buildContext.ImportDir(dir, mode)
+	bp.ImportPath = path
+	if bp.PkgObj == "" {
+		// The module is outside GOPATH. Install its packages and
+		// commands into the first GOPATH entry, as go get would.
+		if list := filepath.SplitList(buildContext.GOPATH); len(list) > 0 && list[0] != "" && list[0] != goroot {
+			bp.BinDir = filepath.Join(list[0], "bin")
+			suffix := ""
+			if buildContext.InstallSuffix != "" {
+				suffix = "_" + buildContext.InstallSuffix
+			}
+			switch buildContext.Compiler {
+			case "gccgo":
+				bp.PkgTargetRoot = filepath.Join(list[0], "pkg", "gccgo_"+buildContext.GOOS+"_"+buildContext.GOARCH+suffix)
+				d, elem := filepath.Split(filepath.FromSlash(path))
+				bp.PkgObj = filepath.Join(bp.PkgTargetRoot, d, "lib"+elem+".a")
+			case "gc":
+				bp.PkgTargetRoot = filepath.Join(list[0], "pkg", buildContext.GOOS+"_"+buildContext.GOARCH+suffix)
+				bp.PkgObj = filepath.Join(bp.PkgTargetRoot, filepath.FromSlash(path)+".a")
+			}
+		}
+	}
+	return bp, m, err
+}
+
+// modImportDir returns the directory holding the package with the
+// given import path, along with the module that provides it.
+func modImportDir(path string) (string, *moduleInfo, error) {
+	if modInMain(path) {
+		dir := filepath.Join(modRoot, filepath.FromSlash(strings.TrimPrefix(path[len(modMain.Module):], "/")))
+		return dir, &moduleInfo{Path: modMain.Module, Main: true, Dir: modRoot}, nil
+	}
+	if modVendor() {
+		dir := filepath.Join(modRoot, "vendor", filepath.FromSlash(path))
+		if !isDir(dir) {
+			return "", nil, fmt.Errorf("cannot find package %q in vendor directory %s", path, filepath.Join(modRoot, "vendor"))
+		}
+		return dir, nil, nil
+	}
+
+	modLoad()
+	var best modVersion
+	for _, m := range modBuildList[1:] {
+		if (path == m.Path || strings.HasPrefix(path, m.Path+"/")) && len(m.Path) > len(best.Path) {
+			best = m
+		}
+	}
+	if best.Path == "" {
+		return "", nil, fmt.Errorf("cannot find module providing package %s", path)
+	}
+	root, err := modDir(best)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(path[len(best.Path):], "/")))
+	return dir, &moduleInfo{Path: best.Path, Version: best.Version, Dir: root}, nil
+}
+
+// A moduleInfo describes a module in the build list,
+// as reported by go list -m and in Package.Module.
+type moduleInfo struct {
+	Path    string `json:",omitempty"` // module path
+	Version string `json:",omitempty"` // module version
+	Main    bool   `json:",omitempty"` // is this the main module?
+	Dir     string `json:",omitempty"` // directory holding files for this module, if any
+}
+
+// modInfo returns the moduleInfo for the module version m in
+// the build list. It does not download the module source.
+func modInfo(m modVersion) *moduleInfo {
+	info := &moduleInfo{Path: m.Path, Version: m.Version}
+	if m.Path == modMain.Module && m.Version == "" {
+		info.Main = true
+		info.Dir = modRoot
+		return info
+	}
+	if root, err := modCacheRoot(); err == nil {
+		dir := filepath.Join(root, filepath.FromSlash(modEscapePath(m.Path))+"@"+m.Version)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			info.Dir = dir
+		}
+	}
+	return info
+}
@@ -0,0 +1,264 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tests for module-aware mode.
+
+package main_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A testModule is a module version served by the test proxy.
+type testModule struct {
+	path, version string
+	files         map[string]string // file name -> content, including go.mod
+}
+
+var testModules = []testModule{
+	{"example.com/a", "v1.0.0", map[string]string{
+		"go.mod": "module example.com/a\n\nrequire example.com/b v1.0.0\n",
+		"a.go":   "package a\n\nimport \"example.com/b\"\n\nfunc A() string { return \"a1.0.0 \" + b.B() }\n",
+	}},
+	{"example.com/a", "v1.1.0", map[string]string{
+		"go.mod": "module example.com/a\n\nrequire example.com/b v1.2.0\n",
+		"a.go":   "package a\n\nimport \"example.com/b\"\n\nfunc A() string { return \"a1.1.0 \" + b.B() }\n",
+	}},
+	{"example.com/b", "v1.0.0", map[string]string{
+		"go.mod": "module example.com/b\n",
+		"b.go":   "package b\n\nfunc B() string { return \"b1.0.0\" }\n",
+	}},
+	{"example.com/b", "v1.2.0", map[string]string{
+		"go.mod":    "module example.com/b\n",
+		"b.go":      "package b\n\nfunc B() string { return \"b1.2.0\" }\n",
+		"b_test.go": "package b\n",
+	}},
+	{"example.com/b", "v2.0.0-pre", map[string]string{
+		"go.mod": "module example.com/b\n",
+		"b.go":   "package b\n\nfunc B() string { return \"b2.0.0-pre\" }\n",
+	}},
+}
+
+// modTestgo returns a testgoData running in module-aware mode
+// in the main module example.com/m, which requires example.com/a v1.1.0
+// and example.com/b v1.0.0, with modules served by a file-based proxy
+// and a module cache in a fresh GOPATH.
+func modTestgo(t *testing.T) *testgoData {
+	tg := testgo(t)
+	tg.makeTempdir()
+	versions := make(map[string][]string)
+	for _, m := range testModules {
+		dir := tg.path(filepath.Join("proxy", m.path, "@v"))
+		tg.must(os.MkdirAll(dir, 0777))
+		tg.must(ioutil.WriteFile(filepath.Join(dir, m.version+".mod"), []byte(m.files["go.mod"]), 0666))
+		var buf bytes.Buffer
+		z := zip.NewWriter(&buf)
+		for name, data := range m.files {
+			w, err := z.Create(m.path + "@" + m.version + "/" + name)
+			tg.must(err)
+			_, err = w.Write([]byte(data))
+			tg.must(err)
+		}
+		tg.must(z.Close())
+		tg.must(ioutil.WriteFile(filepath.Join(dir, m.version+".zip"), buf.Bytes(), 0666))
+		versions[dir] = append(versions[dir], m.version)
+	}
+	for dir, list := range versions {
+		tg.must(ioutil.WriteFile(filepath.Join(dir, "list"), []byte(strings.Join(list, "\n")+"\n"), 0666))
+	}
+
+	tg.tempFile("m/go.mod", `module example.com/m
+
+require (
+	example.com/a v1.1.0
+	example.com/b v1.0.0
+)
+`)
+	tg.tempFile("m/main.go", `package main
+
+import (
+	"example.com/a"
+	"fmt"
+)
+
+func main() { fmt.Println(a.A()) }
+`)
+	tg.setenv("GO111MODULE", "on")
+	tg.setenv("GOPROXY", "file://"+filepath.ToSlash(tg.path("proxy")))
+	tg.setenv("GOPATH", tg.path("gopath"))
+	tg.cd(tg.path("m"))
+	return tg
+}
+
+// wantFile fails if the content of file is not want.
+func (tg *testgoData) wantFile(file, want string) {
+	data, err := ioutil.ReadFile(file)
+	tg.must(err)
+	if string(data) != want {
+		tg.t.Fatalf("%s:\n%s\nwant:\n%s", file, data, want)
+	}
+}
+
+// grepFile looks for a regular expression in the content of file.
+func (tg *testgoData) grepFile(file, match, msg string) {
+	data, err := ioutil.ReadFile(file)
+	tg.must(err)
+	tg.doGrep(match, bytes.NewBuffer(data), filepath.Base(file), msg)
+}
+
+func TestModListBuildList(t *testing.T) {
+	tg := modTestgo(t)
+	defer tg.cleanup()
+
+	tg.run("list", "-m")
+	if out := tg.getStdout(); out != "example.com/m\n" {
+		t.Errorf("go list -m = %q, want %q", out, "example.com/m\n")
+	}
+
+	// example.com/a v1.1.0 requires example.com/b v1.2.0,
+	// which is higher than the main module's own requirement.
+	tg.run("list", "-m", "all")
+	want := "example.com/m\nexample.com/a v1.1.0\nexample.com/b v1.2.0\n"
+	if out := tg.getStdout(); out != want {
+		t.Errorf("go list -m all:\n%s\nwant:\n%s", out, want)
+	}
+	tg.run("list", "-m", "example.com/b")
+	tg.grepStdout(`^example.com/b v1.2.0$`, "go list -m example.com/b did not report selected version")
+	tg.runFail("list", "-m", "example.com/c")
+	tg.grepStderr("not in build list", "go list -m of unknown module did not fail as expected")
+
+	// Computing the build list needs only the go.mod files.
+	tg.mustNotExist(tg.path("gopath/pkg/mod/example.com/b@v1.2.0"))
+	for _, line := range []string{
+		`^example.com/a v1.1.0/go.mod h1:`,
+		`^example.com/b v1.0.0/go.mod h1:`,
+		`^example.com/b v1.2.0/go.mod h1:`,
+	} {
+		tg.grepFile(tg.path("m/go.sum"), line, "go.sum does not record go.mod hash")
+	}
+}
+
+func TestModBuild(t *testing.T) {
+	tg := modTestgo(t)
+	defer tg.cleanup()
+
+	tg.run("build", "-o", "m"+exeSuffix, ".")
+	out, err := exec.Command(tg.path("m/m" + exeSuffix)).CombinedOutput()
+	tg.must(err)
+	if string(out) != "a1.1.0 b1.2.0\n" {
+		t.Errorf("program printed %q, want %q", out, "a1.1.0 b1.2.0\n")
+	}
+
+	tg.run("list", "-f", "{{.Module.Path}} {{.Module.Version}} {{.Dir}}", "example.com/b")
+	tg.grepStdout(`^example.com/b v1.2.0 .*example.com.b@v1.2.0$`, "example.com/b not loaded from module cache")
+	tg.run("list", "-f", "{{.ImportPath}} {{.Module.Main}}", ".")
+	tg.grepStdout(`^example.com/m true$`, "main module package has wrong import path")
+	tg.grepFile(tg.path("m/go.sum"), `^example.com/b v1.2.0 h1:`, "go.sum does not record module hash")
+}
+
+func TestModGet(t *testing.T) {
+	tg := modTestgo(t)
+	defer tg.cleanup()
+
+	// Downgrading example.com/a also drops its requirement on example.com/b v1.2.0.
+	tg.run("get", "-d", "example.com/a@v1.0.0")
+	tg.run("list", "-m", "all")
+	want := "example.com/m\nexample.com/a v1.0.0\nexample.com/b v1.0.0\n"
+	if out := tg.getStdout(); out != want {
+		t.Errorf("go list -m all:\n%s\nwant:\n%s", out, want)
+	}
+
+	// A version prefix selects the latest matching release,
+	// and latest ignores prereleases.
+	tg.run("get", "-d", "example.com/b@v1")
+	tg.run("get", "-d", "example.com/a")
+	tg.wantFile(tg.path("m/go.mod"), `module example.com/m
+
+require (
+	example.com/a v1.1.0
+	example.com/b v1.2.0
+)
+`)
+	tg.mustExist(tg.path("gopath/pkg/mod/example.com/a@v1.1.0/a.go"))
+
+	tg.run("get", "-d", "example.com/b@v2.0.0-pre")
+	tg.run("list", "-m", "example.com/b")
+	tg.grepStdout(`^example.com/b v2.0.0-pre$`, "go get of prerelease did not select it")
+
+	tg.runFail("get", "-d", "example.com/b@v1.3.0")
+	tg.grepStderr("has no version v1.3.0", "go get of unknown version did not fail as expected")
+	tg.runFail("get", "-d", "example.com/c/pkg@latest")
+	tg.grepStderr("cannot find module providing package example.com/c/pkg", "go get of unknown module did not fail as expected")
+}
+
+func TestModVendor(t *testing.T) {
+	tg := modTestgo(t)
+	defer tg.cleanup()
+
+	tg.run("mod", "vendor")
+	tg.wantFile(tg.path("m/vendor/modules.txt"), ""+
+		"# example.com/a v1.1.0\n"+
+		"example.com/a\n"+
+		"# example.com/b v1.2.0\n"+
+		"example.com/b\n")
+	tg.mustExist(tg.path("m/vendor/example.com/b/b.go"))
+	tg.mustNotExist(tg.path("m/vendor/example.com/b/b_test.go"))
+
+	// Building from the vendor directory needs neither the proxy nor the cache.
+	tg.unsetenv("GOPROXY")
+	tg.setenv("GOPATH", tg.path("empty"))
+	tg.run("build", "-mod=vendor", "-o", "m"+exeSuffix, ".")
+	tg.runFail("build", "-o", "m"+exeSuffix, ".")
+	tg.grepStderr("GOPROXY", "build without vendor did not need module proxy")
+}
+
+func TestModChecksum(t *testing.T) {
+	tg := modTestgo(t)
+	defer tg.cleanup()
+
+	tg.run("mod", "download")
+	tg.mustExist(tg.path("gopath/pkg/mod/cache/download/example.com/b/@v/v1.2.0.zip"))
+	tg.run("mod", "verify")
+	tg.grepStdout("all modules verified", "go mod verify failed")
+
+	tg.must(ioutil.WriteFile(tg.path("gopath/pkg/mod/example.com/b@v1.2.0/b.go"), []byte("package b\n"), 0666))
+	tg.runFail("mod", "verify")
+	tg.grepStderr(`example.com/b@v1.2.0: dir has been modified`, "go mod verify did not detect modified module")
+
+	// A fresh download that does not match go.sum is rejected.
+	sum, err := ioutil.ReadFile(tg.path("m/go.sum"))
+	tg.must(err)
+	bad := strings.Replace(string(sum), "example.com/a v1.1.0 h1:", "example.com/a v1.1.0 h1:x", 1)
+	tg.must(ioutil.WriteFile(tg.path("m/go.sum"), []byte(bad), 0666))
+	tg.setenv("GOPATH", tg.path("gopath2"))
+	tg.runFail("build", ".")
+	tg.grepStderr("verifying example.com/a@v1.1.0: checksum mismatch", "build did not detect checksum mismatch")
+}
+
+func TestModInit(t *testing.T) {
+	tg := testgo(t)
+	defer tg.cleanup()
+	tg.tempDir("x")
+	tg.setenv("GOPATH", tg.path("gopath"))
+	tg.cd(tg.path("x"))
+
+	tg.run("mod", "init", "example.com/x")
+	tg.wantFile(tg.path("x/go.mod"), "module example.com/x\n")
+	tg.runFail("mod", "init", "example.com/x")
+	tg.grepStderr("already exists", "second go mod init did not fail as expected")
+
+	// Outside GOPATH, go.mod enables module-aware mode by default.
+	tg.tempFile("x/x.go", "package x\n")
+	tg.run("list", "-m")
+	tg.grepStdout(`^example.com/x$`, "go list -m in new module")
+	tg.run("list", ".")
+	tg.grepStdout(`^example.com/x$`, "go list in new module")
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "sort"
+
+// mvsBuildList computes the build list for the target module using
+// minimal version selection. reqs returns the requirements listed in
+// the go.mod file of a given module version.
+//
+// Starting at the target, mvsBuildList visits every module version
+// reachable through requirements and selects, for each module path,
+// the highest version visited. The result is never newer than some
+// version explicitly required, so a build is reproducible from the
+// go.mod files alone, without consulting the list of versions that
+// exist upstream.
+//
+// The target is the first element of the returned list; the
+// remaining modules are sorted by path.
+func mvsBuildList(target modVersion, reqs func(modVersion) ([]modVersion, error)) ([]modVersion, error) {
+	selected := map[string]string{target.Path: target.Version}
+	seen := map[modVersion]bool{target: true}
+	queue := []modVersion{target}
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		list, err := reqs(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range list {
+			if r.Path == target.Path {
+				// The target is always selected at its own version.
+				continue
+			}
+			if v, ok := selected[r.Path]; !ok || semverCompare(r.Version, v) > 0 {
+				selected[r.Path] = r.Version
+			}
+			if !seen[r] {
+				seen[r] = true
+				queue = append(queue, r)
+			}
+		}
+	}
+
+	list := []modVersion{target}
+	var rest []modVersion
+	for path, vers := range selected {
+		if path != target.Path {
+			rest = append(rest, modVersion{Path: path, Version: vers})
+		}
+	}
+	sort.Sort(byModulePath(rest))
+	return append(list, rest...), nil
+}
@@ -68,6 +68,9 @@ type Package struct {
 	Imports []string `json:",omitempty"` // import paths used by this package
 	Deps    []string `json:",omitempty"` // all (recursively) imported dependencies
 
+	// Module information
+	Module *moduleInfo `json:",omitempty"` // module providing this package (module-aware mode only)
+
 	// Error information
 	Incomplete bool            `json:",omitempty"` // was there an error loading this package or dependencies?
 	Error      *PackageError   `json:",omitempty"` // error loading this package (not dependencies)
@@ -320,9 +323,17 @@ func loadImport(path, srcDir string, parent *Package, stk *importStack, importPo
 	importPath := path
 	origPath := path
 	isLocal := build.IsLocalImport(path)
+	if isLocal && modEnabled {
+		// In module-aware mode, a local import of a directory
+		// in the main module means the same as its full import path.
+		if ip := modImportPathForDir(filepath.Join(srcDir, path)); ip != "" {
+			path, origPath, importPath = ip, ip, ip
+			isLocal = false
+		}
+	}
 	if isLocal {
 		importPath = dirToImportPath(filepath.Join(srcDir, path))
-	} else if mode&useVendor != 0 {
+	} else if mode&useVendor != 0 && !modEnabled {
 		// We do our own vendor resolution, because we want to
 		// find out the key to use in packageCache without the
 		// overhead of repeated calls to buildContext.Import.
@@ -359,7 +370,13 @@ func loadImport(path, srcDir string, parent *Package, stk *importStack, importPo
 		// Not vendoring, or we already found the vendored path.
 		buildMode |= build.IgnoreVendor
 	}
-	bp, err := buildContext.Import(path, srcDir, buildMode)
+	var bp *build.Package
+	var err error
+	if modEnabled && !isLocal && (!isStandardImportPath(path) || modInMain(path)) {
+		bp, p.Module, err = modImport(path, buildMode)
+	} else {
+		bp, err = buildContext.Import(path, srcDir, buildMode)
+	}
 	bp.ImportPath = importPath
 	if gobin != "" {
 		bp.BinDir = gobin
@@ -510,6 +527,13 @@ func disallowInternal(srcDir string, p *Package, stk *importStack) *Package {
 		return p
 	}
 
+	// The generated 'testmain' package is allowed to access testing/internal/...,
+	// as if it were generated into the testing directory tree
+	// (it's actually in a temporary directory outside any Go tree).
+	if strings.HasPrefix(p.ImportPath, "testing/internal") && len(*stk) >= 2 && (*stk)[len(*stk)-2] == "testmain" {
+		return p
+	}
+
 	// The stack includes p.ImportPath.
 	// If that's the only thing on the stack, we started
 	// with a name given on the command line, not an
@@ -1614,7 +1638,7 @@ func loadPackage(arg string, stk *importStack) *Package {
 	// This lets you run go test ./ioutil in package io and be
 	// referring to io/ioutil rather than a hypothetical import of
 	// "./ioutil".
-	if build.IsLocalImport(arg) {
+	if build.IsLocalImport(arg) && !modEnabled {
 		bp, _ := buildContext.ImportDir(filepath.Join(cwd, arg), build.FindOnly)
 		if bp.ImportPath != "" && bp.ImportPath != "." {
 			arg = bp.ImportPath
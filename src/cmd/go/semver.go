@@ -0,0 +1,231 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Semantic versions, as used by module versions.
+// See http://semver.org/ for the precise rules.
+// Module versions always carry a leading "v" and must
+// name all three components: v1.2.3, v1.2.3-pre, v1.2.3+meta.
+
+// A semver is a parsed semantic version.
+type semver struct {
+	major, minor, patch string
+	prerelease          string
+	build               string
+}
+
+// parseSemver parses v, reporting whether it is a complete
+// semantic version of the form vMAJOR.MINOR.PATCH[-PRE][+BUILD].
+func parseSemver(v string) (p semver, ok bool) {
+	if v == "" || v[0] != 'v' {
+		return
+	}
+	if p.major, v, ok = semverNum(v[1:]); !ok {
+		return
+	}
+	if v == "" || v[0] != '.' {
+		ok = false
+		return
+	}
+	if p.minor, v, ok = semverNum(v[1:]); !ok {
+		return
+	}
+	if v == "" || v[0] != '.' {
+		ok = false
+		return
+	}
+	if p.patch, v, ok = semverNum(v[1:]); !ok {
+		return
+	}
+	if len(v) > 0 && v[0] == '-' {
+		if p.prerelease, v, ok = semverIdents(v, true); !ok {
+			return
+		}
+	}
+	if len(v) > 0 && v[0] == '+' {
+		if p.build, v, ok = semverIdents(v, false); !ok {
+			return
+		}
+	}
+	if v != "" {
+		ok = false
+		return
+	}
+	ok = true
+	return
+}
+
+// semverNum parses a leading decimal number without extra zeros.
+func semverNum(v string) (num, rest string, ok bool) {
+	i := 0
+	for i < len(v) && '0' <= v[i] && v[i] <= '9' {
+		i++
+	}
+	if i == 0 || v[0] == '0' && i != 1 {
+		return "", "", false
+	}
+	return v[:i], v[i:], true
+}
+
+// semverIdents parses a leading '-' or '+' followed by a
+// dot-separated list of identifiers. In prereleases, numeric
+// identifiers must not have leading zeros.
+func semverIdents(v string, pre bool) (s, rest string, ok bool) {
+	i := 1
+	start := 1
+	for i < len(v) && v[i] != '+' {
+		c := v[i]
+		if c == '.' {
+			if start == i || pre && badNumIdent(v[start:i]) {
+				return "", "", false
+			}
+			start = i + 1
+		} else if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '-') {
+			return "", "", false
+		}
+		i++
+	}
+	if start == i || pre && badNumIdent(v[start:i]) {
+		return "", "", false
+	}
+	return v[:i], v[i:], true
+}
+
+func badNumIdent(s string) bool {
+	return isNumIdent(s) && len(s) > 1 && s[0] == '0'
+}
+
+func isNumIdent(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// semverIsValid reports whether v is a valid module version.
+func semverIsValid(v string) bool {
+	_, ok := parseSemver(v)
+	return ok
+}
+
+// semverIsPrerelease reports whether v is a valid prerelease version.
+func semverIsPrerelease(v string) bool {
+	p, ok := parseSemver(v)
+	return ok && p.prerelease != ""
+}
+
+// semverCompare returns an integer comparing two versions according to
+// semantic version precedence. The result is 0 if v == w, -1 if v < w,
+// and +1 if v > w. An invalid version is considered less than all
+// valid versions, and equal to other invalid versions.
+func semverCompare(v, w string) int {
+	pv, ok1 := parseSemver(v)
+	pw, ok2 := parseSemver(w)
+	if !ok1 && !ok2 {
+		return 0
+	}
+	if !ok1 {
+		return -1
+	}
+	if !ok2 {
+		return +1
+	}
+	if c := compareNum(pv.major, pw.major); c != 0 {
+		return c
+	}
+	if c := compareNum(pv.minor, pw.minor); c != 0 {
+		return c
+	}
+	if c := compareNum(pv.patch, pw.patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(pv.prerelease, pw.prerelease)
+}
+
+// semverMax returns the larger of v and w.
+func semverMax(v, w string) string {
+	if semverCompare(v, w) < 0 {
+		return w
+	}
+	return v
+}
+
+func compareNum(x, y string) int {
+	if len(x) != len(y) {
+		if len(x) < len(y) {
+			return -1
+		}
+		return +1
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return +1
+	}
+	return 0
+}
+
+func comparePrerelease(x, y string) int {
+	// "When major, minor, and patch are equal, a pre-release version has
+	// lower precedence than a normal version."
+	if x == y {
+		return 0
+	}
+	if x == "" {
+		return +1
+	}
+	if y == "" {
+		return -1
+	}
+	// Both begin with '-'; compare the dot-separated identifiers.
+	x, y = x[1:], y[1:]
+	for x != "" && y != "" {
+		var dx, dy string
+		dx, x = nextIdent(x)
+		dy, y = nextIdent(y)
+		if dx == dy {
+			continue
+		}
+		nx, ny := isNumIdent(dx), isNumIdent(dy)
+		switch {
+		case nx && ny:
+			return compareNum(dx, dy)
+		case nx:
+			return -1
+		case ny:
+			return +1
+		case dx < dy:
+			return -1
+		default:
+			return +1
+		}
+	}
+	if x == "" {
+		if y == "" {
+			return 0
+		}
+		return -1
+	}
+	return +1
+}
+
+func nextIdent(x string) (ident, rest string) {
+	for i := 0; i < len(x); i++ {
+		if x[i] == '.' {
+			return x[:i], x[i+1:]
+		}
+	}
+	return x, ""
+}
+
+// byVersion sorts a list of versions in increasing semver order.
+type byVersion []string
+
+func (vs byVersion) Len() int           { return len(vs) }
+func (vs byVersion) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
+func (vs byVersion) Less(i, j int) bool { return semverCompare(vs[i], vs[j]) < 0 }
@@ -0,0 +1,148 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// semverTests lists versions in increasing order;
+// entries in the same group compare equal.
+var semverTests = [][]string{
+	{"v0.0.0"},
+	{"v0.0.1"},
+	{"v0.1.0"},
+	{"v1.0.0-0"},
+	{"v1.0.0-1"},
+	{"v1.0.0-alpha"},
+	{"v1.0.0-alpha.1"},
+	{"v1.0.0-alpha.beta"},
+	{"v1.0.0-beta"},
+	{"v1.0.0-beta.2"},
+	{"v1.0.0-beta.11"},
+	{"v1.0.0-rc.1"},
+	{"v1.0.0", "v1.0.0+meta"},
+	{"v1.2.0"},
+	{"v1.10.0"},
+	{"v2.0.0"},
+}
+
+var badSemvers = []string{
+	"",
+	"1.0.0",
+	"v1",
+	"v1.2",
+	"v1.2.3.4",
+	"v01.2.3",
+	"v1.2.3-",
+	"v1.2.3-01",
+	"v1.2.3-a..b",
+	"v1.2.3+",
+	"v1.2.3+a+b",
+	"v1.2.3-a_b",
+}
+
+func TestSemverCompare(t *testing.T) {
+	for i, gi := range semverTests {
+		for j, gj := range semverTests {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = +1
+			}
+			for _, v := range gi {
+				for _, w := range gj {
+					if got := semverCompare(v, w); got != want {
+						t.Errorf("semverCompare(%q, %q) = %d, want %d", v, w, got, want)
+					}
+				}
+			}
+		}
+	}
+	for _, v := range badSemvers {
+		if semverIsValid(v) {
+			t.Errorf("semverIsValid(%q) = true, want false", v)
+		}
+		if got := semverCompare(v, "v0.0.0"); got != -1 {
+			t.Errorf("semverCompare(%q, v0.0.0) = %d, want -1", v, got)
+		}
+	}
+}
+
+func TestMVSBuildList(t *testing.T) {
+	// A graph with a diamond and a cycle back to the target.
+	graph := map[modVersion][]modVersion{
+		{"m", ""}:       {{"a", "v1.0.0"}, {"b", "v1.1.0"}},
+		{"a", "v1.0.0"}: {{"c", "v1.2.0"}, {"m", "v0.1.0"}},
+		{"b", "v1.1.0"}: {{"c", "v1.1.0"}, {"d", "v1.0.0"}},
+		{"c", "v1.1.0"}: {{"d", "v1.5.0"}},
+		{"c", "v1.2.0"}: nil,
+		{"d", "v1.0.0"}: nil,
+		{"d", "v1.5.0"}: nil,
+	}
+	reqs := func(m modVersion) ([]modVersion, error) {
+		list, ok := graph[m]
+		if !ok {
+			t.Fatalf("unexpected request for %v", m)
+		}
+		return list, nil
+	}
+	list, err := mvsBuildList(modVersion{"m", ""}, reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []modVersion{
+		{"m", ""},
+		{"a", "v1.0.0"},
+		{"b", "v1.1.0"},
+		{"c", "v1.2.0"},
+		{"d", "v1.5.0"},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("mvsBuildList = %v, want %v", list, want)
+	}
+}
+
+func TestParseModFile(t *testing.T) {
+	const text = `// comment
+module "example.com/m"
+
+require example.com/a v1.0.0 // indirect
+
+require (
+	example.com/c v1.2.3-pre
+	example.com/b v0.1.0
+)
+`
+	f, err := parseModFile("go.mod", []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const formatted = `module example.com/m
+
+require (
+	example.com/a v1.0.0
+	example.com/b v0.1.0
+	example.com/c v1.2.3-pre
+)
+`
+	if out := string(f.format()); out != formatted {
+		t.Errorf("format:\n%s\nwant:\n%s", out, formatted)
+	}
+
+	for _, bad := range []string{
+		"require example.com/a v1.0.0\n",
+		"module m\nrequire example.com/a 1.0.0\n",
+		"module m\nrequire (\nexample.com/a v1.0.0\n",
+		"module m\nreplace x => y\n",
+	} {
+		if _, err := parseModFile("go.mod", []byte(bad)); err == nil {
+			t.Errorf("parseModFile(%q) succeeded, want error", bad)
+		}
+	}
+}
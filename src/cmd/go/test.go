@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -13,6 +14,7 @@ import (
 	"go/doc"
 	"go/parser"
 	"go/token"
+	"io"
 	"os"
 	"os/exec"
 	"path"
@@ -20,7 +22,9 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 	"unicode"
@@ -125,7 +129,10 @@ control the execution of any test:
 
 const testFlag2 = `
 	-bench regexp
-	    Run benchmarks matching the regular expression.
+	    Run (sub)benchmarks matching a regular expression.
+	    The given regular expression is split into smaller ones by
+	    top-level '/', where each must match the corresponding part of a
+	    benchmark's identifier.
 	    By default, no benchmarks run. To run all benchmarks,
 	    use '-bench .' or '-bench=.'.
 
@@ -189,6 +196,25 @@ const testFlag2 = `
 	    Write a CPU profile to the specified file before exiting.
 	    Writes test binary as -c would.
 
+	-fuzz regexp
+	    Run the fuzz target matching the regular expression. When specified,
+	    the command line argument must match exactly one package, and regexp
+	    must match exactly one fuzz target within that package. Fuzzing
+	    generates new inputs from the seed corpus until an input fails or
+	    the -fuzztime limit is reached. The failing input is minimized and
+	    written to the testdata/fuzz directory of the package, where later
+	    runs of 'go test' will find it. Sets -cover, which guides the
+	    generation of inputs. See 'go help testfunc'.
+
+	-fuzzminimizetime t
+	    Spend at most t minimizing a failing input found by -fuzz.
+	    The default is 60 seconds (60s).
+
+	-fuzztime t
+	    Spend at most t running fuzz inputs, specified as a time.Duration
+	    (for example, -fuzztime 1h30s). By default, fuzzing runs until
+	    it finds a failure. Fuzzing is not subject to -timeout.
+
 	-memprofile mem.out
 	    Write a memory profile to the file after all tests have passed.
 	    Writes test binary as -c would.
@@ -199,6 +225,15 @@ const testFlag2 = `
 	    To profile all memory allocations, use -test.memprofilerate=1
 	    and pass --alloc_space flag to the pprof tool.
 
+	-mutexprofile mutex.out
+	    Write a mutex contention profile to the specified file
+	    when all tests are complete.
+	    Writes test binary as -c would.
+
+	-mutexprofilefraction n
+	    Sample 1 in n stack traces of goroutines holding a
+	    contended mutex.
+
 	-outputdir directory
 	    Place output files from profiling in the specified directory,
 	    by default the directory in which "go test" is running.
@@ -214,7 +249,9 @@ const testFlag2 = `
 
 	-run regexp
 	    Run only those tests and examples matching the regular
-	    expression.
+	    expression. For tests the regular expression is split into
+	    smaller ones by top-level '/', where each must match the
+	    corresponding part of a test's identifier.
 
 	-short
 	    Tell long-running tests to shorten their run time.
@@ -297,8 +334,8 @@ var helpTestfunc = &Command{
 	UsageLine: "testfunc",
 	Short:     "description of testing functions",
 	Long: `
-The 'go test' command expects to find test, benchmark, and example functions
-in the "*_test.go" files corresponding to the package under test.
+The 'go test' command expects to find test, benchmark, fuzz target, and example
+functions in the "*_test.go" files corresponding to the package under test.
 
 A test function is one named TestXXX (where XXX is any alphanumeric string
 not starting with a lower case letter) and should have the signature,
@@ -309,6 +346,14 @@ A benchmark function is one named BenchmarkXXX and should have the signature,
 
 	func BenchmarkXXX(b *testing.B) { ... }
 
+A fuzz target is one named FuzzXXX and should have the signature,
+
+	func FuzzXXX(f *testing.F) { ... }
+
+It runs as a test on its seed corpus: the inputs it adds with f.Add and
+the files in testdata/fuzz/FuzzXXX. With the -fuzz flag, it generates
+new inputs as well (see 'go help testflag').
+
 An example function is similar to a test function but, instead of using
 *testing.T to report success or failure, prints output to os.Stdout.
 That output is compared against the function's "Output:" comment, which
@@ -351,17 +396,19 @@ var (
 	testTimeout      string     // -timeout flag
 	testArgs         []string
 	testBench        bool
-	testStreamOutput bool // show output as it is generated
-	testShowPass     bool // show passing output
+	testFuzz         string // -fuzz flag
+	testStreamOutput bool   // show output as it is generated
+	testShowPass     bool   // show passing output
+	testCacheable    bool   // test results may be cached
 
 	testKillTimeout = 10 * time.Minute
 )
 
 var testMainDeps = map[string]bool{
 	// Dependencies for testmain.
-	"testing": true,
-	"regexp":  true,
-	"os":      true,
+	"testing":                   true,
+	"testing/internal/testdeps": true,
+	"os": true,
 }
 
 func runTest(cmd *Command, args []string) {
@@ -386,6 +433,9 @@ func runTest(cmd *Command, args []string) {
 	if testProfile && len(pkgs) != 1 {
 		fatalf("cannot use test profile flag with multiple packages")
 	}
+	if testFuzz != "" && len(pkgs) != 1 {
+		fatalf("cannot use -fuzz flag with multiple packages")
+	}
 
 	// If a test timeout was given and is parseable, set our kill timeout
 	// to that timeout plus one minute. This is a backup alarm in case
@@ -395,6 +445,13 @@ func runTest(cmd *Command, args []string) {
 		testKillTimeout = dt + 1*time.Minute
 	}
 
+	if testFuzz != "" {
+		// Fuzzing runs until it finds a failure or -fuzztime elapses,
+		// and is guided by coverage of the package under test.
+		testKillTimeout = 100 * 365 * 24 * time.Hour
+		testCover = true
+	}
+
 	// show passing test output (after buffering) with -v flag.
 	// must buffer because tests are running in parallel, and
 	// otherwise the output will get mixed.
@@ -407,9 +464,19 @@ func runTest(cmd *Command, args []string) {
 	// single package under test or if parallelism is set to 1.
 	// In these cases, streaming the output produces the same result
 	// as not streaming, just more immediately.
-	testStreamOutput = len(pkgArgs) == 0 || testBench ||
+	testStreamOutput = len(pkgArgs) == 0 || testBench || testFuzz != "" ||
 		(testShowPass && (len(pkgs) == 1 || buildP == 1))
 
+	// cache test results only for explicitly named packages
+	// run with flags that do not change what the test observes
+	// beyond its own output. See 'go help cache'.
+	testCacheable = len(pkgArgs) > 0 && !testBench && testFuzz == ""
+	for _, arg := range testArgs {
+		if !cacheableTestFlag(arg) {
+			testCacheable = false
+		}
+	}
+
 	var b builder
 	b.init()
 
@@ -789,7 +856,7 @@ func (b *builder) test(p *Package) (buildAction, runAction, printAction *action,
 		omitDWARF:  !testC && !testNeedBinary,
 	}
 
-	// The generated main also imports testing, regexp, and os.
+	// The generated main also imports testing, testing/internal/testdeps, and os.
 	stk.push("testmain")
 	for dep := range testMainDeps {
 		if dep == ptest.ImportPath {
@@ -1054,7 +1121,13 @@ func declareCoverVars(importPath string, files ...string) map[string]*CoverVar {
 
 // runTest is the action for running a test binary.
 func (b *builder) runTest(a *action) error {
-	args := stringList(findExecCmd(), a.deps[0].target, testArgs)
+	var fuzzArgs []string
+	if c := openBuildCache(); testFuzz != "" && c != nil {
+		// Keep the inputs that fuzzing finds interesting, so that
+		// the next run of the fuzz target can start from them.
+		fuzzArgs = []string{"-test.fuzzcachedir=" + filepath.Join(c.dir, "fuzz", a.p.ImportPath)}
+	}
+	args := stringList(findExecCmd(), a.deps[0].target, fuzzArgs, testArgs)
 	a.testOutput = new(bytes.Buffer)
 
 	if buildN || buildX {
@@ -1076,9 +1149,15 @@ func (b *builder) runTest(a *action) error {
 	cmd.Dir = a.p.Dir
 	cmd.Env = envForDir(cmd.Dir, origEnv)
 	var buf bytes.Buffer
+	var streamed testOutputRecorder
 	if testStreamOutput {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+		if testCacheable {
+			// Keep a copy of the output for the cache.
+			cmd.Stdout = io.MultiWriter(os.Stdout, streamed.writer(testStdout))
+			cmd.Stderr = io.MultiWriter(os.Stderr, streamed.writer(testStderr))
+		}
 	} else {
 		cmd.Stdout = &buf
 		cmd.Stderr = &buf
@@ -1103,6 +1182,26 @@ func (b *builder) runTest(a *action) error {
 		cmd.Env = env
 	}
 
+	key, cacheable := b.testCacheKey(a, cmd)
+	if cacheable {
+		if out, ok := openBuildCache().getBytes(key); ok {
+			if testStreamOutput {
+				// Replay the output as it was streamed,
+				// keeping standard output and standard error apart.
+				if replayTestOutput(out, os.Stdout, os.Stderr) {
+					fmt.Fprintf(a.testOutput, "ok  \t%s\t(cached)\n", a.p.ImportPath)
+					return nil
+				}
+			} else {
+				if testShowPass {
+					a.testOutput.Write(out)
+				}
+				fmt.Fprintf(a.testOutput, "ok  \t%s\t(cached)%s\n", a.p.ImportPath, coveragePercentage(out))
+				return nil
+			}
+		}
+	}
+
 	t0 := time.Now()
 	err := cmd.Start()
 
@@ -1142,6 +1241,13 @@ func (b *builder) runTest(a *action) error {
 	out := buf.Bytes()
 	t := fmt.Sprintf("%.3fs", time.Since(t0).Seconds())
 	if err == nil {
+		if cacheable {
+			if testStreamOutput {
+				openBuildCache().putBytes(key, streamed.buf.Bytes())
+			} else {
+				openBuildCache().putBytes(key, out)
+			}
+		}
 		if testShowPass {
 			a.testOutput.Write(out)
 		}
@@ -1161,6 +1267,148 @@ func (b *builder) runTest(a *action) error {
 	return nil
 }
 
+// cacheableTestFlags lists the test binary flags that
+// do not prevent caching of test results.
+var cacheableTestFlags = []string{
+	"-test.cpu=",
+	"-test.parallel=",
+	"-test.run=",
+	"-test.short=",
+	"-test.timeout=",
+	"-test.v=",
+}
+
+func cacheableTestFlag(arg string) bool {
+	for _, prefix := range cacheableTestFlags {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// testCacheKey returns the cache key for the result of running
+// the test binary built for a using cmd, and whether the result
+// may be cached at all.
+func (b *builder) testCacheKey(a *action, cmd *exec.Cmd) (cacheID, bool) {
+	if !testCacheable || openBuildCache() == nil {
+		return cacheID{}, false
+	}
+	h := sha256.New()
+	id, err := hashFile(a.deps[0].target)
+	if err != nil {
+		return cacheID{}, false
+	}
+	fmt.Fprintf(h, "testbin %x\n", id)
+	for _, arg := range testArgs {
+		fmt.Fprintf(h, "arg %q\n", arg)
+	}
+	fmt.Fprintf(h, "dir %s\n", cmd.Dir)
+	// Streamed output is recorded in a different form; see testOutputRecorder.
+	fmt.Fprintf(h, "stream %v\n", testStreamOutput)
+	env := append([]string(nil), cmd.Env...)
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintf(h, "env %q\n", kv)
+	}
+
+	// Tests commonly read their inputs from testdata.
+	testdata := filepath.Join(a.p.Dir, "testdata")
+	err = filepath.Walk(testdata, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path == testdata && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		id, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(testdata, path)
+		fmt.Fprintf(h, "testdata %q %x\n", filepath.ToSlash(rel), id)
+		return nil
+	})
+	if err != nil {
+		return cacheID{}, false
+	}
+	var key cacheID
+	copy(key[:], h.Sum(nil))
+	return key, true
+}
+
+// Streams recorded by a testOutputRecorder.
+const (
+	testStdout = 'o'
+	testStderr = 'e'
+)
+
+// A testOutputRecorder records the output of a test binary whose output
+// is streamed, for the cache. Each write is recorded as the stream it went
+// to, its length in decimal and a newline, followed by the data, so that
+// replayTestOutput can write it back to the same stream in the same order.
+type testOutputRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// writer returns a writer that records writes to stream.
+func (r *testOutputRecorder) writer(stream byte) io.Writer {
+	return &testStreamWriter{r, stream}
+}
+
+type testStreamWriter struct {
+	r      *testOutputRecorder
+	stream byte
+}
+
+func (w *testStreamWriter) Write(p []byte) (int, error) {
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+	fmt.Fprintf(&w.r.buf, "%c%d\n", w.stream, len(p))
+	w.r.buf.Write(p)
+	return len(p), nil
+}
+
+// replayTestOutput writes output recorded by a testOutputRecorder
+// to stdout and stderr. It reports whether the recording was valid;
+// if not, it writes nothing.
+func replayTestOutput(data []byte, stdout, stderr io.Writer) bool {
+	type chunk struct {
+		w    io.Writer
+		data []byte
+	}
+	var chunks []chunk
+	for len(data) > 0 {
+		var w io.Writer
+		switch data[0] {
+		case testStdout:
+			w = stdout
+		case testStderr:
+			w = stderr
+		default:
+			return false
+		}
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return false
+		}
+		n, err := strconv.Atoi(string(data[1:i]))
+		if err != nil || n < 0 || n > len(data)-i-1 {
+			return false
+		}
+		chunks = append(chunks, chunk{w, data[i+1 : i+1+n]})
+		data = data[i+1+n:]
+	}
+	for _, c := range chunks {
+		c.w.Write(c.data)
+	}
+	return true
+}
+
 // coveragePercentage returns the coverage results (if enabled) for the
 // test. It uncovers the data by scanning the output from the test run.
 func coveragePercentage(out []byte) string {
@@ -1287,6 +1535,7 @@ func writeTestmain(out string, t *testFuncs) error {
 type testFuncs struct {
 	Tests       []testFunc
 	Benchmarks  []testFunc
+	FuzzTargets []testFunc
 	Examples    []testFunc
 	TestMain    *testFunc
 	Package     *Package
@@ -1365,6 +1614,13 @@ func (t *testFuncs) load(filename, pkg string, doImport, seen *bool) error {
 			}
 			t.Benchmarks = append(t.Benchmarks, testFunc{pkg, name, ""})
 			*doImport, *seen = true, true
+		case isTest(name, "Fuzz"):
+			err := checkTestFunc(n, "F")
+			if err != nil {
+				return err
+			}
+			t.FuzzTargets = append(t.FuzzTargets, testFunc{pkg, name, ""})
+			*doImport, *seen = true, true
 		}
 	}
 	ex := doc.Examples(f)
@@ -1403,8 +1659,8 @@ import (
 {{if not .TestMain}}
 	"os"
 {{end}}
-	"regexp"
 	"testing"
+	"testing/internal/testdeps"
 
 {{if .ImportTest}}
 	{{if .NeedTest}}_test{{else}}_{{end}} {{.Package.ImportPath | printf "%q"}}
@@ -1433,26 +1689,18 @@ var benchmarks = []testing.InternalBenchmark{
 {{end}}
 }
 
+var fuzzTargets = []testing.InternalFuzzTarget{
+{{range .FuzzTargets}}
+	{"{{.Name}}", {{.Package}}.{{.Name}}},
+{{end}}
+}
+
 var examples = []testing.InternalExample{
 {{range .Examples}}
 	{"{{.Name}}", {{.Package}}.{{.Name}}, {{.Output | printf "%q"}}},
 {{end}}
 }
 
-var matchPat string
-var matchRe *regexp.Regexp
-
-func matchString(pat, str string) (result bool, err error) {
-	if matchRe == nil || matchPat != pat {
-		matchPat = pat
-		matchRe, err = regexp.Compile(matchPat)
-		if err != nil {
-			return
-		}
-	}
-	return matchRe.MatchString(str), nil
-}
-
 {{if .CoverEnabled}}
 
 // Only updated by init functions, so no need for atomicity.
@@ -1501,7 +1749,7 @@ func main() {
 		CoveredPackages: {{printf "%q" .Covered}},
 	})
 {{end}}
-	m := testing.MainStart(matchString, tests, benchmarks, examples)
+	m := testing.MainStart(testdeps.TestDeps{}, tests, benchmarks, fuzzTargets, examples)
 {{with .TestMain}}
 	{{.Package}}.{{.Name}}(m)
 {{else}}
@@ -46,10 +46,15 @@ var testFlagDefn = []*testFlagSpec{
 	{name: "coverprofile", passToTest: true},
 	{name: "cpu", passToTest: true},
 	{name: "cpuprofile", passToTest: true},
+	{name: "fuzz", passToTest: true},
+	{name: "fuzzminimizetime", passToTest: true},
+	{name: "fuzztime", passToTest: true},
 	{name: "memprofile", passToTest: true},
 	{name: "memprofilerate", passToTest: true},
 	{name: "blockprofile", passToTest: true},
 	{name: "blockprofilerate", passToTest: true},
+	{name: "mutexprofile", passToTest: true},
+	{name: "mutexprofilefraction", passToTest: true},
 	{name: "outputdir", passToTest: true},
 	{name: "parallel", passToTest: true},
 	{name: "run", passToTest: true},
@@ -147,9 +152,11 @@ func testFlags(args []string) (packageNames, passToTest []string) {
 			case "bench":
 				// record that we saw the flag; don't care about the value
 				testBench = true
+			case "fuzz":
+				testFuzz = value
 			case "timeout":
 				testTimeout = value
-			case "blockprofile", "cpuprofile", "memprofile", "trace":
+			case "blockprofile", "cpuprofile", "memprofile", "mutexprofile", "trace":
 				testProfile = true
 				testNeedBinary = true
 			case "coverpkg":
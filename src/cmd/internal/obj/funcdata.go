@@ -42,7 +42,17 @@ package obj
 // This value is generated by the compiler, assembler, or linker.
 const (
 	PCDATA_StackMapIndex       = 0
+	PCDATA_UnsafePoint         = 1
 	FUNCDATA_ArgsPointerMaps   = 0
 	FUNCDATA_LocalsPointerMaps = 1
 	ArgsSizeUnknown            = -0x80000000
 )
+
+// PCDATA_UnsafePoint values. Compiled Go functions are safe points
+// for asynchronous preemption except where marked unsafe. Code
+// without a PCDATA_UnsafePoint value, such as assembly functions
+// and function prologues, is never preempted asynchronously.
+const (
+	PCDATA_UnsafePointSafe   = 0
+	PCDATA_UnsafePointUnsafe = -2
+)
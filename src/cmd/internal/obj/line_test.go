@@ -6,6 +6,7 @@ package obj
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 )
 
@@ -49,3 +50,26 @@ func TestLineHist(t *testing.T) {
 		}
 	}
 }
+
+func TestLineHistAbsFile(t *testing.T) {
+	h := LineHist{
+		TrimPathPrefix: "/work",
+		GOROOT:         "/goroot",
+		GOPATH:         "/gopath",
+	}
+	for _, tt := range []struct {
+		file, abs string
+	}{
+		{"/work/p/_test/_testmain.go", "p/_test/_testmain.go"},
+		{"/goroot/src/fmt/print.go", "$GOROOT/src/fmt/print.go"},
+		{"/gopath/src/p/p.go", "$GOPATH/src/p/p.go"},
+		{"/gopath2/src/p/p.go", "/gopath2/src/p/p.go"},
+		{"/elsewhere/p.go", "/elsewhere/p.go"},
+	} {
+		var stk LineStack
+		h.setFile(&stk, tt.file)
+		if want := filepath.Clean(tt.abs); stk.AbsFile != want {
+			t.Errorf("AbsFile for %s = %q, want %q", tt.file, stk.AbsFile, want)
+		}
+	}
+}
@@ -32,6 +32,7 @@ type LineHist struct {
 	PrintFilenameOnly bool        // ignore path when pretty-printing a line; internal use only
 	GOROOT            string      // current GOROOT
 	GOROOT_FINAL      string      // target GOROOT
+	GOPATH            string      // GOPATH directory to record as literal $GOPATH
 }
 
 // A LineStack is an entry in the recorded line history.
@@ -75,7 +76,8 @@ func (h *LineHist) setFile(stk *LineStack, file string) {
 		abs = filepath.Join(h.Dir, file)
 	}
 
-	// Remove leading TrimPathPrefix, or else rewrite $GOROOT to literal $GOROOT.
+	// Remove leading TrimPathPrefix, or else rewrite $GOROOT to literal $GOROOT
+	// and the GOPATH directory to literal $GOPATH.
 	if h.TrimPathPrefix != "" && hasPathPrefix(abs, h.TrimPathPrefix) {
 		if abs == h.TrimPathPrefix {
 			abs = ""
@@ -84,6 +86,8 @@ func (h *LineHist) setFile(stk *LineStack, file string) {
 		}
 	} else if hasPathPrefix(abs, h.GOROOT) {
 		abs = "$GOROOT" + abs[len(h.GOROOT):]
+	} else if h.GOPATH != "" && hasPathPrefix(abs, h.GOPATH) {
+		abs = "$GOPATH" + abs[len(h.GOPATH):]
 	}
 	if abs == "" {
 		abs = "??"
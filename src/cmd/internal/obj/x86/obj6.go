@@ -872,6 +872,15 @@ func preprocess(ctxt *obj.Link, cursym *obj.LSym) {
 			p.Spadj = -2
 			continue
 
+		case AADJSP:
+			if p.Spadj == 0 {
+				// Explicit ADJSP in the function body,
+				// not one from the prologue.
+				deltasp += int32(p.From.Offset)
+				p.Spadj = int32(p.From.Offset)
+			}
+			continue
+
 		case obj.ARET:
 			break
 		}
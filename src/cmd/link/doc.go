@@ -63,6 +63,11 @@ Flags:
 		Ignore version mismatch in the linked archives.
 	-g
 		Disable Go package data checks.
+	-gopath dir=root
+		Expand a leading $GOPATH, recorded by the compiler's -gopath flag,
+		in the names of source files in directory dir to the GOPATH
+		directory root. The option may be repeated, once per package
+		directory.
 	-installsuffix suffix
 		Look for packages in $GOROOT/pkg/$GOOS_$GOARCH_suffix
 		instead of $GOROOT/pkg/$GOOS_$GOARCH.
@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // funcpctab writes to dst a pc-value table mapping the code in func to the values
@@ -152,7 +153,7 @@ func renumberfiles(ctxt *Link, files []*LSym, d *Pcdata) {
 			f.Value = int64(ctxt.Nhistfile)
 			f.Type = obj.SFILEPATH
 			f.Next = ctxt.Filesyms
-			f.Name = expandGoroot(f.Name)
+			f.Name = expandGopath(expandGoroot(f.Name))
 			ctxt.Filesyms = f
 		}
 	}
@@ -391,6 +392,40 @@ func expandGoroot(s string) string {
 	return s
 }
 
+// gopathDirs maps the directory of a source file recorded as
+// $GOPATH/dir/file to the GOPATH directory holding it.
+// The go command sets it with the -gopath flag.
+var gopathDirs = make(map[string]string)
+
+func addgopath(arg string) {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		Exitf("-gopath flag requires argument of the form dir=root")
+	}
+	gopathDirs[filepath.ToSlash(arg[:i])] = arg[i+1:]
+}
+
+// expandGopath expands a leading $GOPATH, which the compiler records in
+// place of the GOPATH directory holding a source file, to the directory
+// given for the file's directory by the -gopath flag. Names with no such
+// directory are left as they are.
+func expandGopath(s string) string {
+	const n = len("$GOPATH")
+	if len(s) < n+1 || s[:n] != "$GOPATH" || (s[n] != '/' && s[n] != '\\') {
+		return s
+	}
+	rel := filepath.ToSlash(s[n+1:])
+	i := strings.LastIndex(rel, "/")
+	if i < 0 {
+		return s
+	}
+	root, ok := gopathDirs[rel[:i]]
+	if !ok {
+		return s
+	}
+	return filepath.ToSlash(filepath.Join(root, rel))
+}
+
 const (
 	BUCKETSIZE    = 256 * MINFUNC
 	SUBBUCKETS    = 16
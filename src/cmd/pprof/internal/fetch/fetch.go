@@ -17,7 +17,7 @@ import (
 	"time"
 
 	"cmd/pprof/internal/plugin"
-	"cmd/pprof/internal/profile"
+	"internal/pprof/profile"
 )
 
 // FetchProfile reads from a data source (network, file) and generates a
@@ -19,7 +19,7 @@ import (
 	"time"
 
 	"cmd/pprof/internal/plugin"
-	"cmd/pprof/internal/profile"
+	"internal/pprof/profile"
 )
 
 // Generate generates a report as directed by the Report.
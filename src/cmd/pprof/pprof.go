@@ -18,9 +18,9 @@ import (
 	"cmd/pprof/internal/driver"
 	"cmd/pprof/internal/fetch"
 	"cmd/pprof/internal/plugin"
-	"cmd/pprof/internal/profile"
 	"cmd/pprof/internal/symbolizer"
 	"cmd/pprof/internal/symbolz"
+	"internal/pprof/profile"
 )
 
 func main() {
@@ -0,0 +1,569 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Profiles of user annotations: tasks and regions.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"internal/trace"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	http.HandleFunc("/usertasks", httpUserTasks)
+	http.HandleFunc("/usertask", httpUserTask)
+	http.HandleFunc("/userregions", httpUserRegions)
+	http.HandleFunc("/userregion", httpUserRegion)
+}
+
+// taskDesc describes a task created by runtime/trace.NewTask.
+type taskDesc struct {
+	ID       uint64
+	Name     string
+	Parent   uint64
+	Start    int64 // creation time
+	End      int64 // time of the first End, or end of the trace if not ended
+	Complete bool  // whether the task ended before tracing stopped
+
+	// Breakdown of the execution of the task's goroutines in
+	// the outermost regions of the task.
+	trace.GExecutionStat
+	Goroutines map[uint64]bool // goroutines with regions of the task
+	Logs       []*trace.Event  // UserLog events of the task
+	Regions    []*regionDesc   // regions of the task
+}
+
+// Duration returns the latency of the task.
+func (t *taskDesc) Duration() time.Duration {
+	return time.Duration(t.End - t.Start)
+}
+
+// regionDesc describes a region of a goroutine.
+type regionDesc struct {
+	*trace.UserRegionDesc
+	G         uint64
+	StartTime int64 // start time, or the goroutine's start if not in the trace
+	EndTime   int64 // end time, or the end of the trace if not ended
+}
+
+// Duration returns the duration of the region.
+func (r *regionDesc) Duration() time.Duration {
+	return time.Duration(r.EndTime - r.StartTime)
+}
+
+// Complete reports whether both the start and the end of the region are in the trace.
+func (r *regionDesc) Complete() bool {
+	return r.Start != nil && r.End != nil && r.End.Type == trace.EvUserRegion
+}
+
+var (
+	annotationsInit sync.Once
+	tasks           map[uint64]*taskDesc     // tasks created during tracing by id
+	regions         map[string][]*regionDesc // regions by type
+)
+
+// analyzeAnnotations collects the tasks and regions of the trace
+// and stores them in tasks and regions.
+func analyzeAnnotations(events []*trace.Event) {
+	annotationsInit.Do(func() {
+		analyzeGoroutines(events)
+		tasks = make(map[uint64]*taskDesc)
+		regions = make(map[string][]*regionDesc)
+
+		var lastTs int64
+		for _, ev := range events {
+			lastTs = ev.Ts
+			switch ev.Type {
+			case trace.EvUserTaskCreate:
+				t := &taskDesc{
+					ID:         ev.Args[0],
+					Parent:     ev.Args[1],
+					Name:       ev.SArgs[0],
+					Start:      ev.Ts,
+					Goroutines: make(map[uint64]bool),
+				}
+				if ev.Link != nil {
+					t.End = ev.Link.Ts
+					t.Complete = true
+				}
+				tasks[t.ID] = t
+			case trace.EvUserLog:
+				if t := tasks[ev.Args[0]]; t != nil {
+					t.Logs = append(t.Logs, ev)
+				}
+			}
+		}
+		for _, t := range tasks {
+			if !t.Complete {
+				t.End = lastTs
+			}
+		}
+
+		for _, g := range gs {
+			for i, r := range g.Regions {
+				rd := &regionDesc{UserRegionDesc: r, G: g.ID, StartTime: g.StartTime, EndTime: lastTs}
+				if r.Start != nil {
+					rd.StartTime = r.Start.Ts
+				}
+				if r.End != nil {
+					rd.EndTime = r.End.Ts
+				}
+				regions[r.Name] = append(regions[r.Name], rd)
+
+				t := tasks[r.TaskID]
+				if t == nil {
+					continue
+				}
+				t.Regions = append(t.Regions, rd)
+				t.Goroutines[g.ID] = true
+				if !nestedInTask(g.Regions[:i], r) {
+					t.GExecutionStat = addStat(t.GExecutionStat, r.GExecutionStat)
+				}
+			}
+		}
+		for _, t := range tasks {
+			sort.Sort(regionsByStart(t.Regions))
+		}
+	})
+}
+
+// nestedInTask reports whether region r is nested in one of the
+// regions rs of the same goroutine and task that started before r.
+func nestedInTask(rs []*trace.UserRegionDesc, r *trace.UserRegionDesc) bool {
+	for _, r1 := range rs {
+		if r1.TaskID != r.TaskID {
+			continue
+		}
+		if r1.End == nil || r.End != nil && r1.End.Ts >= r.End.Ts {
+			return true
+		}
+	}
+	return false
+}
+
+func addStat(s, v trace.GExecutionStat) trace.GExecutionStat {
+	s.ExecTime += v.ExecTime
+	s.SchedWaitTime += v.SchedWaitTime
+	s.IOTime += v.IOTime
+	s.BlockTime += v.BlockTime
+	s.SyscallTime += v.SyscallTime
+	s.GCTime += v.GCTime
+	s.SweepTime += v.SweepTime
+	s.TotalTime += v.TotalTime
+	return s
+}
+
+type regionsByStart []*regionDesc
+
+func (l regionsByStart) Len() int {
+	return len(l)
+}
+
+func (l regionsByStart) Less(i, j int) bool {
+	return l[i].StartTime < l[j].StartTime
+}
+
+func (l regionsByStart) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+type tasksByDuration []*taskDesc
+
+func (l tasksByDuration) Len() int {
+	return len(l)
+}
+
+func (l tasksByDuration) Less(i, j int) bool {
+	return l[i].Duration() > l[j].Duration()
+}
+
+func (l tasksByDuration) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+type regionsByDuration []*regionDesc
+
+func (l regionsByDuration) Len() int {
+	return len(l)
+}
+
+func (l regionsByDuration) Less(i, j int) bool {
+	return l[i].Duration() > l[j].Duration()
+}
+
+func (l regionsByDuration) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// durationHistogram is a histogram of durations.
+// Bucket i counts the durations in [2^i, 2^(i+1)) nanoseconds;
+// bucket 0 also counts durations below 1ns.
+type durationHistogram struct {
+	Count   int
+	Buckets []int
+}
+
+func (h *durationHistogram) add(d time.Duration) {
+	b := 0
+	for ; d >= 2; d >>= 1 {
+		b++
+	}
+	for len(h.Buckets) <= b {
+		h.Buckets = append(h.Buckets, 0)
+	}
+	h.Buckets[b]++
+	h.Count++
+}
+
+// histogramRow is a row of the HTML rendering of a durationHistogram.
+type histogramRow struct {
+	Min, Max time.Duration
+	Count    int
+	Width    int // relative width of the bar, in pixels
+	URL      string
+}
+
+// rows returns the rows of the histogram from its first to its last
+// non-empty bucket. url returns the URL of the list of the items of
+// a bucket.
+func (h *durationHistogram) rows(url func(min, max time.Duration) string) []histogramRow {
+	maxCount := 0
+	for _, c := range h.Buckets {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+	var rows []histogramRow
+	for i, c := range h.Buckets {
+		if c == 0 && rows == nil {
+			continue
+		}
+		min, max := time.Duration(1)<<uint(i), time.Duration(1)<<uint(i+1)
+		if i == 0 {
+			min = 0
+		}
+		rows = append(rows, histogramRow{
+			Min:   min,
+			Max:   max,
+			Count: c,
+			Width: c * 300 / maxCount,
+			URL:   url(min, max),
+		})
+	}
+	for len(rows) > 0 && rows[len(rows)-1].Count == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+// parseLatencyRange parses the latmin and latmax parameters of r.
+// A missing latmax is unbounded.
+func parseLatencyRange(r *http.Request) (min, max time.Duration, err error) {
+	max = 1<<63 - 1
+	if s := r.FormValue("latmin"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse latmin parameter '%v': %v", s, err)
+		}
+		min = time.Duration(v)
+	}
+	if s := r.FormValue("latmax"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse latmax parameter '%v': %v", s, err)
+		}
+		max = time.Duration(v)
+	}
+	return min, max, nil
+}
+
+// typeSummary summarizes the tasks or regions of one type.
+type typeSummary struct {
+	Name       string
+	Count      int // number of complete tasks or regions
+	Incomplete int // number of tasks or regions whose start or end is not in the trace
+	Histogram  []histogramRow
+}
+
+type typeSummaryList []typeSummary
+
+func (l typeSummaryList) Len() int {
+	return len(l)
+}
+
+func (l typeSummaryList) Less(i, j int) bool {
+	return l[i].Name < l[j].Name
+}
+
+func (l typeSummaryList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// httpUserTasks serves the latency histograms of the task types.
+func httpUserTasks(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	analyzeAnnotations(events)
+	hists := make(map[string]*durationHistogram)
+	incomplete := make(map[string]int)
+	for _, t := range tasks {
+		h := hists[t.Name]
+		if h == nil {
+			h = new(durationHistogram)
+			hists[t.Name] = h
+		}
+		if !t.Complete {
+			incomplete[t.Name]++
+			continue
+		}
+		h.add(t.Duration())
+	}
+	var list typeSummaryList
+	for name, h := range hists {
+		name := name
+		list = append(list, typeSummary{
+			Name:       name,
+			Count:      h.Count,
+			Incomplete: incomplete[name],
+			Histogram: h.rows(func(min, max time.Duration) string {
+				return fmt.Sprintf("/usertask?type=%s&latmin=%d&latmax=%d", template.URLQueryEscaper(name), int64(min), int64(max))
+			}),
+		})
+	}
+	sort.Sort(list)
+	err = templUserTypes.Execute(w, struct {
+		Kind  string
+		Page  string
+		Types typeSummaryList
+	}{"Tasks", "usertask", list})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// httpUserRegions serves the duration histograms of the region types.
+func httpUserRegions(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	analyzeAnnotations(events)
+	var list typeSummaryList
+	for name, rs := range regions {
+		name := name
+		var h durationHistogram
+		incomplete := 0
+		for _, r := range rs {
+			if !r.Complete() {
+				incomplete++
+				continue
+			}
+			h.add(r.Duration())
+		}
+		list = append(list, typeSummary{
+			Name:       name,
+			Count:      h.Count,
+			Incomplete: incomplete,
+			Histogram: h.rows(func(min, max time.Duration) string {
+				return fmt.Sprintf("/userregion?type=%s&latmin=%d&latmax=%d", template.URLQueryEscaper(name), int64(min), int64(max))
+			}),
+		})
+	}
+	sort.Sort(list)
+	err = templUserTypes.Execute(w, struct {
+		Kind  string
+		Page  string
+		Types typeSummaryList
+	}{"Regions", "userregion", list})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+var templUserTypes = template.Must(template.New("").Parse(`
+<html>
+<style>
+.bar { background: #4285f4; height: 1em; display: inline-block; }
+td.count { text-align: right; }
+</style>
+<body>
+<h2>{{.Kind}}</h2>
+{{range .Types}}
+  <h3><a href="/{{$.Page}}?type={{.Name}}">{{.Name}}</a></h3>
+  Count: {{.Count}}{{if .Incomplete}}, incomplete (not in histogram): {{.Incomplete}}{{end}}<br>
+  <table>
+  {{range .Histogram}}
+    <tr>
+      <td> [{{.Min}}, {{.Max}}) </td>
+      <td class="count"> <a href="{{.URL}}">{{.Count}}</a> </td>
+      <td> <div class="bar" style="width: {{.Width}}px"></div> </td>
+    </tr>
+  {{end}}
+  </table>
+{{end}}
+</body>
+</html>
+`))
+
+// httpUserTask serves the tasks of one type with the given latencies.
+func httpUserTask(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	min, max, err := parseLatencyRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	analyzeAnnotations(events)
+	name := r.FormValue("type")
+	var list tasksByDuration
+	for _, t := range tasks {
+		if t.Name != name {
+			continue
+		}
+		if d := t.Duration(); r.FormValue("latmin") != "" && (!t.Complete || d < min || d >= max) {
+			continue
+		}
+		list = append(list, t)
+	}
+	sort.Sort(list)
+	err = templUserTask.Execute(w, struct {
+		Name  string
+		Tasks tasksByDuration
+	}{name, list})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+var templUserTask = template.Must(template.New("").Parse(`
+<html>
+<body>
+<h2>Tasks: {{.Name}}</h2>
+Execution times are the sums over the outermost regions of the task.
+<table border="1" sortable="1">
+<tr>
+<th> Task </th>
+<th> Start, ns </th>
+<th> Latency, ns </th>
+<th> Execution time, ns </th>
+<th> Network wait time, ns </th>
+<th> Sync block time, ns </th>
+<th> Blocking syscall time, ns </th>
+<th> Scheduler wait time, ns </th>
+<th> GC sweeping time, ns </th>
+<th> GC pause time, ns </th>
+<th> Goroutines </th>
+<th> Regions and logs </th>
+</tr>
+{{range .Tasks}}
+  <tr>
+    <td> {{.ID}}{{if .Parent}} (subtask of {{.Parent}}){{end}} </td>
+    <td> {{.Start}} </td>
+    <td> {{.Duration.Nanoseconds}}{{if not .Complete}} (not ended){{end}} </td>
+    <td> {{.ExecTime}} </td>
+    <td> {{.IOTime}} </td>
+    <td> {{.BlockTime}} </td>
+    <td> {{.SyscallTime}} </td>
+    <td> {{.SchedWaitTime}} </td>
+    <td> {{.SweepTime}} </td>
+    <td> {{.GCTime}} </td>
+    <td> {{range $g, $_ := .Goroutines}}<a href="/trace?goid={{$g}}">{{$g}}</a> {{end}} </td>
+    <td>
+      {{range .Regions}}{{.StartTime}}: region {{.Name}} in goroutine {{.G}} for {{.Duration}}<br>{{end}}
+      {{range .Logs}}{{.Ts}}: log {{index .SArgs 0}}: {{index .SArgs 1}}<br>{{end}}
+    </td>
+  </tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// httpUserRegion serves the regions of one type with the given durations.
+func httpUserRegion(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	min, max, err := parseLatencyRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	analyzeAnnotations(events)
+	name := r.FormValue("type")
+	var list regionsByDuration
+	for _, rd := range regions[name] {
+		if d := rd.Duration(); r.FormValue("latmin") != "" && (!rd.Complete() || d < min || d >= max) {
+			continue
+		}
+		list = append(list, rd)
+	}
+	sort.Sort(list)
+	err = templUserRegion.Execute(w, struct {
+		Name    string
+		Regions regionsByDuration
+	}{name, list})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+var templUserRegion = template.Must(template.New("").Parse(`
+<html>
+<body>
+<h2>Regions: {{.Name}}</h2>
+<table border="1" sortable="1">
+<tr>
+<th> Goroutine </th>
+<th> Task </th>
+<th> Start, ns </th>
+<th> Total time, ns </th>
+<th> Execution time, ns </th>
+<th> Network wait time, ns </th>
+<th> Sync block time, ns </th>
+<th> Blocking syscall time, ns </th>
+<th> Scheduler wait time, ns </th>
+<th> GC sweeping time, ns </th>
+<th> GC pause time, ns </th>
+</tr>
+{{range .Regions}}
+  <tr>
+    <td> <a href="/trace?goid={{.G}}">{{.G}}</a> </td>
+    <td> {{if .TaskID}}{{.TaskID}}{{end}} </td>
+    <td> {{.StartTime}}{{if not .Complete}} (incomplete){{end}} </td>
+    <td> {{.TotalTime}} </td>
+    <td> {{.ExecTime}} </td>
+    <td> {{.IOTime}} </td>
+    <td> {{.BlockTime}} </td>
+    <td> {{.SyscallTime}} </td>
+    <td> {{.SchedWaitTime}} </td>
+    <td> {{.SweepTime}} </td>
+    <td> {{.GCTime}} </td>
+  </tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,188 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"internal/trace"
+	rtrace "runtime/trace"
+	"sync"
+	"testing"
+	"time"
+)
+
+// traceProgram traces f and analyzes the annotations of the trace.
+// The analysis runs once per process, so only one test may call it.
+func traceProgram(t *testing.T, f func()) {
+	buf := new(bytes.Buffer)
+	if err := rtrace.Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	f()
+	rtrace.Stop()
+
+	events, err := trace.Parse(buf)
+	if err == trace.ErrTimeOrder {
+		t.Skipf("skipping trace: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	analyzeAnnotations(events)
+}
+
+func TestAnalyzeAnnotations(t *testing.T) {
+	const sleep = 10 * time.Millisecond
+	traceProgram(t, func() {
+		ctx, task := rtrace.NewTask(context.Background(), "task0")
+		rtrace.WithRegion(ctx, "region0", func() {
+			time.Sleep(sleep)
+		})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtrace.WithRegion(ctx, "region1", func() {
+				rtrace.WithRegion(ctx, "region0", func() {
+					time.Sleep(sleep)
+				})
+			})
+		}()
+		wg.Wait()
+		rtrace.Log(ctx, "key0", "value0")
+		task.End()
+
+		rtrace.NewTask(context.Background(), "task1") // never ended
+	})
+
+	byName := make(map[string]*taskDesc)
+	for _, task := range tasks {
+		byName[task.Name] = task
+	}
+	task0 := byName["task0"]
+	if task0 == nil {
+		t.Fatalf("task0 not found in %v", tasks)
+	}
+	if !task0.Complete {
+		t.Errorf("task0 is not complete")
+	}
+	if d := task0.Duration(); d < 2*sleep {
+		t.Errorf("task0 duration is %v, want at least %v", d, 2*sleep)
+	}
+	if n := len(task0.Goroutines); n != 2 {
+		t.Errorf("task0 has %d goroutines, want 2", n)
+	}
+	if n := len(task0.Logs); n != 1 || task0.Logs[0].SArgs[0] != "key0" || task0.Logs[0].SArgs[1] != "value0" {
+		t.Errorf("task0 logs are %v, want one key0=value0 log", task0.Logs)
+	}
+	var names []string
+	for i, r := range task0.Regions {
+		names = append(names, r.Name)
+		if !r.Complete() {
+			t.Errorf("region %q of task0 is not complete", r.Name)
+		}
+		if i > 0 && r.StartTime < task0.Regions[i-1].StartTime {
+			t.Errorf("regions of task0 are not sorted by start time")
+		}
+	}
+	if len(names) != 3 || names[0] != "region0" || names[1] != "region1" || names[2] != "region0" {
+		t.Errorf("task0 regions are %v, want [region0 region1 region0]", names)
+	}
+
+	// The breakdown of task0 counts the outermost regions only,
+	// not the region0 nested in region1.
+	if len(task0.Regions) == 3 {
+		outer := task0.Regions[0].TotalTime + task0.Regions[1].TotalTime
+		if task0.TotalTime != outer {
+			t.Errorf("task0 total time is %d, want %d (outermost regions)", task0.TotalTime, outer)
+		}
+		if task0.TotalTime < int64(2*sleep) {
+			t.Errorf("task0 total time is %v, want at least %v", time.Duration(task0.TotalTime), 2*sleep)
+		}
+		if task0.BlockTime+task0.SchedWaitTime+task0.ExecTime+task0.GCTime+task0.SweepTime+task0.SyscallTime+task0.IOTime > task0.TotalTime {
+			t.Errorf("task0 breakdown %+v exceeds its total time", task0.GExecutionStat)
+		}
+	}
+
+	task1 := byName["task1"]
+	if task1 == nil {
+		t.Fatalf("task1 not found in %v", tasks)
+	}
+	if task1.Complete {
+		t.Errorf("task1 is complete, but was never ended")
+	}
+
+	// The region duration histograms are built from the regions by type.
+	for name, want := range map[string]int{"region0": 2, "region1": 1} {
+		rs := regions[name]
+		if len(rs) != want {
+			t.Errorf("got %d %s regions, want %d", len(rs), name, want)
+			continue
+		}
+		var h durationHistogram
+		for _, r := range rs {
+			h.add(r.Duration())
+		}
+		if h.Count != want {
+			t.Errorf("%s histogram count is %d, want %d", name, h.Count, want)
+		}
+		total := 0
+		for _, row := range h.rows(func(min, max time.Duration) string { return "" }) {
+			total += row.Count
+			if row.Max <= sleep {
+				if row.Count != 0 {
+					t.Errorf("%s histogram has %d regions in [%v, %v), want all at least %v", name, row.Count, row.Min, row.Max, sleep)
+				}
+			}
+		}
+		if total != want {
+			t.Errorf("%s histogram rows count %d regions, want %d", name, total, want)
+		}
+	}
+}
+
+func TestDurationHistogram(t *testing.T) {
+	var h durationHistogram
+	for _, d := range []time.Duration{0, 1, 3, 3, 100} {
+		h.add(d)
+	}
+	if h.Count != 5 {
+		t.Errorf("count is %d, want 5", h.Count)
+	}
+	type row struct {
+		min, max time.Duration
+		count    int
+		width    int
+	}
+	want := []row{
+		{0, 2, 2, 300},
+		{2, 4, 2, 300},
+		{4, 8, 0, 0},
+		{8, 16, 0, 0},
+		{16, 32, 0, 0},
+		{32, 64, 0, 0},
+		{64, 128, 1, 150},
+	}
+	got := h.rows(func(min, max time.Duration) string { return "" })
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Min != w.min || g.Max != w.max || g.Count != w.count || g.Width != w.width {
+			t.Errorf("row %d is [%v, %v) count %d width %d, want [%v, %v) count %d width %d",
+				i, g.Min, g.Max, g.Count, g.Width, w.min, w.max, w.count, w.width)
+		}
+	}
+
+	// Leading and trailing empty buckets are not rendered.
+	h = durationHistogram{}
+	h.add(5)
+	got = h.rows(func(min, max time.Duration) string { return "" })
+	if len(got) != 1 || got[0].Min != 4 || got[0].Max != 8 || got[0].Count != 1 {
+		t.Errorf("rows of a single 5ns duration are %+v, want one [4ns, 8ns) row", got)
+	}
+}
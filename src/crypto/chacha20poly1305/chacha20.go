@@ -0,0 +1,86 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+// chachaState holds the input of the ChaCha20 block function, as described
+// in RFC 7539, section 2.3, less the constant words.
+type chachaState struct {
+	key     [8]uint32
+	counter uint32
+	nonce   [3]uint32
+}
+
+// The constant words of the ChaCha20 state, "expand 32-byte k".
+const (
+	sigma0 = 0x61707865
+	sigma1 = 0x3320646e
+	sigma2 = 0x79622d32
+	sigma3 = 0x6b206574
+)
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d ^= a
+	d = d<<16 | d>>16
+	c += d
+	b ^= c
+	b = b<<12 | b>>20
+	a += b
+	d ^= a
+	d = d<<8 | d>>24
+	c += d
+	b ^= c
+	b = b<<7 | b>>25
+	return a, b, c, d
+}
+
+// block writes the key stream block for the current counter to out.
+func (s *chachaState) block(out *[64]byte) {
+	in := [16]uint32{
+		sigma0, sigma1, sigma2, sigma3,
+		s.key[0], s.key[1], s.key[2], s.key[3],
+		s.key[4], s.key[5], s.key[6], s.key[7],
+		s.counter, s.nonce[0], s.nonce[1], s.nonce[2],
+	}
+	x := in
+
+	for i := 0; i < 10; i++ {
+		// Column rounds.
+		x[0], x[4], x[8], x[12] = quarterRound(x[0], x[4], x[8], x[12])
+		x[1], x[5], x[9], x[13] = quarterRound(x[1], x[5], x[9], x[13])
+		x[2], x[6], x[10], x[14] = quarterRound(x[2], x[6], x[10], x[14])
+		x[3], x[7], x[11], x[15] = quarterRound(x[3], x[7], x[11], x[15])
+		// Diagonal rounds.
+		x[0], x[5], x[10], x[15] = quarterRound(x[0], x[5], x[10], x[15])
+		x[1], x[6], x[11], x[12] = quarterRound(x[1], x[6], x[11], x[12])
+		x[2], x[7], x[8], x[13] = quarterRound(x[2], x[7], x[8], x[13])
+		x[3], x[4], x[9], x[14] = quarterRound(x[3], x[4], x[9], x[14])
+	}
+
+	for i := range x {
+		putUint32(out[4*i:], x[i]+in[i])
+	}
+}
+
+// xorKeyStream XORs src with the key stream, starting at the current
+// counter, and writes the result to dst. dst and src may overlap entirely
+// or not at all.
+func (s *chachaState) xorKeyStream(dst, src []byte) {
+	var buf [64]byte
+	for len(src) > 0 {
+		s.block(&buf)
+		s.counter++
+
+		n := len(src)
+		if n > len(buf) {
+			n = len(buf)
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ buf[i]
+		}
+		dst = dst[n:]
+		src = src[n:]
+	}
+}
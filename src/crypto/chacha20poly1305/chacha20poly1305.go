@@ -0,0 +1,166 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chacha20poly1305 implements the ChaCha20-Poly1305 AEAD as specified
+// in RFC 7539.
+//
+// ChaCha20-Poly1305 is fast in software, which makes it a good choice on
+// platforms without hardware support for AES.
+package chacha20poly1305
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	// KeySize is the size of the key used by this AEAD, in bytes.
+	KeySize = 32
+	// NonceSize is the size of the nonce used with this AEAD, in bytes.
+	NonceSize = 12
+	// Overhead is the size of the Poly1305 authentication tag, and the
+	// difference between a ciphertext length and its plaintext.
+	Overhead = 16
+)
+
+type chacha20poly1305 struct {
+	key [8]uint32
+}
+
+// New returns a ChaCha20-Poly1305 AEAD that uses the given 256-bit key.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	c := new(chacha20poly1305)
+	for i := range c.key {
+		c.key[i] = getUint32(key[4*i:])
+	}
+	return c, nil
+}
+
+func (c *chacha20poly1305) NonceSize() int {
+	return NonceSize
+}
+
+func (c *chacha20poly1305) Overhead() int {
+	return Overhead
+}
+
+func (c *chacha20poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: bad nonce length passed to Seal")
+	}
+	if uint64(len(plaintext)) > (1<<38)-64 {
+		panic("chacha20poly1305: plaintext too large")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+Overhead)
+
+	s, polyKey := c.newState(nonce)
+	s.xorKeyStream(out, plaintext)
+	auth(out[len(plaintext):], polyKey, out[:len(plaintext)], additionalData)
+
+	return ret
+}
+
+var errOpen = errors.New("chacha20poly1305: message authentication failed")
+
+func (c *chacha20poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < Overhead {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > (1<<38)-48 {
+		panic("chacha20poly1305: ciphertext too large")
+	}
+
+	tag := ciphertext[len(ciphertext)-Overhead:]
+	ciphertext = ciphertext[:len(ciphertext)-Overhead]
+
+	s, polyKey := c.newState(nonce)
+	var expectedTag [Overhead]byte
+	auth(expectedTag[:], polyKey, ciphertext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+
+	if subtle.ConstantTimeCompare(expectedTag[:], tag) != 1 {
+		// Clear dst like crypto/cipher's GCM does, so that callers
+		// see the same behaviour from every AEAD.
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+
+	s.xorKeyStream(out, ciphertext)
+
+	return ret, nil
+}
+
+// newState returns the ChaCha20 state for the given nonce, positioned for
+// encryption, and the one-time Poly1305 key, which is taken from the first
+// key stream block. See RFC 7539, section 2.6.
+func (c *chacha20poly1305) newState(nonce []byte) (s *chachaState, polyKey []byte) {
+	s = &chachaState{key: c.key}
+	s.nonce[0] = getUint32(nonce[0:])
+	s.nonce[1] = getUint32(nonce[4:])
+	s.nonce[2] = getUint32(nonce[8:])
+
+	var block [64]byte
+	s.block(&block)
+	s.counter++
+	return s, block[:32]
+}
+
+// auth computes the Poly1305 tag of ciphertext and additionalData, as laid
+// out in RFC 7539, section 2.8, and writes it to out.
+func auth(out, polyKey, ciphertext, additionalData []byte) {
+	var lengths [16]byte
+	putUint64(lengths[0:], uint64(len(additionalData)))
+	putUint64(lengths[8:], uint64(len(ciphertext)))
+
+	m := newPoly1305(polyKey)
+	m.writePadded(additionalData)
+	m.writePadded(ciphertext)
+	m.writePadded(lengths[:])
+
+	var tag [Overhead]byte
+	m.sum(&tag)
+	copy(out, tag[:])
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes. If the
+// original slice has sufficient capacity then no allocation is performed.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func putUint64(b []byte, v uint64) {
+	putUint32(b, uint32(v))
+	putUint32(b[4:], uint32(v>>32))
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The test vector from RFC 7539, section 2.3.2.
+func TestChaChaBlock(t *testing.T) {
+	key := fromHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := fromHex("000000090000004a00000000")
+	want := fromHex("10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e")
+
+	s := &chachaState{counter: 1}
+	for i := range s.key {
+		s.key[i] = getUint32(key[4*i:])
+	}
+	for i := range s.nonce {
+		s.nonce[i] = getUint32(nonce[4*i:])
+	}
+	var out [64]byte
+	s.block(&out)
+	if !bytes.Equal(out[:], want) {
+		t.Errorf("got %x, want %x", out, want)
+	}
+}
+
+var chacha20Poly1305Tests = []struct {
+	key, nonce, plaintext, aad, out string
+}{
+	// RFC 7539, section 2.8.2.
+	{
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"4c616469657320616e642047656e746c656d656e206f662074686520636c617373206f66202739393a204966204920636f756c64206f6666657220796f75206f6e6c79206f6e652074697020666f7220746865206675747572652c2073756e73637265656e20776f756c642062652069742e",
+		"50515253c0c1c2c3c4c5c6c7",
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b61161ae10b594f09e26a7e902ecbd0600691",
+	},
+	// RFC 7539, appendix A.5.
+	{
+		"1c9240a5eb55d38af333888604f6b5f0473917c1402b80099dca5cbc207075c0",
+		"000000000102030405060708",
+		"496e7465726e65742d4472616674732061726520647261667420646f63756d656e74732076616c696420666f722061206d6178696d756d206f6620736978206d6f6e74687320616e64206d617920626520757064617465642c207265706c616365642c206f72206f62736f6c65746564206279206f7468657220646f63756d656e747320617420616e792074696d652e20497420697320696e617070726f70726961746520746f2075736520496e7465726e65742d447261667473206173207265666572656e6365206d6174657269616c206f7220746f2063697465207468656d206f74686572207468616e206173202fe2809c776f726b20696e2070726f67726573732e2fe2809d",
+		"f33388860000000000004e91",
+		"64a0861575861af460f062c79be643bd5e805cfd345cf389f108670ac76c8cb24c6cfc18755d43eea09ee94e382d26b0bdb7b73c321b0100d4f03b7f355894cf332f830e710b97ce98c8a84abd0b948114ad176e008d33bd60f982b1ff37c8559797a06ef4f0ef61c186324e2b3506383606907b6a7c02b0f9f6157b53c867e4b9166c767b804d46a59b5216cde7a4e99040c5a40433225ee282a1b0a06c523eaf4534d7f83fa1155b0047718cbc546a0d072b04b3564eea1b422273f548271a0bb2316053fa76991955ebd63159434ecebb4e466dae5a1073a6727627097a1049e617d91d361094fa68f0ff77987130305beaba2eda04df997b714d6c6f2c29a6ad5cb4022b02709beead9d67890cbb22392336fea1851f38",
+	},
+	// Empty plaintext and additional data.
+	{
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"",
+		"",
+		"a0784d7a4716f3feb4f64e7f4b39bf04",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for i, test := range chacha20Poly1305Tests {
+		key := fromHex(test.key)
+		nonce := fromHex(test.nonce)
+		plaintext := fromHex(test.plaintext)
+		aad := fromHex(test.aad)
+		want := fromHex(test.out)
+
+		aead, err := New(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ct := aead.Seal(nil, nonce, plaintext, aad)
+		if !bytes.Equal(ct, want) {
+			t.Errorf("#%d: got %x, want %x", i, ct, want)
+			continue
+		}
+
+		pt, err := aead.Open(nil, nonce, ct, aad)
+		if err != nil {
+			t.Errorf("#%d: Open failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Errorf("#%d: plaintext mismatch: got %x, want %x", i, pt, plaintext)
+		}
+
+		// Seal and Open in place.
+		buf := append([]byte(nil), plaintext...)
+		ct = aead.Seal(buf[:0], nonce, buf, aad)
+		if !bytes.Equal(ct, want) {
+			t.Errorf("#%d: in-place Seal: got %x, want %x", i, ct, want)
+		}
+		pt, err = aead.Open(ct[:0], nonce, ct, aad)
+		if err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("#%d: in-place Open failed: %v", i, err)
+		}
+
+		ct = aead.Seal(nil, nonce, plaintext, aad)
+		if len(aad) > 0 {
+			aad[0] ^= 0x80
+			if _, err := aead.Open(nil, nonce, ct, aad); err == nil {
+				t.Errorf("#%d: Open succeeded with altered additional data", i)
+			}
+			aad[0] ^= 0x80
+		}
+		ct[len(ct)-1] ^= 0x80
+		if _, err := aead.Open(nil, nonce, ct, aad); err == nil {
+			t.Errorf("#%d: Open succeeded with altered tag", i)
+		}
+		ct[len(ct)-1] ^= 0x80
+		if len(plaintext) > 0 {
+			ct[0] ^= 0x80
+			if _, err := aead.Open(nil, nonce, ct, aad); err == nil {
+				t.Errorf("#%d: Open succeeded with altered ciphertext", i)
+			}
+		}
+	}
+}
+
+func TestBadKeySize(t *testing.T) {
+	for _, n := range []int{0, 16, 31, 33} {
+		if _, err := New(make([]byte, n)); err == nil {
+			t.Errorf("New accepted a %d-byte key", n)
+		}
+	}
+}
+
+func benchmarkSeal(b *testing.B, size int) {
+	aead, _ := New(make([]byte, KeySize))
+	var nonce [NonceSize]byte
+	var ad [13]byte
+	buf := make([]byte, size, size+Overhead)
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aead.Seal(buf[:0], nonce[:], buf[:size], ad[:])
+	}
+}
+
+func BenchmarkSeal64(b *testing.B) { benchmarkSeal(b, 64) }
+func BenchmarkSeal1K(b *testing.B) { benchmarkSeal(b, 1024) }
+func BenchmarkSeal8K(b *testing.B) { benchmarkSeal(b, 8192) }
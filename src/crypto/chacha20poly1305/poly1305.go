@@ -0,0 +1,129 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+// poly1305 computes the Poly1305 one-time authenticator of RFC 7539,
+// section 2.5. The accumulator and the key r are held in five 26-bit limbs,
+// so that limb products fit in a uint64.
+type poly1305 struct {
+	r [5]uint32
+	h [5]uint32
+	s [4]uint32
+}
+
+const mask26 = 1<<26 - 1
+
+func newPoly1305(key []byte) *poly1305 {
+	p := new(poly1305)
+	// r is clamped as the specification requires.
+	p.r[0] = getUint32(key[0:]) & 0x3ffffff
+	p.r[1] = (getUint32(key[3:]) >> 2) & 0x3ffff03
+	p.r[2] = (getUint32(key[6:]) >> 4) & 0x3ffc0ff
+	p.r[3] = (getUint32(key[9:]) >> 6) & 0x3f03fff
+	p.r[4] = (getUint32(key[12:]) >> 8) & 0x00fffff
+	for i := range p.s {
+		p.s[i] = getUint32(key[16+4*i:])
+	}
+	return p
+}
+
+// writePadded adds msg to the authenticated data, followed by enough zero
+// bytes to make its length a multiple of 16. The AEAD construction only
+// ever authenticates such padded segments.
+func (p *poly1305) writePadded(msg []byte) {
+	for len(msg) >= 16 {
+		p.block(msg)
+		msg = msg[16:]
+	}
+	if len(msg) > 0 {
+		var buf [16]byte
+		copy(buf[:], msg)
+		p.block(buf[:])
+	}
+}
+
+// block adds a full 16-byte block to the accumulator and multiplies it by
+// r, modulo 2^130 - 5.
+func (p *poly1305) block(m []byte) {
+	r0, r1, r2, r3, r4 := uint64(p.r[0]), uint64(p.r[1]), uint64(p.r[2]), uint64(p.r[3]), uint64(p.r[4])
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+
+	h0 := uint64(p.h[0] + getUint32(m[0:])&mask26)
+	h1 := uint64(p.h[1] + (getUint32(m[3:])>>2)&mask26)
+	h2 := uint64(p.h[2] + (getUint32(m[6:])>>4)&mask26)
+	h3 := uint64(p.h[3] + (getUint32(m[9:])>>6)&mask26)
+	h4 := uint64(p.h[4] + (getUint32(m[12:])>>8 | 1<<24))
+
+	d0 := h0*r0 + h1*s4 + h2*s3 + h3*s2 + h4*s1
+	d1 := h0*r1 + h1*r0 + h2*s4 + h3*s3 + h4*s2
+	d2 := h0*r2 + h1*r1 + h2*r0 + h3*s4 + h4*s3
+	d3 := h0*r3 + h1*r2 + h2*r1 + h3*r0 + h4*s4
+	d4 := h0*r4 + h1*r3 + h2*r2 + h3*r1 + h4*r0
+
+	d1 += d0 >> 26
+	d2 += d1 >> 26
+	d3 += d2 >> 26
+	d4 += d3 >> 26
+	// 2^130 = 5 modulo the prime.
+	d0 = d0&mask26 + (d4>>26)*5
+	d1 = d1&mask26 + d0>>26
+
+	p.h[0] = uint32(d0 & mask26)
+	p.h[1] = uint32(d1)
+	p.h[2] = uint32(d2 & mask26)
+	p.h[3] = uint32(d3 & mask26)
+	p.h[4] = uint32(d4 & mask26)
+}
+
+// sum writes the authenticator to out.
+func (p *poly1305) sum(out *[16]byte) {
+	h0, h1, h2, h3, h4 := p.h[0], p.h[1], p.h[2], p.h[3], p.h[4]
+
+	// Fully carry h.
+	h2 += h1 >> 26
+	h1 &= mask26
+	h3 += h2 >> 26
+	h2 &= mask26
+	h4 += h3 >> 26
+	h3 &= mask26
+	h0 += (h4 >> 26) * 5
+	h4 &= mask26
+	h1 += h0 >> 26
+	h0 &= mask26
+
+	// Compute g = h - p = h + 5 - 2^130, and select it in constant time
+	// if it isn't negative.
+	g0 := h0 + 5
+	g1 := h1 + g0>>26
+	g0 &= mask26
+	g2 := h2 + g1>>26
+	g1 &= mask26
+	g3 := h3 + g2>>26
+	g2 &= mask26
+	g4 := h4 + g3>>26 - 1<<26
+	g3 &= mask26
+
+	mask := (g4 >> 31) - 1
+	h0 = h0&^mask | g0&mask
+	h1 = h1&^mask | g1&mask
+	h2 = h2&^mask | g2&mask
+	h3 = h3&^mask | g3&mask
+	h4 = h4&^mask | g4&mask
+
+	// Pack h into 128 bits and add s.
+	h0 = h0 | h1<<26
+	h1 = h1>>6 | h2<<20
+	h2 = h2>>12 | h3<<14
+	h3 = h3>>18 | h4<<8
+
+	f := uint64(h0) + uint64(p.s[0])
+	putUint32(out[0:], uint32(f))
+	f = uint64(h1) + uint64(p.s[1]) + f>>32
+	putUint32(out[4:], uint32(f))
+	f = uint64(h2) + uint64(p.s[2]) + f>>32
+	putUint32(out[8:], uint32(f))
+	f = uint64(h3) + uint64(p.s[3]) + f>>32
+	putUint32(out[12:], uint32(f))
+}
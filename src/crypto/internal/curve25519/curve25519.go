@@ -0,0 +1,308 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package curve25519 implements the X25519 function of RFC 7748, which
+// performs scalar multiplication on the elliptic curve known as Curve25519.
+package curve25519
+
+// A fieldElement is an element of GF(2^255 - 19), held in ten limbs of,
+// alternately, 26 and 25 bits: f[0] + f[1]*2^26 + f[2]*2^51 + ... +
+// f[9]*2^230. Limbs may temporarily exceed their width and be negative.
+type fieldElement [10]int64
+
+// limbWidth and limbOffset give the size and position, in bits, of each limb.
+var (
+	limbWidth  = [10]uint{26, 25, 26, 25, 26, 25, 26, 25, 26, 25}
+	limbOffset = [10]uint{0, 26, 51, 77, 102, 128, 153, 179, 204, 230}
+)
+
+func feZero(h *fieldElement) {
+	*h = fieldElement{}
+}
+
+func feOne(h *fieldElement) {
+	*h = fieldElement{1}
+}
+
+func feAdd(h, f, g *fieldElement) {
+	for i := range h {
+		h[i] = f[i] + g[i]
+	}
+}
+
+func feSub(h, f, g *fieldElement) {
+	for i := range h {
+		h[i] = f[i] - g[i]
+	}
+}
+
+// feCSwap swaps f and g if b == 1, and leaves them unchanged if b == 0, in
+// constant time.
+func feCSwap(f, g *fieldElement, b int64) {
+	b = -b
+	for i := range f {
+		t := b & (f[i] ^ g[i])
+		f[i] ^= t
+		g[i] ^= t
+	}
+}
+
+// feCarry reduces the limbs of h to about their widths, in an order that
+// keeps every carry small. Carries out of the top limb wrap around to the
+// bottom one, multiplied by 19, since 2^255 = 19 modulo the prime.
+func feCarry(h *fieldElement) {
+	var c int64
+
+	c = (h[0] + 1<<25) >> 26
+	h[1] += c
+	h[0] -= c << 26
+
+	c = (h[4] + 1<<25) >> 26
+	h[5] += c
+	h[4] -= c << 26
+
+	c = (h[1] + 1<<24) >> 25
+	h[2] += c
+	h[1] -= c << 25
+
+	c = (h[5] + 1<<24) >> 25
+	h[6] += c
+	h[5] -= c << 25
+
+	c = (h[2] + 1<<25) >> 26
+	h[3] += c
+	h[2] -= c << 26
+
+	c = (h[6] + 1<<25) >> 26
+	h[7] += c
+	h[6] -= c << 26
+
+	c = (h[3] + 1<<24) >> 25
+	h[4] += c
+	h[3] -= c << 25
+
+	c = (h[7] + 1<<24) >> 25
+	h[8] += c
+	h[7] -= c << 25
+
+	c = (h[4] + 1<<25) >> 26
+	h[5] += c
+	h[4] -= c << 26
+
+	c = (h[8] + 1<<25) >> 26
+	h[9] += c
+	h[8] -= c << 26
+
+	c = (h[9] + 1<<24) >> 25
+	h[0] += 19 * c
+	h[9] -= c << 25
+
+	c = (h[0] + 1<<25) >> 26
+	h[1] += c
+	h[0] -= c << 26
+}
+
+// feMul sets h = f * g. The limbs of f and g must be at most about 2^27 in
+// magnitude, which is the case for the sum or difference of carried elements.
+func feMul(h, f, g *fieldElement) {
+	f0, f1, f2, f3, f4, f5, f6, f7, f8, f9 := f[0], f[1], f[2], f[3], f[4], f[5], f[6], f[7], f[8], f[9]
+	g0, g1, g2, g3, g4, g5, g6, g7, g8, g9 := g[0], g[1], g[2], g[3], g[4], g[5], g[6], g[7], g[8], g[9]
+
+	// The product of two odd limbs lands half a bit above the even limb
+	// it's accumulated into, so it's doubled.
+	f1_2, f3_2, f5_2, f7_2, f9_2 := 2*f1, 2*f3, 2*f5, 2*f7, 2*f9
+	g1_19, g2_19, g3_19, g4_19, g5_19, g6_19, g7_19, g8_19, g9_19 := 19*g1, 19*g2, 19*g3, 19*g4, 19*g5, 19*g6, 19*g7, 19*g8, 19*g9
+
+	h[0] = f0*g0 + f1_2*g9_19 + f2*g8_19 + f3_2*g7_19 + f4*g6_19 + f5_2*g5_19 + f6*g4_19 + f7_2*g3_19 + f8*g2_19 + f9_2*g1_19
+	h[1] = f0*g1 + f1*g0 + f2*g9_19 + f3*g8_19 + f4*g7_19 + f5*g6_19 + f6*g5_19 + f7*g4_19 + f8*g3_19 + f9*g2_19
+	h[2] = f0*g2 + f1_2*g1 + f2*g0 + f3_2*g9_19 + f4*g8_19 + f5_2*g7_19 + f6*g6_19 + f7_2*g5_19 + f8*g4_19 + f9_2*g3_19
+	h[3] = f0*g3 + f1*g2 + f2*g1 + f3*g0 + f4*g9_19 + f5*g8_19 + f6*g7_19 + f7*g6_19 + f8*g5_19 + f9*g4_19
+	h[4] = f0*g4 + f1_2*g3 + f2*g2 + f3_2*g1 + f4*g0 + f5_2*g9_19 + f6*g8_19 + f7_2*g7_19 + f8*g6_19 + f9_2*g5_19
+	h[5] = f0*g5 + f1*g4 + f2*g3 + f3*g2 + f4*g1 + f5*g0 + f6*g9_19 + f7*g8_19 + f8*g7_19 + f9*g6_19
+	h[6] = f0*g6 + f1_2*g5 + f2*g4 + f3_2*g3 + f4*g2 + f5_2*g1 + f6*g0 + f7_2*g9_19 + f8*g8_19 + f9_2*g7_19
+	h[7] = f0*g7 + f1*g6 + f2*g5 + f3*g4 + f4*g3 + f5*g2 + f6*g1 + f7*g0 + f8*g9_19 + f9*g8_19
+	h[8] = f0*g8 + f1_2*g7 + f2*g6 + f3_2*g5 + f4*g4 + f5_2*g3 + f6*g2 + f7_2*g1 + f8*g0 + f9_2*g9_19
+	h[9] = f0*g9 + f1*g8 + f2*g7 + f3*g6 + f4*g5 + f5*g4 + f6*g3 + f7*g2 + f8*g1 + f9*g0
+
+	feCarry(h)
+}
+
+func feSquare(h, f *fieldElement) {
+	feMul(h, f, f)
+}
+
+// feMul121666 sets h = f * 121666. The ladder computes AA + a24 * E, where
+// a24 = (486662 - 2) / 4 = 121665, as BB + 121666 * E.
+func feMul121666(h, f *fieldElement) {
+	for i := range h {
+		h[i] = f[i] * 121666
+	}
+	feCarry(h)
+}
+
+// feInvert sets out = z^-1 = z^(p-2).
+func feInvert(out, z *fieldElement) {
+	var z2, z9, z11, z2_5_0, z2_10_0, z2_20_0, z2_50_0, z2_100_0, t fieldElement
+
+	feSquare(&z2, z)      // 2
+	feSquare(&t, &z2)     // 4
+	feSquare(&t, &t)      // 8
+	feMul(&z9, &t, z)     // 9
+	feMul(&z11, &z9, &z2) // 11
+	feSquare(&t, &z11)    // 22
+	feMul(&z2_5_0, &t, &z9)
+
+	feSquare(&t, &z2_5_0)
+	for i := 1; i < 5; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&z2_10_0, &t, &z2_5_0)
+
+	feSquare(&t, &z2_10_0)
+	for i := 1; i < 10; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&z2_20_0, &t, &z2_10_0)
+
+	feSquare(&t, &z2_20_0)
+	for i := 1; i < 20; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&t, &t, &z2_20_0)
+
+	for i := 0; i < 10; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&z2_50_0, &t, &z2_10_0)
+
+	feSquare(&t, &z2_50_0)
+	for i := 1; i < 50; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&z2_100_0, &t, &z2_50_0)
+
+	feSquare(&t, &z2_100_0)
+	for i := 1; i < 100; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&t, &t, &z2_100_0)
+
+	for i := 0; i < 50; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(&t, &t, &z2_50_0)
+
+	for i := 0; i < 5; i++ {
+		feSquare(&t, &t)
+	}
+	feMul(out, &t, &z11) // 2^255 - 21
+}
+
+// feFromBytes sets h to the little-endian number in src, ignoring its most
+// significant bit.
+func feFromBytes(h *fieldElement, src *[32]byte) {
+	var buf [40]byte
+	copy(buf[:], src[:])
+	buf[31] &= 127
+
+	for i := range h {
+		off := limbOffset[i]
+		var v uint64
+		for j := uint(0); j < 8; j++ {
+			v |= uint64(buf[off/8+j]) << (8 * j)
+		}
+		h[i] = int64(v>>(off%8)) & (1<<limbWidth[i] - 1)
+	}
+}
+
+// feToBytes writes h, fully reduced modulo the prime, to dst in
+// little-endian order. h must be carried.
+func feToBytes(dst *[32]byte, h *fieldElement) {
+	// Compute q, the quotient of h by the prime, which is 0 or 1 for a
+	// carried h, and subtract q times the prime.
+	q := (19*h[9] + 1<<24) >> 25
+	for i := range h {
+		q = (h[i] + q) >> limbWidth[i]
+	}
+
+	var r fieldElement = *h
+	r[0] += 19 * q
+	for i := 0; i < 9; i++ {
+		c := r[i] >> limbWidth[i]
+		r[i+1] += c
+		r[i] -= c << limbWidth[i]
+	}
+	r[9] &= 1<<25 - 1
+
+	var buf [40]byte
+	for i := range r {
+		off := limbOffset[i]
+		v := uint64(r[i]) << (off % 8)
+		for j := uint(0); j < 5; j++ {
+			buf[off/8+j] |= byte(v >> (8 * j))
+		}
+	}
+	copy(dst[:], buf[:32])
+}
+
+// ScalarMult sets dst to the product scalar * point, where point is the
+// u-coordinate of a point on Curve25519. The scalar is clamped as RFC 7748
+// specifies.
+func ScalarMult(dst, scalar, point *[32]byte) {
+	var e [32]byte
+	copy(e[:], scalar[:])
+	e[0] &= 248
+	e[31] &= 127
+	e[31] |= 64
+
+	var x1, x2, z2, x3, z3, tmp0, tmp1 fieldElement
+	feFromBytes(&x1, point)
+	feOne(&x2)
+	feZero(&z2)
+	x3 = x1
+	feOne(&z3)
+
+	// The Montgomery ladder, from RFC 7748, section 5.
+	var swap int64
+	for pos := 254; pos >= 0; pos-- {
+		b := int64(e[pos/8]>>uint(pos&7)) & 1
+		swap ^= b
+		feCSwap(&x2, &x3, swap)
+		feCSwap(&z2, &z3, swap)
+		swap = b
+
+		feSub(&tmp0, &x3, &z3)     // D = x3 - z3
+		feSub(&tmp1, &x2, &z2)     // B = x2 - z2
+		feAdd(&x2, &x2, &z2)       // A = x2 + z2
+		feAdd(&z2, &x3, &z3)       // C = x3 + z3
+		feMul(&z3, &tmp0, &x2)     // DA
+		feMul(&z2, &z2, &tmp1)     // CB
+		feSquare(&tmp0, &tmp1)     // BB
+		feSquare(&tmp1, &x2)       // AA
+		feAdd(&x3, &z3, &z2)       // DA + CB
+		feSub(&z2, &z3, &z2)       // DA - CB
+		feMul(&x2, &tmp1, &tmp0)   // x2 = AA * BB
+		feSub(&tmp1, &tmp1, &tmp0) // E = AA - BB
+		feSquare(&z2, &z2)         // (DA - CB)^2
+		feMul121666(&z3, &tmp1)    // 121666 * E
+		feSquare(&x3, &x3)         // x3 = (DA + CB)^2
+		feAdd(&tmp0, &tmp0, &z3)   // AA + a24 * E
+		feMul(&z3, &x1, &z2)       // z3 = x1 * (DA - CB)^2
+		feMul(&z2, &tmp1, &tmp0)   // z2 = E * (AA + a24 * E)
+	}
+	feCSwap(&x2, &x3, swap)
+	feCSwap(&z2, &z3, swap)
+
+	feInvert(&z2, &z2)
+	feMul(&x2, &x2, &z2)
+	feToBytes(dst, &x2)
+}
+
+var basePoint = [32]byte{9}
+
+// ScalarBaseMult sets dst to the product scalar * base, where base is the
+// standard generator, u = 9.
+func ScalarBaseMult(dst, scalar *[32]byte) {
+	ScalarMult(dst, scalar, &basePoint)
+}
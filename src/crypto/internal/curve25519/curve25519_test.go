@@ -0,0 +1,93 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve25519
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex32(s string) *[32]byte {
+	var out [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		panic("bad test vector: " + s)
+	}
+	copy(out[:], b)
+	return &out
+}
+
+// Test vectors from RFC 7748, section 5.2.
+var scalarMultTests = []struct {
+	scalar, point, out string
+}{
+	{
+		"a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4",
+		"e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c",
+		"c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552",
+	},
+	{
+		"4b66e9d4d1b4673c5ad22691957d6af5c11b6421e0ea01d42ca4169e7918ba0d",
+		"e5210f12786811d3f4b7959d0538ae2c31dbe7106fc03c3efc4cd549c715a493",
+		"95cbde9476e8907d7aade45cb4b873f88b595a68799fa152e6f8f7647aac7957",
+	},
+}
+
+func TestScalarMult(t *testing.T) {
+	for i, test := range scalarMultTests {
+		var out [32]byte
+		ScalarMult(&out, fromHex32(test.scalar), fromHex32(test.point))
+		if want := fromHex32(test.out); out != *want {
+			t.Errorf("#%d: got %x, want %x", i, out, *want)
+		}
+	}
+}
+
+// TestIterated runs the iterated test of RFC 7748, section 5.2, for 1,000
+// iterations.
+func TestIterated(t *testing.T) {
+	k := basePoint
+	u := basePoint
+	for i := 0; i < 1000; i++ {
+		var out [32]byte
+		ScalarMult(&out, &k, &u)
+		u = k
+		k = out
+	}
+	if want := fromHex32("684cf59ba83309552800ef566f2f4d3c1c3887c49360e3875f2eb94d99532c51"); k != *want {
+		t.Errorf("got %x, want %x", k, *want)
+	}
+}
+
+// TestDiffieHellman checks the key agreement of RFC 7748, section 6.1.
+func TestDiffieHellman(t *testing.T) {
+	alicePrivate := fromHex32("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	bobPrivate := fromHex32("5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb")
+
+	var alicePublic, bobPublic, aliceShared, bobShared [32]byte
+	ScalarBaseMult(&alicePublic, alicePrivate)
+	ScalarBaseMult(&bobPublic, bobPrivate)
+	if want := fromHex32("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"); alicePublic != *want {
+		t.Errorf("Alice's public key: got %x, want %x", alicePublic, *want)
+	}
+	if want := fromHex32("de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f"); bobPublic != *want {
+		t.Errorf("Bob's public key: got %x, want %x", bobPublic, *want)
+	}
+
+	ScalarMult(&aliceShared, alicePrivate, &bobPublic)
+	ScalarMult(&bobShared, bobPrivate, &alicePublic)
+	want := fromHex32("4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742")
+	if aliceShared != *want || bobShared != *want {
+		t.Errorf("shared secrets: got %x and %x, want %x", aliceShared, bobShared, *want)
+	}
+}
+
+func BenchmarkScalarBaseMult(b *testing.B) {
+	var in, out [32]byte
+	in[0] = 1
+	for i := 0; i < b.N; i++ {
+		ScalarBaseMult(&out, &in)
+	}
+}
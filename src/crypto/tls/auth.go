@@ -0,0 +1,165 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Signing contexts of TLS 1.3 CertificateVerify messages. See RFC 8446,
+// section 4.4.3.
+const (
+	serverSignatureContext = "TLS 1.3, server CertificateVerify\x00"
+	clientSignatureContext = "TLS 1.3, client CertificateVerify\x00"
+)
+
+var signaturePadding = []byte{
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+}
+
+// signedMessage returns the digest, computed with sigHash, of the content
+// covered by a TLS 1.3 CertificateVerify signature.
+func signedMessage(sigHash crypto.Hash, context string, transcript hash.Hash) []byte {
+	h := sigHash.New()
+	h.Write(signaturePadding)
+	h.Write([]byte(context))
+	h.Write(transcript.Sum(nil))
+	return h.Sum(nil)
+}
+
+// isRSAPSS reports whether sigAndHash is one of the RSASSA-PSS signature
+// schemes.
+func isRSAPSS(sigAndHash signatureAndHash) bool {
+	if sigAndHash.hash != hashIntrinsic {
+		return false
+	}
+	switch sigAndHash.signature {
+	case signatureRSAPSSSHA256, signatureRSAPSSSHA384, signatureRSAPSSSHA512:
+		return true
+	}
+	return false
+}
+
+// hashForSignatureAlgorithm returns the hash function used by a
+// signature algorithm, including the RSASSA-PSS schemes.
+func hashForSignatureAlgorithm(sigAndHash signatureAndHash) (crypto.Hash, error) {
+	if sigAndHash.hash == hashIntrinsic {
+		switch sigAndHash.signature {
+		case signatureRSAPSSSHA256:
+			return crypto.SHA256, nil
+		case signatureRSAPSSSHA384:
+			return crypto.SHA384, nil
+		case signatureRSAPSSSHA512:
+			return crypto.SHA512, nil
+		}
+		return 0, errors.New("tls: unsupported signature algorithm")
+	}
+	if sigAndHash.hash == hashSHA512 {
+		return crypto.SHA512, nil
+	}
+	return lookupTLSHash(sigAndHash.hash)
+}
+
+// signatureAlgorithmsTLS13ForKey returns the TLS 1.3 signature algorithms
+// that can be used with pub. An ECDSA key can only sign with the hash
+// that matches its curve.
+func signatureAlgorithmsTLS13ForKey(pub crypto.PublicKey) []signatureAndHash {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return []signatureAndHash{
+			{hashIntrinsic, signatureRSAPSSSHA256},
+			{hashIntrinsic, signatureRSAPSSSHA384},
+			{hashIntrinsic, signatureRSAPSSSHA512},
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return []signatureAndHash{{hashSHA256, signatureECDSA}}
+		case elliptic.P384():
+			return []signatureAndHash{{hashSHA384, signatureECDSA}}
+		case elliptic.P521():
+			return []signatureAndHash{{hashSHA512, signatureECDSA}}
+		}
+	}
+	return nil
+}
+
+// selectSignatureAlgorithmTLS13 returns the first signature algorithm in
+// peerAlgs that can be used with pub in a TLS 1.3 handshake.
+func selectSignatureAlgorithmTLS13(pub crypto.PublicKey, peerAlgs []signatureAndHash) (signatureAndHash, error) {
+	supported := signatureAlgorithmsTLS13ForKey(pub)
+	for _, sigAndHash := range peerAlgs {
+		if isSupportedSignatureAndHash(sigAndHash, supported) {
+			return sigAndHash, nil
+		}
+	}
+	return signatureAndHash{}, fmt.Errorf("tls: peer doesn't support any common signature algorithms for a %T", pub)
+}
+
+// signHandshake signs digest, computed with the hash of sigAndHash, with
+// priv.
+func signHandshake(rand io.Reader, priv crypto.Signer, sigAndHash signatureAndHash, digest []byte) ([]byte, error) {
+	sigHash, err := hashForSignatureAlgorithm(sigAndHash)
+	if err != nil {
+		return nil, err
+	}
+	var opts crypto.SignerOpts = sigHash
+	if isRSAPSS(sigAndHash) {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: sigHash}
+	}
+	return priv.Sign(rand, digest, opts)
+}
+
+// verifyHandshakeSignature verifies a signature sig of digest, computed
+// with the hash of sigAndHash, against pub.
+func verifyHandshakeSignature(pub crypto.PublicKey, sigAndHash signatureAndHash, digest, sig []byte) error {
+	sigHash, err := hashForSignatureAlgorithm(sigAndHash)
+	if err != nil {
+		return err
+	}
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sigAndHash.signature != signatureECDSA {
+			return errors.New("tls: bad signature type for an ECDSA key")
+		}
+		ecdsaSig := new(ecdsaSignature)
+		if _, err := asn1.Unmarshal(sig, ecdsaSig); err != nil {
+			return err
+		}
+		if ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+			return errors.New("tls: ECDSA signature contained zero or negative values")
+		}
+		if !ecdsa.Verify(pub, digest, ecdsaSig.R, ecdsaSig.S) {
+			return errors.New("tls: ECDSA verification failure")
+		}
+	case *rsa.PublicKey:
+		if isRSAPSS(sigAndHash) {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(pub, sigHash, digest, sig, opts)
+		}
+		if sigAndHash.signature != signatureRSA {
+			return errors.New("tls: bad signature type for an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(pub, sigHash, digest, sig)
+	default:
+		return fmt.Errorf("tls: unsupported public key type %T", pub)
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ const (
 	VersionTLS10 = 0x0301
 	VersionTLS11 = 0x0302
 	VersionTLS12 = 0x0303
+	VersionTLS13 = 0x0304
 )
 
 const (
@@ -34,8 +35,34 @@ const (
 
 	minVersion = VersionTLS10
 	maxVersion = VersionTLS12
+
+	// maxSupportedVersion is the highest version implemented by this
+	// package. Versions above maxVersion are only negotiated if
+	// Config.MaxVersion enables them.
+	maxSupportedVersion = VersionTLS13
 )
 
+// Downgrade protection sentinels, set in the last eight bytes of the
+// ServerHello random by servers that support TLS 1.3 when they negotiate
+// a lower version. See RFC 8446, section 4.1.3.
+const (
+	downgradeCanaryTLS12 = "DOWNGRD\x01"
+	downgradeCanaryTLS11 = "DOWNGRD\x00"
+)
+
+// helloRetryRequestRandom is set as the random of a ServerHello to mark it
+// as a HelloRetryRequest. See RFC 8446, section 4.1.3.
+var helloRetryRequestRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11,
+	0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E,
+	0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// maxSessionTicketLifetime is the maximum lifetime of a TLS 1.3 session
+// ticket. See RFC 8446, section 4.6.1.
+const maxSessionTicketLifetime = 7 * 24 * time.Hour
+
 // TLS record types.
 type recordType uint8
 
@@ -48,18 +75,21 @@ const (
 
 // TLS handshake message types.
 const (
-	typeClientHello        uint8 = 1
-	typeServerHello        uint8 = 2
-	typeNewSessionTicket   uint8 = 4
-	typeCertificate        uint8 = 11
-	typeServerKeyExchange  uint8 = 12
-	typeCertificateRequest uint8 = 13
-	typeServerHelloDone    uint8 = 14
-	typeCertificateVerify  uint8 = 15
-	typeClientKeyExchange  uint8 = 16
-	typeFinished           uint8 = 20
-	typeCertificateStatus  uint8 = 22
-	typeNextProtocol       uint8 = 67 // Not IANA assigned
+	typeClientHello         uint8 = 1
+	typeServerHello         uint8 = 2
+	typeNewSessionTicket    uint8 = 4
+	typeEncryptedExtensions uint8 = 8
+	typeCertificate         uint8 = 11
+	typeServerKeyExchange   uint8 = 12
+	typeCertificateRequest  uint8 = 13
+	typeServerHelloDone     uint8 = 14
+	typeCertificateVerify   uint8 = 15
+	typeClientKeyExchange   uint8 = 16
+	typeFinished            uint8 = 20
+	typeCertificateStatus   uint8 = 22
+	typeKeyUpdate           uint8 = 24
+	typeNextProtocol        uint8 = 67  // Not IANA assigned
+	typeMessageHash         uint8 = 254 // synthetic message
 )
 
 // TLS compression types.
@@ -69,16 +99,22 @@ const (
 
 // TLS extension numbers
 const (
-	extensionServerName          uint16 = 0
-	extensionStatusRequest       uint16 = 5
-	extensionSupportedCurves     uint16 = 10
-	extensionSupportedPoints     uint16 = 11
-	extensionSignatureAlgorithms uint16 = 13
-	extensionALPN                uint16 = 16
-	extensionSCT                 uint16 = 18 // https://tools.ietf.org/html/rfc6962#section-6
-	extensionSessionTicket       uint16 = 35
-	extensionNextProtoNeg        uint16 = 13172 // not IANA assigned
-	extensionRenegotiationInfo   uint16 = 0xff01
+	extensionServerName             uint16 = 0
+	extensionStatusRequest          uint16 = 5
+	extensionSupportedCurves        uint16 = 10
+	extensionSupportedPoints        uint16 = 11
+	extensionSignatureAlgorithms    uint16 = 13
+	extensionALPN                   uint16 = 16
+	extensionSCT                    uint16 = 18 // https://tools.ietf.org/html/rfc6962#section-6
+	extensionSessionTicket          uint16 = 35
+	extensionPreSharedKey           uint16 = 41
+	extensionSupportedVersions      uint16 = 43
+	extensionCookie                 uint16 = 44
+	extensionPSKModes               uint16 = 45
+	extensionCertificateAuthorities uint16 = 47
+	extensionKeyShare               uint16 = 51
+	extensionNextProtoNeg           uint16 = 13172 // not IANA assigned
+	extensionRenegotiationInfo      uint16 = 0xff01
 )
 
 // TLS signaling cipher suite values
@@ -94,6 +130,13 @@ const (
 	CurveP256 CurveID = 23
 	CurveP384 CurveID = 24
 	CurveP521 CurveID = 25
+	X25519    CurveID = 29
+)
+
+// TLS 1.3 PSK Key Exchange Modes. See RFC 8446, section 4.2.9.
+const (
+	pskModePlain uint8 = 0
+	pskModeDHE   uint8 = 1
 )
 
 // TLS Elliptic Curve Point Formats
@@ -127,6 +170,7 @@ const (
 	hashSHA1   uint8 = 2
 	hashSHA256 uint8 = 4
 	hashSHA384 uint8 = 5
+	hashSHA512 uint8 = 6
 )
 
 // Signature algorithms for TLS 1.2 (See RFC 5246, section A.4.1)
@@ -135,6 +179,18 @@ const (
 	signatureECDSA uint8 = 3
 )
 
+// The RSASSA-PSS signature schemes of TLS 1.3 (See RFC 8446, section
+// 4.2.3) share the code points of TLS 1.2 signature and hash pairs.
+// They are encoded as a hash of hashIntrinsic followed by one of the
+// signatures below, which also determine the hash function.
+const (
+	hashIntrinsic uint8 = 8
+
+	signatureRSAPSSSHA256 uint8 = 4
+	signatureRSAPSSSHA384 uint8 = 5
+	signatureRSAPSSSHA512 uint8 = 6
+)
+
 // signatureAndHash mirrors the TLS 1.2, SignatureAndHashAlgorithm struct. See
 // RFC 5246, section A.4.1.
 type signatureAndHash struct {
@@ -153,6 +209,35 @@ var supportedSignatureAlgorithms = []signatureAndHash{
 	{hashSHA1, signatureECDSA},
 }
 
+// supportedSignatureAlgorithmsTLS13 contains the signature algorithms
+// that may be used in TLS 1.3 CertificateVerify messages. In TLS 1.3
+// an ECDSA algorithm also names the curve of the key, and RSA keys
+// sign with RSASSA-PSS.
+var supportedSignatureAlgorithmsTLS13 = []signatureAndHash{
+	{hashIntrinsic, signatureRSAPSSSHA256},
+	{hashSHA256, signatureECDSA},
+	{hashIntrinsic, signatureRSAPSSSHA384},
+	{hashSHA384, signatureECDSA},
+	{hashIntrinsic, signatureRSAPSSSHA512},
+	{hashSHA512, signatureECDSA},
+}
+
+// supportedSignatureAlgorithmsAll contains the signature algorithms
+// advertised in a ClientHello that offers TLS 1.3, which may also be
+// answered by a TLS 1.2 server.
+var supportedSignatureAlgorithmsAll = []signatureAndHash{
+	{hashIntrinsic, signatureRSAPSSSHA256},
+	{hashSHA256, signatureECDSA},
+	{hashIntrinsic, signatureRSAPSSSHA384},
+	{hashSHA384, signatureECDSA},
+	{hashIntrinsic, signatureRSAPSSSHA512},
+	{hashSHA512, signatureECDSA},
+	{hashSHA256, signatureRSA},
+	{hashSHA384, signatureRSA},
+	{hashSHA1, signatureRSA},
+	{hashSHA1, signatureECDSA},
+}
+
 // ConnectionState records basic TLS details about the connection.
 type ConnectionState struct {
 	Version                     uint16                // TLS version used by the connection (e.g. VersionTLS12)
@@ -168,8 +253,9 @@ type ConnectionState struct {
 	OCSPResponse                []byte                // stapled OCSP response from server, if any
 
 	// TLSUnique contains the "tls-unique" channel binding value (see RFC
-	// 5929, section 3). For resumed sessions this value will be nil
-	// because resumption does not include enough context (see
+	// 5929, section 3). For resumed sessions and TLS 1.3 connections
+	// this value will be nil because resumption does not include enough
+	// context and TLS 1.3 does not define it (see
 	// https://secure-resumption.com/#channelbindings). This will change in
 	// future versions of Go once the TLS master-secret fix has been
 	// standardized and implemented.
@@ -197,6 +283,12 @@ type ClientSessionState struct {
 	masterSecret       []byte                // MasterSecret generated by client on a full handshake
 	serverCertificates []*x509.Certificate   // Certificate chain presented by the server
 	verifiedChains     [][]*x509.Certificate // Certificate chains we built for verification
+
+	// For TLS 1.3 sessions, masterSecret holds the pre-shared key
+	// derived from the ticket and sessionTicket its identity.
+	receivedAt time.Time // When the ticket was received from the server
+	useBy      time.Time // Expiration of the ticket lifetime
+	ageAdd     uint32    // Random obfuscation factor for sending the ticket age
 }
 
 // ClientSessionCache is a cache of ClientSessionState objects that can be used
@@ -213,7 +305,8 @@ type ClientSessionCache interface {
 }
 
 // ClientHelloInfo contains information from a ClientHello message in order to
-// guide certificate selection in the GetCertificate callback.
+// guide certificate selection in the GetCertificate and GetConfigForClient
+// callbacks.
 type ClientHelloInfo struct {
 	// CipherSuites lists the CipherSuites supported by the client (e.g.
 	// TLS_RSA_WITH_RC4_128_SHA).
@@ -238,6 +331,43 @@ type ClientHelloInfo struct {
 	SupportedPoints []uint8
 }
 
+// SignatureScheme identifies a signature algorithm supported by TLS. See
+// https://tools.ietf.org/html/draft-ietf-tls-tls13-18#section-4.2.3. In
+// TLS 1.2 and earlier, the value combines the hash (high byte) and
+// signature (low byte) of a SignatureAndHashAlgorithm.
+type SignatureScheme uint16
+
+const (
+	PKCS1WithSHA1   SignatureScheme = 0x0201
+	PKCS1WithSHA256 SignatureScheme = 0x0401
+	PKCS1WithSHA384 SignatureScheme = 0x0501
+	PKCS1WithSHA512 SignatureScheme = 0x0601
+
+	PSSWithSHA256 SignatureScheme = 0x0804
+	PSSWithSHA384 SignatureScheme = 0x0805
+	PSSWithSHA512 SignatureScheme = 0x0806
+
+	ECDSAWithP256AndSHA256 SignatureScheme = 0x0403
+	ECDSAWithP384AndSHA384 SignatureScheme = 0x0503
+	ECDSAWithP521AndSHA512 SignatureScheme = 0x0603
+	ECDSAWithSHA1          SignatureScheme = 0x0203
+)
+
+// CertificateRequestInfo contains information from a server's
+// CertificateRequest message, which is used to demand a certificate and proof
+// of control from a client.
+type CertificateRequestInfo struct {
+	// AcceptableCAs contains zero or more, DER-encoded, X.501
+	// Distinguished Names. These are the names of root or intermediate CAs
+	// that the server wishes the returned certificate to be signed by. An
+	// empty slice indicates that the server has no preference.
+	AcceptableCAs [][]byte
+
+	// SignatureSchemes lists the signature schemes that the server is
+	// willing to verify.
+	SignatureSchemes []SignatureScheme
+}
+
 // A Config structure is used to configure a TLS client or server.
 // After one has been passed to a TLS function it must not be
 // modified. A Config may be reused; the tls package will also not
@@ -276,6 +406,40 @@ type Config struct {
 	// first element of Certificates will be used.
 	GetCertificate func(clientHello *ClientHelloInfo) (*Certificate, error)
 
+	// GetClientCertificate, if not nil, is called when a server requests a
+	// certificate from a client. If set, the contents of Certificates will
+	// be ignored.
+	//
+	// If GetClientCertificate returns an error, the handshake will be
+	// aborted and that error will be returned. Otherwise, if it returns
+	// nil or a Certificate with an empty Certificate field, no certificate
+	// will be sent to the server. If this is unacceptable to the server
+	// then it may abort the handshake.
+	GetClientCertificate func(*CertificateRequestInfo) (*Certificate, error)
+
+	// GetConfigForClient, if not nil, is called after a ClientHello is
+	// received from a client. It may return a non-nil Config in order to
+	// change the Config that will be used to handle this connection. If
+	// the returned Config is nil, the original Config will be used. The
+	// Config returned by this callback may not be subsequently modified.
+	//
+	// If the returned Config has no SessionTicketKey set, it shares the
+	// session ticket keys of the original Config.
+	GetConfigForClient func(*ClientHelloInfo) (*Config, error)
+
+	// VerifyPeerCertificate, if not nil, is called after normal
+	// certificate verification by either a TLS client or server. It
+	// receives the raw ASN.1 certificates provided by the peer and also
+	// any verified chains that normal processing found. If it returns a
+	// non-nil error, the handshake is aborted and that error results.
+	//
+	// If normal verification fails then the handshake will abort before
+	// considering this callback. If normal verification is disabled by
+	// setting InsecureSkipVerify, or (for a server) when ClientAuth is
+	// RequestClientCert or RequireAnyClientCert, then this callback will
+	// be considered but the verifiedChains argument will always be nil.
+	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
 	// RootCAs defines the set of root certificate authorities
 	// that clients use when verifying server certificates.
 	// If RootCAs is nil, TLS uses the host's root CA set.
@@ -328,7 +492,8 @@ type Config struct {
 	// If multiple servers are terminating connections for the same host
 	// they should all have the same SessionTicketKey. If the
 	// SessionTicketKey leaks, previously recorded and future TLS
-	// connections using that key are compromised.
+	// connections using that key are compromised. To rotate keys, use
+	// SetSessionTicketKeys instead.
 	SessionTicketKey [32]byte
 
 	// SessionCache is a cache of ClientSessionState entries for TLS session
@@ -340,8 +505,8 @@ type Config struct {
 	MinVersion uint16
 
 	// MaxVersion contains the maximum SSL/TLS version that is acceptable.
-	// If zero, then the maximum version supported by this package is used,
-	// which is currently TLS 1.2.
+	// If zero, then TLS 1.2 is taken as the maximum. TLS 1.3 is only
+	// negotiated if MaxVersion is set to VersionTLS13.
 	MaxVersion uint16
 
 	// CurvePreferences contains the elliptic curves that will be used in
@@ -349,6 +514,14 @@ type Config struct {
 	// be used.
 	CurvePreferences []CurveID
 
+	// KeyLogWriter optionally specifies a destination for TLS secrets in
+	// NSS key log format that can be used to allow external programs such
+	// as Wireshark to decrypt TLS connections. See
+	// https://developer.mozilla.org/en-US/docs/Mozilla/Projects/NSS/Key_Log_Format.
+	// Use of KeyLogWriter compromises security and should only be used
+	// for debugging.
+	KeyLogWriter io.Writer
+
 	serverInitOnce sync.Once // guards calling (*Config).serverInit
 
 	// mutex protects sessionTicketKeys
@@ -384,8 +557,13 @@ func ticketKeyFromBytes(b [32]byte) (key ticketKey) {
 	return key
 }
 
-func (c *Config) serverInit() {
-	if c.SessionTicketsDisabled {
+// serverInit sets up the session ticket keys of a server Config. If
+// originalConfig is not nil, c was returned by its GetConfigForClient
+// callback and, unless c has a SessionTicketKey of its own, shares its keys.
+func (c *Config) serverInit(originalConfig *Config) {
+	// Keys set by SetSessionTicketKeys before the first handshake take
+	// precedence over SessionTicketKey.
+	if c.SessionTicketsDisabled || len(c.ticketKeys()) != 0 {
 		return
 	}
 
@@ -397,6 +575,12 @@ func (c *Config) serverInit() {
 		}
 	}
 
+	if !alreadySet && originalConfig != nil && !originalConfig.SessionTicketsDisabled {
+		c.SessionTicketKey = originalConfig.SessionTicketKey
+		c.sessionTicketKeys = originalConfig.ticketKeys()
+		return
+	}
+
 	if !alreadySet {
 		if _, err := io.ReadFull(c.rand(), c.SessionTicketKey[:]); err != nil {
 			c.SessionTicketsDisabled = true
@@ -436,6 +620,34 @@ func (c *Config) SetSessionTicketKeys(keys [][32]byte) {
 	c.mutex.Unlock()
 }
 
+const (
+	keyLogLabelTLS12           = "CLIENT_RANDOM"
+	keyLogLabelClientHandshake = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogLabelServerHandshake = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogLabelClientTraffic   = "CLIENT_TRAFFIC_SECRET_0"
+	keyLogLabelServerTraffic   = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// writeKeyLog writes a line to the KeyLogWriter, if any, recording secret
+// for the connection identified by clientRandom.
+func (c *Config) writeKeyLog(label string, clientRandom, secret []byte) error {
+	if c.KeyLogWriter == nil {
+		return nil
+	}
+
+	logLine := []byte(fmt.Sprintf("%s %x %x\n", label, clientRandom, secret))
+
+	writerMutex.Lock()
+	_, err := c.KeyLogWriter.Write(logLine)
+	writerMutex.Unlock()
+
+	return err
+}
+
+// writerMutex protects all KeyLogWriters globally. It is rarely enabled,
+// and is only for debugging, so a global mutex saves space.
+var writerMutex sync.Mutex
+
 func (c *Config) rand() io.Reader {
 	r := c.Rand
 	if r == nil {
@@ -474,7 +686,7 @@ func (c *Config) maxVersion() uint16 {
 	return c.MaxVersion
 }
 
-var defaultCurvePreferences = []CurveID{CurveP256, CurveP384, CurveP521}
+var defaultCurvePreferences = []CurveID{X25519, CurveP256, CurveP384, CurveP521}
 
 func (c *Config) curvePreferences() []CurveID {
 	if c == nil || len(c.CurvePreferences) == 0 {
@@ -483,11 +695,41 @@ func (c *Config) curvePreferences() []CurveID {
 	return c.CurvePreferences
 }
 
+// supportedVersions returns the protocol versions enabled by c, highest
+// first, as advertised in the supported_versions extension.
+func (c *Config) supportedVersions() []uint16 {
+	var versions []uint16
+	for v := c.maxVersion(); v >= c.minVersion(); v-- {
+		if v > maxSupportedVersion {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// mutualSupportedVersion returns the highest version in peerVersions, the
+// content of a supported_versions extension, that is also enabled by c.
+func (c *Config) mutualSupportedVersion(peerVersions []uint16) (uint16, bool) {
+	for _, v := range c.supportedVersions() {
+		for _, peerVersion := range peerVersions {
+			if v == peerVersion {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
 // mutualVersion returns the protocol version to use given the advertised
-// version of the peer.
+// legacy version of the peer. TLS 1.3 is only negotiated with the
+// supported_versions extension, so the result is at most TLS 1.2.
 func (c *Config) mutualVersion(vers uint16) (uint16, bool) {
 	minVersion := c.minVersion()
 	maxVersion := c.maxVersion()
+	if maxVersion > VersionTLS12 {
+		maxVersion = VersionTLS12
+	}
 
 	if vers < minVersion {
 		return 0, false
@@ -681,8 +923,9 @@ func defaultConfig() *Config {
 }
 
 var (
-	once                   sync.Once
-	varDefaultCipherSuites []uint16
+	once                        sync.Once
+	varDefaultCipherSuites      []uint16
+	varDefaultCipherSuitesTLS13 []uint16
 )
 
 func defaultCipherSuites() []uint16 {
@@ -690,12 +933,62 @@ func defaultCipherSuites() []uint16 {
 	return varDefaultCipherSuites
 }
 
+// defaultCipherSuitesTLS13 returns the TLS 1.3 cipher suites in order of
+// preference.
+func defaultCipherSuitesTLS13() []uint16 {
+	once.Do(initDefaultCipherSuites)
+	return varDefaultCipherSuitesTLS13
+}
+
 func initDefaultCipherSuites() {
+	var topCipherSuites []uint16
+	if hasAESGCMHardwareSupport {
+		// If AES-GCM hardware is provided then prioritise AES-GCM
+		// cipher suites.
+		topCipherSuites = []uint16{
+			TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		}
+		varDefaultCipherSuitesTLS13 = []uint16{
+			TLS_AES_128_GCM_SHA256,
+			TLS_CHACHA20_POLY1305_SHA256,
+			TLS_AES_256_GCM_SHA384,
+		}
+	} else {
+		// Without AES-GCM hardware, we put the ChaCha20-Poly1305
+		// cipher suites first.
+		topCipherSuites = []uint16{
+			TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		}
+		varDefaultCipherSuitesTLS13 = []uint16{
+			TLS_CHACHA20_POLY1305_SHA256,
+			TLS_AES_128_GCM_SHA256,
+			TLS_AES_256_GCM_SHA384,
+		}
+	}
+
 	varDefaultCipherSuites = make([]uint16, 0, len(cipherSuites))
+	varDefaultCipherSuites = append(varDefaultCipherSuites, topCipherSuites...)
+
+NextCipherSuite:
 	for _, suite := range cipherSuites {
 		if suite.flags&suiteDefaultOff != 0 {
 			continue
 		}
+		for _, existing := range varDefaultCipherSuites {
+			if existing == suite.id {
+				continue NextCipherSuite
+			}
+		}
 		varDefaultCipherSuites = append(varDefaultCipherSuites, suite.id)
 	}
 }
@@ -704,6 +997,12 @@ func unexpectedMessageError(wanted, got interface{}) error {
 	return fmt.Errorf("tls: received unexpected handshake message of type %T when waiting for %T", got, wanted)
 }
 
+// signatureScheme returns the SignatureScheme with the same encoding as
+// sigHash.
+func signatureScheme(sigHash signatureAndHash) SignatureScheme {
+	return SignatureScheme(sigHash.hash)<<8 | SignatureScheme(sigHash.signature)
+}
+
 func isSupportedSignatureAndHash(sigHash signatureAndHash, sigHashes []signatureAndHash) bool {
 	for _, s := range sigHashes {
 		if s == sigHash {
@@ -47,6 +47,9 @@ type Conn struct {
 	// firstFinished contains the first Finished hash sent during the
 	// handshake. This is the "tls-unique" channel binding value.
 	firstFinished [12]byte
+	// resumptionSecret is the TLS 1.3 resumption master secret, from
+	// which the PSKs of the session tickets are derived.
+	resumptionSecret []byte
 
 	clientProtocol         string
 	clientProtocolFallback bool
@@ -115,6 +118,8 @@ type halfConn struct {
 	nextCipher interface{} // next encryption state
 	nextMac    macFunction // next MAC algorithm
 
+	trafficSecret []byte // current TLS 1.3 traffic secret
+
 	// used to save allocating a new buffer for each MAC.
 	inDigestBuf, outDigestBuf []byte
 }
@@ -155,6 +160,17 @@ func (hc *halfConn) changeCipherSpec() error {
 	return nil
 }
 
+// setTrafficSecret sets the TLS 1.3 traffic secret and the keys derived
+// from it, which take effect immediately, and resets the sequence number.
+func (hc *halfConn) setTrafficSecret(suite *cipherSuiteTLS13, secret []byte) {
+	hc.version = VersionTLS13
+	hc.trafficSecret = secret
+	key, iv := suite.trafficKey(secret)
+	hc.cipher = suite.aead(key, iv)
+	hc.mac = nil
+	hc.resetSeq()
+}
+
 // incSeq increments the sequence number.
 func (hc *halfConn) incSeq() {
 	for i := 7; i >= 0; i-- {
@@ -261,13 +277,19 @@ func (hc *halfConn) decrypt(b *block) (ok bool, prefixLen int, alertValue alert)
 		switch c := hc.cipher.(type) {
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
-		case cipher.AEAD:
-			explicitIVLen = 8
+		case aead:
+			if hc.version >= VersionTLS13 {
+				return hc.decryptTLS13(b, c)
+			}
+			explicitIVLen = c.explicitNonceLen()
 			if len(payload) < explicitIVLen {
 				return false, 0, alertBadRecordMAC
 			}
-			nonce := payload[:8]
-			payload = payload[8:]
+			nonce := payload[:explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
+			payload = payload[explicitIVLen:]
 
 			copy(hc.additionalData[:], hc.seq[:])
 			copy(hc.additionalData[8:], b.data[:3])
@@ -341,6 +363,36 @@ func (hc *halfConn) decrypt(b *block) (ok bool, prefixLen int, alertValue alert)
 	return true, recordHeaderLen + explicitIVLen, 0
 }
 
+// decryptTLS13 decrypts a TLS 1.3 record in b, and replaces its outer
+// record type and length with those of the inner plaintext. See RFC 8446,
+// section 5.2.
+func (hc *halfConn) decryptTLS13(b *block, aead aead) (ok bool, prefixLen int, alertValue alert) {
+	if recordType(b.data[0]) != recordTypeApplicationData {
+		return false, 0, alertUnexpectedMessage
+	}
+	payload := b.data[recordHeaderLen:]
+	payload, err := aead.Open(payload[:0], hc.seq[:], payload, b.data[:recordHeaderLen])
+	if err != nil {
+		return false, 0, alertBadRecordMAC
+	}
+
+	// Strip the zero padding, then the content type.
+	i := len(payload) - 1
+	for i >= 0 && payload[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return false, 0, alertUnexpectedMessage
+	}
+	b.data[0] = payload[i]
+	b.data[3] = byte(i >> 8)
+	b.data[4] = byte(i)
+	b.resize(recordHeaderLen + i)
+	hc.incSeq()
+
+	return true, recordHeaderLen, 0
+}
+
 // padToBlockSize calculates the needed padding block, if any, for a payload.
 // On exit, prefix aliases payload and extends to the end of the last full
 // block of payload. finalBlock is a fresh slice which contains the contents of
@@ -377,10 +429,25 @@ func (hc *halfConn) encrypt(b *block, explicitIVLen int) (bool, alert) {
 		switch c := hc.cipher.(type) {
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
-		case cipher.AEAD:
+		case aead:
+			if hc.version >= VersionTLS13 {
+				// The record header, with the final length, is
+				// the additional data. See RFC 8446, section 5.2.
+				payloadLen := len(b.data) - recordHeaderLen
+				b.resize(len(b.data) + c.Overhead())
+				n := payloadLen + c.Overhead()
+				b.data[3] = byte(n >> 8)
+				b.data[4] = byte(n)
+				payload := b.data[recordHeaderLen : recordHeaderLen+payloadLen]
+				c.Seal(payload[:0], hc.seq[:], payload, b.data[:recordHeaderLen])
+				break
+			}
 			payloadLen := len(b.data) - recordHeaderLen - explicitIVLen
 			b.resize(len(b.data) + c.Overhead())
 			nonce := b.data[recordHeaderLen : recordHeaderLen+explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
 			payload := b.data[recordHeaderLen+explicitIVLen:]
 			payload = payload[:payloadLen]
 
@@ -541,7 +608,9 @@ func (c *Conn) readRecord(want recordType) error {
 		c.sendAlert(alertInternalError)
 		return c.in.setErrorLocked(errors.New("tls: unknown record type requested"))
 	case recordTypeHandshake, recordTypeChangeCipherSpec:
-		if c.handshakeComplete {
+		// TLS 1.3 carries post-handshake messages, which are read
+		// after the handshake has completed.
+		if c.handshakeComplete && !(want == recordTypeHandshake && c.vers >= VersionTLS13) {
 			c.sendAlert(alertInternalError)
 			return c.in.setErrorLocked(errors.New("tls: handshake or ChangeCipherSpec requested after handshake complete"))
 		}
@@ -584,7 +653,9 @@ Again:
 
 	vers := uint16(b.data[1])<<8 | uint16(b.data[2])
 	n := int(b.data[3])<<8 | int(b.data[4])
-	if c.haveVers && vers != c.vers {
+	// The record version is frozen in TLS 1.3 and must be ignored. See RFC
+	// 8446, section 5.1.
+	if c.haveVers && c.vers < VersionTLS13 && vers != c.vers {
 		c.sendAlert(alertProtocolVersion)
 		msg := fmt.Sprintf("received record with version %x when expecting version %x", vers, c.vers)
 		return c.in.setErrorLocked(c.newRecordHeaderError(msg))
@@ -616,11 +687,26 @@ Again:
 
 	// Process message.
 	b, c.rawInput = c.in.splitBlock(b, recordHeaderLen+n)
+
+	// A TLS 1.3 peer may send an unencrypted ChangeCipherSpec record
+	// during the handshake for middlebox compatibility, which is
+	// ignored. See RFC 8446, section 5.
+	if c.vers >= VersionTLS13 && typ == recordTypeChangeCipherSpec {
+		if c.handshakeComplete || n != 1 || b.data[recordHeaderLen] != 1 {
+			c.in.freeBlock(b)
+			return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+		}
+		c.in.freeBlock(b)
+		goto Again
+	}
+
 	ok, off, err := c.in.decrypt(b)
 	if !ok {
 		c.in.setErrorLocked(c.sendAlert(err))
 	}
 	b.off = off
+	// The type of a TLS 1.3 record is only known after decryption.
+	typ = recordType(b.data[0])
 	data := b.data[b.off:]
 	if len(data) > maxPlaintext {
 		err := c.sendAlert(alertRecordOverflow)
@@ -672,9 +758,13 @@ Again:
 
 	case recordTypeHandshake:
 		// TODO(rsc): Should at least pick off connection close.
-		if typ != want {
+		if typ != want && !(c.handshakeComplete && c.vers >= VersionTLS13) {
 			return c.in.setErrorLocked(c.sendAlert(alertNoRenegotiation))
 		}
+		if len(data) == 0 && c.vers >= VersionTLS13 {
+			c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+			break
+		}
 		c.hand.Write(data)
 	}
 
@@ -727,24 +817,25 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (int, error) {
 		}
 		explicitIVLen := 0
 		explicitIVIsSeq := false
+		tls13 := c.out.version >= VersionTLS13 && c.out.cipher != nil
 
 		var cbc cbcMode
-		if c.out.version >= VersionTLS11 {
+		if c.out.version >= VersionTLS11 && !tls13 {
 			var ok bool
 			if cbc, ok = c.out.cipher.(cbcMode); ok {
 				explicitIVLen = cbc.BlockSize()
 			}
 		}
-		if explicitIVLen == 0 {
-			if _, ok := c.out.cipher.(cipher.AEAD); ok {
-				explicitIVLen = 8
+		if explicitIVLen == 0 && !tls13 {
+			if a, ok := c.out.cipher.(aead); ok {
+				explicitIVLen = a.explicitNonceLen()
 				// The AES-GCM construction in TLS has an
 				// explicit nonce so that the nonce can be
 				// random. However, the nonce is only 8 bytes
 				// which is too small for a secure, random
 				// nonce. Therefore we use the sequence number
 				// as the nonce.
-				explicitIVIsSeq = true
+				explicitIVIsSeq = explicitIVLen > 0
 			}
 		}
 		b.resize(recordHeaderLen + explicitIVLen + m)
@@ -754,6 +845,8 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (int, error) {
 			// Some TLS servers fail if the record version is
 			// greater than TLS 1.0 for the initial ClientHello.
 			vers = VersionTLS10
+		} else if vers >= VersionTLS13 {
+			vers = VersionTLS12
 		}
 		b.data[1] = byte(vers >> 8)
 		b.data[2] = byte(vers)
@@ -770,6 +863,13 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (int, error) {
 			}
 		}
 		copy(b.data[recordHeaderLen+explicitIVLen:], data)
+		if tls13 {
+			// The content type is appended to the plaintext and
+			// the record disguised as application data.
+			b.resize(recordHeaderLen + m + 1)
+			b.data[recordHeaderLen+m] = byte(typ)
+			b.data[0] = byte(recordTypeApplicationData)
+		}
 		c.out.encrypt(b, explicitIVLen)
 		if _, err := c.conn.Write(b.data); err != nil {
 			return n, err
@@ -821,13 +921,29 @@ func (c *Conn) readHandshake() (interface{}, error) {
 	case typeServerHello:
 		m = new(serverHelloMsg)
 	case typeNewSessionTicket:
-		m = new(newSessionTicketMsg)
+		if c.vers >= VersionTLS13 {
+			m = new(newSessionTicketMsgTLS13)
+		} else {
+			m = new(newSessionTicketMsg)
+		}
+	case typeEncryptedExtensions:
+		m = new(encryptedExtensionsMsg)
 	case typeCertificate:
-		m = new(certificateMsg)
+		if c.vers >= VersionTLS13 {
+			m = new(certificateMsgTLS13)
+		} else {
+			m = new(certificateMsg)
+		}
 	case typeCertificateRequest:
-		m = &certificateRequestMsg{
-			hasSignatureAndHash: c.vers >= VersionTLS12,
+		if c.vers >= VersionTLS13 {
+			m = new(certificateRequestMsgTLS13)
+		} else {
+			m = &certificateRequestMsg{
+				hasSignatureAndHash: c.vers >= VersionTLS12,
+			}
 		}
+	case typeKeyUpdate:
+		m = new(keyUpdateMsg)
 	case typeCertificateStatus:
 		m = new(certificateStatusMsg)
 	case typeServerKeyExchange:
@@ -859,6 +975,69 @@ func (c *Conn) readHandshake() (interface{}, error) {
 	return m, nil
 }
 
+// handlePostHandshakeMessage processes a TLS 1.3 handshake message that
+// arrived after the handshake. See RFC 8446, section 4.6.
+// c.in.Mutex < L; c.out.Mutex < L.
+func (c *Conn) handlePostHandshakeMessage() error {
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+
+	switch msg := msg.(type) {
+	case *newSessionTicketMsgTLS13:
+		if !c.isClient {
+			c.sendAlert(alertUnexpectedMessage)
+			return c.in.setErrorLocked(errors.New("tls: received a session ticket from a client"))
+		}
+		return c.handleNewSessionTicket(msg)
+	case *keyUpdateMsg:
+		return c.handleKeyUpdate(msg)
+	}
+	c.sendAlert(alertUnexpectedMessage)
+	return c.in.setErrorLocked(fmt.Errorf("tls: received unexpected handshake message of type %T after the handshake", msg))
+}
+
+// handleKeyUpdate switches to the next read traffic secret and, if the
+// peer requested it, updates the write traffic secret too.
+// c.in.Mutex < L; c.out.Mutex < L.
+func (c *Conn) handleKeyUpdate(keyUpdate *keyUpdateMsg) error {
+	// The new keys apply from the next record, so the message must end
+	// the current one.
+	if c.hand.Len() > 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return c.in.setErrorLocked(errors.New("tls: KeyUpdate not at a record boundary"))
+	}
+	suite := cipherSuiteTLS13ByID(c.cipherSuite)
+	c.in.setTrafficSecret(suite, suite.nextTrafficSecret(c.in.trafficSecret))
+
+	if keyUpdate.updateRequested {
+		c.out.Lock()
+		defer c.out.Unlock()
+		if err := c.sendKeyUpdateLocked(false); err != nil {
+			return c.in.setErrorLocked(err)
+		}
+	}
+	return nil
+}
+
+// sendKeyUpdateLocked sends a KeyUpdate message and switches to the next
+// write traffic secret. If requestUpdate is true, the peer is asked to
+// update its own keys.
+// c.out.Mutex <= L.
+func (c *Conn) sendKeyUpdateLocked(requestUpdate bool) error {
+	if err := c.out.err; err != nil {
+		return err
+	}
+	msg := &keyUpdateMsg{updateRequested: requestUpdate}
+	if _, err := c.writeRecord(recordTypeHandshake, msg.marshal()); err != nil {
+		return c.out.setErrorLocked(err)
+	}
+	suite := cipherSuiteTLS13ByID(c.cipherSuite)
+	c.out.setTrafficSecret(suite, suite.nextTrafficSecret(c.out.trafficSecret))
+	return nil
+}
+
 var errClosed = errors.New("crypto/tls: use of closed connection")
 
 // Write writes data to the connection.
@@ -899,6 +1078,14 @@ func (c *Conn) Write(b []byte) (int, error) {
 	// https://bugzilla.mozilla.org/show_bug.cgi?id=665814
 	// http://www.imperialviolet.org/2012/01/15/beastfollowup.html
 
+	// Update the keys of TLS 1.3 connections well before the AEAD
+	// limits on the number of records. See RFC 8446, section 5.5.
+	if c.vers >= VersionTLS13 && c.out.seq[0]|c.out.seq[1]|c.out.seq[2]|c.out.seq[3]|c.out.seq[4] != 0 {
+		if err := c.sendKeyUpdateLocked(false); err != nil {
+			return 0, err
+		}
+	}
+
 	var m int
 	if len(b) > 1 && c.vers <= VersionTLS10 {
 		if _, ok := c.out.cipher.(cipher.BlockMode); ok {
@@ -938,6 +1125,11 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 				// Soft error, like EAGAIN
 				return 0, err
 			}
+			for c.hand.Len() > 0 && c.in.err == nil {
+				if err := c.handlePostHandshakeMessage(); err != nil {
+					return 0, err
+				}
+			}
 		}
 		if err := c.in.err; err != nil {
 			return 0, err
@@ -1053,7 +1245,7 @@ func (c *Conn) ConnectionState() ConnectionState {
 		state.ServerName = c.serverName
 		state.SignedCertificateTimestamps = c.scts
 		state.OCSPResponse = c.ocspResponse
-		if !c.didResume {
+		if !c.didResume && c.vers < VersionTLS13 {
 			state.TLSUnique = c.firstFinished[:]
 		}
 	}
@@ -13,10 +13,12 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type clientHandshakeState struct {
@@ -64,6 +66,12 @@ func (c *Conn) clientHandshake() error {
 		alpnProtocols:       c.config.NextProtos,
 	}
 
+	// TLS 1.3 is negotiated with the supported_versions extension, and
+	// the legacy version is frozen at TLS 1.2. See RFC 8446, section 4.1.2.
+	if hello.vers > VersionTLS12 {
+		hello.vers = VersionTLS12
+	}
+
 	possibleCipherSuites := c.config.cipherSuites()
 	hello.cipherSuites = make([]uint16, 0, len(possibleCipherSuites))
 
@@ -93,6 +101,26 @@ NextCipherSuite:
 		hello.signatureAndHashes = supportedSignatureAlgorithms
 	}
 
+	var ecdheParams ecdheParameters
+	if c.config.maxVersion() >= VersionTLS13 {
+		hello.supportedVersions = c.config.supportedVersions()
+		hello.signatureAndHashes = supportedSignatureAlgorithmsAll
+
+		suites := append([]uint16(nil), defaultCipherSuitesTLS13()...)
+		hello.cipherSuites = append(suites, hello.cipherSuites...)
+
+		// Send a key share for the most preferred group only. If the
+		// server prefers another one it asks for it with a
+		// HelloRetryRequest.
+		curveID := c.config.curvePreferences()[0]
+		if ecdheParams, err = generateECDHEParameters(c.config.rand(), curveID); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hello.keyShares = []keyShare{{group: curveID, data: ecdheParams.PublicKey()}}
+		hello.pskModes = []uint8{pskModeDHE}
+	}
+
 	var session *ClientSessionState
 	var cacheKey string
 	sessionCache := c.config.ClientSessionCache
@@ -109,7 +137,8 @@ NextCipherSuite:
 		candidateSession, ok := sessionCache.Get(cacheKey)
 		if ok {
 			// Check that the ciphersuite/version used for the
-			// previous session are still valid.
+			// previous session are still valid. TLS 1.3 sessions
+			// are also only usable until the ticket expires.
 			cipherSuiteOk := false
 			for _, id := range hello.cipherSuites {
 				if id == candidateSession.cipherSuite {
@@ -120,13 +149,33 @@ NextCipherSuite:
 
 			versOk := candidateSession.vers >= c.config.minVersion() &&
 				candidateSession.vers <= c.config.maxVersion()
+			if candidateSession.vers >= VersionTLS13 && !c.config.time().Before(candidateSession.useBy) {
+				versOk = false
+			}
 			if versOk && cipherSuiteOk {
 				session = candidateSession
 			}
 		}
 	}
 
-	if session != nil {
+	var earlySecret, binderKey []byte
+	if session != nil && session.vers >= VersionTLS13 {
+		// The TLS 1.3 session is offered as a PSK, whose binder
+		// authenticates this ClientHello. See RFC 8446, section 4.2.11.
+		suite := cipherSuiteTLS13ByID(session.cipherSuite)
+		ticketAge := uint32(c.config.time().Sub(session.receivedAt) / time.Millisecond)
+		hello.pskIdentities = []pskIdentity{{
+			label:               session.sessionTicket,
+			obfuscatedTicketAge: ticketAge + session.ageAdd,
+		}}
+		hello.pskBinders = [][]byte{make([]byte, suite.hash.Size())}
+
+		earlySecret = suite.extract(session.masterSecret, nil)
+		binderKey = suite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
+		transcript := suite.hash.New()
+		transcript.Write(hello.marshalWithoutBinders())
+		hello.updateBinders([][]byte{suite.finishedHash(binderKey, transcript)})
+	} else if session != nil {
 		hello.sessionTicket = session.sessionTicket
 		// A random session ID is used to detect when the
 		// server accepted the ticket and is resuming a session
@@ -152,6 +201,30 @@ NextCipherSuite:
 		return unexpectedMessageError(serverHello, msg)
 	}
 
+	if serverHello.supportedVersion != 0 {
+		if len(hello.supportedVersions) == 0 || serverHello.supportedVersion != VersionTLS13 {
+			c.sendAlert(alertIllegalParameter)
+			return fmt.Errorf("tls: server selected unsupported protocol version %x", serverHello.supportedVersion)
+		}
+		c.vers = VersionTLS13
+		c.haveVers = true
+
+		hs := &clientHandshakeStateTLS13{
+			c:           c,
+			serverHello: serverHello,
+			hello:       hello,
+			ecdheParams: ecdheParams,
+			session:     session,
+			earlySecret: earlySecret,
+			binderKey:   binderKey,
+		}
+		return hs.handshake()
+	}
+	if session != nil && session.vers >= VersionTLS13 {
+		// The TLS 1.3 session can't be resumed with TLS 1.2.
+		session = nil
+	}
+
 	vers, ok := c.config.mutualVersion(serverHello.vers)
 	if !ok || vers < VersionTLS10 {
 		// TLS 1.0 is the minimum version supported as a client.
@@ -161,6 +234,18 @@ NextCipherSuite:
 	c.vers = vers
 	c.haveVers = true
 
+	// A server that supports TLS 1.3 marks its random when it negotiates
+	// a lower version, which a client that offered TLS 1.3, or TLS 1.2
+	// and got less, must reject. See RFC 8446, section 4.1.3.
+	if len(serverHello.random) == 32 {
+		canary := string(serverHello.random[24:])
+		if (c.config.maxVersion() >= VersionTLS13 && canary == downgradeCanaryTLS12) ||
+			(c.config.maxVersion() >= VersionTLS12 && vers <= VersionTLS11 && canary == downgradeCanaryTLS11) {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: downgrade attempt detected, possibly due to a MitM attack or a broken middlebox")
+		}
+	}
+
 	suite := mutualCipherSuite(hello.cipherSuites, serverHello.cipherSuite)
 	if suite == nil {
 		c.sendAlert(alertHandshakeFailure)
@@ -247,46 +332,10 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 	}
 	hs.finishedHash.Write(certMsg.marshal())
 
-	certs := make([]*x509.Certificate, len(certMsg.certificates))
-	for i, asn1Data := range certMsg.certificates {
-		cert, err := x509.ParseCertificate(asn1Data)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return errors.New("tls: failed to parse certificate from server: " + err.Error())
-		}
-		certs[i] = cert
-	}
-
-	if !c.config.InsecureSkipVerify {
-		opts := x509.VerifyOptions{
-			Roots:         c.config.RootCAs,
-			CurrentTime:   c.config.time(),
-			DNSName:       c.config.ServerName,
-			Intermediates: x509.NewCertPool(),
-		}
-
-		for i, cert := range certs {
-			if i == 0 {
-				continue
-			}
-			opts.Intermediates.AddCert(cert)
-		}
-		c.verifiedChains, err = certs[0].Verify(opts)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return err
-		}
-	}
-
-	switch certs[0].PublicKey.(type) {
-	case *rsa.PublicKey, *ecdsa.PublicKey:
-		break
-	default:
-		c.sendAlert(alertUnsupportedCertificate)
-		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	if err := c.verifyServerCertificate(certMsg.certificates); err != nil {
+		return err
 	}
-
-	c.peerCertificates = certs
+	certs := c.peerCertificates
 
 	if hs.serverHello.ocspStapling {
 		msg, err = c.readHandshake()
@@ -346,57 +395,8 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 
 		hs.finishedHash.Write(certReq.marshal())
 
-		var rsaAvail, ecdsaAvail bool
-		for _, certType := range certReq.certificateTypes {
-			switch certType {
-			case certTypeRSASign:
-				rsaAvail = true
-			case certTypeECDSASign:
-				ecdsaAvail = true
-			}
-		}
-
-		// We need to search our list of client certs for one
-		// where SignatureAlgorithm is acceptable to the server and the
-		// Issuer is in certReq.certificateAuthorities
-	findCert:
-		for i, chain := range c.config.Certificates {
-			if !rsaAvail && !ecdsaAvail {
-				continue
-			}
-
-			for j, cert := range chain.Certificate {
-				x509Cert := chain.Leaf
-				// parse the certificate if this isn't the leaf
-				// node, or if chain.Leaf was nil
-				if j != 0 || x509Cert == nil {
-					if x509Cert, err = x509.ParseCertificate(cert); err != nil {
-						c.sendAlert(alertInternalError)
-						return errors.New("tls: failed to parse client certificate #" + strconv.Itoa(i) + ": " + err.Error())
-					}
-				}
-
-				switch {
-				case rsaAvail && x509Cert.PublicKeyAlgorithm == x509.RSA:
-				case ecdsaAvail && x509Cert.PublicKeyAlgorithm == x509.ECDSA:
-				default:
-					continue findCert
-				}
-
-				if len(certReq.certificateAuthorities) == 0 {
-					// they gave us an empty list, so just take the
-					// first cert from c.config.Certificates
-					chainToSend = &chain
-					break findCert
-				}
-
-				for _, ca := range certReq.certificateAuthorities {
-					if bytes.Equal(x509Cert.RawIssuer, ca) {
-						chainToSend = &chain
-						break findCert
-					}
-				}
-			}
+		if chainToSend, err = hs.selectClientCertificate(certReq); err != nil {
+			return err
 		}
 
 		msg, err = c.readHandshake()
@@ -483,12 +483,172 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 	}
 
 	hs.masterSecret = masterFromPreMasterSecret(c.vers, hs.suite, preMasterSecret, hs.hello.random, hs.serverHello.random)
+	if err := c.config.writeKeyLog(keyLogLabelTLS12, hs.hello.random, hs.masterSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to write to key log: " + err.Error())
+	}
 
 	hs.finishedHash.discardHandshakeBuffer()
 
 	return nil
 }
 
+// selectClientCertificate returns the certificate chain to send in reply to
+// a TLS 1.2 or earlier CertificateRequest, or nil if there is none.
+func (hs *clientHandshakeState) selectClientCertificate(certReq *certificateRequestMsg) (*Certificate, error) {
+	c := hs.c
+
+	var rsaAvail, ecdsaAvail bool
+	for _, certType := range certReq.certificateTypes {
+		switch certType {
+		case certTypeRSASign:
+			rsaAvail = true
+		case certTypeECDSASign:
+			ecdsaAvail = true
+		}
+	}
+
+	if c.config.GetClientCertificate != nil {
+		cri := &CertificateRequestInfo{
+			AcceptableCAs: certReq.certificateAuthorities,
+		}
+		if certReq.hasSignatureAndHash {
+			for _, sigHash := range certReq.signatureAndHashes {
+				switch {
+				case rsaAvail && sigHash.signature == signatureRSA:
+				case ecdsaAvail && sigHash.signature == signatureECDSA:
+				default:
+					continue
+				}
+				cri.SignatureSchemes = append(cri.SignatureSchemes, signatureScheme(sigHash))
+			}
+		} else {
+			// Prior to TLS 1.2, the certificate types imply SHA-1
+			// based signatures.
+			if rsaAvail {
+				cri.SignatureSchemes = append(cri.SignatureSchemes, PKCS1WithSHA1)
+			}
+			if ecdsaAvail {
+				cri.SignatureSchemes = append(cri.SignatureSchemes, ECDSAWithSHA1)
+			}
+		}
+		return c.getClientCertificate(cri)
+	}
+
+	// We need to search our list of client certs for one
+	// where SignatureAlgorithm is acceptable to the server and the
+	// Issuer is in certReq.certificateAuthorities
+findCert:
+	for i, chain := range c.config.Certificates {
+		if !rsaAvail && !ecdsaAvail {
+			continue
+		}
+
+		for j, cert := range chain.Certificate {
+			x509Cert := chain.Leaf
+			// parse the certificate if this isn't the leaf
+			// node, or if chain.Leaf was nil
+			if j != 0 || x509Cert == nil {
+				var err error
+				if x509Cert, err = x509.ParseCertificate(cert); err != nil {
+					c.sendAlert(alertInternalError)
+					return nil, errors.New("tls: failed to parse client certificate #" + strconv.Itoa(i) + ": " + err.Error())
+				}
+			}
+
+			switch {
+			case rsaAvail && x509Cert.PublicKeyAlgorithm == x509.RSA:
+			case ecdsaAvail && x509Cert.PublicKeyAlgorithm == x509.ECDSA:
+			default:
+				continue findCert
+			}
+
+			if len(certReq.certificateAuthorities) == 0 {
+				// they gave us an empty list, so just take the
+				// first cert from c.config.Certificates
+				return &chain, nil
+			}
+
+			for _, ca := range certReq.certificateAuthorities {
+				if bytes.Equal(x509Cert.RawIssuer, ca) {
+					return &chain, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// getClientCertificate calls the GetClientCertificate callback of the
+// Config. It returns nil if the callback chose not to send a certificate.
+func (c *Conn) getClientCertificate(cri *CertificateRequestInfo) (*Certificate, error) {
+	cert, err := c.config.GetClientCertificate(cri)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return nil, err
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, nil
+	}
+	return cert, nil
+}
+
+// verifyServerCertificate parses and, unless InsecureSkipVerify is set,
+// verifies the certificate chain presented by the server, and records it
+// in c.peerCertificates.
+func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
+	certs := make([]*x509.Certificate, len(certificates))
+	for i, asn1Data := range certificates {
+		cert, err := x509.ParseCertificate(asn1Data)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return errors.New("tls: failed to parse certificate from server: " + err.Error())
+		}
+		certs[i] = cert
+	}
+
+	if !c.config.InsecureSkipVerify {
+		opts := x509.VerifyOptions{
+			Roots:         c.config.RootCAs,
+			CurrentTime:   c.config.time(),
+			DNSName:       c.config.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+
+		for i, cert := range certs {
+			if i == 0 {
+				continue
+			}
+			opts.Intermediates.AddCert(cert)
+		}
+		var err error
+		c.verifiedChains, err = certs[0].Verify(opts)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return err
+		}
+	}
+
+	if c.config.VerifyPeerCertificate != nil {
+		if err := c.config.VerifyPeerCertificate(certificates, c.verifiedChains); err != nil {
+			c.sendAlert(alertBadCertificate)
+			return err
+		}
+	}
+
+	switch certs[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		break
+	default:
+		c.sendAlert(alertUnsupportedCertificate)
+		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	}
+
+	c.peerCertificates = certs
+	return nil
+}
+
 func (hs *clientHandshakeState) establishKeys() error {
 	c := hs.c
 
@@ -555,6 +715,10 @@ func (hs *clientHandshakeState) processServerHello() (bool, error) {
 	if hs.serverResumedSession() {
 		// Restore masterSecret and peerCerts from previous state
 		hs.masterSecret = hs.session.masterSecret
+		if err := c.config.writeKeyLog(keyLogLabelTLS12, hs.hello.random, hs.masterSecret); err != nil {
+			c.sendAlert(alertInternalError)
+			return false, errors.New("tls: failed to write to key log: " + err.Error())
+		}
 		c.peerCertificates = hs.session.serverCertificates
 		c.verifiedChains = hs.session.verifiedChains
 		return true, nil
@@ -693,3 +857,599 @@ func hostnameInSNI(name string) string {
 	}
 	return name
 }
+
+// clientHandshakeStateTLS13 contains details of a TLS 1.3 client handshake
+// in progress. See RFC 8446, section 2.
+type clientHandshakeStateTLS13 struct {
+	c           *Conn
+	serverHello *serverHelloMsg
+	hello       *clientHelloMsg
+	ecdheParams ecdheParameters
+
+	// session, earlySecret and binderKey are set if a PSK is offered.
+	session     *ClientSessionState
+	earlySecret []byte
+	binderKey   []byte
+
+	certReq       *certificateRequestMsgTLS13
+	usingPSK      bool
+	suite         *cipherSuiteTLS13
+	transcript    hash.Hash
+	masterSecret  []byte
+	trafficSecret []byte // client_application_traffic_secret_0
+}
+
+func (hs *clientHandshakeStateTLS13) handshake() error {
+	c := hs.c
+
+	if err := hs.checkServerHelloOrHRR(); err != nil {
+		return err
+	}
+
+	hs.transcript = hs.suite.hash.New()
+	hs.transcript.Write(hs.hello.marshal())
+
+	if bytes.Equal(hs.serverHello.random, helloRetryRequestRandom) {
+		if err := hs.processHelloRetryRequest(); err != nil {
+			return err
+		}
+	}
+
+	hs.transcript.Write(hs.serverHello.marshal())
+
+	if err := hs.processServerHello(); err != nil {
+		return err
+	}
+	if err := hs.establishHandshakeKeys(); err != nil {
+		return err
+	}
+	if err := hs.readServerParameters(); err != nil {
+		return err
+	}
+	if err := hs.readServerCertificate(); err != nil {
+		return err
+	}
+	if err := hs.readServerFinished(); err != nil {
+		return err
+	}
+	if err := hs.sendClientCertificate(); err != nil {
+		return err
+	}
+	if err := hs.sendClientFinished(); err != nil {
+		return err
+	}
+
+	c.handshakeComplete = true
+	return nil
+}
+
+// checkServerHelloOrHRR does validity checks that apply to both ServerHello
+// and HelloRetryRequest messages. It sets hs.suite.
+func (hs *clientHandshakeStateTLS13) checkServerHelloOrHRR() error {
+	c := hs.c
+
+	if hs.serverHello.supportedVersion != VersionTLS13 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected TLS 1.3 using the legacy version field")
+	}
+	if hs.serverHello.vers != VersionTLS12 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent an incorrect legacy version")
+	}
+
+	if hs.serverHello.nextProtoNeg ||
+		len(hs.serverHello.nextProtos) != 0 ||
+		hs.serverHello.ocspStapling ||
+		hs.serverHello.ticketSupported ||
+		hs.serverHello.secureRenegotiation ||
+		len(hs.serverHello.alpnProtocol) != 0 ||
+		len(hs.serverHello.scts) != 0 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent a ServerHello extension forbidden in TLS 1.3")
+	}
+
+	if !bytes.Equal(hs.hello.sessionId, hs.serverHello.sessionId) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server did not echo the legacy session ID")
+	}
+
+	if hs.serverHello.compressionMethod != compressionNone {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected unsupported compression format")
+	}
+
+	selectedSuite := cipherSuiteTLS13ByID(hs.serverHello.cipherSuite)
+	if hs.suite != nil && selectedSuite != hs.suite {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server changed cipher suite after a HelloRetryRequest")
+	}
+	if selectedSuite == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server chose an unconfigured cipher suite")
+	}
+	hs.suite = selectedSuite
+	c.cipherSuite = hs.suite.id
+
+	return nil
+}
+
+// processHelloRetryRequest handles the HelloRetryRequest in hs.serverHello,
+// sends a second ClientHello, and reads the ServerHello in response.
+func (hs *clientHandshakeStateTLS13) processHelloRetryRequest() error {
+	c := hs.c
+
+	// The first ClientHello is replaced in the transcript by a synthetic
+	// message holding its hash. See RFC 8446, section 4.4.1.
+	firstHello := hs.hello.marshal()
+	retryTranscript := append(hs.suite.messageHash(firstHello), hs.serverHello.marshal()...)
+	hs.transcript.Reset()
+	hs.transcript.Write(retryTranscript)
+
+	if hs.serverHello.serverShare.group != 0 {
+		c.sendAlert(alertDecodeError)
+		return errors.New("tls: received malformed key_share extension")
+	}
+
+	curveID := hs.serverHello.selectedGroup
+	if curveID == 0 && len(hs.serverHello.cookie) == 0 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent an unnecessary HelloRetryRequest message")
+	}
+
+	hello := *hs.hello
+	hello.raw = nil
+	hello.cookie = hs.serverHello.cookie
+	if curveID != 0 {
+		curveOK := false
+		for _, id := range hello.supportedCurves {
+			if id == curveID {
+				curveOK = true
+				break
+			}
+		}
+		if !curveOK || curveID == hs.ecdheParams.CurveID() {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: server selected unsupported group")
+		}
+		params, err := generateECDHEParameters(c.config.rand(), curveID)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hs.ecdheParams = params
+		hello.keyShares = []keyShare{{group: curveID, data: params.PublicKey()}}
+	}
+
+	if len(hello.pskIdentities) > 0 {
+		pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
+		if pskSuite.hash == hs.suite.hash {
+			// Update the binder, which now covers the messages of
+			// the first round trip too.
+			ticketAge := uint32(c.config.time().Sub(hs.session.receivedAt) / time.Millisecond)
+			hello.pskIdentities = []pskIdentity{{
+				label:               hs.session.sessionTicket,
+				obfuscatedTicketAge: ticketAge + hs.session.ageAdd,
+			}}
+			transcript := hs.suite.hash.New()
+			transcript.Write(retryTranscript)
+			transcript.Write(hello.marshalWithoutBinders())
+			hello.updateBinders([][]byte{hs.suite.finishedHash(hs.binderKey, transcript)})
+		} else {
+			// The server selected a cipher suite incompatible with
+			// the PSK, so it can't be used.
+			hello.pskIdentities = nil
+			hello.pskBinders = nil
+		}
+	}
+	hs.hello = &hello
+
+	hs.transcript.Write(hs.hello.marshal())
+	if _, err := c.writeRecord(recordTypeHandshake, hs.hello.marshal()); err != nil {
+		return err
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	serverHello, ok := msg.(*serverHelloMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(serverHello, msg)
+	}
+	hs.serverHello = serverHello
+
+	return hs.checkServerHelloOrHRR()
+}
+
+func (hs *clientHandshakeStateTLS13) processServerHello() error {
+	c := hs.c
+
+	if bytes.Equal(hs.serverHello.random, helloRetryRequestRandom) {
+		c.sendAlert(alertUnexpectedMessage)
+		return errors.New("tls: server sent two HelloRetryRequest messages")
+	}
+
+	if len(hs.serverHello.cookie) != 0 || hs.serverHello.selectedGroup != 0 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server sent a HelloRetryRequest extension in a ServerHello")
+	}
+
+	if hs.serverHello.serverShare.group != hs.ecdheParams.CurveID() {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected unsupported group")
+	}
+
+	if !hs.serverHello.selectedIdentityPresent {
+		return nil
+	}
+
+	if int(hs.serverHello.selectedIdentity) >= len(hs.hello.pskIdentities) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected an invalid PSK")
+	}
+	pskSuite := cipherSuiteTLS13ByID(hs.session.cipherSuite)
+	if pskSuite.hash != hs.suite.hash {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: server selected an invalid PSK and cipher suite pair")
+	}
+
+	hs.usingPSK = true
+	c.didResume = true
+	c.peerCertificates = hs.session.serverCertificates
+	c.verifiedChains = hs.session.verifiedChains
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) establishHandshakeKeys() error {
+	c := hs.c
+
+	sharedKey := hs.ecdheParams.SharedKey(hs.serverHello.serverShare.data)
+	if sharedKey == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid server key share")
+	}
+
+	// The handshake keys apply from the next record, so the ServerHello
+	// must end the current one.
+	if c.hand.Len() > 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return errors.New("tls: handshake messages sent before the key change")
+	}
+
+	earlySecret := hs.earlySecret
+	if !hs.usingPSK {
+		earlySecret = hs.suite.extract(nil, nil)
+	}
+	handshakeSecret := hs.suite.extract(sharedKey,
+		hs.suite.deriveSecret(earlySecret, "derived", nil))
+
+	clientSecret := hs.suite.deriveSecret(handshakeSecret, clientHandshakeTrafficLabel, hs.transcript)
+	c.out.setTrafficSecret(hs.suite, clientSecret)
+	serverSecret := hs.suite.deriveSecret(handshakeSecret, serverHandshakeTrafficLabel, hs.transcript)
+	c.in.setTrafficSecret(hs.suite, serverSecret)
+
+	if err := c.config.writeKeyLog(keyLogLabelClientHandshake, hs.hello.random, clientSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to write to key log: " + err.Error())
+	}
+	if err := c.config.writeKeyLog(keyLogLabelServerHandshake, hs.hello.random, serverSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to write to key log: " + err.Error())
+	}
+
+	hs.masterSecret = hs.suite.extract(nil,
+		hs.suite.deriveSecret(handshakeSecret, "derived", nil))
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) readServerParameters() error {
+	c := hs.c
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	encryptedExtensions, ok := msg.(*encryptedExtensionsMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(encryptedExtensions, msg)
+	}
+	hs.transcript.Write(encryptedExtensions.marshal())
+
+	if len(encryptedExtensions.alpnProtocol) != 0 {
+		if len(hs.hello.alpnProtocols) == 0 {
+			c.sendAlert(alertHandshakeFailure)
+			return errors.New("tls: server advertised unrequested ALPN extension")
+		}
+		c.clientProtocol = encryptedExtensions.alpnProtocol
+		c.clientProtocolFallback = false
+	}
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) readServerCertificate() error {
+	c := hs.c
+
+	// Either a PSK or a certificate is always used, but not both.
+	if hs.usingPSK {
+		return nil
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+
+	certReq, ok := msg.(*certificateRequestMsgTLS13)
+	if ok {
+		hs.transcript.Write(certReq.marshal())
+		hs.certReq = certReq
+
+		msg, err = c.readHandshake()
+		if err != nil {
+			return err
+		}
+	}
+
+	certMsg, ok := msg.(*certificateMsgTLS13)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certMsg, msg)
+	}
+	if len(certMsg.certificates) == 0 {
+		c.sendAlert(alertDecodeError)
+		return errors.New("tls: received empty certificates message")
+	}
+	hs.transcript.Write(certMsg.marshal())
+
+	c.scts = certMsg.scts
+	c.ocspResponse = certMsg.ocspStaple
+
+	if err := c.verifyServerCertificate(certMsg.certificates); err != nil {
+		return err
+	}
+
+	msg, err = c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certVerify, ok := msg.(*certificateVerifyMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certVerify, msg)
+	}
+
+	pub := c.peerCertificates[0].PublicKey
+	if !isSupportedSignatureAndHash(certVerify.signatureAndHash, signatureAlgorithmsTLS13ForKey(pub)) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid signature algorithm for the server certificate")
+	}
+	sigHash, err := hashForSignatureAlgorithm(certVerify.signatureAndHash)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	digest := signedMessage(sigHash, serverSignatureContext, hs.transcript)
+	if err := verifyHandshakeSignature(pub, certVerify.signatureAndHash, digest, certVerify.signature); err != nil {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: invalid signature by the server certificate: " + err.Error())
+	}
+
+	hs.transcript.Write(certVerify.marshal())
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) readServerFinished() error {
+	c := hs.c
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	finished, ok := msg.(*finishedMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(finished, msg)
+	}
+
+	verify := hs.suite.finishedHash(c.in.trafficSecret, hs.transcript)
+	if len(verify) != len(finished.verifyData) ||
+		subtle.ConstantTimeCompare(verify, finished.verifyData) != 1 {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: server's Finished message was incorrect")
+	}
+	hs.transcript.Write(finished.marshal())
+
+	if c.hand.Len() > 0 {
+		c.sendAlert(alertUnexpectedMessage)
+		return errors.New("tls: handshake messages sent before the key change")
+	}
+
+	// Derive the application secrets, which cover the transcript through
+	// the server Finished, and switch to the server one.
+	hs.trafficSecret = hs.suite.deriveSecret(hs.masterSecret, clientApplicationTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(hs.masterSecret, serverApplicationTrafficLabel, hs.transcript)
+	c.in.setTrafficSecret(hs.suite, serverSecret)
+
+	if err := c.config.writeKeyLog(keyLogLabelClientTraffic, hs.hello.random, hs.trafficSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to write to key log: " + err.Error())
+	}
+	if err := c.config.writeKeyLog(keyLogLabelServerTraffic, hs.hello.random, serverSecret); err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to write to key log: " + err.Error())
+	}
+
+	return nil
+}
+
+func (hs *clientHandshakeStateTLS13) sendClientCertificate() error {
+	c := hs.c
+
+	if hs.certReq == nil {
+		return nil
+	}
+
+	chainToSend, err := hs.selectClientCertificate()
+	if err != nil {
+		return err
+	}
+
+	// The client must send a Certificate message, even if it's empty.
+	certMsg := new(certificateMsgTLS13)
+	if chainToSend != nil {
+		certMsg.certificates = chainToSend.Certificate
+	}
+	hs.transcript.Write(certMsg.marshal())
+	if _, err := c.writeRecord(recordTypeHandshake, certMsg.marshal()); err != nil {
+		return err
+	}
+
+	if chainToSend == nil {
+		return nil
+	}
+
+	key, ok := chainToSend.PrivateKey.(crypto.Signer)
+	if !ok {
+		c.sendAlert(alertInternalError)
+		return fmt.Errorf("tls: client certificate private key of type %T does not implement crypto.Signer", chainToSend.PrivateKey)
+	}
+	certVerify := &certificateVerifyMsg{hasSignatureAndHash: true}
+	certVerify.signatureAndHash, err = selectSignatureAlgorithmTLS13(key.Public(), hs.certReq.signatureAndHashes)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	sigHash, err := hashForSignatureAlgorithm(certVerify.signatureAndHash)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	digest := signedMessage(sigHash, clientSignatureContext, hs.transcript)
+	certVerify.signature, err = signHandshake(c.config.rand(), key, certVerify.signatureAndHash, digest)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to sign handshake with client certificate: " + err.Error())
+	}
+
+	hs.transcript.Write(certVerify.marshal())
+	if _, err := c.writeRecord(recordTypeHandshake, certVerify.marshal()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// selectClientCertificate returns the certificate chosen by the
+// GetClientCertificate callback or, without one, the first configured
+// certificate that can sign with one of the algorithms of the
+// CertificateRequest and, if the server listed any, was issued by one of
+// its certificate authorities. It returns nil if there is none.
+func (hs *clientHandshakeStateTLS13) selectClientCertificate() (*Certificate, error) {
+	c := hs.c
+
+	if c.config.GetClientCertificate != nil {
+		cri := &CertificateRequestInfo{
+			AcceptableCAs: hs.certReq.certificateAuthorities,
+		}
+		for _, sigHash := range hs.certReq.signatureAndHashes {
+			cri.SignatureSchemes = append(cri.SignatureSchemes, signatureScheme(sigHash))
+		}
+		return c.getClientCertificate(cri)
+	}
+
+	for i := range c.config.Certificates {
+		chain := &c.config.Certificates[i]
+		key, ok := chain.PrivateKey.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		if _, err := selectSignatureAlgorithmTLS13(key.Public(), hs.certReq.signatureAndHashes); err != nil {
+			continue
+		}
+		if len(hs.certReq.certificateAuthorities) == 0 {
+			return chain, nil
+		}
+
+		for j, cert := range chain.Certificate {
+			x509Cert := chain.Leaf
+			// parse the certificate if this isn't the leaf
+			// node, or if chain.Leaf was nil
+			if j != 0 || x509Cert == nil {
+				var err error
+				if x509Cert, err = x509.ParseCertificate(cert); err != nil {
+					c.sendAlert(alertInternalError)
+					return nil, errors.New("tls: failed to parse client certificate #" + strconv.Itoa(i) + ": " + err.Error())
+				}
+			}
+			for _, ca := range hs.certReq.certificateAuthorities {
+				if bytes.Equal(x509Cert.RawIssuer, ca) {
+					return chain, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (hs *clientHandshakeStateTLS13) sendClientFinished() error {
+	c := hs.c
+
+	finished := &finishedMsg{
+		verifyData: hs.suite.finishedHash(c.out.trafficSecret, hs.transcript),
+	}
+
+	hs.transcript.Write(finished.marshal())
+	if _, err := c.writeRecord(recordTypeHandshake, finished.marshal()); err != nil {
+		return err
+	}
+
+	c.out.setTrafficSecret(hs.suite, hs.trafficSecret)
+	c.resumptionSecret = hs.suite.deriveSecret(hs.masterSecret, resumptionLabel, hs.transcript)
+
+	return nil
+}
+
+// handleNewSessionTicket stores a TLS 1.3 session ticket, received after
+// the handshake, in the ClientSessionCache for resuming the session later.
+// c.in.Mutex < L.
+func (c *Conn) handleNewSessionTicket(msg *newSessionTicketMsgTLS13) error {
+	sessionCache := c.config.ClientSessionCache
+	if sessionCache == nil || c.config.SessionTicketsDisabled {
+		return nil
+	}
+
+	// A zero lifetime means the ticket must be discarded immediately.
+	if msg.lifetime == 0 {
+		return nil
+	}
+	lifetime := time.Duration(msg.lifetime) * time.Second
+	if lifetime > maxSessionTicketLifetime {
+		c.sendAlert(alertIllegalParameter)
+		return c.in.setErrorLocked(errors.New("tls: received a session ticket with invalid lifetime"))
+	}
+
+	suite := cipherSuiteTLS13ByID(c.cipherSuite)
+	psk := suite.expandLabel(c.resumptionSecret, "resumption", msg.nonce, suite.hash.Size())
+
+	now := c.config.time()
+	session := &ClientSessionState{
+		sessionTicket:      msg.label,
+		vers:               c.vers,
+		cipherSuite:        c.cipherSuite,
+		masterSecret:       psk,
+		serverCertificates: c.peerCertificates,
+		verifiedChains:     c.verifiedChains,
+		receivedAt:         now,
+		useBy:              now.Add(lifetime),
+		ageAdd:             msg.ageAdd,
+	}
+
+	cacheKey := clientSessionCacheKey(c.conn.RemoteAddr(), c.config)
+	sessionCache.Put(cacheKey, session)
+	return nil
+}
@@ -24,6 +24,26 @@ type clientHelloMsg struct {
 	signatureAndHashes  []signatureAndHash
 	secureRenegotiation bool
 	alpnProtocols       []string
+	supportedVersions   []uint16
+	cookie              []byte
+	keyShares           []keyShare
+	pskModes            []uint8
+	pskIdentities       []pskIdentity
+	pskBinders          [][]byte
+}
+
+// keyShare is a KeyShareEntry of the TLS 1.3 key_share extension. See RFC
+// 8446, section 4.2.8.
+type keyShare struct {
+	group CurveID
+	data  []byte
+}
+
+// pskIdentity is a PskIdentity of the TLS 1.3 pre_shared_key extension.
+// See RFC 8446, section 4.2.11.
+type pskIdentity struct {
+	label               []byte
+	obfuscatedTicketAge uint32
 }
 
 func (m *clientHelloMsg) equal(i interface{}) bool {
@@ -48,7 +68,13 @@ func (m *clientHelloMsg) equal(i interface{}) bool {
 		bytes.Equal(m.sessionTicket, m1.sessionTicket) &&
 		eqSignatureAndHashes(m.signatureAndHashes, m1.signatureAndHashes) &&
 		m.secureRenegotiation == m1.secureRenegotiation &&
-		eqStrings(m.alpnProtocols, m1.alpnProtocols)
+		eqStrings(m.alpnProtocols, m1.alpnProtocols) &&
+		eqUint16s(m.supportedVersions, m1.supportedVersions) &&
+		bytes.Equal(m.cookie, m1.cookie) &&
+		eqKeyShares(m.keyShares, m1.keyShares) &&
+		bytes.Equal(m.pskModes, m1.pskModes) &&
+		eqPSKIdentities(m.pskIdentities, m1.pskIdentities) &&
+		eqByteSlices(m.pskBinders, m1.pskBinders)
 }
 
 func (m *clientHelloMsg) marshal() []byte {
@@ -104,6 +130,37 @@ func (m *clientHelloMsg) marshal() []byte {
 	if m.scts {
 		numExtensions++
 	}
+	if len(m.supportedVersions) > 0 {
+		extensionsLength += 1 + 2*len(m.supportedVersions)
+		numExtensions++
+	}
+	if len(m.cookie) > 0 {
+		extensionsLength += 2 + len(m.cookie)
+		numExtensions++
+	}
+	keySharesLength := 0
+	if len(m.keyShares) > 0 {
+		for _, ks := range m.keyShares {
+			keySharesLength += 4 + len(ks.data)
+		}
+		extensionsLength += 2 + keySharesLength
+		numExtensions++
+	}
+	if len(m.pskModes) > 0 {
+		extensionsLength += 1 + len(m.pskModes)
+		numExtensions++
+	}
+	identitiesLength, bindersLength := 0, 0
+	if len(m.pskIdentities) > 0 {
+		for _, psk := range m.pskIdentities {
+			identitiesLength += 2 + len(psk.label) + 4
+		}
+		for _, binder := range m.pskBinders {
+			bindersLength += 1 + len(binder)
+		}
+		extensionsLength += 2 + identitiesLength + 2 + bindersLength
+		numExtensions++
+	}
 	if numExtensions > 0 {
 		extensionsLength += 4 * numExtensions
 		length += 2 + extensionsLength
@@ -283,12 +340,139 @@ func (m *clientHelloMsg) marshal() []byte {
 		// zero uint16 for the zero-length extension_data
 		z = z[4:]
 	}
+	if len(m.supportedVersions) > 0 {
+		// RFC 8446, section 4.2.1
+		z[0] = byte(extensionSupportedVersions >> 8)
+		z[1] = byte(extensionSupportedVersions)
+		l := 1 + 2*len(m.supportedVersions)
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(l - 1)
+		z = z[5:]
+		for _, vers := range m.supportedVersions {
+			z[0] = byte(vers >> 8)
+			z[1] = byte(vers)
+			z = z[2:]
+		}
+	}
+	if len(m.cookie) > 0 {
+		// RFC 8446, section 4.2.2
+		z[0] = byte(extensionCookie >> 8)
+		z[1] = byte(extensionCookie)
+		l := 2 + len(m.cookie)
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(len(m.cookie) >> 8)
+		z[5] = byte(len(m.cookie))
+		copy(z[6:], m.cookie)
+		z = z[l+4:]
+	}
+	if len(m.keyShares) > 0 {
+		// RFC 8446, section 4.2.8
+		z[0] = byte(extensionKeyShare >> 8)
+		z[1] = byte(extensionKeyShare)
+		l := 2 + keySharesLength
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(keySharesLength >> 8)
+		z[5] = byte(keySharesLength)
+		z = z[6:]
+		for _, ks := range m.keyShares {
+			z[0] = byte(ks.group >> 8)
+			z[1] = byte(ks.group)
+			z[2] = byte(len(ks.data) >> 8)
+			z[3] = byte(len(ks.data))
+			copy(z[4:], ks.data)
+			z = z[4+len(ks.data):]
+		}
+	}
+	if len(m.pskModes) > 0 {
+		// RFC 8446, section 4.2.9
+		z[0] = byte(extensionPSKModes >> 8)
+		z[1] = byte(extensionPSKModes)
+		l := 1 + len(m.pskModes)
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(len(m.pskModes))
+		copy(z[5:], m.pskModes)
+		z = z[4+l:]
+	}
+	if len(m.pskIdentities) > 0 {
+		// RFC 8446, section 4.2.11. This extension must be the last
+		// one, so that the binders end the message.
+		z[0] = byte(extensionPreSharedKey >> 8)
+		z[1] = byte(extensionPreSharedKey)
+		l := 2 + identitiesLength + 2 + bindersLength
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(identitiesLength >> 8)
+		z[5] = byte(identitiesLength)
+		z = z[6:]
+		for _, psk := range m.pskIdentities {
+			z[0] = byte(len(psk.label) >> 8)
+			z[1] = byte(len(psk.label))
+			copy(z[2:], psk.label)
+			z = z[2+len(psk.label):]
+			z[0] = byte(psk.obfuscatedTicketAge >> 24)
+			z[1] = byte(psk.obfuscatedTicketAge >> 16)
+			z[2] = byte(psk.obfuscatedTicketAge >> 8)
+			z[3] = byte(psk.obfuscatedTicketAge)
+			z = z[4:]
+		}
+		z[0] = byte(bindersLength >> 8)
+		z[1] = byte(bindersLength)
+		z = z[2:]
+		for _, binder := range m.pskBinders {
+			z[0] = byte(len(binder))
+			copy(z[1:], binder)
+			z = z[1+len(binder):]
+		}
+	}
 
 	m.raw = x
 
 	return x
 }
 
+// bindersLength returns the length of the PSK binders list at the end of
+// the marshaled message, including its length prefix.
+func (m *clientHelloMsg) bindersLength() int {
+	length := 2
+	for _, binder := range m.pskBinders {
+		length += 1 + len(binder)
+	}
+	return length
+}
+
+// marshalWithoutBinders returns the ClientHello through its PSK
+// identities, which the PSK binders are computed over. See RFC 8446,
+// section 4.2.11.2.
+func (m *clientHelloMsg) marshalWithoutBinders() []byte {
+	full := m.marshal()
+	return full[:len(full)-m.bindersLength()]
+}
+
+// updateBinders replaces the PSK binders, which must have the same
+// lengths as the current ones.
+func (m *clientHelloMsg) updateBinders(pskBinders [][]byte) {
+	if len(pskBinders) != len(m.pskBinders) {
+		panic("tls: internal error: pskBinders length mismatch")
+	}
+	for i := range m.pskBinders {
+		if len(pskBinders[i]) != len(m.pskBinders[i]) {
+			panic("tls: internal error: pskBinders length mismatch")
+		}
+	}
+	m.pskBinders = pskBinders
+	if m.raw != nil {
+		z := m.raw[len(m.raw)-m.bindersLength()+2:]
+		for _, binder := range m.pskBinders {
+			copy(z[1:], binder)
+			z = z[1+len(binder):]
+		}
+	}
+}
+
 func (m *clientHelloMsg) unmarshal(data []byte) bool {
 	if len(data) < 42 {
 		return false
@@ -339,6 +523,12 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 	m.signatureAndHashes = nil
 	m.alpnProtocols = nil
 	m.scts = false
+	m.supportedVersions = nil
+	m.cookie = nil
+	m.keyShares = nil
+	m.pskModes = nil
+	m.pskIdentities = nil
+	m.pskBinders = nil
 
 	if len(data) == 0 {
 		// ClientHello is optionally followed by extension data
@@ -475,6 +665,114 @@ func (m *clientHelloMsg) unmarshal(data []byte) bool {
 			if length != 0 {
 				return false
 			}
+		case extensionSupportedVersions:
+			// RFC 8446, section 4.2.1
+			if length < 1 {
+				return false
+			}
+			l := int(data[0])
+			if l%2 == 1 || l == 0 || length != l+1 {
+				return false
+			}
+			d := data[1:length]
+			for len(d) > 0 {
+				m.supportedVersions = append(m.supportedVersions, uint16(d[0])<<8|uint16(d[1]))
+				d = d[2:]
+			}
+		case extensionCookie:
+			// RFC 8446, section 4.2.2
+			if length < 2 {
+				return false
+			}
+			l := int(data[0])<<8 | int(data[1])
+			if l == 0 || length != l+2 {
+				return false
+			}
+			m.cookie = data[2:length]
+		case extensionKeyShare:
+			// RFC 8446, section 4.2.8
+			if length < 2 {
+				return false
+			}
+			l := int(data[0])<<8 | int(data[1])
+			if length != l+2 {
+				return false
+			}
+			d := data[2:length]
+			m.keyShares = []keyShare{}
+			for len(d) > 0 {
+				if len(d) < 4 {
+					return false
+				}
+				group := CurveID(d[0])<<8 | CurveID(d[1])
+				keyLen := int(d[2])<<8 | int(d[3])
+				d = d[4:]
+				if keyLen == 0 || len(d) < keyLen {
+					return false
+				}
+				m.keyShares = append(m.keyShares, keyShare{group: group, data: d[:keyLen]})
+				d = d[keyLen:]
+			}
+		case extensionPSKModes:
+			// RFC 8446, section 4.2.9
+			if length < 1 {
+				return false
+			}
+			l := int(data[0])
+			if l == 0 || length != l+1 {
+				return false
+			}
+			m.pskModes = data[1:length]
+		case extensionPreSharedKey:
+			// RFC 8446, section 4.2.11
+			if len(data) != length {
+				// pre_shared_key must be the last extension.
+				return false
+			}
+			if length < 2 {
+				return false
+			}
+			l := int(data[0])<<8 | int(data[1])
+			d := data[2:]
+			if l == 0 || len(d) < l {
+				return false
+			}
+			identities := d[:l]
+			d = d[l:]
+			for len(identities) > 0 {
+				if len(identities) < 2 {
+					return false
+				}
+				labelLen := int(identities[0])<<8 | int(identities[1])
+				identities = identities[2:]
+				if labelLen == 0 || len(identities) < labelLen+4 {
+					return false
+				}
+				var psk pskIdentity
+				psk.label = identities[:labelLen]
+				identities = identities[labelLen:]
+				psk.obfuscatedTicketAge = uint32(identities[0])<<24 | uint32(identities[1])<<16 |
+					uint32(identities[2])<<8 | uint32(identities[3])
+				identities = identities[4:]
+				m.pskIdentities = append(m.pskIdentities, psk)
+			}
+			if len(d) < 2 {
+				return false
+			}
+			l = int(d[0])<<8 | int(d[1])
+			d = d[2:]
+			if l == 0 || len(d) != l {
+				return false
+			}
+			for len(d) > 0 {
+				binderLen := int(d[0])
+				d = d[1:]
+				if binderLen == 0 || len(d) < binderLen {
+					return false
+				}
+				m.pskBinders = append(m.pskBinders, d[:binderLen])
+				d = d[binderLen:]
+			}
 		}
 		data = data[length:]
 	}
@@ -496,6 +794,15 @@ type serverHelloMsg struct {
 	ticketSupported     bool
 	secureRenegotiation bool
 	alpnProtocol        string
+
+	// TLS 1.3 extensions. selectedGroup is only set in a
+	// HelloRetryRequest.
+	supportedVersion        uint16
+	serverShare             keyShare
+	selectedIdentityPresent bool
+	selectedIdentity        uint16
+	cookie                  []byte
+	selectedGroup           CurveID
 }
 
 func (m *serverHelloMsg) equal(i interface{}) bool {
@@ -524,7 +831,14 @@ func (m *serverHelloMsg) equal(i interface{}) bool {
 		m.ocspStapling == m1.ocspStapling &&
 		m.ticketSupported == m1.ticketSupported &&
 		m.secureRenegotiation == m1.secureRenegotiation &&
-		m.alpnProtocol == m1.alpnProtocol
+		m.alpnProtocol == m1.alpnProtocol &&
+		m.supportedVersion == m1.supportedVersion &&
+		m.serverShare.group == m1.serverShare.group &&
+		bytes.Equal(m.serverShare.data, m1.serverShare.data) &&
+		m.selectedIdentityPresent == m1.selectedIdentityPresent &&
+		m.selectedIdentity == m1.selectedIdentity &&
+		bytes.Equal(m.cookie, m1.cookie) &&
+		m.selectedGroup == m1.selectedGroup
 }
 
 func (m *serverHelloMsg) marshal() []byte {
@@ -570,6 +884,25 @@ func (m *serverHelloMsg) marshal() []byte {
 		extensionsLength += 2 + sctLen
 		numExtensions++
 	}
+	if m.supportedVersion != 0 {
+		extensionsLength += 2
+		numExtensions++
+	}
+	if m.serverShare.group != 0 {
+		extensionsLength += 4 + len(m.serverShare.data)
+		numExtensions++
+	} else if m.selectedGroup != 0 {
+		extensionsLength += 2
+		numExtensions++
+	}
+	if m.selectedIdentityPresent {
+		extensionsLength += 2
+		numExtensions++
+	}
+	if len(m.cookie) > 0 {
+		extensionsLength += 2 + len(m.cookie)
+		numExtensions++
+	}
 
 	if numExtensions > 0 {
 		extensionsLength += 4 * numExtensions
@@ -662,6 +995,57 @@ func (m *serverHelloMsg) marshal() []byte {
 			z = z[len(sct)+2:]
 		}
 	}
+	if m.supportedVersion != 0 {
+		// RFC 8446, section 4.2.1
+		z[0] = byte(extensionSupportedVersions >> 8)
+		z[1] = byte(extensionSupportedVersions)
+		z[3] = 2
+		z[4] = byte(m.supportedVersion >> 8)
+		z[5] = byte(m.supportedVersion)
+		z = z[6:]
+	}
+	if m.serverShare.group != 0 {
+		// RFC 8446, section 4.2.8
+		z[0] = byte(extensionKeyShare >> 8)
+		z[1] = byte(extensionKeyShare)
+		l := 4 + len(m.serverShare.data)
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(m.serverShare.group >> 8)
+		z[5] = byte(m.serverShare.group)
+		z[6] = byte(len(m.serverShare.data) >> 8)
+		z[7] = byte(len(m.serverShare.data))
+		copy(z[8:], m.serverShare.data)
+		z = z[4+l:]
+	} else if m.selectedGroup != 0 {
+		z[0] = byte(extensionKeyShare >> 8)
+		z[1] = byte(extensionKeyShare)
+		z[3] = 2
+		z[4] = byte(m.selectedGroup >> 8)
+		z[5] = byte(m.selectedGroup)
+		z = z[6:]
+	}
+	if m.selectedIdentityPresent {
+		// RFC 8446, section 4.2.11
+		z[0] = byte(extensionPreSharedKey >> 8)
+		z[1] = byte(extensionPreSharedKey)
+		z[3] = 2
+		z[4] = byte(m.selectedIdentity >> 8)
+		z[5] = byte(m.selectedIdentity)
+		z = z[6:]
+	}
+	if len(m.cookie) > 0 {
+		// RFC 8446, section 4.2.2
+		z[0] = byte(extensionCookie >> 8)
+		z[1] = byte(extensionCookie)
+		l := 2 + len(m.cookie)
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		z[4] = byte(len(m.cookie) >> 8)
+		z[5] = byte(len(m.cookie))
+		copy(z[6:], m.cookie)
+		z = z[4+l:]
+	}
 
 	m.raw = x
 
@@ -694,6 +1078,12 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 	m.scts = nil
 	m.ticketSupported = false
 	m.alpnProtocol = ""
+	m.supportedVersion = 0
+	m.serverShare = keyShare{}
+	m.selectedIdentityPresent = false
+	m.selectedIdentity = 0
+	m.cookie = nil
+	m.selectedGroup = 0
 
 	if len(data) == 0 {
 		// ServerHello is optionally followed by extension data
@@ -796,6 +1186,41 @@ func (m *serverHelloMsg) unmarshal(data []byte) bool {
 				m.scts = append(m.scts, d[:sctLen])
 				d = d[sctLen:]
 			}
+		case extensionSupportedVersions:
+			if length != 2 {
+				return false
+			}
+			m.supportedVersion = uint16(data[0])<<8 | uint16(data[1])
+		case extensionKeyShare:
+			// A HelloRetryRequest only carries the selected group.
+			if length == 2 {
+				m.selectedGroup = CurveID(data[0])<<8 | CurveID(data[1])
+				break
+			}
+			if length < 4 {
+				return false
+			}
+			m.serverShare.group = CurveID(data[0])<<8 | CurveID(data[1])
+			l := int(data[2])<<8 | int(data[3])
+			if l == 0 || length != l+4 {
+				return false
+			}
+			m.serverShare.data = data[4:length]
+		case extensionPreSharedKey:
+			if length != 2 {
+				return false
+			}
+			m.selectedIdentityPresent = true
+			m.selectedIdentity = uint16(data[0])<<8 | uint16(data[1])
+		case extensionCookie:
+			if length < 2 {
+				return false
+			}
+			l := int(data[0])<<8 | int(data[1])
+			if l == 0 || length != l+2 {
+				return false
+			}
+			m.cookie = data[2:length]
 		}
 		data = data[length:]
 	}
@@ -1466,6 +1891,617 @@ func (m *newSessionTicketMsg) unmarshal(data []byte) bool {
 	return true
 }
 
+type encryptedExtensionsMsg struct {
+	raw          []byte
+	alpnProtocol string
+}
+
+func (m *encryptedExtensionsMsg) equal(i interface{}) bool {
+	m1, ok := i.(*encryptedExtensionsMsg)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.alpnProtocol == m1.alpnProtocol
+}
+
+func (m *encryptedExtensionsMsg) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	// See RFC 8446, section 4.3.1.
+	extensionsLength := 0
+	if alpnLen := len(m.alpnProtocol); alpnLen > 0 {
+		if alpnLen >= 256 {
+			panic("invalid ALPN protocol")
+		}
+		extensionsLength += 4 + 2 + 1 + alpnLen
+	}
+
+	length := 2 + extensionsLength
+	x := make([]byte, 4+length)
+	x[0] = typeEncryptedExtensions
+	x[1] = uint8(length >> 16)
+	x[2] = uint8(length >> 8)
+	x[3] = uint8(length)
+	x[4] = uint8(extensionsLength >> 8)
+	x[5] = uint8(extensionsLength)
+	z := x[6:]
+
+	if alpnLen := len(m.alpnProtocol); alpnLen > 0 {
+		z[0] = byte(extensionALPN >> 8)
+		z[1] = byte(extensionALPN & 0xff)
+		l := 2 + 1 + alpnLen
+		z[2] = byte(l >> 8)
+		z[3] = byte(l)
+		l -= 2
+		z[4] = byte(l >> 8)
+		z[5] = byte(l)
+		l--
+		z[6] = byte(l)
+		copy(z[7:], []byte(m.alpnProtocol))
+	}
+
+	m.raw = x
+	return x
+}
+
+func (m *encryptedExtensionsMsg) unmarshal(data []byte) bool {
+	m.raw = data
+	m.alpnProtocol = ""
+
+	if len(data) < 6 {
+		return false
+	}
+	length := uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	if uint32(len(data))-4 != length {
+		return false
+	}
+	extensionsLength := int(data[4])<<8 | int(data[5])
+	data = data[6:]
+	if len(data) != extensionsLength {
+		return false
+	}
+
+	for len(data) != 0 {
+		if len(data) < 4 {
+			return false
+		}
+		extension := uint16(data[0])<<8 | uint16(data[1])
+		length := int(data[2])<<8 | int(data[3])
+		data = data[4:]
+		if len(data) < length {
+			return false
+		}
+
+		switch extension {
+		case extensionALPN:
+			d := data[:length]
+			if len(d) < 3 {
+				return false
+			}
+			l := int(d[0])<<8 | int(d[1])
+			if l != len(d)-2 {
+				return false
+			}
+			d = d[2:]
+			l = int(d[0])
+			if l != len(d)-1 || l == 0 {
+				return false
+			}
+			m.alpnProtocol = string(d[1:])
+		}
+		data = data[length:]
+	}
+
+	return true
+}
+
+// certificateMsgTLS13 is the TLS 1.3 Certificate message. The OCSP staple
+// and SCTs of the leaf are carried in its entry extensions. See RFC 8446,
+// section 4.4.2.
+type certificateMsgTLS13 struct {
+	raw          []byte
+	certificates [][]byte
+	ocspStaple   []byte
+	scts         [][]byte
+}
+
+func (m *certificateMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*certificateMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		eqByteSlices(m.certificates, m1.certificates) &&
+		bytes.Equal(m.ocspStaple, m1.ocspStaple) &&
+		eqByteSlices(m.scts, m1.scts)
+}
+
+// leafExtensionsLength returns the length of the extensions of the first
+// certificate entry, without their length prefix.
+func (m *certificateMsgTLS13) leafExtensionsLength() int {
+	length := 0
+	if len(m.ocspStaple) > 0 {
+		length += 4 + 1 + 3 + len(m.ocspStaple)
+	}
+	if len(m.scts) > 0 {
+		length += 4 + 2
+		for _, sct := range m.scts {
+			length += 2 + len(sct)
+		}
+	}
+	return length
+}
+
+func (m *certificateMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	leafExtensionsLength := m.leafExtensionsLength()
+	listLength := 0
+	for i, cert := range m.certificates {
+		listLength += 3 + len(cert) + 2
+		if i == 0 {
+			listLength += leafExtensionsLength
+		}
+	}
+
+	length := 1 + 3 + listLength
+	x := make([]byte, 4+length)
+	x[0] = typeCertificate
+	x[1] = uint8(length >> 16)
+	x[2] = uint8(length >> 8)
+	x[3] = uint8(length)
+	// x[4] is the zero-length certificate_request_context.
+	x[5] = uint8(listLength >> 16)
+	x[6] = uint8(listLength >> 8)
+	x[7] = uint8(listLength)
+
+	z := x[8:]
+	for i, cert := range m.certificates {
+		z[0] = uint8(len(cert) >> 16)
+		z[1] = uint8(len(cert) >> 8)
+		z[2] = uint8(len(cert))
+		copy(z[3:], cert)
+		z = z[3+len(cert):]
+		if i != 0 {
+			z = z[2:]
+			continue
+		}
+
+		z[0] = uint8(leafExtensionsLength >> 8)
+		z[1] = uint8(leafExtensionsLength)
+		z = z[2:]
+		if len(m.ocspStaple) > 0 {
+			// RFC 8446, section 4.4.2.1
+			z[0] = byte(extensionStatusRequest >> 8)
+			z[1] = byte(extensionStatusRequest)
+			l := 1 + 3 + len(m.ocspStaple)
+			z[2] = byte(l >> 8)
+			z[3] = byte(l)
+			z[4] = statusTypeOCSP
+			z[5] = byte(len(m.ocspStaple) >> 16)
+			z[6] = byte(len(m.ocspStaple) >> 8)
+			z[7] = byte(len(m.ocspStaple))
+			copy(z[8:], m.ocspStaple)
+			z = z[4+l:]
+		}
+		if len(m.scts) > 0 {
+			sctLen := 0
+			for _, sct := range m.scts {
+				sctLen += 2 + len(sct)
+			}
+			z[0] = byte(extensionSCT >> 8)
+			z[1] = byte(extensionSCT)
+			z[2] = byte((sctLen + 2) >> 8)
+			z[3] = byte(sctLen + 2)
+			z[4] = byte(sctLen >> 8)
+			z[5] = byte(sctLen)
+			z = z[6:]
+			for _, sct := range m.scts {
+				z[0] = byte(len(sct) >> 8)
+				z[1] = byte(len(sct))
+				copy(z[2:], sct)
+				z = z[2+len(sct):]
+			}
+		}
+	}
+
+	m.raw = x
+	return x
+}
+
+func (m *certificateMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+	m.certificates = nil
+	m.ocspStaple = nil
+	m.scts = nil
+
+	if len(data) < 8 {
+		return false
+	}
+	length := uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	if uint32(len(data))-4 != length {
+		return false
+	}
+	// The certificate_request_context is always empty, as post-handshake
+	// authentication is not supported.
+	if data[4] != 0 {
+		return false
+	}
+	listLength := int(data[5])<<16 | int(data[6])<<8 | int(data[7])
+	d := data[8:]
+	if len(d) != listLength {
+		return false
+	}
+
+	for len(d) > 0 {
+		if len(d) < 3 {
+			return false
+		}
+		certLen := int(d[0])<<16 | int(d[1])<<8 | int(d[2])
+		d = d[3:]
+		if certLen == 0 || len(d) < certLen+2 {
+			return false
+		}
+		m.certificates = append(m.certificates, d[:certLen])
+		d = d[certLen:]
+		extensionsLength := int(d[0])<<8 | int(d[1])
+		d = d[2:]
+		if len(d) < extensionsLength {
+			return false
+		}
+		extensions := d[:extensionsLength]
+		d = d[extensionsLength:]
+		if len(m.certificates) > 1 {
+			// Extensions of the other entries are ignored.
+			continue
+		}
+
+		for len(extensions) > 0 {
+			if len(extensions) < 4 {
+				return false
+			}
+			extension := uint16(extensions[0])<<8 | uint16(extensions[1])
+			l := int(extensions[2])<<8 | int(extensions[3])
+			extensions = extensions[4:]
+			if len(extensions) < l {
+				return false
+			}
+			e := extensions[:l]
+			extensions = extensions[l:]
+
+			switch extension {
+			case extensionStatusRequest:
+				if len(e) < 4 || e[0] != statusTypeOCSP {
+					return false
+				}
+				respLen := int(e[1])<<16 | int(e[2])<<8 | int(e[3])
+				if respLen == 0 || len(e) != 4+respLen {
+					return false
+				}
+				m.ocspStaple = e[4:]
+			case extensionSCT:
+				if len(e) < 2 {
+					return false
+				}
+				sctsLen := int(e[0])<<8 | int(e[1])
+				e = e[2:]
+				if sctsLen == 0 || len(e) != sctsLen {
+					return false
+				}
+				for len(e) > 0 {
+					if len(e) < 2 {
+						return false
+					}
+					sctLen := int(e[0])<<8 | int(e[1])
+					e = e[2:]
+					if sctLen == 0 || len(e) < sctLen {
+						return false
+					}
+					m.scts = append(m.scts, e[:sctLen])
+					e = e[sctLen:]
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// certificateRequestMsgTLS13 is the TLS 1.3 CertificateRequest message.
+// See RFC 8446, section 4.3.2.
+type certificateRequestMsgTLS13 struct {
+	raw                    []byte
+	signatureAndHashes     []signatureAndHash
+	certificateAuthorities [][]byte
+}
+
+func (m *certificateRequestMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*certificateRequestMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		eqSignatureAndHashes(m.signatureAndHashes, m1.signatureAndHashes) &&
+		eqByteSlices(m.certificateAuthorities, m1.certificateAuthorities)
+}
+
+func (m *certificateRequestMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	sigAlgsLength := 2 * len(m.signatureAndHashes)
+	extensionsLength := 4 + 2 + sigAlgsLength
+	casLength := 0
+	if len(m.certificateAuthorities) > 0 {
+		for _, ca := range m.certificateAuthorities {
+			casLength += 2 + len(ca)
+		}
+		extensionsLength += 4 + 2 + casLength
+	}
+
+	length := 1 + 2 + extensionsLength
+	x := make([]byte, 4+length)
+	x[0] = typeCertificateRequest
+	x[1] = uint8(length >> 16)
+	x[2] = uint8(length >> 8)
+	x[3] = uint8(length)
+	// x[4] is the zero-length certificate_request_context.
+	x[5] = uint8(extensionsLength >> 8)
+	x[6] = uint8(extensionsLength)
+
+	z := x[7:]
+	z[0] = byte(extensionSignatureAlgorithms >> 8)
+	z[1] = byte(extensionSignatureAlgorithms)
+	z[2] = byte((2 + sigAlgsLength) >> 8)
+	z[3] = byte(2 + sigAlgsLength)
+	z[4] = byte(sigAlgsLength >> 8)
+	z[5] = byte(sigAlgsLength)
+	z = z[6:]
+	for _, sigAndHash := range m.signatureAndHashes {
+		z[0] = sigAndHash.hash
+		z[1] = sigAndHash.signature
+		z = z[2:]
+	}
+	if len(m.certificateAuthorities) > 0 {
+		z[0] = byte(extensionCertificateAuthorities >> 8)
+		z[1] = byte(extensionCertificateAuthorities)
+		z[2] = byte((2 + casLength) >> 8)
+		z[3] = byte(2 + casLength)
+		z[4] = byte(casLength >> 8)
+		z[5] = byte(casLength)
+		z = z[6:]
+		for _, ca := range m.certificateAuthorities {
+			z[0] = byte(len(ca) >> 8)
+			z[1] = byte(len(ca))
+			copy(z[2:], ca)
+			z = z[2+len(ca):]
+		}
+	}
+
+	m.raw = x
+	return x
+}
+
+func (m *certificateRequestMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+	m.signatureAndHashes = nil
+	m.certificateAuthorities = nil
+
+	if len(data) < 7 {
+		return false
+	}
+	length := uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	if uint32(len(data))-4 != length {
+		return false
+	}
+	if data[4] != 0 {
+		return false
+	}
+	extensionsLength := int(data[5])<<8 | int(data[6])
+	data = data[7:]
+	if len(data) != extensionsLength {
+		return false
+	}
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return false
+		}
+		extension := uint16(data[0])<<8 | uint16(data[1])
+		length := int(data[2])<<8 | int(data[3])
+		data = data[4:]
+		if len(data) < length {
+			return false
+		}
+		d := data[:length]
+		data = data[length:]
+
+		switch extension {
+		case extensionSignatureAlgorithms:
+			if len(d) < 2 {
+				return false
+			}
+			l := int(d[0])<<8 | int(d[1])
+			if l%2 == 1 || l == 0 || len(d) != l+2 {
+				return false
+			}
+			d = d[2:]
+			for len(d) > 0 {
+				m.signatureAndHashes = append(m.signatureAndHashes, signatureAndHash{hash: d[0], signature: d[1]})
+				d = d[2:]
+			}
+		case extensionCertificateAuthorities:
+			if len(d) < 2 {
+				return false
+			}
+			l := int(d[0])<<8 | int(d[1])
+			if l == 0 || len(d) != l+2 {
+				return false
+			}
+			d = d[2:]
+			for len(d) > 0 {
+				if len(d) < 2 {
+					return false
+				}
+				caLen := int(d[0])<<8 | int(d[1])
+				d = d[2:]
+				if caLen == 0 || len(d) < caLen {
+					return false
+				}
+				m.certificateAuthorities = append(m.certificateAuthorities, d[:caLen])
+				d = d[caLen:]
+			}
+		}
+	}
+
+	// The signature_algorithms extension is mandatory.
+	return len(m.signatureAndHashes) > 0
+}
+
+// newSessionTicketMsgTLS13 is the TLS 1.3 NewSessionTicket message. See
+// RFC 8446, section 4.6.1.
+type newSessionTicketMsgTLS13 struct {
+	raw      []byte
+	lifetime uint32
+	ageAdd   uint32
+	nonce    []byte
+	label    []byte
+}
+
+func (m *newSessionTicketMsgTLS13) equal(i interface{}) bool {
+	m1, ok := i.(*newSessionTicketMsgTLS13)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.lifetime == m1.lifetime &&
+		m.ageAdd == m1.ageAdd &&
+		bytes.Equal(m.nonce, m1.nonce) &&
+		bytes.Equal(m.label, m1.label)
+}
+
+func (m *newSessionTicketMsgTLS13) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	length := 4 + 4 + 1 + len(m.nonce) + 2 + len(m.label) + 2
+	x := make([]byte, 4+length)
+	x[0] = typeNewSessionTicket
+	x[1] = uint8(length >> 16)
+	x[2] = uint8(length >> 8)
+	x[3] = uint8(length)
+	x[4] = uint8(m.lifetime >> 24)
+	x[5] = uint8(m.lifetime >> 16)
+	x[6] = uint8(m.lifetime >> 8)
+	x[7] = uint8(m.lifetime)
+	x[8] = uint8(m.ageAdd >> 24)
+	x[9] = uint8(m.ageAdd >> 16)
+	x[10] = uint8(m.ageAdd >> 8)
+	x[11] = uint8(m.ageAdd)
+	z := x[12:]
+	z[0] = uint8(len(m.nonce))
+	copy(z[1:], m.nonce)
+	z = z[1+len(m.nonce):]
+	z[0] = uint8(len(m.label) >> 8)
+	z[1] = uint8(len(m.label))
+	copy(z[2:], m.label)
+	// The trailing extensions list is empty.
+
+	m.raw = x
+	return x
+}
+
+func (m *newSessionTicketMsgTLS13) unmarshal(data []byte) bool {
+	m.raw = data
+
+	if len(data) < 4+4+4+1 {
+		return false
+	}
+	length := uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	if uint32(len(data))-4 != length {
+		return false
+	}
+	m.lifetime = uint32(data[4])<<24 | uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7])
+	m.ageAdd = uint32(data[8])<<24 | uint32(data[9])<<16 | uint32(data[10])<<8 | uint32(data[11])
+	d := data[12:]
+	nonceLen := int(d[0])
+	d = d[1:]
+	if len(d) < nonceLen+2 {
+		return false
+	}
+	m.nonce = d[:nonceLen]
+	d = d[nonceLen:]
+	labelLen := int(d[0])<<8 | int(d[1])
+	d = d[2:]
+	if labelLen == 0 || len(d) < labelLen+2 {
+		return false
+	}
+	m.label = d[:labelLen]
+	d = d[labelLen:]
+	// Extensions, such as early_data, are ignored.
+	extensionsLength := int(d[0])<<8 | int(d[1])
+	return len(d) == 2+extensionsLength
+}
+
+// keyUpdateMsg is the TLS 1.3 KeyUpdate message. See RFC 8446, section
+// 4.6.3.
+type keyUpdateMsg struct {
+	raw             []byte
+	updateRequested bool
+}
+
+func (m *keyUpdateMsg) equal(i interface{}) bool {
+	m1, ok := i.(*keyUpdateMsg)
+	if !ok {
+		return false
+	}
+
+	return bytes.Equal(m.raw, m1.raw) &&
+		m.updateRequested == m1.updateRequested
+}
+
+func (m *keyUpdateMsg) marshal() []byte {
+	if m.raw != nil {
+		return m.raw
+	}
+
+	x := []byte{typeKeyUpdate, 0, 0, 1, 0}
+	if m.updateRequested {
+		x[4] = 1
+	}
+
+	m.raw = x
+	return x
+}
+
+func (m *keyUpdateMsg) unmarshal(data []byte) bool {
+	m.raw = data
+
+	if len(data) != 5 {
+		return false
+	}
+	switch data[4] {
+	case 0:
+		m.updateRequested = false
+	case 1:
+		m.updateRequested = true
+	default:
+		return false
+	}
+	return true
+}
+
 func eqUint16s(x, y []uint16) bool {
 	if len(x) != len(y) {
 		return false
@@ -1526,3 +2562,27 @@ func eqSignatureAndHashes(x, y []signatureAndHash) bool {
 	}
 	return true
 }
+
+func eqKeyShares(x, y []keyShare) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i, v := range x {
+		if y[i].group != v.group || !bytes.Equal(y[i].data, v.data) {
+			return false
+		}
+	}
+	return true
+}
+
+func eqPSKIdentities(x, y []pskIdentity) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i, v := range x {
+		if y[i].obfuscatedTicketAge != v.obfuscatedTicketAge || !bytes.Equal(y[i].label, v.label) {
+			return false
+		}
+	}
+	return true
+}
@@ -24,6 +24,12 @@ var tests = []interface{}{
 	&nextProtoMsg{},
 	&newSessionTicketMsg{},
 	&sessionState{},
+	&encryptedExtensionsMsg{},
+	&certificateMsgTLS13{},
+	&certificateRequestMsgTLS13{},
+	&newSessionTicketMsgTLS13{},
+	&keyUpdateMsg{},
+	&sessionStateTLS13{},
 }
 
 type testMessage interface {
@@ -145,6 +151,28 @@ func (*clientHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 	if rand.Intn(10) > 5 {
 		m.scts = true
 	}
+	if rand.Intn(10) > 5 {
+		m.supportedVersions = []uint16{VersionTLS13, VersionTLS12}
+	}
+	if rand.Intn(10) > 5 {
+		m.cookie = randomBytes(rand.Intn(500)+1, rand)
+	}
+	for i := 0; i < rand.Intn(3); i++ {
+		m.keyShares = append(m.keyShares, keyShare{
+			group: CurveID(rand.Intn(30000)),
+			data:  randomBytes(rand.Intn(200)+1, rand),
+		})
+	}
+	if rand.Intn(10) > 5 {
+		m.pskModes = []uint8{pskModeDHE}
+	}
+	for i := 0; i < rand.Intn(3); i++ {
+		m.pskIdentities = append(m.pskIdentities, pskIdentity{
+			label:               randomBytes(rand.Intn(100)+1, rand),
+			obfuscatedTicketAge: uint32(rand.Int63()),
+		})
+		m.pskBinders = append(m.pskBinders, randomBytes(rand.Intn(32)+32, rand))
+	}
 
 	return reflect.ValueOf(m)
 }
@@ -183,6 +211,25 @@ func (*serverHelloMsg) Generate(rand *rand.Rand, size int) reflect.Value {
 		}
 	}
 
+	if rand.Intn(10) > 5 {
+		m.supportedVersion = VersionTLS13
+	}
+	if rand.Intn(10) > 5 {
+		m.serverShare = keyShare{
+			group: CurveID(rand.Intn(30000) + 1),
+			data:  randomBytes(rand.Intn(200)+1, rand),
+		}
+	} else if rand.Intn(10) > 5 {
+		m.selectedGroup = CurveID(rand.Intn(30000) + 1)
+	}
+	if rand.Intn(10) > 5 {
+		m.selectedIdentityPresent = true
+		m.selectedIdentity = uint16(rand.Intn(0xffff))
+	}
+	if rand.Intn(10) > 5 {
+		m.cookie = randomBytes(rand.Intn(500)+1, rand)
+	}
+
 	return reflect.ValueOf(m)
 }
 
@@ -260,3 +307,66 @@ func (*sessionState) Generate(rand *rand.Rand, size int) reflect.Value {
 	}
 	return reflect.ValueOf(s)
 }
+
+func (*encryptedExtensionsMsg) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := &encryptedExtensionsMsg{}
+	if rand.Intn(10) > 5 {
+		m.alpnProtocol = randomString(rand.Intn(32)+1, rand)
+	}
+	return reflect.ValueOf(m)
+}
+
+func (*certificateMsgTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := &certificateMsgTLS13{}
+	numCerts := rand.Intn(20)
+	for i := 0; i < numCerts; i++ {
+		m.certificates = append(m.certificates, randomBytes(rand.Intn(10)+1, rand))
+	}
+	if numCerts > 0 && rand.Intn(10) > 5 {
+		m.ocspStaple = randomBytes(rand.Intn(100)+1, rand)
+	}
+	if numCerts > 0 && rand.Intn(10) > 5 {
+		for i := 0; i < rand.Intn(4)+1; i++ {
+			m.scts = append(m.scts, randomBytes(rand.Intn(500)+1, rand))
+		}
+	}
+	return reflect.ValueOf(m)
+}
+
+func (*certificateRequestMsgTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := &certificateRequestMsgTLS13{}
+	m.signatureAndHashes = supportedSignatureAlgorithmsTLS13
+	numCAs := rand.Intn(100)
+	for i := 0; i < numCAs; i++ {
+		m.certificateAuthorities = append(m.certificateAuthorities, randomBytes(rand.Intn(15)+1, rand))
+	}
+	return reflect.ValueOf(m)
+}
+
+func (*newSessionTicketMsgTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := &newSessionTicketMsgTLS13{}
+	m.lifetime = uint32(rand.Intn(500000))
+	m.ageAdd = uint32(rand.Int63())
+	m.nonce = randomBytes(rand.Intn(100), rand)
+	m.label = randomBytes(rand.Intn(1000)+1, rand)
+	return reflect.ValueOf(m)
+}
+
+func (*keyUpdateMsg) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := &keyUpdateMsg{}
+	m.updateRequested = rand.Intn(10) > 5
+	return reflect.ValueOf(m)
+}
+
+func (*sessionStateTLS13) Generate(rand *rand.Rand, size int) reflect.Value {
+	s := &sessionStateTLS13{}
+	s.cipherSuite = uint16(rand.Intn(10000))
+	s.createdAt = uint64(rand.Int63())
+	s.psk = randomBytes(rand.Intn(100)+1, rand)
+	numCerts := rand.Intn(20)
+	s.certificates = make([][]byte, numCerts)
+	for i := 0; i < numCerts; i++ {
+		s.certificates[i] = randomBytes(rand.Intn(10)+1, rand)
+	}
+	return reflect.ValueOf(s)
+}
@@ -38,9 +38,15 @@ func (zeroSource) Read(b []byte) (n int, err error) {
 var testConfig *Config
 
 func allCipherSuites() []uint16 {
-	ids := make([]uint16, len(cipherSuites))
-	for i, suite := range cipherSuites {
-		ids[i] = suite.id
+	ids := make([]uint16, 0, len(cipherSuites))
+	for _, suite := range cipherSuites {
+		// The handshakes recorded in testdata predate the
+		// ChaCha20-Poly1305 cipher suites.
+		if suite.id == TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305 ||
+			suite.id == TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305 {
+			continue
+		}
+		ids = append(ids, suite.id)
 	}
 
 	return ids
@@ -55,6 +61,8 @@ func init() {
 		MinVersion:         VersionSSL30,
 		MaxVersion:         VersionTLS12,
 		CipherSuites:       allCipherSuites(),
+		// The handshakes recorded in testdata predate X25519.
+		CurvePreferences: []CurveID{CurveP256, CurveP384, CurveP521},
 	}
 	testConfig.Certificates[0].Certificate = [][]byte{testRSACertificate}
 	testConfig.Certificates[0].PrivateKey = testRSAPrivateKey
@@ -83,7 +91,10 @@ func testClientHelloFailure(t *testing.T, serverConfig *Config, m handshakeMessa
 	hs := serverHandshakeState{
 		c: Server(s, serverConfig),
 	}
-	_, err := hs.readClientHello()
+	err := hs.readClientHello()
+	if err == nil {
+		_, err = hs.processClientHello()
+	}
 	s.Close()
 	if len(expectedSubStr) == 0 {
 		if err != nil && err != io.EOF {
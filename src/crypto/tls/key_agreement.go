@@ -15,7 +15,6 @@ import (
 	"encoding/asn1"
 	"errors"
 	"io"
-	"math/big"
 )
 
 var errClientKeyExchange = errors.New("tls: invalid ClientKeyExchange message")
@@ -112,10 +111,10 @@ func md5SHA1Hash(slices [][]byte) []byte {
 // only used for >= TLS 1.2 and precisely identifies the hash function to use.
 func hashForServerKeyExchange(sigAndHash signatureAndHash, version uint16, slices ...[]byte) ([]byte, crypto.Hash, error) {
 	if version >= VersionTLS12 {
-		if !isSupportedSignatureAndHash(sigAndHash, supportedSignatureAlgorithms) {
+		if !isSupportedSignatureAndHash(sigAndHash, supportedSignatureAlgorithmsAll) {
 			return nil, crypto.Hash(0), errors.New("tls: unsupported hash function used by peer")
 		}
-		hashFunc, err := lookupTLSHash(sigAndHash.hash)
+		hashFunc, err := hashForSignatureAlgorithm(sigAndHash)
 		if err != nil {
 			return nil, crypto.Hash(0), err
 		}
@@ -169,16 +168,29 @@ func curveForCurveID(id CurveID) (elliptic.Curve, bool) {
 
 }
 
+// isSupportedCurve reports whether id is a group that ecdheParameters can
+// be generated for.
+func isSupportedCurve(id CurveID) bool {
+	if id == X25519 {
+		return true
+	}
+	_, ok := curveForCurveID(id)
+	return ok
+}
+
 // ecdheRSAKeyAgreement implements a TLS key agreement where the server
 // generates a ephemeral EC public/private key pair and signs it. The
 // pre-master secret is then calculated using ECDH. The signature may
 // either be ECDSA or RSA.
 type ecdheKeyAgreement struct {
-	version    uint16
-	sigType    uint8
-	privateKey []byte
-	curve      elliptic.Curve
-	x, y       *big.Int
+	version uint16
+	sigType uint8
+	params  ecdheParameters
+
+	// curveID and serverPublicKey are set by the client from the
+	// ServerKeyExchange message.
+	curveID         CurveID
+	serverPublicKey []byte
 }
 
 func (ka *ecdheKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, hello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
@@ -198,19 +210,16 @@ NextCandidate:
 	if curveid == 0 {
 		return nil, errors.New("tls: no supported elliptic curves offered")
 	}
-
-	var ok bool
-	if ka.curve, ok = curveForCurveID(curveid); !ok {
+	if !isSupportedCurve(curveid) {
 		return nil, errors.New("tls: preferredCurves includes unsupported curve")
 	}
 
-	var x, y *big.Int
 	var err error
-	ka.privateKey, x, y, err = elliptic.GenerateKey(ka.curve, config.rand())
+	ka.params, err = generateECDHEParameters(config.rand(), curveid)
 	if err != nil {
 		return nil, err
 	}
-	ecdhePublic := elliptic.Marshal(ka.curve, x, y)
+	ecdhePublic := ka.params.PublicKey()
 
 	// http://tools.ietf.org/html/rfc4492#section-5.4
 	serverECDHParams := make([]byte, 1+2+1+len(ecdhePublic))
@@ -219,7 +228,6 @@ NextCandidate:
 	serverECDHParams[2] = byte(curveid)
 	serverECDHParams[3] = byte(len(ecdhePublic))
 	copy(serverECDHParams[4:], ecdhePublic)
-
 	sigAndHash := signatureAndHash{signature: ka.sigType}
 
 	if ka.version >= VersionTLS12 {
@@ -281,17 +289,11 @@ func (ka *ecdheKeyAgreement) processClientKeyExchange(config *Config, cert *Cert
 	if len(ckx.ciphertext) == 0 || int(ckx.ciphertext[0]) != len(ckx.ciphertext)-1 {
 		return nil, errClientKeyExchange
 	}
-	x, y := elliptic.Unmarshal(ka.curve, ckx.ciphertext[1:])
-	if x == nil {
-		return nil, errClientKeyExchange
-	}
-	if !ka.curve.IsOnCurve(x, y) {
+
+	preMasterSecret := ka.params.SharedKey(ckx.ciphertext[1:])
+	if preMasterSecret == nil {
 		return nil, errClientKeyExchange
 	}
-	x, _ = ka.curve.ScalarMult(x, y, ka.privateKey)
-	preMasterSecret := make([]byte, (ka.curve.Params().BitSize+7)>>3)
-	xBytes := x.Bytes()
-	copy(preMasterSecret[len(preMasterSecret)-len(xBytes):], xBytes)
 
 	return preMasterSecret, nil
 }
@@ -303,24 +305,16 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	if skx.key[0] != 3 { // named curve
 		return errors.New("tls: server selected unsupported curve")
 	}
-	curveid := CurveID(skx.key[1])<<8 | CurveID(skx.key[2])
-
-	var ok bool
-	if ka.curve, ok = curveForCurveID(curveid); !ok {
+	ka.curveID = CurveID(skx.key[1])<<8 | CurveID(skx.key[2])
+	if !isSupportedCurve(ka.curveID) {
 		return errors.New("tls: server selected unsupported curve")
 	}
 
 	publicLen := int(skx.key[3])
-	if publicLen+4 > len(skx.key) {
-		return errServerKeyExchange
-	}
-	ka.x, ka.y = elliptic.Unmarshal(ka.curve, skx.key[4:4+publicLen])
-	if ka.x == nil {
-		return errServerKeyExchange
-	}
-	if !ka.curve.IsOnCurve(ka.x, ka.y) {
+	if publicLen+4 > len(skx.key) || publicLen == 0 {
 		return errServerKeyExchange
 	}
+	ka.serverPublicKey = skx.key[4 : 4+publicLen]
 	serverECDHParams := skx.key[:4+publicLen]
 
 	sig := skx.key[4+publicLen:]
@@ -332,7 +326,12 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	if ka.version >= VersionTLS12 {
 		// handle SignatureAndHashAlgorithm
 		sigAndHash = signatureAndHash{hash: sig[0], signature: sig[1]}
-		if sigAndHash.signature != ka.sigType {
+		if !isSupportedSignatureAndHash(sigAndHash, clientHello.signatureAndHashes) {
+			return errors.New("tls: server used a signature algorithm that was not offered")
+		}
+		// A client that offers TLS 1.3 also offers RSASSA-PSS, which
+		// a TLS 1.2 server may then use with an RSA key.
+		if sigAndHash.signature != ka.sigType && !(ka.sigType == signatureRSA && isRSAPSS(sigAndHash)) {
 			return errServerKeyExchange
 		}
 		sig = sig[2:]
@@ -371,6 +370,9 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 		if !ok {
 			return errors.New("ECDHE RSA requires a RSA server public key")
 		}
+		if isRSAPSS(sigAndHash) {
+			return verifyHandshakeSignature(pubKey, sigAndHash, digest, sig)
+		}
 		if err := rsa.VerifyPKCS1v15(pubKey, hashFunc, digest, sig); err != nil {
 			return err
 		}
@@ -382,19 +384,21 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 }
 
 func (ka *ecdheKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate) ([]byte, *clientKeyExchangeMsg, error) {
-	if ka.curve == nil {
+	if ka.curveID == 0 {
 		return nil, nil, errors.New("missing ServerKeyExchange message")
 	}
-	priv, mx, my, err := elliptic.GenerateKey(ka.curve, config.rand())
+
+	var err error
+	ka.params, err = generateECDHEParameters(config.rand(), ka.curveID)
 	if err != nil {
 		return nil, nil, err
 	}
-	x, _ := ka.curve.ScalarMult(ka.x, ka.y, priv)
-	preMasterSecret := make([]byte, (ka.curve.Params().BitSize+7)>>3)
-	xBytes := x.Bytes()
-	copy(preMasterSecret[len(preMasterSecret)-len(xBytes):], xBytes)
+	preMasterSecret := ka.params.SharedKey(ka.serverPublicKey)
+	if preMasterSecret == nil {
+		return nil, nil, errServerKeyExchange
+	}
 
-	serialized := elliptic.Marshal(ka.curve, mx, my)
+	serialized := ka.params.PublicKey()
 
 	ckx := new(clientKeyExchangeMsg)
 	ckx.ciphertext = make([]byte, 1+len(serialized))
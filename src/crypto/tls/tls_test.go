@@ -6,6 +6,7 @@ package tls
 
 import (
 	"bytes"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"internal/testenv"
@@ -466,3 +467,660 @@ func (w *changeImplConn) Close() error {
 	}
 	return w.Conn.Close()
 }
+
+// testTLS13Handshake runs a handshake between a client and a server using
+// the given configurations over a loopback TCP connection, and then has the
+// server send a short message, so that the client processes any session
+// ticket. It returns the connection states seen by both sides.
+func testTLS13Handshake(t *testing.T, clientConfig, serverConfig *Config) (clientState, serverState ConnectionState, err error) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	type result struct {
+		state ConnectionState
+		err   error
+	}
+	srvCh := make(chan result, 1)
+	go func() {
+		sconn, err := ln.Accept()
+		if err != nil {
+			srvCh <- result{err: err}
+			return
+		}
+		srv := Server(sconn, serverConfig)
+		defer srv.Close()
+		if err := srv.Handshake(); err != nil {
+			srvCh <- result{err: err}
+			return
+		}
+		_, err = srv.Write([]byte("hello"))
+		srvCh <- result{srv.ConnectionState(), err}
+	}()
+
+	conn, err := Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		<-srvCh
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		<-srvCh
+		return
+	}
+	if string(buf) != "hello" {
+		err = fmt.Errorf("client read %q, want %q", buf, "hello")
+		return
+	}
+
+	srv := <-srvCh
+	return conn.ConnectionState(), srv.state, srv.err
+}
+
+func tls13TestConfig() *Config {
+	config := *testConfig
+	config.MaxVersion = VersionTLS13
+	return &config
+}
+
+func TestTLS13Handshake(t *testing.T) {
+	ecdsaConfig := tls13TestConfig()
+	ecdsaConfig.Certificates = []Certificate{{
+		Certificate: [][]byte{testECDSACertificate},
+		PrivateKey:  testECDSAPrivateKey,
+	}}
+
+	for _, test := range []struct {
+		name         string
+		serverConfig *Config
+		suite        uint16
+	}{
+		{"RSA", tls13TestConfig(), defaultCipherSuitesTLS13()[0]},
+		{"ECDSA", ecdsaConfig, defaultCipherSuitesTLS13()[0]},
+	} {
+		clientState, serverState, err := testTLS13Handshake(t, tls13TestConfig(), test.serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %s", test.name, err)
+		}
+		for _, state := range []ConnectionState{clientState, serverState} {
+			if state.Version != VersionTLS13 {
+				t.Errorf("%s: got version %x, want %x", test.name, state.Version, VersionTLS13)
+			}
+			if state.CipherSuite != test.suite {
+				t.Errorf("%s: got cipher suite %x, want %x", test.name, state.CipherSuite, test.suite)
+			}
+			if state.DidResume {
+				t.Errorf("%s: unexpected resumption", test.name)
+			}
+			if state.TLSUnique != nil {
+				t.Errorf("%s: TLSUnique is defined for TLS 1.3", test.name)
+			}
+		}
+		if len(clientState.PeerCertificates) != 1 {
+			t.Errorf("%s: client saw %d server certificates, want 1", test.name, len(clientState.PeerCertificates))
+		}
+	}
+}
+
+func TestTLS13ALPN(t *testing.T) {
+	clientConfig := tls13TestConfig()
+	clientConfig.NextProtos = []string{"proto1", "proto2"}
+	serverConfig := tls13TestConfig()
+	serverConfig.NextProtos = []string{"proto2", "proto3"}
+
+	clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if clientState.NegotiatedProtocol != "proto2" || serverState.NegotiatedProtocol != "proto2" {
+		t.Errorf("got negotiated protocols %q and %q, want %q", clientState.NegotiatedProtocol, serverState.NegotiatedProtocol, "proto2")
+	}
+}
+
+func TestTLS13HelloRetryRequest(t *testing.T) {
+	clientConfig := tls13TestConfig()
+	clientConfig.CurvePreferences = []CurveID{CurveP384, CurveP256}
+	serverConfig := tls13TestConfig()
+	serverConfig.CurvePreferences = []CurveID{CurveP256}
+
+	if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+
+	serverConfig.CurvePreferences = []CurveID{CurveP521}
+	if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err == nil {
+		t.Fatal("handshake succeeded without a common group")
+	}
+}
+
+func TestTLS13Resumption(t *testing.T) {
+	for _, hrr := range []bool{false, true} {
+		clientConfig := tls13TestConfig()
+		clientConfig.ClientSessionCache = NewLRUClientSessionCache(32)
+		serverConfig := tls13TestConfig()
+		if hrr {
+			clientConfig.CurvePreferences = []CurveID{CurveP384, CurveP256}
+			serverConfig.CurvePreferences = []CurveID{CurveP256}
+		}
+
+		testResumeState := func(test string, didResume bool) {
+			clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Fatalf("%s (HRR %v): handshake failed: %s", test, hrr, err)
+			}
+			if clientState.DidResume != didResume || serverState.DidResume != didResume {
+				t.Fatalf("%s (HRR %v): resumed: %v and %v, expected: %v", test, hrr, clientState.DidResume, serverState.DidResume, didResume)
+			}
+			if clientState.Version != VersionTLS13 {
+				t.Fatalf("%s (HRR %v): got version %x, want %x", test, hrr, clientState.Version, VersionTLS13)
+			}
+			if len(clientState.PeerCertificates) == 0 {
+				t.Fatalf("%s (HRR %v): expected peer certificates", test, hrr)
+			}
+		}
+
+		testResumeState("Handshake", false)
+		testResumeState("Resume", true)
+
+		serverConfig.SessionTicketsDisabled = true
+		testResumeState("DisabledOnServer", false)
+		serverConfig.SessionTicketsDisabled = false
+
+		serverConfig.SetSessionTicketKeys([][32]byte{{1}})
+		testResumeState("NewKey", false)
+		testResumeState("ResumeNewKey", true)
+
+		serverConfig.Time = func() time.Time { return time.Unix(0, 0).Add(maxSessionTicketLifetime + time.Second) }
+		testResumeState("Expired", false)
+	}
+}
+
+func TestTLS13KeyUpdate(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		sconn, err := ln.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		srv := Server(sconn, tls13TestConfig())
+		defer srv.Close()
+		// Echo everything, across the key updates requested by the client.
+		_, err = io.Copy(srv, srv)
+		errCh <- err
+	}()
+
+	conn, err := Dial("tcp", ln.Addr().String(), tls13TestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 5)
+	for i := 0; i < 3; i++ {
+		conn.out.Lock()
+		err := conn.sendKeyUpdateLocked(true)
+		conn.out.Unlock()
+		if err != nil {
+			t.Fatalf("#%d: failed to send KeyUpdate: %s", i, err)
+		}
+
+		msg := []byte(fmt.Sprintf("ping%d", i))
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatalf("#%d: write failed: %s", i, err)
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("#%d: read failed: %s", i, err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Fatalf("#%d: read %q, want %q", i, buf, msg)
+		}
+	}
+
+	conn.Close()
+	if err := <-errCh; err != nil {
+		t.Errorf("server error: %s", err)
+	}
+}
+
+func TestTLS13ClientAuth(t *testing.T) {
+	serverConfig := tls13TestConfig()
+	serverConfig.ClientAuth = RequireAnyClientCert
+
+	clientConfig := tls13TestConfig()
+	clientConfig.Certificates = nil
+	if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err == nil {
+		t.Fatal("handshake succeeded without a client certificate")
+	}
+
+	for _, cert := range []Certificate{
+		{Certificate: [][]byte{testRSACertificate}, PrivateKey: testRSAPrivateKey},
+		{Certificate: [][]byte{testECDSACertificate}, PrivateKey: testECDSAPrivateKey},
+	} {
+		clientConfig := tls13TestConfig()
+		clientConfig.Certificates = []Certificate{cert}
+		_, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		if len(serverState.PeerCertificates) != 1 || !bytes.Equal(serverState.PeerCertificates[0].Raw, cert.Certificate[0]) {
+			t.Errorf("server did not see the client certificate")
+		}
+	}
+}
+
+func TestTLS13VersionFallback(t *testing.T) {
+	tls12Config := testConfig
+
+	for _, test := range []struct {
+		name                       string
+		clientConfig, serverConfig *Config
+	}{
+		{"TLS12Server", tls13TestConfig(), tls12Config},
+		{"TLS12Client", tls12Config, tls13TestConfig()},
+	} {
+		clientState, serverState, err := testTLS13Handshake(t, test.clientConfig, test.serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %s", test.name, err)
+		}
+		if clientState.Version != VersionTLS12 || serverState.Version != VersionTLS12 {
+			t.Errorf("%s: got versions %x and %x, want %x", test.name, clientState.Version, serverState.Version, VersionTLS12)
+		}
+		if clientState.TLSUnique == nil {
+			t.Errorf("%s: TLSUnique not set for TLS 1.2", test.name)
+		}
+	}
+}
+
+// TestTLS13DowngradeProtection checks that a TLS 1.3 client rejects a lower
+// version when the server signals that it supports TLS 1.3, as happens when
+// the supported_versions extension is stripped by an attacker.
+func TestTLS13DowngradeProtection(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	go func() {
+		sconn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		srv := Server(sconn, tls13TestConfig())
+		srv.Handshake()
+		srv.Close()
+	}()
+
+	rawConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawConn.Close()
+
+	stripped := false
+	conn := &changeImplConn{Conn: rawConn}
+	conn.writeFunc = func(p []byte) (int, error) {
+		if stripped {
+			return rawConn.Write(p)
+		}
+		stripped = true
+		hello := new(clientHelloMsg)
+		if len(p) < recordHeaderLen || !hello.unmarshal(p[recordHeaderLen:]) {
+			t.Error("first record is not a ClientHello")
+			return rawConn.Write(p)
+		}
+		hello.raw = nil
+		hello.supportedVersions = nil
+		hello.keyShares = nil
+		hello.pskModes = nil
+		m := hello.marshal()
+		record := append([]byte{byte(recordTypeHandshake), p[1], p[2], byte(len(m) >> 8), byte(len(m))}, m...)
+		if _, err := rawConn.Write(record); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	err = Client(conn, tls13TestConfig()).Handshake()
+	if err == nil || !strings.Contains(err.Error(), "downgrade attempt detected") {
+		t.Errorf("got error %v, want a downgrade error", err)
+	}
+}
+
+func TestX25519ChaCha20Poly1305(t *testing.T) {
+	// Make ChaCha20-Poly1305 the preferred TLS 1.3 cipher suite.
+	defaultSuites := defaultCipherSuitesTLS13()
+	defer func() { varDefaultCipherSuitesTLS13 = defaultSuites }()
+	varDefaultCipherSuitesTLS13 = []uint16{TLS_CHACHA20_POLY1305_SHA256}
+
+	for _, test := range []struct {
+		version uint16
+		suites  []uint16
+		want    uint16
+	}{
+		{VersionTLS12, []uint16{TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305},
+		{VersionTLS13, nil, TLS_CHACHA20_POLY1305_SHA256},
+	} {
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = test.version
+		clientConfig.CipherSuites = test.suites
+		clientConfig.CurvePreferences = []CurveID{X25519}
+		serverConfig := tls13TestConfig()
+		serverConfig.CipherSuites = nil
+		serverConfig.CurvePreferences = []CurveID{X25519, CurveP256}
+
+		clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%x: handshake failed: %s", test.version, err)
+		}
+		if clientState.Version != test.version {
+			t.Errorf("%x: got version %x", test.version, clientState.Version)
+		}
+		if clientState.CipherSuite != test.want || serverState.CipherSuite != test.want {
+			t.Errorf("%x: got cipher suites %x and %x, want %x", test.version, clientState.CipherSuite, serverState.CipherSuite, test.want)
+		}
+	}
+}
+
+func TestDefaultCipherSuitesOrder(t *testing.T) {
+	var want uint16 = TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	var want13 uint16 = TLS_AES_128_GCM_SHA256
+	if !hasAESGCMHardwareSupport {
+		want = TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305
+		want13 = TLS_CHACHA20_POLY1305_SHA256
+	}
+	if got := defaultCipherSuites()[0]; got != want {
+		t.Errorf("first default cipher suite is %x, want %x", got, want)
+	}
+	if got := defaultCipherSuitesTLS13()[0]; got != want13 {
+		t.Errorf("first default TLS 1.3 cipher suite is %x, want %x", got, want13)
+	}
+
+	seen := make(map[uint16]bool)
+	for _, id := range defaultCipherSuites() {
+		if seen[id] {
+			t.Errorf("cipher suite %x is listed twice", id)
+		}
+		seen[id] = true
+	}
+	for _, suite := range cipherSuites {
+		if suite.flags&suiteDefaultOff == 0 && !seen[suite.id] {
+			t.Errorf("cipher suite %x is missing from the defaults", suite.id)
+		}
+	}
+}
+
+func TestGetClientCertificate(t *testing.T) {
+	issuer, err := x509.ParseCertificate(testRSACertificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCallback := errors.New("callback error")
+
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		serverConfig := tls13TestConfig()
+		serverConfig.ClientAuth = RequireAnyClientCert
+		serverConfig.ClientCAs = x509.NewCertPool()
+		serverConfig.ClientCAs.AddCert(issuer)
+
+		var cri *CertificateRequestInfo
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = version
+		clientConfig.GetClientCertificate = func(info *CertificateRequestInfo) (*Certificate, error) {
+			cri = info
+			return &Certificate{
+				Certificate: [][]byte{testECDSACertificate},
+				PrivateKey:  testECDSAPrivateKey,
+			}, nil
+		}
+		_, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%x: handshake failed: %s", version, err)
+		}
+		if cri == nil {
+			t.Fatalf("%x: GetClientCertificate was not called", version)
+		}
+		if len(cri.AcceptableCAs) != 1 || !bytes.Equal(cri.AcceptableCAs[0], issuer.RawSubject) {
+			t.Errorf("%x: got acceptable CAs %x, want the subject of the ClientCAs certificate", version, cri.AcceptableCAs)
+		}
+		if len(cri.SignatureSchemes) == 0 {
+			t.Errorf("%x: no signature schemes in CertificateRequestInfo", version)
+		}
+		if len(serverState.PeerCertificates) != 1 || !bytes.Equal(serverState.PeerCertificates[0].Raw, testECDSACertificate) {
+			t.Errorf("%x: server did not see the client certificate", version)
+		}
+
+		clientConfig.GetClientCertificate = func(*CertificateRequestInfo) (*Certificate, error) {
+			return new(Certificate), nil
+		}
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err == nil {
+			t.Errorf("%x: handshake succeeded without a client certificate", version)
+		}
+
+		clientConfig.GetClientCertificate = func(*CertificateRequestInfo) (*Certificate, error) {
+			return nil, errCallback
+		}
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err != errCallback {
+			t.Errorf("%x: got error %v, want %v", version, err, errCallback)
+		}
+	}
+}
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	errCallback := errors.New("callback error")
+
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		var clientSaw, serverSaw [][]byte
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = version
+		clientConfig.Certificates = []Certificate{{
+			Certificate: [][]byte{testECDSACertificate},
+			PrivateKey:  testECDSAPrivateKey,
+		}}
+		clientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if verifiedChains != nil {
+				t.Errorf("%x: got verified chains with InsecureSkipVerify", version)
+			}
+			clientSaw = rawCerts
+			return nil
+		}
+		serverConfig := tls13TestConfig()
+		serverConfig.ClientAuth = RequireAnyClientCert
+		serverConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			serverSaw = rawCerts
+			return nil
+		}
+
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err != nil {
+			t.Fatalf("%x: handshake failed: %s", version, err)
+		}
+		if len(clientSaw) != 1 || !bytes.Equal(clientSaw[0], testRSACertificate) {
+			t.Errorf("%x: client callback did not see the server certificate", version)
+		}
+		if len(serverSaw) != 1 || !bytes.Equal(serverSaw[0], testECDSACertificate) {
+			t.Errorf("%x: server callback did not see the client certificate", version)
+		}
+
+		clientConfig.VerifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+			return errCallback
+		}
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err != errCallback {
+			t.Errorf("%x: client: got error %v, want %v", version, err, errCallback)
+		}
+		clientConfig.VerifyPeerCertificate = nil
+
+		serverConfig.VerifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+			return errCallback
+		}
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err == nil {
+			t.Errorf("%x: handshake succeeded although the server callback failed", version)
+		}
+	}
+}
+
+func TestGetConfigForClient(t *testing.T) {
+	errCallback := errors.New("callback error")
+
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		var serverName string
+		serverConfig := tls13TestConfig()
+		serverConfig.Certificates = nil
+		serverConfig.GetConfigForClient = func(clientHello *ClientHelloInfo) (*Config, error) {
+			serverName = clientHello.ServerName
+			// Each connection gets a fresh Config, which must share the
+			// session ticket keys of the original one. A nil Rand makes
+			// its own ticket key random.
+			config := tls13TestConfig()
+			config.Rand = nil
+			config.NextProtos = []string{"proto"}
+			return config, nil
+		}
+
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = version
+		clientConfig.ServerName = "example.golang"
+		clientConfig.NextProtos = []string{"proto"}
+		clientConfig.ClientSessionCache = NewLRUClientSessionCache(32)
+
+		for _, didResume := range []bool{false, true} {
+			clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Fatalf("%x: handshake failed: %s", version, err)
+			}
+			if serverName != clientConfig.ServerName {
+				t.Errorf("%x: callback got server name %q, want %q", version, serverName, clientConfig.ServerName)
+			}
+			if clientState.NegotiatedProtocol != "proto" {
+				t.Errorf("%x: got protocol %q, want %q", version, clientState.NegotiatedProtocol, "proto")
+			}
+			if clientState.DidResume != didResume || serverState.DidResume != didResume {
+				t.Errorf("%x: resumed: %v and %v, expected: %v", version, clientState.DidResume, serverState.DidResume, didResume)
+			}
+		}
+
+		serverConfig.GetConfigForClient = func(*ClientHelloInfo) (*Config, error) {
+			return nil, errCallback
+		}
+		if _, _, err := testTLS13Handshake(t, clientConfig, serverConfig); err == nil {
+			t.Errorf("%x: handshake succeeded although the callback failed", version)
+		}
+	}
+}
+
+func TestKeyLogWriter(t *testing.T) {
+	for _, test := range []struct {
+		version uint16
+		labels  []string
+	}{
+		{VersionTLS12, []string{keyLogLabelTLS12}},
+		{VersionTLS13, []string{keyLogLabelClientHandshake, keyLogLabelServerHandshake, keyLogLabelClientTraffic, keyLogLabelServerTraffic}},
+	} {
+		var clientLog, serverLog bytes.Buffer
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = test.version
+		clientConfig.KeyLogWriter = &clientLog
+		serverConfig := tls13TestConfig()
+		serverConfig.KeyLogWriter = &serverLog
+
+		clientState, _, err := testTLS13Handshake(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%x: handshake failed: %s", test.version, err)
+		}
+		if clientState.Version != test.version {
+			t.Fatalf("%x: got version %x", test.version, clientState.Version)
+		}
+		if clientLog.String() != serverLog.String() {
+			t.Errorf("%x: client and server logs differ:\n%s\n%s", test.version, clientLog.String(), serverLog.String())
+		}
+
+		lines := strings.Split(strings.TrimSuffix(clientLog.String(), "\n"), "\n")
+		if len(lines) != len(test.labels) {
+			t.Fatalf("%x: got %d key log lines, want %d:\n%s", test.version, len(lines), len(test.labels), clientLog.String())
+		}
+		var clientRandom string
+		for i, line := range lines {
+			fields := strings.Split(line, " ")
+			if len(fields) != 3 || fields[0] != test.labels[i] || len(fields[1]) != 64 || len(fields[2]) == 0 {
+				t.Errorf("%x: malformed key log line %q", test.version, line)
+				continue
+			}
+			if i > 0 && fields[1] != clientRandom {
+				t.Errorf("%x: key log lines name different client randoms", test.version)
+			}
+			clientRandom = fields[1]
+		}
+	}
+}
+
+func TestSessionTicketKeyRotation(t *testing.T) {
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = version
+		clientConfig.ClientSessionCache = NewLRUClientSessionCache(32)
+		serverConfig := tls13TestConfig()
+
+		testResumeState := func(test string, didResume bool) {
+			clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Fatalf("%x: %s: handshake failed: %s", version, test, err)
+			}
+			if clientState.DidResume != didResume || serverState.DidResume != didResume {
+				t.Fatalf("%x: %s: resumed: %v and %v, expected: %v", version, test, clientState.DidResume, serverState.DidResume, didResume)
+			}
+		}
+
+		// Keys set before the first handshake must not be replaced by
+		// the SessionTicketKey.
+		serverConfig.SetSessionTicketKeys([][32]byte{{1}})
+		testResumeState("Handshake", false)
+		testResumeState("Resume", true)
+		if keys := serverConfig.ticketKeys(); len(keys) != 1 || keys[0] != ticketKeyFromBytes([32]byte{1}) {
+			t.Fatalf("%x: ticket keys set before the first handshake were replaced", version)
+		}
+
+		// A ticket encrypted with an older key is still accepted, and
+		// replaced by one encrypted with the new key.
+		serverConfig.SetSessionTicketKeys([][32]byte{{2}, {1}})
+		testResumeState("RotatedKey", true)
+		serverConfig.SetSessionTicketKeys([][32]byte{{2}})
+		testResumeState("OldKeyRemoved", true)
+
+		serverConfig.SetSessionTicketKeys([][32]byte{{3}})
+		testResumeState("UnknownKey", false)
+	}
+}
+
+func TestSessionTicketKeyRotationAfterHandshake(t *testing.T) {
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		clientConfig := tls13TestConfig()
+		clientConfig.MaxVersion = version
+		clientConfig.ClientSessionCache = NewLRUClientSessionCache(32)
+		serverConfig := tls13TestConfig()
+		serverConfig.SetSessionTicketKeys([][32]byte{{1}})
+
+		testResumeState := func(test string, didResume bool) {
+			clientState, serverState, err := testTLS13Handshake(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Fatalf("%x: %s: handshake failed: %s", version, test, err)
+			}
+			if clientState.DidResume != didResume || serverState.DidResume != didResume {
+				t.Fatalf("%x: %s: resumed: %v and %v, expected: %v", version, test, clientState.DidResume, serverState.DidResume, didResume)
+			}
+		}
+
+		// The client now holds a ticket encrypted with key {1}.
+		testResumeState("Handshake", false)
+
+		// Rotate in a new key after the first handshake. The ticket's
+		// key is no longer first, but must still decrypt it.
+		serverConfig.SetSessionTicketKeys([][32]byte{{2}, {1}})
+		testResumeState("RotatedKey", true)
+
+		// The resumption issued a new ticket encrypted with the
+		// first key, which still works once the old key is gone.
+		serverConfig.SetSessionTicketKeys([][32]byte{{2}})
+		testResumeState("OldKeyRemoved", true)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"runtime"
 	"strings"
 	"time"
@@ -157,21 +158,9 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 		return CertificateInvalidError{c, Expired}
 	}
 
-	if len(c.PermittedDNSDomains) > 0 {
-		ok := false
-		for _, domain := range c.PermittedDNSDomains {
-			if opts.DNSName == domain ||
-				(strings.HasSuffix(opts.DNSName, domain) &&
-					len(opts.DNSName) >= 1+len(domain) &&
-					opts.DNSName[len(opts.DNSName)-len(domain)-1] == '.') {
-				ok = true
-				break
-			}
-		}
-
-		if !ok {
-			return CertificateInvalidError{c, CANotAuthorizedForThisName}
-		}
+	if (certType == intermediateCertificate || certType == rootCertificate) &&
+		c.hasNameConstraints() && !c.permitsNamesOf(currentChain[0]) {
+		return CertificateInvalidError{c, CANotAuthorizedForThisName}
 	}
 
 	// KeyUsage status flags are ignored. From Engineering Security, Peter
@@ -205,6 +194,212 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 	return nil
 }
 
+// hasNameConstraints reports whether c constrains the names of the
+// certificates below it in a chain.
+func (c *Certificate) hasNameConstraints() bool {
+	return len(c.PermittedDNSDomains) > 0 || len(c.ExcludedDNSDomains) > 0 ||
+		len(c.PermittedIPRanges) > 0 || len(c.ExcludedIPRanges) > 0 ||
+		len(c.PermittedEmailAddresses) > 0 || len(c.ExcludedEmailAddresses) > 0 ||
+		len(c.PermittedURIDomains) > 0 || len(c.ExcludedURIDomains) > 0
+}
+
+// permitsNamesOf reports whether the name constraints of c allow all the
+// names of leaf. As in VerifyHostname, the common name of leaf is taken as
+// a DNS name if leaf has no DNS names. See RFC 5280, section 4.2.1.10.
+func (c *Certificate) permitsNamesOf(leaf *Certificate) bool {
+	dnsNames := leaf.DNSNames
+	if len(dnsNames) == 0 && isHostname(leaf.Subject.CommonName) {
+		dnsNames = []string{leaf.Subject.CommonName}
+	}
+	for _, name := range dnsNames {
+		if !c.permitsDNSName(name) {
+			return false
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		if !c.permitsIPAddress(ip) {
+			return false
+		}
+	}
+	for _, email := range leaf.EmailAddresses {
+		if !c.permitsEmailAddress(email) {
+			return false
+		}
+	}
+	for _, uri := range leaf.URIs {
+		if !c.permitsURI(uri) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Certificate) permitsDNSName(name string) bool {
+	name = toLowerCaseASCII(strings.TrimSuffix(name, "."))
+	for _, constraint := range c.ExcludedDNSDomains {
+		if matchDomainConstraint(name, constraint) {
+			return false
+		}
+		// A wildcard name is excluded if any name it matches could be.
+		if strings.HasPrefix(name, "*.") && matchDomainConstraint(strings.TrimPrefix(toLowerCaseASCII(constraint), "."), name[1:]) {
+			return false
+		}
+	}
+	if len(c.PermittedDNSDomains) == 0 {
+		return true
+	}
+	for _, constraint := range c.PermittedDNSDomains {
+		if matchDomainConstraint(name, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Certificate) permitsIPAddress(ip net.IP) bool {
+	for _, constraint := range c.ExcludedIPRanges {
+		if matchIPConstraint(ip, constraint) {
+			return false
+		}
+	}
+	if len(c.PermittedIPRanges) == 0 {
+		return true
+	}
+	for _, constraint := range c.PermittedIPRanges {
+		if matchIPConstraint(ip, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Certificate) permitsEmailAddress(email string) bool {
+	if len(c.PermittedEmailAddresses) == 0 && len(c.ExcludedEmailAddresses) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		// A malformed address can't be checked against the constraints.
+		return false
+	}
+	mailbox, host := email[:at], toLowerCaseASCII(email[at+1:])
+	for _, constraint := range c.ExcludedEmailAddresses {
+		if matchEmailConstraint(mailbox, host, constraint) {
+			return false
+		}
+	}
+	if len(c.PermittedEmailAddresses) == 0 {
+		return true
+	}
+	for _, constraint := range c.PermittedEmailAddresses {
+		if matchEmailConstraint(mailbox, host, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Certificate) permitsURI(uri *url.URL) bool {
+	if len(c.PermittedURIDomains) == 0 && len(c.ExcludedURIDomains) == 0 {
+		return true
+	}
+	host := uri.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	// URI constraints only apply to fully qualified domain names, so a
+	// URI without one, or with an IP address, can't satisfy them.
+	if len(host) == 0 || strings.HasPrefix(host, "[") || net.ParseIP(host) != nil {
+		return false
+	}
+	host = toLowerCaseASCII(host)
+	for _, constraint := range c.ExcludedURIDomains {
+		if matchURIConstraint(host, constraint) {
+			return false
+		}
+	}
+	if len(c.PermittedURIDomains) == 0 {
+		return true
+	}
+	for _, constraint := range c.PermittedURIDomains {
+		if matchURIConstraint(host, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomainConstraint reports whether the lower-case DNS name domain is
+// within the subtree of constraint. A constraint matches itself and its
+// subdomains, unless it starts with a period, in which case it only matches
+// its subdomains. An empty constraint matches every name.
+func matchDomainConstraint(domain, constraint string) bool {
+	constraint = toLowerCaseASCII(constraint)
+	if len(constraint) == 0 {
+		return true
+	}
+	if constraint[0] == '.' {
+		return len(domain) > len(constraint) && strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint || strings.HasSuffix(domain, "."+constraint)
+}
+
+// matchIPConstraint reports whether ip is within the range of constraint.
+// IPv4 addresses only match IPv4 ranges, and IPv6 addresses IPv6 ranges.
+func matchIPConstraint(ip net.IP, constraint *net.IPNet) bool {
+	return len(ip) == len(constraint.IP) && constraint.Contains(ip)
+}
+
+// matchEmailConstraint reports whether the email address with the given
+// mailbox and lower-case host is within the subtree of constraint, which
+// names a particular mailbox, all the mailboxes on a host, or, if it starts
+// with a period, all the mailboxes in a domain.
+func matchEmailConstraint(mailbox, host, constraint string) bool {
+	if at := strings.LastIndex(constraint, "@"); at >= 0 {
+		return mailbox == constraint[:at] && host == toLowerCaseASCII(constraint[at+1:])
+	}
+	constraint = toLowerCaseASCII(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// matchURIConstraint reports whether the lower-case host of a URI is
+// within the subtree of constraint, which names a particular host or, if it
+// starts with a period, all the hosts in a domain.
+func matchURIConstraint(host, constraint string) bool {
+	constraint = toLowerCaseASCII(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// isHostname reports whether name looks like a DNS name, possibly with a
+// wildcard first label, rather than free text.
+func isHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 {
+		return false
+	}
+	for i, label := range strings.Split(name, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if len(label) == 0 {
+			return false
+		}
+		for _, c := range label {
+			if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' {
+				continue
+			}
+			return false
+		}
+	}
+	return true
+}
+
 // Verify attempts to verify c by building one or more chains from c to a
 // certificate in opts.Roots, using certificates in opts.Intermediates if
 // needed. If successful, it returns one or more chains where the first
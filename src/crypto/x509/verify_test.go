@@ -5,9 +5,15 @@
 package x509
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
+	"math/big"
+	"net"
+	"net/url"
 	"runtime"
 	"strings"
 	"testing"
@@ -1132,3 +1138,163 @@ Nr4TDea9Y355e6cJDUCrat2PisP29owaQgVR1EX1n6diIWgVIEM8med8vSTYqZEX
 c4g/VhsxOBi0cQ+azcgOno4uG+GMmIPLHzHxREzGBHNJdmAPx/i9F4BrLunMTA5a
 mnkPIAou1Z5jJh5VkpTYghdae9C8x49OhgQ=
 -----END CERTIFICATE-----`
+
+var nameConstraintsTests = []struct {
+	name       string
+	constraint Certificate // only the name constraints are used
+	leaf       Certificate // only the subject and its alternate names are used
+	ok         bool
+}{
+	// DNS names.
+	{"DNSPermitted", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{DNSNames: []string{"foo.example.com", "example.com"}}, true},
+	{"DNSNotPermitted", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{DNSNames: []string{"foo.example.com", "foo.example.org"}}, false},
+	{"DNSSuffixNotLabel", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{DNSNames: []string{"fooexample.com"}}, false},
+	{"DNSSubdomainsOnly", Certificate{PermittedDNSDomains: []string{".example.com"}}, Certificate{DNSNames: []string{"example.com"}}, false},
+	{"DNSSubdomain", Certificate{PermittedDNSDomains: []string{".example.com"}}, Certificate{DNSNames: []string{"a.b.example.com"}}, true},
+	{"DNSCaseInsensitive", Certificate{PermittedDNSDomains: []string{"Example.COM"}}, Certificate{DNSNames: []string{"FOO.example.com"}}, true},
+	{"DNSExcluded", Certificate{PermittedDNSDomains: []string{"example.com"}, ExcludedDNSDomains: []string{"bar.example.com"}}, Certificate{DNSNames: []string{"foo.bar.example.com"}}, false},
+	{"DNSExcludedWildcard", Certificate{ExcludedDNSDomains: []string{"bar.example.com"}}, Certificate{DNSNames: []string{"*.example.com"}}, false},
+	{"DNSPermittedWildcard", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{DNSNames: []string{"*.example.com"}}, true},
+	{"DNSCommonName", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{Subject: pkix.Name{CommonName: "foo.example.org"}}, false},
+	{"DNSCommonNameNotHostname", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{Subject: pkix.Name{CommonName: "Gopher Client"}}, true},
+	{"DNSCommonNameWithSANs", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{Subject: pkix.Name{CommonName: "foo.example.org"}, DNSNames: []string{"foo.example.com"}}, true},
+	{"DNSOnlyConstrainsDNS", Certificate{PermittedDNSDomains: []string{"example.com"}}, Certificate{EmailAddresses: []string{"gopher@example.org"}}, true},
+
+	// IP addresses.
+	{"IPPermitted", Certificate{PermittedIPRanges: []*net.IPNet{parseCIDR("10.0.0.0/8")}}, Certificate{IPAddresses: []net.IP{net.IPv4(10, 1, 2, 3)}}, true},
+	{"IPNotPermitted", Certificate{PermittedIPRanges: []*net.IPNet{parseCIDR("10.0.0.0/8")}}, Certificate{IPAddresses: []net.IP{net.IPv4(192, 168, 1, 1)}}, false},
+	{"IPOtherFamily", Certificate{PermittedIPRanges: []*net.IPNet{parseCIDR("10.0.0.0/8")}}, Certificate{IPAddresses: []net.IP{net.ParseIP("::1")}}, false},
+	{"IPv6Permitted", Certificate{PermittedIPRanges: []*net.IPNet{parseCIDR("2001:db8::/32")}}, Certificate{IPAddresses: []net.IP{net.ParseIP("2001:db8::1")}}, true},
+	{"IPExcluded", Certificate{PermittedIPRanges: []*net.IPNet{parseCIDR("10.0.0.0/8")}, ExcludedIPRanges: []*net.IPNet{parseCIDR("10.1.0.0/16")}}, Certificate{IPAddresses: []net.IP{net.IPv4(10, 1, 2, 3)}}, false},
+
+	// Email addresses.
+	{"EmailHost", Certificate{PermittedEmailAddresses: []string{"example.com"}}, Certificate{EmailAddresses: []string{"gopher@example.com"}}, true},
+	{"EmailHostNotSubdomain", Certificate{PermittedEmailAddresses: []string{"example.com"}}, Certificate{EmailAddresses: []string{"gopher@sub.example.com"}}, false},
+	{"EmailDomain", Certificate{PermittedEmailAddresses: []string{".example.com"}}, Certificate{EmailAddresses: []string{"gopher@sub.example.com"}}, true},
+	{"EmailMailbox", Certificate{PermittedEmailAddresses: []string{"gopher@example.com"}}, Certificate{EmailAddresses: []string{"gopher@EXAMPLE.com"}}, true},
+	{"EmailOtherMailbox", Certificate{PermittedEmailAddresses: []string{"gopher@example.com"}}, Certificate{EmailAddresses: []string{"other@example.com"}}, false},
+	{"EmailExcluded", Certificate{ExcludedEmailAddresses: []string{"EXAMPLE.com"}}, Certificate{EmailAddresses: []string{"gopher@example.com"}}, false},
+	{"EmailMalformed", Certificate{ExcludedEmailAddresses: []string{"example.com"}}, Certificate{EmailAddresses: []string{"example.com"}}, false},
+
+	// URIs.
+	{"URIDomain", Certificate{PermittedURIDomains: []string{".example.com"}}, Certificate{URIs: []*url.URL{parseURI("spiffe://foo.example.com/workload")}}, true},
+	{"URIDomainNotHost", Certificate{PermittedURIDomains: []string{".example.com"}}, Certificate{URIs: []*url.URL{parseURI("spiffe://example.com/workload")}}, false},
+	{"URIHost", Certificate{PermittedURIDomains: []string{"example.com"}}, Certificate{URIs: []*url.URL{parseURI("https://example.com:8443/path")}}, true},
+	{"URIHostNotSubdomain", Certificate{PermittedURIDomains: []string{"example.com"}}, Certificate{URIs: []*url.URL{parseURI("https://foo.example.com/")}}, false},
+	{"URIWithoutHost", Certificate{ExcludedURIDomains: []string{"example.com"}}, Certificate{URIs: []*url.URL{parseURI("urn:example:gopher")}}, false},
+	{"URIWithIP", Certificate{ExcludedURIDomains: []string{"example.com"}}, Certificate{URIs: []*url.URL{parseURI("https://10.1.2.3/")}}, false},
+	{"URIExcluded", Certificate{ExcludedURIDomains: []string{".example.com"}}, Certificate{URIs: []*url.URL{parseURI("spiffe://bad.example.com/workload")}}, false},
+}
+
+func parseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func parseURI(s string) *url.URL {
+	uri, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return uri
+}
+
+func TestNameConstraints(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(10000, 0)
+	for _, test := range nameConstraintsTests {
+		// The constraints are placed on an intermediate, as well as
+		// on a root.
+		for _, onIntermediate := range []bool{false, true} {
+			root := &Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "Root"},
+				NotBefore:             time.Unix(1000, 0),
+				NotAfter:              time.Unix(100000, 0),
+				KeyUsage:              KeyUsageCertSign,
+				BasicConstraintsValid: true,
+				IsCA: true,
+			}
+			intermediate := &Certificate{
+				SerialNumber:          big.NewInt(2),
+				Subject:               pkix.Name{CommonName: "Intermediate"},
+				NotBefore:             time.Unix(1000, 0),
+				NotAfter:              time.Unix(100000, 0),
+				KeyUsage:              KeyUsageCertSign,
+				BasicConstraintsValid: true,
+				IsCA: true,
+			}
+			constrained := root
+			if onIntermediate {
+				constrained = intermediate
+			}
+			constrained.PermittedDNSDomains = test.constraint.PermittedDNSDomains
+			constrained.ExcludedDNSDomains = test.constraint.ExcludedDNSDomains
+			constrained.PermittedIPRanges = test.constraint.PermittedIPRanges
+			constrained.ExcludedIPRanges = test.constraint.ExcludedIPRanges
+			constrained.PermittedEmailAddresses = test.constraint.PermittedEmailAddresses
+			constrained.ExcludedEmailAddresses = test.constraint.ExcludedEmailAddresses
+			constrained.PermittedURIDomains = test.constraint.PermittedURIDomains
+			constrained.ExcludedURIDomains = test.constraint.ExcludedURIDomains
+
+			leaf := &Certificate{
+				SerialNumber:   big.NewInt(3),
+				Subject:        test.leaf.Subject,
+				NotBefore:      time.Unix(1000, 0),
+				NotAfter:       time.Unix(100000, 0),
+				DNSNames:       test.leaf.DNSNames,
+				IPAddresses:    test.leaf.IPAddresses,
+				EmailAddresses: test.leaf.EmailAddresses,
+				URIs:           test.leaf.URIs,
+			}
+
+			rootCert := mustCreateCertificate(t, root, root, caKey.Public(), caKey)
+			intermediateCert := mustCreateCertificate(t, intermediate, rootCert, caKey.Public(), caKey)
+			leafCert := mustCreateCertificate(t, leaf, intermediateCert, leafKey.Public(), caKey)
+
+			opts := VerifyOptions{
+				Roots:         NewCertPool(),
+				Intermediates: NewCertPool(),
+				CurrentTime:   now,
+				KeyUsages:     []ExtKeyUsage{ExtKeyUsageAny},
+			}
+			opts.Roots.AddCert(rootCert)
+			opts.Intermediates.AddCert(intermediateCert)
+
+			_, err := leafCert.Verify(opts)
+			if test.ok && err != nil {
+				t.Errorf("%s (on intermediate %v): unexpected error: %s", test.name, onIntermediate, err)
+			}
+			if !test.ok {
+				if inval, ok := err.(CertificateInvalidError); !ok || inval.Reason != CANotAuthorizedForThisName {
+					t.Errorf("%s (on intermediate %v): got error %v, want CANotAuthorizedForThisName", test.name, onIntermediate, err)
+				}
+			}
+		}
+	}
+}
+
+// mustCreateCertificate creates a certificate for pub from template, signed
+// by priv, the key of parent, and returns it parsed.
+func mustCreateCertificate(t *testing.T, template, parent *Certificate, pub interface{}, priv *ecdsa.PrivateKey) *Certificate {
+	derBytes, err := CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(derBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
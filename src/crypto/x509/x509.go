@@ -23,6 +23,7 @@ import (
 	"io"
 	"math/big"
 	"net"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -555,10 +556,18 @@ type Certificate struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
+	URIs           []*url.URL
 
 	// Name constraints
 	PermittedDNSDomainsCritical bool // if true then the name constraints are marked critical.
 	PermittedDNSDomains         []string
+	ExcludedDNSDomains          []string
+	PermittedIPRanges           []*net.IPNet
+	ExcludedIPRanges            []*net.IPNet
+	PermittedEmailAddresses     []string
+	ExcludedEmailAddresses      []string
+	PermittedURIDomains         []string
+	ExcludedURIDomains          []string
 
 	// CRL Distribution Points
 	CRLDistributionPoints []string
@@ -766,7 +775,7 @@ type nameConstraints struct {
 }
 
 type generalSubtree struct {
-	Name string `asn1:"tag:2,optional,ia5"`
+	Name asn1.RawValue
 }
 
 // RFC 5280, 4.2.2.1
@@ -871,7 +880,7 @@ func parsePublicKey(algo PublicKeyAlgorithm, keyData *publicKeyInfo) (interface{
 	}
 }
 
-func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddresses []net.IP, err error) {
+func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL, err error) {
 	// RFC 5280, 4.2.1.6
 
 	// SubjectAltName ::= GeneralNames
@@ -913,6 +922,13 @@ func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddre
 			emailAddresses = append(emailAddresses, string(v.Bytes))
 		case 2:
 			dnsNames = append(dnsNames, string(v.Bytes))
+		case 6:
+			uri, parseErr := url.Parse(string(v.Bytes))
+			if parseErr != nil {
+				err = fmt.Errorf("x509: cannot parse URI %q: %s", string(v.Bytes), parseErr)
+				return
+			}
+			uris = append(uris, uri)
 		case 7:
 			switch len(v.Bytes) {
 			case net.IPv4len, net.IPv6len:
@@ -927,6 +943,37 @@ func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddre
 	return
 }
 
+// parseGeneralSubtrees appends the names of the given name constraints to
+// the slice for their type. It reports whether any of them has a type that
+// isn't supported, such as a directory name.
+func parseGeneralSubtrees(subtrees []generalSubtree, dnsDomains *[]string, ipRanges *[]*net.IPNet, emailAddresses, uriDomains *[]string) (unhandled bool, err error) {
+	for _, subtree := range subtrees {
+		if subtree.Name.Class != asn1.ClassContextSpecific {
+			unhandled = true
+			continue
+		}
+		switch subtree.Name.Tag {
+		case 1:
+			*emailAddresses = append(*emailAddresses, string(subtree.Name.Bytes))
+		case 2:
+			*dnsDomains = append(*dnsDomains, string(subtree.Name.Bytes))
+		case 6:
+			*uriDomains = append(*uriDomains, string(subtree.Name.Bytes))
+		case 7:
+			// The constraint is an address followed by a mask of
+			// the same length.
+			b := subtree.Name.Bytes
+			if len(b) != 2*net.IPv4len && len(b) != 2*net.IPv6len {
+				return false, errors.New("x509: certificate contained IP range constraint of length " + strconv.Itoa(len(b)))
+			}
+			*ipRanges = append(*ipRanges, &net.IPNet{IP: b[:len(b)/2], Mask: b[len(b)/2:]})
+		default:
+			unhandled = true
+		}
+	}
+	return unhandled, nil
+}
+
 func parseCertificate(in *certificate) (*Certificate, error) {
 	out := new(Certificate)
 	out.Raw = in.Raw
@@ -1006,12 +1053,12 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 				out.MaxPathLenZero = out.MaxPathLen == 0
 
 			case 17:
-				out.DNSNames, out.EmailAddresses, out.IPAddresses, err = parseSANExtension(e.Value)
+				out.DNSNames, out.EmailAddresses, out.IPAddresses, out.URIs, err = parseSANExtension(e.Value)
 				if err != nil {
 					return nil, err
 				}
 
-				if len(out.DNSNames) == 0 && len(out.EmailAddresses) == 0 && len(out.IPAddresses) == 0 {
+				if len(out.DNSNames) == 0 && len(out.EmailAddresses) == 0 && len(out.IPAddresses) == 0 && len(out.URIs) == 0 {
 					// If we didn't parse anything then we do the critical check, below.
 					unhandled = true
 				}
@@ -1039,18 +1086,16 @@ func parseCertificate(in *certificate) (*Certificate, error) {
 					return nil, errors.New("x509: trailing data after X.509 NameConstraints")
 				}
 
-				if len(constraints.Excluded) > 0 && e.Critical {
-					return out, UnhandledCriticalExtension{}
+				unhandledName, err := parseGeneralSubtrees(constraints.Permitted, &out.PermittedDNSDomains, &out.PermittedIPRanges, &out.PermittedEmailAddresses, &out.PermittedURIDomains)
+				if err != nil {
+					return nil, err
 				}
-
-				for _, subtree := range constraints.Permitted {
-					if len(subtree.Name) == 0 {
-						if e.Critical {
-							return out, UnhandledCriticalExtension{}
-						}
-						continue
-					}
-					out.PermittedDNSDomains = append(out.PermittedDNSDomains, subtree.Name)
+				unhandledExcludedName, err := parseGeneralSubtrees(constraints.Excluded, &out.ExcludedDNSDomains, &out.ExcludedIPRanges, &out.ExcludedEmailAddresses, &out.ExcludedURIDomains)
+				if err != nil {
+					return nil, err
+				}
+				if (unhandledName || unhandledExcludedName) && e.Critical {
+					return out, UnhandledCriticalExtension{}
 				}
 
 			case 31:
@@ -1286,7 +1331,7 @@ func oidInExtensions(oid asn1.ObjectIdentifier, extensions []pkix.Extension) boo
 
 // marshalSANs marshals a list of addresses into a the contents of an X.509
 // SubjectAlternativeName extension.
-func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP) (derBytes []byte, err error) {
+func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) (derBytes []byte, err error) {
 	var rawValues []asn1.RawValue
 	for _, name := range dnsNames {
 		rawValues = append(rawValues, asn1.RawValue{Tag: 2, Class: 2, Bytes: []byte(name)})
@@ -1302,9 +1347,38 @@ func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP) (derBy
 		}
 		rawValues = append(rawValues, asn1.RawValue{Tag: 7, Class: 2, Bytes: ip})
 	}
+	for _, uri := range uris {
+		rawValues = append(rawValues, asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(uri.String())})
+	}
 	return asn1.Marshal(rawValues)
 }
 
+// marshalGeneralSubtrees returns the name constraints for the given names,
+// in the form used by the NameConstraints extension.
+func marshalGeneralSubtrees(dnsDomains []string, ipRanges []*net.IPNet, emailAddresses, uriDomains []string) (subtrees []generalSubtree, err error) {
+	for _, domain := range dnsDomains {
+		subtrees = append(subtrees, generalSubtree{Name: asn1.RawValue{Tag: 2, Class: 2, Bytes: []byte(domain)}})
+	}
+	for _, ipNet := range ipRanges {
+		ip := ipNet.IP
+		// IPv4 ranges are always encoded in 4 bytes, to match their mask.
+		if len(ipNet.Mask) == net.IPv4len {
+			ip = ip.To4()
+		}
+		if len(ip) != len(ipNet.Mask) {
+			return nil, errors.New("x509: invalid IP range constraint " + ipNet.String())
+		}
+		subtrees = append(subtrees, generalSubtree{Name: asn1.RawValue{Tag: 7, Class: 2, Bytes: append(append([]byte(nil), ip...), ipNet.Mask...)}})
+	}
+	for _, email := range emailAddresses {
+		subtrees = append(subtrees, generalSubtree{Name: asn1.RawValue{Tag: 1, Class: 2, Bytes: []byte(email)}})
+	}
+	for _, domain := range uriDomains {
+		subtrees = append(subtrees, generalSubtree{Name: asn1.RawValue{Tag: 6, Class: 2, Bytes: []byte(domain)}})
+	}
+	return subtrees, nil
+}
+
 func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 	ret = make([]pkix.Extension, 10 /* maximum number of elements. */)
 	n := 0
@@ -1411,10 +1485,10 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0) &&
+	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0 || len(template.URIs) > 0) &&
 		!oidInExtensions(oidExtensionSubjectAltName, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionSubjectAltName
-		ret[n].Value, err = marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses)
+		ret[n].Value, err = marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses, template.URIs)
 		if err != nil {
 			return
 		}
@@ -1435,15 +1509,19 @@ func buildExtensions(template *Certificate) (ret []pkix.Extension, err error) {
 		n++
 	}
 
-	if len(template.PermittedDNSDomains) > 0 &&
+	if template.hasNameConstraints() &&
 		!oidInExtensions(oidExtensionNameConstraints, template.ExtraExtensions) {
 		ret[n].Id = oidExtensionNameConstraints
 		ret[n].Critical = template.PermittedDNSDomainsCritical
 
 		var out nameConstraints
-		out.Permitted = make([]generalSubtree, len(template.PermittedDNSDomains))
-		for i, permitted := range template.PermittedDNSDomains {
-			out.Permitted[i] = generalSubtree{Name: permitted}
+		out.Permitted, err = marshalGeneralSubtrees(template.PermittedDNSDomains, template.PermittedIPRanges, template.PermittedEmailAddresses, template.PermittedURIDomains)
+		if err != nil {
+			return
+		}
+		out.Excluded, err = marshalGeneralSubtrees(template.ExcludedDNSDomains, template.ExcludedIPRanges, template.ExcludedEmailAddresses, template.ExcludedURIDomains)
+		if err != nil {
+			return
 		}
 		ret[n].Value, err = asn1.Marshal(out)
 		if err != nil {
@@ -1560,8 +1638,10 @@ func signingParamsForPublicKey(pub interface{}, requestedSigAlgo SignatureAlgori
 // CreateCertificate creates a new certificate based on a template. The
 // following members of template are used: SerialNumber, Subject, NotBefore,
 // NotAfter, KeyUsage, ExtKeyUsage, UnknownExtKeyUsage, BasicConstraintsValid,
-// IsCA, MaxPathLen, SubjectKeyId, DNSNames, PermittedDNSDomainsCritical,
-// PermittedDNSDomains, SignatureAlgorithm.
+// IsCA, MaxPathLen, SubjectKeyId, DNSNames, URIs, PermittedDNSDomainsCritical,
+// PermittedDNSDomains, ExcludedDNSDomains, PermittedIPRanges,
+// ExcludedIPRanges, PermittedEmailAddresses, ExcludedEmailAddresses,
+// PermittedURIDomains, ExcludedURIDomains, SignatureAlgorithm.
 //
 // The certificate is signed by parent. If parent is equal to template then the
 // certificate is self-signed. The parameter pub is the public key of the
@@ -1730,6 +1810,164 @@ func (c *Certificate) CreateCRL(rand io.Reader, priv interface{}, revokedCerts [
 	})
 }
 
+// RevocationList contains the fields used to create an X.509 v2 Certificate
+// Revocation List with CreateRevocationList.
+type RevocationList struct {
+	// SignatureAlgorithm is used to determine the signature algorithm to
+	// be used when signing the CRL. If zero, the default algorithm for the
+	// signing key will be used.
+	SignatureAlgorithm SignatureAlgorithm
+
+	// RevokedCertificates is used to populate the revokedCertificates
+	// sequence in the CRL. It may be empty, in which case an empty CRL
+	// will be created. The Extensions of each entry, such as a reason
+	// code or an invalidity date, are included as given.
+	RevokedCertificates []pkix.RevokedCertificate
+
+	// Number is used to populate the X.509 v2 cRLNumber extension in the
+	// CRL, which should be a monotonically increasing sequence number for
+	// a given CRL scope and CRL issuer.
+	Number *big.Int
+
+	// ThisUpdate is used to populate the thisUpdate field in the CRL,
+	// which indicates the issuance date of the CRL.
+	ThisUpdate time.Time
+
+	// NextUpdate is used to populate the nextUpdate field in the CRL,
+	// which indicates the date by which the next CRL will be issued.
+	// NextUpdate must be greater than ThisUpdate.
+	NextUpdate time.Time
+
+	// ExtraExtensions contains any additional extensions to add directly
+	// to the CRL. Values override the authority key identifier and CRL
+	// number extensions that would otherwise be produced.
+	ExtraExtensions []pkix.Extension
+}
+
+// These structures mirror pkix.CertificateList and pkix.TBSCertificateList,
+// but hold the issuer as raw DER so that it is exactly the subject of the
+// issuing certificate.
+
+type certificateList struct {
+	TBSCertList        tbsCertificateList
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateList struct {
+	Raw                 asn1.RawContent
+	Version             int
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+var oidExtensionCRLNumber = asn1.ObjectIdentifier{2, 5, 29, 20}
+
+// CreateRevocationList creates a new X.509 v2 Certificate Revocation List,
+// according to RFC 5280, based on template.
+//
+// The CRL is signed by priv, which should be the private key associated
+// with the public key in the issuer certificate. The issuer must have a
+// SubjectKeyId and, if it has a KeyUsage, be allowed to sign CRLs.
+func CreateRevocationList(rand io.Reader, template *RevocationList, issuer *Certificate, priv interface{}) (crlBytes []byte, err error) {
+	if template == nil {
+		return nil, errors.New("x509: template can not be nil")
+	}
+	if issuer == nil {
+		return nil, errors.New("x509: issuer can not be nil")
+	}
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&KeyUsageCRLSign == 0 {
+		return nil, errors.New("x509: issuer must have the crlSign key usage bit set")
+	}
+	if len(issuer.SubjectKeyId) == 0 {
+		return nil, errors.New("x509: issuer certificate doesn't contain a subject key identifier")
+	}
+	if !template.NextUpdate.After(template.ThisUpdate) {
+		return nil, errors.New("x509: template.ThisUpdate is not before template.NextUpdate")
+	}
+	if template.Number == nil || template.Number.Sign() < 0 {
+		return nil, errors.New("x509: template contains a nil or negative Number")
+	}
+
+	key, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("x509: certificate private key does not implement crypto.Signer")
+	}
+
+	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(key.Public(), template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	asn1Issuer, err := subjectBytes(issuer)
+	if err != nil {
+		return
+	}
+
+	// RFC 5280 requires revocation dates to be in UTC.
+	var revokedCerts []pkix.RevokedCertificate
+	for _, rc := range template.RevokedCertificates {
+		rc.RevocationTime = rc.RevocationTime.UTC()
+		revokedCerts = append(revokedCerts, rc)
+	}
+
+	var extensions []pkix.Extension
+	if !oidInExtensions(oidExtensionAuthorityKeyId, template.ExtraExtensions) {
+		aki := pkix.Extension{Id: oidExtensionAuthorityKeyId}
+		aki.Value, err = asn1.Marshal(authKeyId{Id: issuer.SubjectKeyId})
+		if err != nil {
+			return
+		}
+		extensions = append(extensions, aki)
+	}
+	if !oidInExtensions(oidExtensionCRLNumber, template.ExtraExtensions) {
+		crlNumber := pkix.Extension{Id: oidExtensionCRLNumber}
+		crlNumber.Value, err = asn1.Marshal(template.Number)
+		if err != nil {
+			return
+		}
+		extensions = append(extensions, crlNumber)
+	}
+	extensions = append(extensions, template.ExtraExtensions...)
+
+	tbsCertList := tbsCertificateList{
+		Version:             1, // v2
+		Signature:           signatureAlgorithm,
+		Issuer:              asn1.RawValue{FullBytes: asn1Issuer},
+		ThisUpdate:          template.ThisUpdate.UTC(),
+		NextUpdate:          template.NextUpdate.UTC(),
+		RevokedCertificates: revokedCerts,
+		Extensions:          extensions,
+	}
+
+	tbsCertListContents, err := asn1.Marshal(tbsCertList)
+	if err != nil {
+		return
+	}
+
+	tbsCertList.Raw = tbsCertListContents
+
+	h := hashFunc.New()
+	h.Write(tbsCertListContents)
+	digest := h.Sum(nil)
+
+	var signature []byte
+	signature, err = key.Sign(rand, digest, hashFunc)
+	if err != nil {
+		return
+	}
+
+	return asn1.Marshal(certificateList{
+		TBSCertList:        tbsCertList,
+		SignatureAlgorithm: signatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
 // CertificateRequest represents a PKCS #10, certificate signature request.
 type CertificateRequest struct {
 	Raw                      []byte // Complete ASN.1 DER content (CSR, signature algorithm and signature).
@@ -1767,6 +2005,7 @@ type CertificateRequest struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
+	URIs           []*url.URL
 }
 
 // These structures reflect the ASN.1 structure of X.509 certificate
@@ -1884,9 +2123,9 @@ func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv
 
 	var extensions []pkix.Extension
 
-	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0) &&
+	if (len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0 || len(template.URIs) > 0) &&
 		!oidInExtensions(oidExtensionSubjectAltName, template.ExtraExtensions) {
-		sanBytes, err := marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses)
+		sanBytes, err := marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses, template.URIs)
 		if err != nil {
 			return nil, err
 		}
@@ -2061,7 +2300,7 @@ func parseCertificateRequest(in *certificateRequest) (*CertificateRequest, error
 
 	for _, extension := range out.Extensions {
 		if extension.Id.Equal(oidExtensionSubjectAltName) {
-			out.DNSNames, out.EmailAddresses, out.IPAddresses, err = parseSANExtension(extension.Value)
+			out.DNSNames, out.EmailAddresses, out.IPAddresses, out.URIs, err = parseSANExtension(extension.Value)
 			if err != nil {
 				return nil, err
 			}
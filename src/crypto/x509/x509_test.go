@@ -22,6 +22,7 @@ import (
 	"internal/testenv"
 	"math/big"
 	"net"
+	"net/url"
 	"os/exec"
 	"reflect"
 	"testing"
@@ -341,6 +342,10 @@ func TestCreateSelfSignedCertificate(t *testing.T) {
 	testUnknownExtKeyUsage := []asn1.ObjectIdentifier{[]int{1, 2, 3}, []int{2, 59, 1}}
 	extraExtensionData := []byte("extra extension")
 
+	_, permittedIPRange, _ := net.ParseCIDR("192.168.0.0/16")
+	_, excludedIPRange, _ := net.ParseCIDR("2001:db8::/32")
+	testURL, _ := url.Parse("spiffe://example.com/gopher")
+
 	for _, test := range tests {
 		commonName := "test.example.com"
 		template := Certificate{
@@ -385,9 +390,17 @@ func TestCreateSelfSignedCertificate(t *testing.T) {
 			DNSNames:       []string{"test.example.com"},
 			EmailAddresses: []string{"gopher@golang.org"},
 			IPAddresses:    []net.IP{net.IPv4(127, 0, 0, 1).To4(), net.ParseIP("2001:4860:0:2001::68")},
-
-			PolicyIdentifiers:   []asn1.ObjectIdentifier{[]int{1, 2, 3}},
-			PermittedDNSDomains: []string{".example.com", "example.com"},
+			URIs:           []*url.URL{testURL},
+
+			PolicyIdentifiers:       []asn1.ObjectIdentifier{[]int{1, 2, 3}},
+			PermittedDNSDomains:     []string{".example.com", "example.com"},
+			ExcludedDNSDomains:      []string{"bar.example.com"},
+			PermittedIPRanges:       []*net.IPNet{permittedIPRange},
+			ExcludedIPRanges:        []*net.IPNet{excludedIPRange},
+			PermittedEmailAddresses: []string{"foo@example.com"},
+			ExcludedEmailAddresses:  []string{".example.com", "example.com"},
+			PermittedURIDomains:     []string{".bar.com", "bar.com"},
+			ExcludedURIDomains:      []string{".bar2.com", "bar2.com"},
 
 			CRLDistributionPoints: []string{"http://crl1.example.com/ca1.crl", "http://crl2.example.com/ca1.crl"},
 
@@ -425,6 +438,20 @@ func TestCreateSelfSignedCertificate(t *testing.T) {
 			t.Errorf("%s: failed to parse name constraints: %#v", test.name, cert.PermittedDNSDomains)
 		}
 
+		if !reflect.DeepEqual(cert.ExcludedDNSDomains, template.ExcludedDNSDomains) ||
+			!reflect.DeepEqual(cert.PermittedIPRanges, template.PermittedIPRanges) ||
+			!reflect.DeepEqual(cert.ExcludedIPRanges, template.ExcludedIPRanges) ||
+			!reflect.DeepEqual(cert.PermittedEmailAddresses, template.PermittedEmailAddresses) ||
+			!reflect.DeepEqual(cert.ExcludedEmailAddresses, template.ExcludedEmailAddresses) ||
+			!reflect.DeepEqual(cert.PermittedURIDomains, template.PermittedURIDomains) ||
+			!reflect.DeepEqual(cert.ExcludedURIDomains, template.ExcludedURIDomains) {
+			t.Errorf("%s: name constraints differ from template: %v %v %v %v %v %v %v", test.name, cert.ExcludedDNSDomains, cert.PermittedIPRanges, cert.ExcludedIPRanges, cert.PermittedEmailAddresses, cert.ExcludedEmailAddresses, cert.PermittedURIDomains, cert.ExcludedURIDomains)
+		}
+
+		if len(cert.URIs) != 1 || cert.URIs[0].String() != testURL.String() {
+			t.Errorf("%s: URIs differ from template. Got %v, want %v", test.name, cert.URIs, template.URIs)
+		}
+
 		if cert.Subject.CommonName != commonName {
 			t.Errorf("%s: subject wasn't correctly copied from the template. Got %s, want %s", test.name, cert.Subject.CommonName, commonName)
 		}
@@ -799,6 +826,120 @@ func TestCRLCreation(t *testing.T) {
 	}
 }
 
+func TestCreateRevocationList(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Unix(1000, 0),
+		NotAfter:              time.Unix(100000, 0),
+		SubjectKeyId:          []byte{1, 2, 3},
+		KeyUsage:              KeyUsageCertSign | KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA: true,
+	}
+	derBytes, err := CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := ParseCertificate(derBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reasonCode of keyCompromise, as a CRL entry extension.
+	reasonCode, _ := asn1.Marshal(asn1.Enumerated(1))
+	oidReasonCode := asn1.ObjectIdentifier{2, 5, 29, 21}
+
+	template := &RevocationList{
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{
+				SerialNumber:   big.NewInt(2),
+				RevocationTime: time.Unix(1500, 0).In(time.FixedZone("CET", 3600)),
+				Extensions:     []pkix.Extension{{Id: oidReasonCode, Value: reasonCode}},
+			},
+			{
+				SerialNumber:   big.NewInt(42),
+				RevocationTime: time.Unix(1600, 0),
+			},
+		},
+		Number:     big.NewInt(5),
+		ThisUpdate: time.Unix(2000, 0),
+		NextUpdate: time.Unix(3000, 0),
+	}
+
+	crlBytes, err := CreateRevocationList(rand.Reader, template, issuer, priv)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %s", err)
+	}
+	crl, err := ParseDERCRL(crlBytes)
+	if err != nil {
+		t.Fatalf("failed to parse CRL: %s", err)
+	}
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		t.Errorf("failed to check CRL signature: %s", err)
+	}
+
+	tbs := crl.TBSCertList
+	if tbs.Version != 1 {
+		t.Errorf("got version %d, want 1 (v2)", tbs.Version)
+	}
+	if rawIssuer, err := asn1.Marshal(tbs.Issuer); err != nil || !bytes.Equal(rawIssuer, issuer.RawSubject) {
+		t.Errorf("CRL issuer doesn't match the subject of the issuing certificate")
+	}
+	if !tbs.ThisUpdate.Equal(template.ThisUpdate) || !tbs.NextUpdate.Equal(template.NextUpdate) {
+		t.Errorf("got update times %v and %v, want %v and %v", tbs.ThisUpdate, tbs.NextUpdate, template.ThisUpdate, template.NextUpdate)
+	}
+	if len(tbs.RevokedCertificates) != 2 {
+		t.Fatalf("got %d revoked certificates, want 2", len(tbs.RevokedCertificates))
+	}
+	for i, rc := range tbs.RevokedCertificates {
+		want := template.RevokedCertificates[i]
+		if rc.SerialNumber.Cmp(want.SerialNumber) != 0 || !rc.RevocationTime.Equal(want.RevocationTime) {
+			t.Errorf("revoked certificate #%d: got %v at %v, want %v at %v", i, rc.SerialNumber, rc.RevocationTime, want.SerialNumber, want.RevocationTime)
+		}
+		if !reflect.DeepEqual(rc.Extensions, want.Extensions) {
+			t.Errorf("revoked certificate #%d: got extensions %v, want %v", i, rc.Extensions, want.Extensions)
+		}
+	}
+
+	var number *big.Int
+	var aki authKeyId
+	for _, e := range tbs.Extensions {
+		switch {
+		case e.Id.Equal(oidExtensionCRLNumber):
+			asn1.Unmarshal(e.Value, &number)
+		case e.Id.Equal(oidExtensionAuthorityKeyId):
+			asn1.Unmarshal(e.Value, &aki)
+		}
+	}
+	if number == nil || number.Cmp(template.Number) != 0 {
+		t.Errorf("got CRL number %v, want %v", number, template.Number)
+	}
+	if !bytes.Equal(aki.Id, issuer.SubjectKeyId) {
+		t.Errorf("got authority key ID %x, want %x", aki.Id, issuer.SubjectKeyId)
+	}
+
+	for _, test := range []struct {
+		name   string
+		modify func(template *RevocationList, issuer *Certificate)
+	}{
+		{"NilNumber", func(template *RevocationList, issuer *Certificate) { template.Number = nil }},
+		{"NextUpdateBeforeThisUpdate", func(template *RevocationList, issuer *Certificate) { template.NextUpdate = time.Unix(1000, 0) }},
+		{"NoSubjectKeyId", func(template *RevocationList, issuer *Certificate) { issuer.SubjectKeyId = nil }},
+		{"NoCRLSignKeyUsage", func(template *RevocationList, issuer *Certificate) { issuer.KeyUsage = KeyUsageCertSign }},
+	} {
+		badTemplate, badIssuer := *template, *issuer
+		test.modify(&badTemplate, &badIssuer)
+		if _, err := CreateRevocationList(rand.Reader, &badTemplate, &badIssuer, priv); err == nil {
+			t.Errorf("%s: CreateRevocationList succeeded", test.name)
+		}
+	}
+}
+
 func fromBase64(in string) []byte {
 	out := make([]byte, base64.StdEncoding.DecodedLen(len(in)))
 	n, err := base64.StdEncoding.Decode(out, []byte(in))
@@ -906,6 +1047,8 @@ func TestCreateCertificateRequest(t *testing.T) {
 		{"ECDSA-521", ecdsa521Priv, ECDSAWithSHA1},
 	}
 
+	testURL, _ := url.Parse("spiffe://example.com/gopher")
+
 	for _, test := range tests {
 		template := CertificateRequest{
 			Subject: pkix.Name{
@@ -916,6 +1059,7 @@ func TestCreateCertificateRequest(t *testing.T) {
 			DNSNames:           []string{"test.example.com"},
 			EmailAddresses:     []string{"gopher@golang.org"},
 			IPAddresses:        []net.IP{net.IPv4(127, 0, 0, 1).To4(), net.ParseIP("2001:4860:0:2001::68")},
+			URIs:               []*url.URL{testURL},
 		}
 
 		derBytes, err := CreateCertificateRequest(random, &template, test.priv)
@@ -946,6 +1090,8 @@ func TestCreateCertificateRequest(t *testing.T) {
 			t.Errorf("%s: output email addresses and template email addresses don't match", test.name)
 		} else if len(out.IPAddresses) != len(template.IPAddresses) {
 			t.Errorf("%s: output IP addresses and template IP addresses names don't match", test.name)
+		} else if len(out.URIs) != 1 || out.URIs[0].String() != testURL.String() {
+			t.Errorf("%s: output URIs and template URIs don't match", test.name)
 		}
 	}
 }
@@ -971,7 +1117,7 @@ func marshalAndParseCSR(t *testing.T, template *CertificateRequest) *Certificate
 }
 
 func TestCertificateRequestOverrides(t *testing.T) {
-	sanContents, err := marshalSANs([]string{"foo.example.com"}, nil, nil)
+	sanContents, err := marshalSANs([]string{"foo.example.com"}, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1028,7 +1174,7 @@ func TestCertificateRequestOverrides(t *testing.T) {
 		t.Errorf("bad attributes: %#v\n", csr.Attributes)
 	}
 
-	sanContents2, err := marshalSANs([]string{"foo2.example.com"}, nil, nil)
+	sanContents2, err := marshalSANs([]string{"foo2.example.com"}, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
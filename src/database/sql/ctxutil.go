@@ -0,0 +1,46 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// ctxDriverExec calls ExecContext on execerCtx if it is non-nil, and
+// falls back to the context-less Exec on execer otherwise.
+func ctxDriverExec(ctx context.Context, execerCtx driver.ExecerContext, execer driver.Execer, query string, dargs []driver.Value) (driver.Result, error) {
+	if execerCtx != nil {
+		return execerCtx.ExecContext(ctx, query, dargs)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return execer.Exec(query, dargs)
+}
+
+// ctxDriverQuery calls QueryContext on queryerCtx if it is non-nil,
+// and falls back to the context-less Query on queryer otherwise.
+func ctxDriverQuery(ctx context.Context, queryerCtx driver.QueryerContext, queryer driver.Queryer, query string, dargs []driver.Value) (driver.Rows, error) {
+	if queryerCtx != nil {
+		return queryerCtx.QueryContext(ctx, query, dargs)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return queryer.Query(query, dargs)
+}
+
+// ctxDriverBegin calls BeginContext on the driver connection if it is
+// implemented, and falls back to the context-less Begin otherwise.
+func ctxDriverBegin(ctx context.Context, ci driver.Conn) (driver.Tx, error) {
+	if ciCtx, ok := ci.(driver.ConnBeginContext); ok {
+		return ciCtx.BeginContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ci.Begin()
+}
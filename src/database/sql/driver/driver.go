@@ -8,7 +8,10 @@
 // Most code should use package sql.
 package driver
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 // Value is a value that drivers must be able to handle.
 // It is either nil or an instance of one of these types:
@@ -76,6 +79,36 @@ type Queryer interface {
 	Query(query string, args []Value) (Rows, error)
 }
 
+// ExecerContext is an optional interface that may be implemented by a Conn.
+//
+// If a Conn does not implement ExecerContext, the sql package's
+// DB.ExecContext will fall back to Execer; if the Conn does not
+// implement Execer either, DB.ExecContext will first prepare a query,
+// execute the statement, and then close the statement.
+//
+// ExecContext must honor the context timeout and return when the
+// context is canceled.
+//
+// ExecContext may return ErrSkip.
+type ExecerContext interface {
+	ExecContext(ctx context.Context, query string, args []Value) (Result, error)
+}
+
+// QueryerContext is an optional interface that may be implemented by a Conn.
+//
+// If a Conn does not implement QueryerContext, the sql package's
+// DB.QueryContext will fall back to Queryer; if the Conn does not
+// implement Queryer either, DB.QueryContext will first prepare a query,
+// execute the statement, and then close the statement.
+//
+// QueryContext must honor the context timeout and return when the
+// context is canceled.
+//
+// QueryContext may return ErrSkip.
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args []Value) (Rows, error)
+}
+
 // Conn is a connection to a database. It is not used concurrently
 // by multiple goroutines.
 //
@@ -98,6 +131,16 @@ type Conn interface {
 	Begin() (Tx, error)
 }
 
+// ConnBeginContext enhances the Conn interface with context.
+type ConnBeginContext interface {
+	// BeginContext starts and returns a new transaction.
+	// It must return when the context is canceled.
+	//
+	// The sql package rolls back the transaction itself if the
+	// context is canceled after BeginContext returns.
+	BeginContext(ctx context.Context) (Tx, error)
+}
+
 // Result is the result of a query execution.
 type Result interface {
 	// LastInsertId returns the database's auto-generated ID
@@ -5,6 +5,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
 	"fmt"
@@ -260,6 +261,59 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestQueryContext(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, "SELECT|people|age,name|")
+	if err != nil {
+		t.Fatalf("QueryContext: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("Next: no rows; err = %v", rows.Err())
+	}
+	var age int
+	var name string
+	if err := rows.Scan(&age, &name); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if age != 1 || name != "Alice" {
+		t.Errorf("got row (%d, %q); want (1, \"Alice\")", age, name)
+	}
+
+	cancel()
+	// The rows are closed asynchronously once the context is done.
+	deadline := time.Now().Add(5 * time.Second)
+	for rows.Next() {
+		if time.Now().After(deadline) {
+			t.Fatal("rows not closed after context was canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := rows.Err(); err != context.Canceled && err != nil {
+		t.Errorf("Err = %v; want %v or nil", err, context.Canceled)
+	}
+	for db.numFreeConns() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not released after context was canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A context that is already done fails the query before it runs.
+	if _, err := db.QueryContext(ctx, "SELECT|people|age,name|"); err != context.Canceled {
+		t.Errorf("QueryContext with canceled context = %v; want %v", err, context.Canceled)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT|people|name=Dave,age=?", 4); err != context.Canceled {
+		t.Errorf("ExecContext with canceled context = %v; want %v", err, context.Canceled)
+	}
+	var n int
+	if err := db.QueryRowContext(context.Background(), "SELECT|people|age|name=?", "Bob").Scan(&n); err != nil || n != 2 {
+		t.Errorf("QueryRowContext = %d, %v; want 2, nil", n, err)
+	}
+}
+
 func TestByteOwnership(t *testing.T) {
 	db := newTestDB(t, "people")
 	defer closeDB(t, db)
@@ -624,6 +678,38 @@ func TestTxQuery(t *testing.T) {
 	}
 }
 
+func TestTxContextRollback(t *testing.T) {
+	db := newTestDB(t, "")
+	defer closeDB(t, db)
+	exec(t, db, "CREATE|t1|name=string,age=int32,dead=bool")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec("INSERT|t1|name=Alice"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// The transaction is rolled back asynchronously once the
+	// context is done.
+	deadline := time.Now().Add(5 * time.Second)
+	for !tx.isDone() {
+		if time.Now().After(deadline) {
+			t.Fatal("transaction not rolled back after context was canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := tx.Commit(); err != ErrTxDone {
+		t.Errorf("Commit after cancel = %v; want %v", err, ErrTxDone)
+	}
+	if _, err := tx.Exec("INSERT|t1|name=Bob"); err == nil {
+		t.Error("Exec after cancel succeeded; want error")
+	}
+}
+
 func TestTxQueryInvalid(t *testing.T) {
 	db := newTestDB(t, "")
 	defer closeDB(t, db)
@@ -1159,17 +1245,17 @@ func TestMaxOpenConnsOnBusy(t *testing.T) {
 
 	db.SetMaxOpenConns(3)
 
-	conn0, err := db.conn(cachedOrNewConn)
+	conn0, err := db.conn(context.Background(), cachedOrNewConn)
 	if err != nil {
 		t.Fatalf("db open conn fail: %v", err)
 	}
 
-	conn1, err := db.conn(cachedOrNewConn)
+	conn1, err := db.conn(context.Background(), cachedOrNewConn)
 	if err != nil {
 		t.Fatalf("db open conn fail: %v", err)
 	}
 
-	conn2, err := db.conn(cachedOrNewConn)
+	conn2, err := db.conn(context.Background(), cachedOrNewConn)
 	if err != nil {
 		t.Fatalf("db open conn fail: %v", err)
 	}
@@ -13,6 +13,7 @@
 //
 //	cmdline   os.Args
 //	memstats  runtime.Memstats
+//	metrics   runtime/metrics, by name
 //
 // The package is sometimes only imported for the side effect of
 // registering its HTTP handler and the above variables. To use it
@@ -30,6 +31,7 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"runtime/metrics"
 	"sort"
 	"strconv"
 	"sync"
@@ -327,8 +329,32 @@ func memstats() interface{} {
 	return *stats
 }
 
+// runtimeMetrics returns the value of every supported runtime metric,
+// by name.
+func runtimeMetrics() interface{} {
+	all := metrics.All()
+	samples := make([]metrics.Sample, len(all))
+	for i := range all {
+		samples[i].Name = all[i].Name
+	}
+	metrics.Read(samples)
+	m := make(map[string]interface{}, len(samples))
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			m[s.Name] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			m[s.Name] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			m[s.Name] = s.Value.Float64Histogram()
+		}
+	}
+	return m
+}
+
 func init() {
 	http.HandleFunc("/debug/vars", expvarHandler)
 	Publish("cmdline", Func(cmdline))
 	Publish("memstats", Func(memstats))
+	Publish("metrics", Func(runtimeMetrics))
 }
@@ -140,7 +140,7 @@ var pkgDeps = map[string][]string{
 	"os":            {"L1", "os", "syscall", "time", "internal/syscall/windows"},
 	"path/filepath": {"L2", "os", "syscall"},
 	"io/ioutil":     {"L2", "os", "path/filepath", "time"},
-	"os/exec":       {"L2", "os", "path/filepath", "syscall"},
+	"os/exec":       {"L2", "os", "context", "path/filepath", "syscall"},
 	"os/signal":     {"L2", "os", "syscall"},
 
 	// OS enables basic operating system functionality,
@@ -158,17 +158,21 @@ var pkgDeps = map[string][]string{
 	"log": {"L1", "os", "fmt", "time"},
 
 	// Packages used by testing must be low-level (L2+fmt).
-	"regexp":         {"L2", "regexp/syntax"},
-	"regexp/syntax":  {"L2"},
-	"runtime/debug":  {"L2", "fmt", "io/ioutil", "os", "time"},
-	"runtime/pprof":  {"L2", "fmt", "text/tabwriter"},
-	"runtime/trace":  {"L0"},
-	"text/tabwriter": {"L2"},
-
-	"testing":          {"L2", "flag", "fmt", "os", "runtime/debug", "runtime/pprof", "runtime/trace", "time"},
-	"testing/iotest":   {"L2", "log"},
-	"testing/quick":    {"L2", "flag", "fmt", "reflect"},
-	"internal/testenv": {"L2", "os", "testing"},
+	"regexp":          {"L2", "regexp/syntax"},
+	"regexp/syntax":   {"L2"},
+	"runtime/debug":   {"L2", "fmt", "io/ioutil", "os", "time"},
+	"runtime/pprof":   {"L2", "compress/gzip", "context", "fmt", "io/ioutil", "os", "text/tabwriter", "time"},
+	"runtime/trace":   {"L0", "context", "fmt", "time"},
+	"runtime/metrics": {"L0", "math"},
+	"text/tabwriter":  {"L2"},
+
+	"testing":                   {"L2", "flag", "fmt", "os", "reflect", "runtime/debug", "runtime/trace", "time"},
+	"testing/internal/testdeps": {"L2", "regexp", "runtime/pprof"},
+	"testing/iotest":            {"L2", "log"},
+	"testing/quick":             {"L2", "flag", "fmt", "reflect"},
+	"internal/testenv":          {"L2", "os", "testing"},
+
+	"context": {"errors", "fmt", "reflect", "sync", "time"},
 
 	// L4 is defined as L3+fmt+log+time, because in general once
 	// you're using L3 packages, use of fmt, log, or time is not a big deal.
@@ -215,8 +219,8 @@ var pkgDeps = map[string][]string{
 	"compress/gzip":            {"L4", "compress/flate"},
 	"compress/lzw":             {"L4"},
 	"compress/zlib":            {"L4", "compress/flate"},
-	"database/sql":             {"L4", "container/list", "database/sql/driver"},
-	"database/sql/driver":      {"L4", "time"},
+	"database/sql":             {"L4", "container/list", "context", "database/sql/driver"},
+	"database/sql/driver":      {"L4", "context", "time"},
 	"debug/dwarf":              {"L4"},
 	"debug/elf":                {"L4", "OS", "debug/dwarf", "compress/zlib"},
 	"debug/gosym":              {"L4"},
@@ -241,7 +245,9 @@ var pkgDeps = map[string][]string{
 	"image/jpeg":               {"L4", "image/internal/imageutil"},
 	"image/png":                {"L4", "compress/zlib"},
 	"index/suffixarray":        {"L4", "regexp"},
+	"internal/nettrace":        {},
 	"internal/singleflight":    {"sync"},
+	"internal/pprof/profile":   {"L4", "OS", "compress/gzip", "regexp"},
 	"internal/trace":           {"L4", "OS"},
 	"math/big":                 {"L4"},
 	"mime":                     {"L4", "OS", "syscall", "internal/syscall/windows/registry"},
@@ -279,7 +285,7 @@ var pkgDeps = map[string][]string{
 	// Basic networking.
 	// Because net must be used by any package that wants to
 	// do networking portably, it must have a small dependency set: just L0+basic os.
-	"net": {"L0", "CGO", "math/rand", "os", "sort", "syscall", "time", "internal/syscall/windows", "internal/singleflight", "internal/race"},
+	"net": {"L0", "CGO", "context", "math/rand", "os", "sort", "syscall", "time", "internal/syscall/windows", "internal/singleflight", "internal/race", "internal/nettrace"},
 
 	// NET enables use of basic network-related packages.
 	"NET": {
@@ -304,10 +310,15 @@ var pkgDeps = map[string][]string{
 	"crypto/sha256": {"L3"},
 	"crypto/sha512": {"L3"},
 
+	"crypto/chacha20poly1305":    {"L3"},
+	"crypto/internal/curve25519": {},
+
 	"CRYPTO": {
 		"crypto/aes",
+		"crypto/chacha20poly1305",
 		"crypto/des",
 		"crypto/hmac",
+		"crypto/internal/curve25519",
 		"crypto/md5",
 		"crypto/rc4",
 		"crypto/sha1",
@@ -345,7 +356,7 @@ var pkgDeps = map[string][]string{
 	},
 	"crypto/x509": {
 		"L4", "CRYPTO-MATH", "OS", "CGO",
-		"crypto/x509/pkix", "encoding/pem", "encoding/hex", "net", "syscall",
+		"crypto/x509/pkix", "encoding/pem", "encoding/hex", "net", "net/url", "syscall",
 	},
 	"crypto/x509/pkix": {"L4", "CRYPTO-MATH"},
 
@@ -356,14 +367,16 @@ var pkgDeps = map[string][]string{
 	// HTTP, kingpin of dependencies.
 	"net/http": {
 		"L4", "NET", "OS",
-		"compress/gzip", "crypto/tls", "mime/multipart", "runtime/debug",
+		"compress/gzip", "context", "crypto/tls", "mime/multipart", "runtime/debug",
 		"net/http/internal",
+		"net/http/httptrace",
 		"internal/golang.org/x/net/http2/hpack",
 	},
-	"net/http/internal": {"L4"},
+	"net/http/internal":  {"L4"},
+	"net/http/httptrace": {"context", "crypto/tls", "internal/nettrace", "net", "reflect", "time"},
 
 	// HTTP-using packages.
-	"expvar":             {"L4", "OS", "encoding/json", "net/http"},
+	"expvar":             {"L4", "OS", "encoding/json", "net/http", "runtime/metrics"},
 	"net/http/cgi":       {"L4", "NET", "OS", "crypto/tls", "net/http", "regexp"},
 	"net/http/cookiejar": {"L4", "NET", "net/http"},
 	"net/http/fcgi":      {"L4", "NET", "OS", "net/http", "net/http/cgi"},
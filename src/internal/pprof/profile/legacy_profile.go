@@ -89,6 +89,15 @@ func parseGoCount(b []byte) (*Profile, error) {
 			}
 			return nil, err
 		}
+		if strings.HasPrefix(line, labelsPrefix) && len(p.Sample) > 0 {
+			// Profiler labels of the preceding sample.
+			labels, err := parseLabels(line[len(labelsPrefix):])
+			if err != nil {
+				return nil, err
+			}
+			p.Sample[len(p.Sample)-1].Label = labels
+			continue
+		}
 		if isSpaceOrComment(line) {
 			continue
 		}
@@ -379,7 +388,11 @@ func cpuProfile(b []byte, period int64, parse func(b []byte) (uint64, []byte)) (
 		},
 	}
 	var err error
-	if b, _, err = parseCPUSamples(b, parse, true, p); err != nil {
+	var labeled map[*Sample]uint64
+	if b, _, labeled, err = parseCPUSamples(b, parse, true, p); err != nil {
+		return nil, err
+	}
+	if b, err = parseCPULabels(b, labeled); err != nil {
 		return nil, err
 	}
 
@@ -426,17 +439,29 @@ func cpuProfile(b []byte, period int64, parse func(b []byte) (uint64, []byte)) (
 //   2nd word -- 1
 //   3rd word -- 0
 //
+// Go profiles may also contain labels records, which say that the
+// following sample was taken with the profiler labels numbered n in
+// the labels section that follows the end of data (see parseCPULabels):
+//   1st word -- 0
+//   2nd word -- 2
+//   3rd word -- 0
+//   4th word -- n
+// parseCPUSamples returns the label numbers of the labeled samples.
+//
 // Addresses from stack traces may point to the next instruction after
 // each call. Optionally adjust by -1 to land somewhere on the actual
 // call (except for the leaf, which is not a call).
-func parseCPUSamples(b []byte, parse func(b []byte) (uint64, []byte), adjust bool, p *Profile) ([]byte, map[uint64]*Location, error) {
+func parseCPUSamples(b []byte, parse func(b []byte) (uint64, []byte), adjust bool, p *Profile) ([]byte, map[uint64]*Location, map[*Sample]uint64, error) {
 	locs := make(map[uint64]*Location)
+	labeled := make(map[*Sample]uint64)
+	var labels uint64
+	var haveLabels bool
 	for len(b) > 0 {
 		var count, nstk uint64
 		count, b = parse(b)
 		nstk, b = parse(b)
 		if b == nil || nstk > uint64(len(b)/4) {
-			return nil, nil, errUnrecognized
+			return nil, nil, nil, errUnrecognized
 		}
 		var sloc []*Location
 		addrs := make([]uint64, nstk)
@@ -448,6 +473,11 @@ func parseCPUSamples(b []byte, parse func(b []byte) (uint64, []byte), adjust boo
 			// End of data marker
 			break
 		}
+		if count == 0 && nstk == 2 && addrs[0] == 0 {
+			// Labels of the next sample.
+			labels, haveLabels = addrs[1], true
+			continue
+		}
 		for i, addr := range addrs {
 			if adjust && i > 0 {
 				addr--
@@ -462,14 +492,121 @@ func parseCPUSamples(b []byte, parse func(b []byte) (uint64, []byte), adjust boo
 			}
 			sloc = append(sloc, loc)
 		}
-		p.Sample = append(p.Sample,
-			&Sample{
-				Value:    []int64{int64(count), int64(count) * int64(p.Period)},
-				Location: sloc,
-			})
+		s := &Sample{
+			Value:    []int64{int64(count), int64(count) * int64(p.Period)},
+			Location: sloc,
+		}
+		p.Sample = append(p.Sample, s)
+		if haveLabels {
+			labeled[s] = labels
+			haveLabels = false
+		}
 	}
 	// Reached the end without finding the EOD marker.
-	return b, locs, nil
+	return b, locs, labeled, nil
+}
+
+// labelsSectionHeader introduces the labels section of a Go CPU profile,
+// which follows the end of data and lists the profiler labels referred
+// to by labels records by number, one per line:
+//
+//	--- labels: ---
+//	0 {"key":"value", "key2":"value2"}
+const labelsSectionHeader = "--- labels: ---"
+
+// parseCPULabels parses the labels section at the start of b, if any,
+// and sets the labels of the samples in labeled, which maps each
+// labeled sample to the number of its labels. It returns the rest of b.
+func parseCPULabels(b []byte, labeled map[*Sample]uint64) ([]byte, error) {
+	r := bytes.NewBuffer(b)
+	line, err := r.ReadString('\n')
+	if strings.TrimSpace(line) != labelsSectionHeader {
+		if len(labeled) > 0 {
+			return nil, errMalformed
+		}
+		return b, nil
+	}
+	sets := make(map[uint64]string)
+	for err == nil {
+		rest := r.Bytes()
+		line, err = r.ReadString('\n')
+		i := strings.Index(line, " {")
+		if i < 0 {
+			// End of the section.
+			b = rest
+			break
+		}
+		n, perr := strconv.ParseUint(line[:i], 10, 64)
+		if perr != nil {
+			return nil, errMalformed
+		}
+		sets[n] = line[i+1:]
+		b = r.Bytes()
+	}
+	for s, n := range labeled {
+		set, ok := sets[n]
+		if !ok {
+			return nil, errMalformed
+		}
+		labels, err := parseLabels(set)
+		if err != nil {
+			return nil, err
+		}
+		s.Label = labels
+	}
+	return b, nil
+}
+
+// labelsPrefix introduces the profiler labels of a sample
+// in a Go count profile.
+const labelsPrefix = "# labels: "
+
+// parseLabels parses a set of profiler labels in the form written
+// by runtime/pprof: {"key":"value", "key2":"value2"}.
+func parseLabels(s string) (map[string][]string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, errMalformed
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	labels := make(map[string][]string)
+	for s != "" {
+		key, rest, err := parseQuoted(s)
+		if err != nil || !strings.HasPrefix(rest, ":") {
+			return nil, errMalformed
+		}
+		value, rest, err := parseQuoted(rest[1:])
+		if err != nil {
+			return nil, errMalformed
+		}
+		labels[key] = append(labels[key], value)
+		if rest = strings.TrimSpace(rest); rest != "" {
+			if rest[0] != ',' {
+				return nil, errMalformed
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+		s = rest
+	}
+	return labels, nil
+}
+
+// parseQuoted parses the Go string literal at the start of s,
+// returning its value and the rest of s.
+func parseQuoted(s string) (value, rest string, err error) {
+	if s == "" || s[0] != '"' {
+		return "", "", errMalformed
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err = strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err
+		}
+	}
+	return "", "", errMalformed
 }
 
 // parseHeap parses a heapz legacy or a growthz profile and
@@ -688,8 +825,8 @@ func scaleHeapSample(count, size, rate int64) (int64, int64) {
 	return int64(float64(count) * scale), int64(float64(size) * scale)
 }
 
-// parseContention parses a contentionz profile and returns a newly
-// populated Profile.
+// parseContention parses a contentionz profile, a Go mutex profile or
+// a Go scheduling latency profile and returns a newly populated Profile.
 func parseContention(b []byte) (p *Profile, err error) {
 	r := bytes.NewBuffer(b)
 	l, err := r.ReadString('\n')
@@ -697,7 +834,7 @@ func parseContention(b []byte) (p *Profile, err error) {
 		return nil, errUnrecognized
 	}
 
-	if !strings.HasPrefix(l, "--- contention") {
+	if !strings.HasPrefix(l, "--- contention") && !strings.HasPrefix(l, "--- mutex:") && !strings.HasPrefix(l, "--- schedlatency:") {
 		return nil, errUnrecognized
 	}
 
@@ -0,0 +1,147 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestEmptyProfile(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := Parse(&buf)
+	if err != nil {
+		t.Error("Want no error, got", err)
+	}
+	if p == nil {
+		t.Fatal("Want a valid profile, got <nil>")
+	}
+	if !p.Empty() {
+		t.Errorf("Profile should be empty, got %#v", p)
+	}
+}
+
+func TestParseGoCountLabels(t *testing.T) {
+	const data = `goroutine profile: total 3
+2 @ 0x1000 0x2000
+# labels: {"key":"value", "quoted":"a\"b"}
+1 @ 0x1000 0x3000
+`
+	p, err := Parse(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 2 {
+		t.Fatalf("got %d samples, want 2", len(p.Sample))
+	}
+	want := map[string][]string{"key": {"value"}, "quoted": {`a"b`}}
+	if got := p.Sample[0].Label; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels of sample 0 = %v, want %v", got, want)
+	}
+	if got := p.Sample[1].Label; got != nil {
+		t.Errorf("labels of sample 1 = %v, want none", got)
+	}
+}
+
+func TestParseCPULabels(t *testing.T) {
+	var buf bytes.Buffer
+	words := func(w ...uint64) {
+		for _, x := range w {
+			binary.Write(&buf, binary.LittleEndian, x)
+		}
+	}
+	words(0, 3, 0, 10000, 0)    // header, 10ms period
+	words(5, 2, 0x1000, 0x2000) // unlabeled sample
+	words(0, 2, 0, 1)           // labels 1 for the next sample
+	words(3, 2, 0x1000, 0x3000) // labeled sample
+	words(0, 1, 0)              // end of data
+	buf.WriteString("--- labels: ---\n1 {\"key\":\"value\"}\n")
+
+	p, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 2 {
+		t.Fatalf("got %d samples, want 2", len(p.Sample))
+	}
+	if got := p.Sample[0].Label; got != nil {
+		t.Errorf("labels of sample 0 = %v, want none", got)
+	}
+	want := map[string][]string{"key": {"value"}}
+	if got := p.Sample[1].Label; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels of sample 1 = %v, want %v", got, want)
+	}
+	if got := p.Sample[1].Value[0]; got != 3 {
+		t.Errorf("count of sample 1 = %d, want 3", got)
+	}
+}
+
+func TestParseMutexProfile(t *testing.T) {
+	const data = `--- mutex:
+cycles/second=1000000000
+sampling period=5
+100 2 @ 0x1000 0x2000
+`
+	p, err := Parse(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 1 {
+		t.Fatalf("got %d samples, want 1", len(p.Sample))
+	}
+	// Values are unsampled by the sampling period.
+	if got, want := p.Sample[0].Value, []int64{10, 500}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sample values = %v, want %v", got, want)
+	}
+}
+
+func TestParsePackedFields(t *testing.T) {
+	var b []byte
+	field := func(tag int, data ...byte) {
+		b = append(b, byte(tag<<3|2), byte(len(data)))
+		b = append(b, data...)
+	}
+	field(1, 0x08, 1, 0x10, 2)           // sample_type samples/count
+	field(1, 0x08, 3, 0x10, 4)           // sample_type cpu/nanoseconds
+	field(2, 0x0a, 1, 1, 0x12, 2, 3, 30) // sample: packed location_id [1], value [3, 30]
+	field(4, 0x08, 1)                    // location 1
+	for _, s := range []string{"", "samples", "count", "cpu", "nanoseconds"} {
+		field(6, []byte(s)...)
+	}
+
+	p, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 1 {
+		t.Fatalf("got %d samples, want 1", len(p.Sample))
+	}
+	s := p.Sample[0]
+	if want := []int64{3, 30}; !reflect.DeepEqual(s.Value, want) {
+		t.Errorf("sample values = %v, want %v", s.Value, want)
+	}
+	if len(s.Location) != 1 || s.Location[0].ID != 1 {
+		t.Errorf("sample locations = %v, want location 1", s.Location)
+	}
+}
+
+func TestParseSchedLatencyProfile(t *testing.T) {
+	const data = `--- schedlatency:
+cycles/second=1000000000
+800 8 @ 0x1000 0x2000
+`
+	p, err := Parse(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 1 {
+		t.Fatalf("got %d samples, want 1", len(p.Sample))
+	}
+	if got, want := p.Sample[0].Value, []int64{8, 800}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sample values = %v, want %v", got, want)
+	}
+}
@@ -4,6 +4,8 @@
 
 package trace
 
+import "sort"
+
 // GDesc contains statistics about execution of a single goroutine.
 type GDesc struct {
 	ID           uint64
@@ -13,6 +15,34 @@ type GDesc struct {
 	StartTime    int64
 	EndTime      int64
 
+	// Regions of the goroutine, sorted by start time.
+	Regions []*UserRegionDesc
+
+	GExecutionStat
+
+	*gdesc // private part
+}
+
+// UserRegionDesc describes a user region of a goroutine
+// and the goroutine's execution during the region.
+type UserRegionDesc struct {
+	TaskID uint64
+	Name   string
+
+	// Start is the UserRegion start event,
+	// or nil if the region started before tracing started.
+	Start *Event
+	// End is the UserRegion end event, or the GoEnd or GoStop event
+	// of a goroutine that did not end the region, or nil if the
+	// region had not ended when tracing stopped.
+	End *Event
+
+	GExecutionStat
+}
+
+// GExecutionStat contains statistics about execution of a goroutine
+// during a period of time.
+type GExecutionStat struct {
 	ExecTime      int64
 	SchedWaitTime int64
 	IOTime        int64
@@ -21,8 +51,19 @@ type GDesc struct {
 	GCTime        int64
 	SweepTime     int64
 	TotalTime     int64
+}
 
-	*gdesc // private part
+// sub returns the difference of two statistics.
+func (s GExecutionStat) sub(v GExecutionStat) GExecutionStat {
+	s.ExecTime -= v.ExecTime
+	s.SchedWaitTime -= v.SchedWaitTime
+	s.IOTime -= v.IOTime
+	s.BlockTime -= v.BlockTime
+	s.SyscallTime -= v.SyscallTime
+	s.GCTime -= v.GCTime
+	s.SweepTime -= v.SweepTime
+	s.TotalTime -= v.TotalTime
+	return s
 }
 
 // gdesc is a private part of GDesc that is required only during analysis.
@@ -34,13 +75,75 @@ type gdesc struct {
 	blockSweepTime   int64
 	blockGCTime      int64
 	blockSchedTime   int64
+
+	activeRegions []*UserRegionDesc // stack of regions that have not ended
+}
+
+// snapshotStat returns the statistics of g as of time ts,
+// counting the periods that are still in progress up to ts.
+// gcStartTime is the start time of the active GC, or 0.
+func (g *GDesc) snapshotStat(ts, gcStartTime int64) GExecutionStat {
+	s := g.GExecutionStat
+	if g.EndTime != 0 {
+		return s
+	}
+	s.TotalTime = ts - g.CreationTime
+	if g.lastStartTime != 0 {
+		s.ExecTime += ts - g.lastStartTime
+	}
+	if g.blockNetTime != 0 {
+		s.IOTime += ts - g.blockNetTime
+	}
+	if g.blockSyncTime != 0 {
+		s.BlockTime += ts - g.blockSyncTime
+	}
+	if g.blockSyscallTime != 0 {
+		s.SyscallTime += ts - g.blockSyscallTime
+	}
+	if g.blockSchedTime != 0 {
+		s.SchedWaitTime += ts - g.blockSchedTime
+	}
+	if g.blockSweepTime != 0 {
+		s.SweepTime += ts - g.blockSweepTime
+	}
+	if gcStartTime != 0 {
+		s.GCTime += ts - gcStartTime
+	}
+	return s
+}
+
+// startRegion pushes a region started by ev onto the active regions of g.
+func (g *GDesc) startRegion(ev *Event, gcStartTime int64) {
+	r := &UserRegionDesc{
+		TaskID:         ev.Args[0],
+		Name:           ev.SArgs[0],
+		Start:          ev,
+		GExecutionStat: g.snapshotStat(ev.Ts, gcStartTime),
+	}
+	g.activeRegions = append(g.activeRegions, r)
+}
+
+// endRegion pops the innermost active region of g, ended by ev at time ts.
+// If the region started before tracing, there is no active region,
+// and endRegion records the region since the goroutine's creation.
+func (g *GDesc) endRegion(ev *Event, ts, gcStartTime int64) {
+	var r *UserRegionDesc
+	if n := len(g.activeRegions); n > 0 {
+		r = g.activeRegions[n-1]
+		g.activeRegions = g.activeRegions[:n-1]
+	} else {
+		r = &UserRegionDesc{TaskID: ev.Args[0], Name: ev.SArgs[0]}
+	}
+	r.End = ev
+	r.GExecutionStat = g.snapshotStat(ts, gcStartTime).sub(r.GExecutionStat)
+	g.Regions = append(g.Regions, r)
 }
 
 // GoroutineStats generates statistics for all goroutines in the trace.
 func GoroutineStats(events []*Event) map[uint64]*GDesc {
 	gs := make(map[uint64]*GDesc)
 	var lastTs int64
-	var gcStartTime int64
+	var gcStartTime int64 // start time of the active GC, or 0
 	for _, ev := range events {
 		lastTs = ev.Ts
 		switch ev.Type {
@@ -65,23 +168,32 @@ func GoroutineStats(events []*Event) map[uint64]*GDesc {
 		case EvGoEnd, EvGoStop:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 			g.TotalTime = ev.Ts - g.CreationTime
 			g.EndTime = ev.Ts
+			// Regions the goroutine did not end end with it.
+			for len(g.activeRegions) > 0 {
+				g.endRegion(ev, ev.Ts, gcStartTime)
+			}
 		case EvGoBlockSend, EvGoBlockRecv, EvGoBlockSelect,
 			EvGoBlockSync, EvGoBlockCond:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 			g.blockSyncTime = ev.Ts
 		case EvGoSched, EvGoPreempt:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 			g.blockSchedTime = ev.Ts
 		case EvGoSleep, EvGoBlock:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 		case EvGoBlockNet:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 			g.blockNetTime = ev.Ts
 		case EvGoUnblock:
 			g := gs[ev.Args[0]]
@@ -97,6 +209,7 @@ func GoroutineStats(events []*Event) map[uint64]*GDesc {
 		case EvGoSysBlock:
 			g := gs[ev.G]
 			g.ExecTime += ev.Ts - g.lastStartTime
+			g.lastStartTime = 0
 			g.blockSyscallTime = ev.Ts
 		case EvGoSysExit:
 			g := gs[ev.G]
@@ -125,10 +238,25 @@ func GoroutineStats(events []*Event) map[uint64]*GDesc {
 					g.GCTime += ev.Ts - gcStartTime
 				}
 			}
+			gcStartTime = 0
+		case EvUserRegion:
+			g := gs[ev.G]
+			switch mode := ev.Args[1]; mode {
+			case 0: // start
+				g.startRegion(ev, gcStartTime)
+			case 1: // end
+				g.endRegion(ev, ev.Ts, gcStartTime)
+			}
 		}
 	}
 
 	for _, g := range gs {
+		// Regions that had not ended when tracing stopped.
+		for len(g.activeRegions) > 0 {
+			g.endRegion(nil, lastTs, gcStartTime)
+		}
+		sort.Sort(regionList(g.Regions))
+
 		if g.TotalTime == 0 {
 			g.TotalTime = lastTs - g.CreationTime
 		}
@@ -157,6 +285,25 @@ func GoroutineStats(events []*Event) map[uint64]*GDesc {
 	return gs
 }
 
+// regionList sorts regions by start time.
+// Regions that started before tracing started come first.
+type regionList []*UserRegionDesc
+
+func (l regionList) Len() int {
+	return len(l)
+}
+
+func (l regionList) Less(i, j int) bool {
+	if l[i].Start == nil || l[j].Start == nil {
+		return l[i].Start == nil && l[j].Start != nil
+	}
+	return l[i].Start.Ts < l[j].Start.Ts
+}
+
+func (l regionList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
 // RelatedGoroutines finds a set of goroutines related to goroutine goid.
 func RelatedGoroutines(events []*Event, goid uint64) map[uint64]bool {
 	// BFS of depth 2 over "unblock" edges
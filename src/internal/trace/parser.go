@@ -6,7 +6,6 @@ package trace
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -27,6 +26,7 @@ type Event struct {
 	StkID uint64    // unique stack ID
 	Stk   []*Frame  // stack trace (can be empty)
 	Args  [3]uint64 // event-type-specific arguments
+	SArgs []string  // event-type-specific string arguments
 	// linked event (can be nil), depends on event type:
 	// for GCStart: the GCStop
 	// for GCScanStart: the GCScanDone
@@ -38,6 +38,8 @@ type Event struct {
 	// for GoUnblock: the associated GoStart
 	// for blocking GoSysCall: the associated GoSysExit
 	// for GoSysExit: the next GoStart
+	// for UserTaskCreate: the first UserTaskEnd of the task
+	// for UserRegion start: the matching UserRegion end
 	Link *Event
 }
 
@@ -59,11 +61,11 @@ const (
 
 // Parse parses, post-processes and verifies the trace.
 func Parse(r io.Reader) ([]*Event, error) {
-	rawEvents, err := readTrace(r)
+	ver, rawEvents, err := readTrace(r)
 	if err != nil {
 		return nil, err
 	}
-	events, err := parseEvents(rawEvents)
+	events, err := parseEvents(ver, rawEvents)
 	if err != nil {
 		return nil, err
 	}
@@ -80,26 +82,34 @@ func Parse(r io.Reader) ([]*Event, error) {
 
 // rawEvent is a helper type used during parsing.
 type rawEvent struct {
-	off  int
-	typ  byte
-	args []uint64
+	off   int
+	typ   byte
+	args  []uint64
+	sargs []string
 }
 
 // readTrace does wire-format parsing and verification.
 // It does not care about specific event types and argument meaning.
-func readTrace(r io.Reader) ([]rawEvent, error) {
+// It returns the trace version (1005, 1007 or 1008) and the events.
+func readTrace(r io.Reader) (ver int, events []rawEvent, err error) {
 	// Read and validate trace header.
 	var buf [16]byte
 	off, err := r.Read(buf[:])
 	if off != 16 || err != nil {
-		return nil, fmt.Errorf("failed to read header: read %v, err %v", off, err)
+		return 0, nil, fmt.Errorf("failed to read header: read %v, err %v", off, err)
 	}
-	if bytes.Compare(buf[:], []byte("go 1.5 trace\x00\x00\x00\x00")) != 0 {
-		return nil, fmt.Errorf("not a trace file")
+	switch string(buf[:]) {
+	case "go 1.5 trace\x00\x00\x00\x00":
+		ver = 1005
+	case "go 1.7 trace\x00\x00\x00\x00":
+		ver = 1007
+	case "go 1.8 trace\x00\x00\x00\x00":
+		ver = 1008
+	default:
+		return 0, nil, fmt.Errorf("not a trace file")
 	}
 
 	// Read events.
-	var events []rawEvent
 	for {
 		// Read event type and number of arguments (1 byte).
 		off0 := off
@@ -108,18 +118,33 @@ func readTrace(r io.Reader) ([]rawEvent, error) {
 			break
 		}
 		if err != nil || n != 1 {
-			return nil, fmt.Errorf("failed to read trace at offset 0x%x: n=%v err=%v", off0, n, err)
+			return 0, nil, fmt.Errorf("failed to read trace at offset 0x%x: n=%v err=%v", off0, n, err)
 		}
 		off += n
 		typ := buf[0] << 2 >> 2
 		narg := buf[0] >> 6
+		if typ == EvString && ver >= 1007 {
+			// String dictionary entry [ID, length, string].
+			var id uint64
+			id, off, err = readVal(r, off)
+			if err != nil {
+				return 0, nil, err
+			}
+			var s string
+			s, off, err = readStr(r, off)
+			if err != nil {
+				return 0, nil, err
+			}
+			events = append(events, rawEvent{off: off0, typ: typ, args: []uint64{id}, sargs: []string{s}})
+			continue
+		}
 		ev := rawEvent{typ: typ, off: off0}
 		if narg < 3 {
 			for i := 0; i < int(narg)+2; i++ { // sequence number and time stamp are present but not counted in narg
 				var v uint64
 				v, off, err = readVal(r, off)
 				if err != nil {
-					return nil, err
+					return 0, nil, err
 				}
 				ev.args = append(ev.args, v)
 			}
@@ -128,36 +153,119 @@ func readTrace(r io.Reader) ([]rawEvent, error) {
 			var v uint64
 			v, off, err = readVal(r, off)
 			if err != nil {
-				return nil, err
+				return 0, nil, err
 			}
 			evLen := v
 			off1 := off
 			for evLen > uint64(off-off1) {
 				v, off, err = readVal(r, off)
 				if err != nil {
-					return nil, err
+					return 0, nil, err
 				}
 				ev.args = append(ev.args, v)
 			}
 			if evLen != uint64(off-off1) {
-				return nil, fmt.Errorf("event has wrong length at offset 0x%x: want %v, got %v", off0, evLen, off-off1)
+				return 0, nil, fmt.Errorf("event has wrong length at offset 0x%x: want %v, got %v", off0, evLen, off-off1)
 			}
 		}
+		if typ == EvUserLog && ver >= 1007 {
+			// The message follows the event.
+			var s string
+			s, off, err = readStr(r, off)
+			if err != nil {
+				return 0, nil, err
+			}
+			ev.sargs = append(ev.sargs, s)
+		}
 		events = append(events, ev)
 	}
-	return events, nil
+	return ver, events, nil
 }
 
 // Parse events transforms raw events into events.
 // It does analyze and verify per-event-type arguments.
-func parseEvents(rawEvents []rawEvent) (events []*Event, err error) {
-	var ticksPerSec, lastSeq, lastTs int64
+//
+// Since version 1008 the trace is a sequence of generations, each
+// ending with an EvGeneration event. Stack and string ids are local
+// to a generation, and each generation starts with a snapshot of the
+// goroutines, which is dropped for the goroutines already known from
+// the previous generations.
+func parseEvents(ver int, rawEvents []rawEvent) (events []*Event, err error) {
+	var ticksPerSec, lastSeq, lastTs, minTs int64
 	var lastG, timerGoid uint64
 	var lastP int
 	lastGs := make(map[int]uint64) // last goroutine running on P
 	stacks := make(map[uint64][]*Frame)
+	strs := make(map[uint64]string)
+	known := make(map[uint64]bool) // goroutines of the previous generations
+	var gen []*Event               // events of the current generation
+	ngen := 0
+
+	// endGen finishes the current generation and appends its events.
+	endGen := func() error {
+		if len(gen) == 0 {
+			return fmt.Errorf("trace is empty")
+		}
+		if ticksPerSec == 0 {
+			return fmt.Errorf("no EvFrequency event")
+		}
+		for _, ev := range gen {
+			// Attach stack traces and resolve string ids.
+			if ev.StkID != 0 {
+				ev.Stk = stacks[ev.StkID]
+			}
+			switch ev.Type {
+			case EvUserTaskCreate, EvUserRegion:
+				ev.SArgs = []string{strs[ev.Args[2]]}
+			case EvUserLog:
+				ev.SArgs[0] = strs[ev.Args[1]]
+			}
+		}
+
+		// Sort by sequence number and translate cpu ticks to real time,
+		// relative to the start of the first generation.
+		sort.Sort(eventList(gen))
+		if ngen == 0 {
+			minTs = gen[0].Ts
+		}
+		for _, ev := range gen {
+			ev.Ts = (ev.Ts - minTs) * 1e9 / ticksPerSec
+			// Move timers and syscalls to separate fake Ps.
+			if timerGoid != 0 && ev.G == timerGoid && ev.Type == EvGoUnblock {
+				ev.P = TimerP
+			}
+			if ev.Type == EvGoSysExit {
+				ev.P = SyscallP
+				ev.G = ev.Args[0]
+			}
+		}
+		for _, ev := range gen {
+			switch ev.Type {
+			case EvGoCreate, EvGoWaiting, EvGoInSyscall:
+				if known[ev.Args[0]] {
+					continue // part of the snapshot
+				}
+			}
+			events = append(events, ev)
+		}
+		for _, ev := range gen {
+			if ev.Type == EvGoCreate {
+				known[ev.Args[0]] = true
+			}
+		}
+
+		ngen++
+		gen = nil
+		ticksPerSec = 0
+		timerGoid = 0
+		stacks = make(map[uint64][]*Frame)
+		strs = make(map[uint64]string)
+		return nil
+	}
+
 	for _, raw := range rawEvents {
-		if raw.typ == EvNone || raw.typ >= EvCount {
+		if raw.typ == EvNone || raw.typ >= EvCount ||
+			ver < 1007 && raw.typ >= EvString || ver < 1008 && raw.typ >= EvGeneration {
 			err = fmt.Errorf("unknown event type %v at offset 0x%x", raw.typ, raw.off)
 			return
 		}
@@ -166,12 +274,14 @@ func parseEvents(rawEvents []rawEvent) (events []*Event, err error) {
 			err = fmt.Errorf("missing description for event type %v", raw.typ)
 			return
 		}
-		if raw.typ != EvStack {
+		if raw.typ != EvStack && raw.typ != EvString {
 			narg := len(desc.Args)
 			if desc.Stack {
 				narg++
 			}
-			if raw.typ != EvBatch && raw.typ != EvFrequency && raw.typ != EvTimerGoroutine {
+			switch raw.typ {
+			case EvBatch, EvFrequency, EvTimerGoroutine, EvGeneration:
+			default:
 				narg++ // sequence number
 				narg++ // timestamp
 			}
@@ -199,6 +309,21 @@ func parseEvents(rawEvents []rawEvent) (events []*Event, err error) {
 			}
 		case EvTimerGoroutine:
 			timerGoid = raw.args[0]
+		case EvGeneration:
+			if err = endGen(); err != nil {
+				return
+			}
+		case EvString:
+			id := raw.args[0]
+			if id == 0 {
+				err = fmt.Errorf("string at offset 0x%x has invalid id 0", raw.off)
+				return
+			}
+			if _, ok := strs[id]; ok {
+				err = fmt.Errorf("string at offset 0x%x has duplicate id %v", raw.off, id)
+				return
+			}
+			strs[id] = raw.sargs[0]
 		case EvStack:
 			if len(raw.args) < 2 {
 				err = fmt.Errorf("EvStack has wrong number of arguments at offset 0x%x: want at least 2, got %v",
@@ -236,6 +361,10 @@ func parseEvents(rawEvents []rawEvent) (events []*Event, err error) {
 			if desc.Stack {
 				e.StkID = raw.args[len(desc.Args)+2]
 			}
+			if raw.typ == EvUserLog {
+				// The category is resolved at the end of the generation.
+				e.SArgs = []string{"", raw.sargs[0]}
+			}
 			switch raw.typ {
 			case EvGoStart:
 				lastG = e.Args[0]
@@ -255,40 +384,16 @@ func parseEvents(rawEvents []rawEvent) (events []*Event, err error) {
 					e.Ts = int64(e.Args[2])
 				}
 			}
-			events = append(events, e)
+			gen = append(gen, e)
 		}
 	}
-	if len(events) == 0 {
-		err = fmt.Errorf("trace is empty")
-		return
-	}
-
-	// Attach stack traces.
-	for _, ev := range events {
-		if ev.StkID != 0 {
-			ev.Stk = stacks[ev.StkID]
-		}
-	}
-
-	// Sort by sequence number and translate cpu ticks to real time.
-	sort.Sort(eventList(events))
-	if ticksPerSec == 0 {
-		err = fmt.Errorf("no EvFrequency event")
-		return
-	}
-	minTs := events[0].Ts
-	for _, ev := range events {
-		ev.Ts = (ev.Ts - minTs) * 1e9 / ticksPerSec
-		// Move timers and syscalls to separate fake Ps.
-		if timerGoid != 0 && ev.G == timerGoid && ev.Type == EvGoUnblock {
-			ev.P = TimerP
-		}
-		if ev.Type == EvGoSysExit {
-			ev.P = SyscallP
-			ev.G = ev.Args[0]
-		}
+	switch {
+	case ver < 1008:
+		// Older traces are a single generation without EvGeneration.
+		err = endGen()
+	case len(gen) != 0 || ngen == 0:
+		err = fmt.Errorf("trace ends in the middle of a generation")
 	}
-
 	return
 }
 
@@ -377,6 +482,8 @@ func postProcessTrace(events []*Event) error {
 
 	gs := make(map[uint64]gdesc)
 	ps := make(map[int]pdesc)
+	tasks := make(map[uint64]*Event)           // task id to UserTaskCreate of unfinished tasks
+	activeRegions := make(map[uint64][]*Event) // goroutine id to stack of started UserRegions
 	gs[0] = gdesc{state: gRunning}
 	var evGC *Event
 
@@ -556,6 +663,53 @@ func postProcessTrace(events []*Event) error {
 			g.evStart.Link = ev
 			g.evStart = nil
 			p.g = 0
+		case EvUserTaskCreate:
+			if err := checkRunning(p, g, ev, false); err != nil {
+				return err
+			}
+			id := ev.Args[0]
+			if _, ok := tasks[id]; ok {
+				return fmt.Errorf("task %v already exists (offset %v, time %v)", id, ev.Off, ev.Ts)
+			}
+			tasks[id] = ev
+		case EvUserTaskEnd:
+			if err := checkRunning(p, g, ev, false); err != nil {
+				return err
+			}
+			// The task may have been created before tracing started
+			// or ended already; only its first end is linked.
+			id := ev.Args[0]
+			if create := tasks[id]; create != nil {
+				create.Link = ev
+				delete(tasks, id)
+			}
+		case EvUserRegion:
+			if err := checkRunning(p, g, ev, false); err != nil {
+				return err
+			}
+			regions := activeRegions[ev.G]
+			switch mode := ev.Args[1]; mode {
+			case 0: // start
+				activeRegions[ev.G] = append(regions, ev)
+			case 1: // end
+				// An end without a start belongs to a region
+				// that started before tracing started.
+				if n := len(regions); n > 0 {
+					start := regions[n-1]
+					if start.Args[0] != ev.Args[0] || start.SArgs[0] != ev.SArgs[0] {
+						return fmt.Errorf("g %v ends region %q of task %v while in region %q of task %v (offset %v, time %v)",
+							ev.G, ev.SArgs[0], ev.Args[0], start.SArgs[0], start.Args[0], ev.Off, ev.Ts)
+					}
+					start.Link = ev
+					activeRegions[ev.G] = regions[:n-1]
+				}
+			default:
+				return fmt.Errorf("invalid region mode %v (offset %v, time %v)", mode, ev.Off, ev.Ts)
+			}
+		case EvUserLog:
+			if err := checkRunning(p, g, ev, false); err != nil {
+				return err
+			}
 		}
 
 		gs[ev.G] = g
@@ -672,6 +826,24 @@ func readVal(r io.Reader, off0 int) (v uint64, off int, err error) {
 	return 0, 0, fmt.Errorf("bad value at offset 0x%x", off0)
 }
 
+// readStr reads a length-prefixed string from r.
+func readStr(r io.Reader, off0 int) (s string, off int, err error) {
+	var sz uint64
+	sz, off, err = readVal(r, off0)
+	if err != nil || sz == 0 {
+		return "", off, err
+	}
+	if sz > 1e6 {
+		return "", off, fmt.Errorf("string at offset 0x%x is too large (len=%d)", off0, sz)
+	}
+	buf := make([]byte, sz)
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return "", off, fmt.Errorf("failed to read trace at offset 0x%x: read %v, want %v, error %v", off, n, sz, err)
+	}
+	return string(buf), off + n, nil
+}
+
 type eventList []*Event
 
 func (l eventList) Len() int {
@@ -694,6 +866,9 @@ func Print(events []*Event) {
 		for i, a := range desc.Args {
 			fmt.Printf(" %v=%v", a, ev.Args[i])
 		}
+		for i, a := range desc.SArgs {
+			fmt.Printf(" %v=%q", a, ev.SArgs[i])
+		}
 		fmt.Printf("\n")
 	}
 }
@@ -738,49 +913,62 @@ const (
 	EvNextGC         = 34 // memstats.next_gc change [timestamp, next_gc]
 	EvTimerGoroutine = 35 // denotes timer goroutine [timer goroutine id]
 	EvFutileWakeup   = 36 // denotes that the previous wakeup of this goroutine was futile [timestamp]
-	EvCount          = 37
+	EvString         = 37 // string dictionary entry [ID, length, string]
+	EvUserTaskCreate = 38 // trace.NewTask [timestamp, task id, parent task id, name string id, stack]
+	EvUserTaskEnd    = 39 // end of a task [timestamp, task id, stack]
+	EvUserRegion     = 40 // trace.WithRegion [timestamp, task id, mode(0:start, 1:end), name string id, stack]
+	EvUserLog        = 41 // trace.Log [timestamp, task id, category string id, stack], followed by [length, message]
+	EvGeneration     = 42 // end of a generation [generation number]
+	EvCount          = 43
 )
 
 var EventDescriptions = [EvCount]struct {
 	Name  string
 	Stack bool
 	Args  []string
+	SArgs []string // string arguments
 }{
-	EvNone:           {"None", false, []string{}},
-	EvBatch:          {"Batch", false, []string{"p", "seq", "ticks"}},
-	EvFrequency:      {"Frequency", false, []string{"freq", "unused"}},
-	EvStack:          {"Stack", false, []string{"id", "siz"}},
-	EvGomaxprocs:     {"Gomaxprocs", true, []string{"procs"}},
-	EvProcStart:      {"ProcStart", false, []string{"thread"}},
-	EvProcStop:       {"ProcStop", false, []string{}},
-	EvGCStart:        {"GCStart", true, []string{}},
-	EvGCDone:         {"GCDone", false, []string{}},
-	EvGCScanStart:    {"GCScanStart", false, []string{}},
-	EvGCScanDone:     {"GCScanDone", false, []string{}},
-	EvGCSweepStart:   {"GCSweepStart", true, []string{}},
-	EvGCSweepDone:    {"GCSweepDone", false, []string{}},
-	EvGoCreate:       {"GoCreate", true, []string{"g", "pc"}},
-	EvGoStart:        {"GoStart", false, []string{"g"}},
-	EvGoEnd:          {"GoEnd", false, []string{}},
-	EvGoStop:         {"GoStop", true, []string{}},
-	EvGoSched:        {"GoSched", true, []string{}},
-	EvGoPreempt:      {"GoPreempt", true, []string{}},
-	EvGoSleep:        {"GoSleep", true, []string{}},
-	EvGoBlock:        {"GoBlock", true, []string{}},
-	EvGoUnblock:      {"GoUnblock", true, []string{"g"}},
-	EvGoBlockSend:    {"GoBlockSend", true, []string{}},
-	EvGoBlockRecv:    {"GoBlockRecv", true, []string{}},
-	EvGoBlockSelect:  {"GoBlockSelect", true, []string{}},
-	EvGoBlockSync:    {"GoBlockSync", true, []string{}},
-	EvGoBlockCond:    {"GoBlockCond", true, []string{}},
-	EvGoBlockNet:     {"GoBlockNet", true, []string{}},
-	EvGoSysCall:      {"GoSysCall", true, []string{}},
-	EvGoSysExit:      {"GoSysExit", false, []string{"g", "seq", "ts"}},
-	EvGoSysBlock:     {"GoSysBlock", false, []string{}},
-	EvGoWaiting:      {"GoWaiting", false, []string{"g"}},
-	EvGoInSyscall:    {"GoInSyscall", false, []string{"g"}},
-	EvHeapAlloc:      {"HeapAlloc", false, []string{"mem"}},
-	EvNextGC:         {"NextGC", false, []string{"mem"}},
-	EvTimerGoroutine: {"TimerGoroutine", false, []string{"g", "unused"}},
-	EvFutileWakeup:   {"FutileWakeup", false, []string{}},
+	EvNone:           {"None", false, []string{}, nil},
+	EvBatch:          {"Batch", false, []string{"p", "seq", "ticks"}, nil},
+	EvFrequency:      {"Frequency", false, []string{"freq", "unused"}, nil},
+	EvStack:          {"Stack", false, []string{"id", "siz"}, nil},
+	EvGomaxprocs:     {"Gomaxprocs", true, []string{"procs"}, nil},
+	EvProcStart:      {"ProcStart", false, []string{"thread"}, nil},
+	EvProcStop:       {"ProcStop", false, []string{}, nil},
+	EvGCStart:        {"GCStart", true, []string{}, nil},
+	EvGCDone:         {"GCDone", false, []string{}, nil},
+	EvGCScanStart:    {"GCScanStart", false, []string{}, nil},
+	EvGCScanDone:     {"GCScanDone", false, []string{}, nil},
+	EvGCSweepStart:   {"GCSweepStart", true, []string{}, nil},
+	EvGCSweepDone:    {"GCSweepDone", false, []string{}, nil},
+	EvGoCreate:       {"GoCreate", true, []string{"g", "pc"}, nil},
+	EvGoStart:        {"GoStart", false, []string{"g"}, nil},
+	EvGoEnd:          {"GoEnd", false, []string{}, nil},
+	EvGoStop:         {"GoStop", true, []string{}, nil},
+	EvGoSched:        {"GoSched", true, []string{}, nil},
+	EvGoPreempt:      {"GoPreempt", true, []string{}, nil},
+	EvGoSleep:        {"GoSleep", true, []string{}, nil},
+	EvGoBlock:        {"GoBlock", true, []string{}, nil},
+	EvGoUnblock:      {"GoUnblock", true, []string{"g"}, nil},
+	EvGoBlockSend:    {"GoBlockSend", true, []string{}, nil},
+	EvGoBlockRecv:    {"GoBlockRecv", true, []string{}, nil},
+	EvGoBlockSelect:  {"GoBlockSelect", true, []string{}, nil},
+	EvGoBlockSync:    {"GoBlockSync", true, []string{}, nil},
+	EvGoBlockCond:    {"GoBlockCond", true, []string{}, nil},
+	EvGoBlockNet:     {"GoBlockNet", true, []string{}, nil},
+	EvGoSysCall:      {"GoSysCall", true, []string{}, nil},
+	EvGoSysExit:      {"GoSysExit", false, []string{"g", "seq", "ts"}, nil},
+	EvGoSysBlock:     {"GoSysBlock", false, []string{}, nil},
+	EvGoWaiting:      {"GoWaiting", false, []string{"g"}, nil},
+	EvGoInSyscall:    {"GoInSyscall", false, []string{"g"}, nil},
+	EvHeapAlloc:      {"HeapAlloc", false, []string{"mem"}, nil},
+	EvNextGC:         {"NextGC", false, []string{"mem"}, nil},
+	EvTimerGoroutine: {"TimerGoroutine", false, []string{"g", "unused"}, nil},
+	EvFutileWakeup:   {"FutileWakeup", false, []string{}, nil},
+	EvString:         {"String", false, []string{}, nil},
+	EvUserTaskCreate: {"UserTaskCreate", true, []string{"taskid", "pid", "typeid"}, []string{"name"}},
+	EvUserTaskEnd:    {"UserTaskEnd", true, []string{"taskid"}, nil},
+	EvUserRegion:     {"UserRegion", true, []string{"taskid", "mode", "typeid"}, []string{"name"}},
+	EvUserLog:        {"UserLog", true, []string{"id", "keyid"}, []string{"category", "message"}},
+	EvGeneration:     {"Generation", false, []string{"gen", "unused"}, nil},
 }
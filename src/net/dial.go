@@ -5,7 +5,9 @@
 package net
 
 import (
+	"context"
 	"errors"
+	"internal/nettrace"
 	"runtime"
 	"time"
 )
@@ -59,12 +61,24 @@ type Dialer struct {
 	// that do not support keep-alives ignore this field.
 	KeepAlive time.Duration
 
+	// Resolver optionally specifies an alternate resolver to use.
+	Resolver *Resolver
+
 	// Cancel is an optional channel whose closure indicates that
 	// the dial should be canceled. Not all types of dials support
 	// cancelation.
+	//
+	// Deprecated: Use DialContext instead.
 	Cancel <-chan struct{}
 }
 
+func (d *Dialer) resolver() *Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return DefaultResolver
+}
+
 // Return either now+Timeout or Deadline, whichever comes first.
 // Or zero, if neither is set.
 func (d *Dialer) deadline(now time.Time) time.Time {
@@ -140,7 +154,10 @@ func parseNetwork(net string) (afnet string, proto int, err error) {
 	return "", 0, UnknownNetworkError(net)
 }
 
-func resolveAddrList(op, net, addr string, deadline time.Time) (addrList, error) {
+// resolveAddrList resolves addr on the named network and returns a
+// list of addresses. The result contains at least one address when
+// error is nil.
+func (r *Resolver) resolveAddrList(ctx context.Context, op, net, addr string, deadline time.Time) (addrList, error) {
 	afnet, _, err := parseNetwork(net)
 	if err != nil {
 		return nil, err
@@ -156,7 +173,7 @@ func resolveAddrList(op, net, addr string, deadline time.Time) (addrList, error)
 		}
 		return addrList{addr}, nil
 	}
-	return internetAddrList(afnet, addr, deadline)
+	return r.internetAddrList(ctx, afnet, addr, deadline)
 }
 
 // Dial connects to the address on the named network.
@@ -201,11 +218,12 @@ func DialTimeout(network, address string, timeout time.Duration) (Conn, error) {
 	return d.Dial(network, address)
 }
 
-// dialContext holds common state for all dial operations.
-type dialContext struct {
+// dialParam holds common state for all dial operations.
+type dialParam struct {
 	Dialer
 	network, address string
 	finalDeadline    time.Time
+	trace            *nettrace.Trace
 }
 
 // Dial connects to the address on the named network.
@@ -213,18 +231,64 @@ type dialContext struct {
 // See func Dial for a description of the network and address
 // parameters.
 func (d *Dialer) Dial(network, address string) (Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using
+// the provided context.
+//
+// The provided Context must be non-nil. If the context expires before
+// the connection is complete, an error is returned. Once successfully
+// connected, any expiration of the context will not affect the
+// connection.
+//
+// See func Dial for a description of the network and address
+// parameters.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: mapErr(ctx.Err())}
+	default:
+	}
 	finalDeadline := d.deadline(time.Now())
-	addrs, err := resolveAddrList("dial", network, address, finalDeadline)
+	if ctxDeadline, ok := ctx.Deadline(); ok && (finalDeadline.IsZero() || ctxDeadline.Before(finalDeadline)) {
+		finalDeadline = ctxDeadline
+	}
+
+	// Merge the context's Done channel and the legacy Cancel channel
+	// into the single cancelation channel used by the dial helpers.
+	cancel := d.Cancel
+	if ctxDone := ctx.Done(); ctxDone != nil {
+		merged := make(chan struct{})
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctxDone:
+			case <-d.Cancel:
+			case <-stop:
+				return
+			}
+			close(merged)
+		}()
+		cancel = merged
+	}
+
+	addrs, err := d.resolver().resolveAddrList(ctx, "dial", network, address, finalDeadline)
 	if err != nil {
 		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
 	}
 
-	ctx := &dialContext{
+	dp := &dialParam{
 		Dialer:        *d,
 		network:       network,
 		address:       address,
 		finalDeadline: finalDeadline,
 	}
+	dp.trace, _ = ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
 
 	// DualStack mode requires that dialTCP support cancelation. This is
 	// not available on plan9 (golang.org/issue/11225), so we ignore it.
@@ -239,9 +303,9 @@ func (d *Dialer) Dial(network, address string) (Conn, error) {
 	if len(fallbacks) == 0 {
 		// dialParallel can accept an empty fallbacks list,
 		// but this shortcut avoids the goroutine/channel overhead.
-		c, err = dialSerial(ctx, primaries, ctx.Cancel)
+		c, err = dialSerial(dp, primaries, cancel)
 	} else {
-		c, err = dialParallel(ctx, primaries, fallbacks, ctx.Cancel)
+		c, err = dialParallel(dp, primaries, fallbacks, cancel)
 	}
 
 	if d.KeepAlive > 0 && err == nil {
@@ -258,16 +322,16 @@ func (d *Dialer) Dial(network, address string) (Conn, error) {
 // head start. It returns the first established connection and
 // closes the others. Otherwise it returns an error from the first
 // primary address.
-func dialParallel(ctx *dialContext, primaries, fallbacks addrList, userCancel <-chan struct{}) (Conn, error) {
+func dialParallel(dp *dialParam, primaries, fallbacks addrList, userCancel <-chan struct{}) (Conn, error) {
 	results := make(chan dialResult, 2)
 	cancel := make(chan struct{})
 
 	// Spawn the primary racer.
-	go dialSerialAsync(ctx, primaries, nil, cancel, results)
+	go dialSerialAsync(dp, primaries, nil, cancel, results)
 
 	// Spawn the fallback racer.
-	fallbackTimer := time.NewTimer(ctx.fallbackDelay())
-	go dialSerialAsync(ctx, fallbacks, fallbackTimer, cancel, results)
+	fallbackTimer := time.NewTimer(dp.fallbackDelay())
+	go dialSerialAsync(dp, fallbacks, fallbackTimer, cancel, results)
 
 	// Wait for both racers to succeed or fail.
 	var primaryResult, fallbackResult dialResult
@@ -327,7 +391,7 @@ type dialResult struct {
 // dialSerialAsync runs dialSerial after some delay, and returns the
 // resulting connection through a channel. When racing two connections,
 // the primary goroutine uses a nil timer to omit the delay.
-func dialSerialAsync(ctx *dialContext, ras addrList, timer *time.Timer, cancel <-chan struct{}, results chan<- dialResult) {
+func dialSerialAsync(dp *dialParam, ras addrList, timer *time.Timer, cancel <-chan struct{}, results chan<- dialResult) {
 	if timer != nil {
 		// We're in the fallback goroutine; sleep before connecting.
 		select {
@@ -336,27 +400,27 @@ func dialSerialAsync(ctx *dialContext, ras addrList, timer *time.Timer, cancel <
 			// dialSerial will immediately return errCanceled in this case.
 		}
 	}
-	c, err := dialSerial(ctx, ras, cancel)
+	c, err := dialSerial(dp, ras, cancel)
 	results <- dialResult{Conn: c, error: err, primary: timer == nil, done: true}
 }
 
 // dialSerial connects to a list of addresses in sequence, returning
 // either the first successful connection, or the first error.
-func dialSerial(ctx *dialContext, ras addrList, cancel <-chan struct{}) (Conn, error) {
+func dialSerial(dp *dialParam, ras addrList, cancel <-chan struct{}) (Conn, error) {
 	var firstErr error // The error from the first address is most relevant.
 
 	for i, ra := range ras {
 		select {
 		case <-cancel:
-			return nil, &OpError{Op: "dial", Net: ctx.network, Source: ctx.LocalAddr, Addr: ra, Err: errCanceled}
+			return nil, &OpError{Op: "dial", Net: dp.network, Source: dp.LocalAddr, Addr: ra, Err: errCanceled}
 		default:
 		}
 
-		partialDeadline, err := partialDeadline(time.Now(), ctx.finalDeadline, len(ras)-i)
+		partialDeadline, err := partialDeadline(time.Now(), dp.finalDeadline, len(ras)-i)
 		if err != nil {
 			// Ran out of time.
 			if firstErr == nil {
-				firstErr = &OpError{Op: "dial", Net: ctx.network, Source: ctx.LocalAddr, Addr: ra, Err: err}
+				firstErr = &OpError{Op: "dial", Net: dp.network, Source: dp.LocalAddr, Addr: ra, Err: err}
 			}
 			break
 		}
@@ -365,9 +429,9 @@ func dialSerial(ctx *dialContext, ras addrList, cancel <-chan struct{}) (Conn, e
 		// quickly, but it's still possible that we could return a spurious Conn,
 		// which the caller must Close.
 		dialer := func(d time.Time) (Conn, error) {
-			return dialSingle(ctx, ra, d, cancel)
+			return dialSingle(dp, ra, d, cancel)
 		}
-		c, err := dial(ctx.network, ra, dialer, partialDeadline)
+		c, err := dial(dp.network, ra, dialer, partialDeadline)
 		if err == nil {
 			return c, nil
 		}
@@ -377,7 +441,7 @@ func dialSerial(ctx *dialContext, ras addrList, cancel <-chan struct{}) (Conn, e
 	}
 
 	if firstErr == nil {
-		firstErr = &OpError{Op: "dial", Net: ctx.network, Source: nil, Addr: nil, Err: errMissingAddress}
+		firstErr = &OpError{Op: "dial", Net: dp.network, Source: nil, Addr: nil, Err: errMissingAddress}
 	}
 	return nil, firstErr
 }
@@ -385,29 +449,38 @@ func dialSerial(ctx *dialContext, ras addrList, cancel <-chan struct{}) (Conn, e
 // dialSingle attempts to establish and returns a single connection to
 // the destination address. This must be called through the OS-specific
 // dial function, because some OSes don't implement the deadline feature.
-func dialSingle(ctx *dialContext, ra Addr, deadline time.Time, cancel <-chan struct{}) (c Conn, err error) {
-	la := ctx.LocalAddr
+func dialSingle(dp *dialParam, ra Addr, deadline time.Time, cancel <-chan struct{}) (c Conn, err error) {
+	if trace := dp.trace; trace != nil {
+		raStr := ra.String()
+		if trace.ConnectStart != nil {
+			trace.ConnectStart(dp.network, raStr)
+		}
+		if trace.ConnectDone != nil {
+			defer func() { trace.ConnectDone(dp.network, raStr, err) }()
+		}
+	}
+	la := dp.LocalAddr
 	if la != nil && la.Network() != ra.Network() {
-		return nil, &OpError{Op: "dial", Net: ctx.network, Source: la, Addr: ra, Err: errors.New("mismatched local address type " + la.Network())}
+		return nil, &OpError{Op: "dial", Net: dp.network, Source: la, Addr: ra, Err: errors.New("mismatched local address type " + la.Network())}
 	}
 	switch ra := ra.(type) {
 	case *TCPAddr:
 		la, _ := la.(*TCPAddr)
-		c, err = testHookDialTCP(ctx.network, la, ra, deadline, cancel)
+		c, err = testHookDialTCP(dp.network, la, ra, deadline, cancel)
 	case *UDPAddr:
 		la, _ := la.(*UDPAddr)
-		c, err = dialUDP(ctx.network, la, ra, deadline)
+		c, err = dialUDP(dp.network, la, ra, deadline)
 	case *IPAddr:
 		la, _ := la.(*IPAddr)
-		c, err = dialIP(ctx.network, la, ra, deadline)
+		c, err = dialIP(dp.network, la, ra, deadline)
 	case *UnixAddr:
 		la, _ := la.(*UnixAddr)
-		c, err = dialUnix(ctx.network, la, ra, deadline)
+		c, err = dialUnix(dp.network, la, ra, deadline)
 	default:
-		return nil, &OpError{Op: "dial", Net: ctx.network, Source: la, Addr: ra, Err: &AddrError{Err: "unexpected address type", Addr: ctx.address}}
+		return nil, &OpError{Op: "dial", Net: dp.network, Source: la, Addr: ra, Err: &AddrError{Err: "unexpected address type", Addr: dp.address}}
 	}
 	if err != nil {
-		return nil, &OpError{Op: "dial", Net: ctx.network, Source: la, Addr: ra, Err: err} // c is non-nil interface containing nil pointer
+		return nil, &OpError{Op: "dial", Net: dp.network, Source: la, Addr: ra, Err: err} // c is non-nil interface containing nil pointer
 	}
 	return c, nil
 }
@@ -420,7 +493,7 @@ func dialSingle(ctx *dialContext, ra Addr, deadline time.Time, cancel <-chan str
 // instead of just the interface with the given host address.
 // See Dial for more details about address syntax.
 func Listen(net, laddr string) (Listener, error) {
-	addrs, err := resolveAddrList("listen", net, laddr, noDeadline)
+	addrs, err := DefaultResolver.resolveAddrList(context.Background(), "listen", net, laddr, noDeadline)
 	if err != nil {
 		return nil, &OpError{Op: "listen", Net: net, Source: nil, Addr: nil, Err: err}
 	}
@@ -447,7 +520,7 @@ func Listen(net, laddr string) (Listener, error) {
 // instead of just the interface with the given host address.
 // See Dial for the syntax of laddr.
 func ListenPacket(net, laddr string) (PacketConn, error) {
-	addrs, err := resolveAddrList("listen", net, laddr, noDeadline)
+	addrs, err := DefaultResolver.resolveAddrList(context.Background(), "listen", net, laddr, noDeadline)
 	if err != nil {
 		return nil, &OpError{Op: "listen", Net: net, Source: nil, Addr: nil, Err: err}
 	}
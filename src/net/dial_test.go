@@ -5,6 +5,7 @@
 package net
 
 import (
+	"context"
 	"internal/testenv"
 	"io"
 	"net/internal/socktest"
@@ -394,14 +395,14 @@ func TestDialParallel(t *testing.T) {
 		d := Dialer{
 			FallbackDelay: fallbackDelay,
 		}
-		ctx := &dialContext{
+		dp := &dialParam{
 			Dialer:        d,
 			network:       "tcp",
 			address:       "?",
 			finalDeadline: d.deadline(time.Now()),
 		}
 		startTime := time.Now()
-		c, err := dialParallel(ctx, primaries, fallbacks, nil)
+		c, err := dialParallel(dp, primaries, fallbacks, nil)
 		elapsed := time.Now().Sub(startTime)
 
 		if c != nil {
@@ -432,7 +433,7 @@ func TestDialParallel(t *testing.T) {
 			wg.Done()
 		}()
 		startTime = time.Now()
-		c, err = dialParallel(ctx, primaries, fallbacks, cancel)
+		c, err = dialParallel(dp, primaries, fallbacks, cancel)
 		if c != nil {
 			c.Close()
 		}
@@ -580,7 +581,7 @@ func TestDialParallelSpuriousConnection(t *testing.T) {
 	d := Dialer{
 		FallbackDelay: fallbackDelay,
 	}
-	ctx := &dialContext{
+	dp := &dialParam{
 		Dialer:        d,
 		network:       "tcp",
 		address:       "?",
@@ -596,7 +597,7 @@ func TestDialParallelSpuriousConnection(t *testing.T) {
 	}
 
 	// dialParallel returns one connection (and closes the other.)
-	c, err := dialParallel(ctx, makeAddr("127.0.0.1"), makeAddr("::1"), nil)
+	c, err := dialParallel(dp, makeAddr("127.0.0.1"), makeAddr("::1"), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -835,3 +836,63 @@ func TestDialCancel(t *testing.T) {
 		}
 	}
 }
+
+func TestDialContextCanceled(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var d Dialer
+	c, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("unexpected successful connection")
+	}
+	if perr := parseDialError(err); perr != nil {
+		t.Error(perr)
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Err != errCanceled {
+		t.Fatalf("dial error = %v (%T); want OpError with Err == errCanceled", err, err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	c, err = d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("unexpected successful connection")
+	}
+	if perr := parseDialError(err); perr != nil {
+		t.Error(perr)
+	}
+	if nerr, ok := err.(Error); !ok || !nerr.Timeout() {
+		t.Fatalf("dial error = %v (%T); want timeout", err, err)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	ln, err := newLocalListener("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var d Dialer
+	c, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
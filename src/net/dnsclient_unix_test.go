@@ -7,6 +7,7 @@
 package net
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -38,7 +39,7 @@ func TestDNSTransportFallback(t *testing.T) {
 
 	for _, tt := range dnsTransportFallbackTests {
 		timeout := time.Duration(tt.timeout) * time.Second
-		msg, err := exchange(tt.server, tt.name, tt.qtype, timeout)
+		msg, err := DefaultResolver.exchange(context.Background(), tt.server, tt.name, tt.qtype, timeout)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -80,7 +81,7 @@ func TestSpecialDomainName(t *testing.T) {
 
 	server := "8.8.8.8:53"
 	for _, tt := range specialDomainNameTests {
-		msg, err := exchange(server, tt.name, tt.qtype, 3*time.Second)
+		msg, err := DefaultResolver.exchange(context.Background(), server, tt.name, tt.qtype, 3*time.Second)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -203,7 +204,7 @@ func TestUpdateResolvConf(t *testing.T) {
 			for j := 0; j < N; j++ {
 				go func(name string) {
 					defer wg.Done()
-					ips, err := goLookupIP(name)
+					ips, err := DefaultResolver.goLookupIP(context.Background(), name)
 					if err != nil {
 						t.Error(err)
 						return
@@ -353,7 +354,7 @@ func TestGoLookupIPWithResolverConfig(t *testing.T) {
 			t.Error(err)
 			continue
 		}
-		addrs, err := goLookupIP(tt.name)
+		addrs, err := DefaultResolver.goLookupIP(context.Background(), tt.name)
 		if err != nil {
 			// This test uses external network connectivity.
 			// We need to take care with errors on both
@@ -405,14 +406,14 @@ func TestGoLookupIPOrderFallbackToFile(t *testing.T) {
 		name := fmt.Sprintf("order %v", order)
 
 		// First ensure that we get an error when contacting a non-existent host.
-		_, err := goLookupIPOrder("notarealhost", order)
+		_, err := DefaultResolver.goLookupIPOrder(context.Background(), "notarealhost", order)
 		if err == nil {
 			t.Errorf("%s: expected error while looking up name not in hosts file", name)
 			continue
 		}
 
 		// Now check that we get an address when the name appears in the hosts file.
-		addrs, err := goLookupIPOrder("thor", order) // entry is in "testdata/hosts"
+		addrs, err := DefaultResolver.goLookupIPOrder(context.Background(), "thor", order) // entry is in "testdata/hosts"
 		if err != nil {
 			t.Errorf("%s: expected to successfully lookup host entry", name)
 			continue
@@ -449,7 +450,7 @@ func TestErrorForOriginalNameWhenSearching(t *testing.T) {
 	}
 
 	d := &fakeDNSConn{}
-	testHookDNSDialer = func(time.Duration) dnsDialer { return d }
+	testHookDNSDialer = func(*Resolver) dnsDialer { return d }
 
 	d.rh = func(q *dnsMsg) (*dnsMsg, error) {
 		r := &dnsMsg{
@@ -468,7 +469,7 @@ func TestErrorForOriginalNameWhenSearching(t *testing.T) {
 		return r, nil
 	}
 
-	_, err = goLookupIP(fqdn)
+	_, err = DefaultResolver.goLookupIP(context.Background(), fqdn)
 	if err == nil {
 		t.Fatal("expected an error")
 	}
@@ -483,7 +484,7 @@ func BenchmarkGoLookupIP(b *testing.B) {
 	testHookUninstaller.Do(uninstallTestHooks)
 
 	for i := 0; i < b.N; i++ {
-		goLookupIP("www.example.com")
+		DefaultResolver.goLookupIP(context.Background(), "www.example.com")
 	}
 }
 
@@ -491,7 +492,7 @@ func BenchmarkGoLookupIPNoSuchHost(b *testing.B) {
 	testHookUninstaller.Do(uninstallTestHooks)
 
 	for i := 0; i < b.N; i++ {
-		goLookupIP("some.nonexistent")
+		DefaultResolver.goLookupIP(context.Background(), "some.nonexistent")
 	}
 }
 
@@ -513,7 +514,7 @@ func BenchmarkGoLookupIPWithBrokenNameServer(b *testing.B) {
 	}
 
 	for i := 0; i < b.N; i++ {
-		goLookupIP("www.example.com")
+		DefaultResolver.goLookupIP(context.Background(), "www.example.com")
 	}
 }
 
@@ -525,7 +526,7 @@ type fakeDNSConn struct {
 	rh func(*dnsMsg) (*dnsMsg, error)
 }
 
-func (f *fakeDNSConn) dialDNS(n, s string) (dnsConn, error) {
+func (f *fakeDNSConn) dialDNS(ctx context.Context, n, s string) (dnsConn, error) {
 	return f, nil
 }
 
@@ -550,3 +551,120 @@ func (f *fakeDNSConn) readDNSResponse() (*dnsMsg, error) {
 	f.qmu.Unlock()
 	return f.rh(q)
 }
+
+// fakeDNSServer serves A queries for any name from pc, answering
+// with the address 127.0.0.1, until pc is closed.
+func fakeDNSServer(pc PacketConn) {
+	b := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		q := &dnsMsg{}
+		if !q.Unpack(b[:n]) || len(q.question) != 1 {
+			continue
+		}
+		r := &dnsMsg{
+			dnsMsgHdr: dnsMsgHdr{
+				id:       q.id,
+				response: true,
+				rcode:    dnsRcodeSuccess,
+			},
+			question: q.question,
+		}
+		if q.question[0].Qtype == dnsTypeA {
+			r.answer = []dnsRR{
+				&dnsRR_A{
+					Hdr: dnsRR_Header{
+						Name:   q.question[0].Name,
+						Rrtype: dnsTypeA,
+						Class:  dnsClassINET,
+					},
+					A: 0x7f000001,
+				},
+			}
+		}
+		out, ok := r.Pack()
+		if !ok {
+			continue
+		}
+		pc.WriteTo(out, addr)
+	}
+}
+
+func TestResolverDial(t *testing.T) {
+	if !supportsIPv4 {
+		t.Skip("IPv4 is not supported")
+	}
+	pc, err := ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go fakeDNSServer(pc)
+
+	var mu sync.Mutex
+	var dialed []string
+	r := &Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, network+" "+address)
+			mu.Unlock()
+			var d Dialer
+			return d.DialContext(ctx, network, pc.LocalAddr().String())
+		},
+	}
+
+	const name = "resolver-dial.test."
+	addrs, err := r.LookupHost(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("LookupHost(%q) = %v; want [127.0.0.1]", name, addrs)
+	}
+	mu.Lock()
+	if len(dialed) == 0 {
+		t.Error("Resolver.Dial was not used")
+	}
+	for _, s := range dialed {
+		if !strings.HasPrefix(s, "udp ") {
+			t.Errorf("Resolver.Dial called with %q; want a udp dial", s)
+		}
+	}
+	mu.Unlock()
+
+	// A Dialer with the Resolver connects to the address it returns.
+	ln, err := newLocalListener("tcp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, err := SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Dialer{Resolver: r}
+	c, err := d.Dial("tcp4", JoinHostPort(name, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestResolverLookupCanceled(t *testing.T) {
+	r := &Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.LookupIPAddr(ctx, "resolver-cancel.test."); err == nil {
+		t.Fatal("LookupIPAddr succeeded with a canceled context")
+	}
+}
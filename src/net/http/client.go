@@ -446,6 +446,7 @@ func (c *Client) doFollowingRedirects(ireq *Request, shouldRedirect func(int) bo
 		if redirect != 0 {
 			nreq := new(Request)
 			nreq.Cancel = ireq.Cancel
+			nreq.ctx = ireq.ctx
 			nreq.Method = ireq.Method
 			if ireq.Method == "POST" || ireq.Method == "PUT" {
 				nreq.Method = "GET"
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
@@ -29,6 +30,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http/httptrace"
 	"net/textproto"
 	"net/url"
 	"os"
@@ -1714,6 +1716,43 @@ func http2summarizeFrame(f http2Frame) string {
 
 func http2requestCancel(req *Request) <-chan struct{} { return req.Cancel }
 
+func http2reqContext(r *Request) context.Context { return r.Context() }
+
+func http2requestTrace(req *Request) *httptrace.ClientTrace {
+	return httptrace.ContextClientTrace(req.Context())
+}
+
+func http2traceGotConn(req *Request, cc *http2ClientConn) {
+	trace := httptrace.ContextClientTrace(req.Context())
+	if trace == nil || trace.GotConn == nil {
+		return
+	}
+	ci := httptrace.GotConnInfo{Conn: cc.tconn}
+	cc.mu.Lock()
+	ci.Reused = cc.nextStreamID > 1
+	ci.WasIdle = len(cc.streams) == 0 && ci.Reused
+	cc.mu.Unlock()
+	trace.GotConn(ci)
+}
+
+func http2traceWroteHeaders(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+}
+
+func http2traceFirstResponseByte(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+}
+
+func http2traceWroteRequest(trace *httptrace.ClientTrace, err error) {
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+}
+
 var http2DebugGoroutines = os.Getenv("DEBUG_HTTP2_GOROUTINES") == "1"
 
 type http2goroutineLock uint64
@@ -2525,6 +2564,45 @@ type http2Server struct {
 	// PermitProhibitedCipherSuites, if true, permits the use of
 	// cipher suites prohibited by the HTTP/2 spec.
 	PermitProhibitedCipherSuites bool
+
+	// Internal state. This is a pointer (rather than embedded directly)
+	// so that we don't embed a Mutex in this struct, which will make the
+	// struct non-copyable, which might break some callers.
+	state *http2serverInternalState
+}
+
+type http2serverInternalState struct {
+	mu          sync.Mutex
+	activeConns map[*http2serverConn]struct{}
+}
+
+func (s *http2serverInternalState) registerConn(sc *http2serverConn) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.activeConns[sc] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *http2serverInternalState) unregisterConn(sc *http2serverConn) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.activeConns, sc)
+	s.mu.Unlock()
+}
+
+func (s *http2serverInternalState) startGracefulShutdown() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	for sc := range s.activeConns {
+		sc.startGracefulShutdown()
+	}
+	s.mu.Unlock()
 }
 
 func (s *http2Server) maxReadFrameSize() uint32 {
@@ -2550,6 +2628,7 @@ func http2ConfigureServer(s *Server, conf *http2Server) error {
 	if conf == nil {
 		conf = new(http2Server)
 	}
+	conf.state = &http2serverInternalState{activeConns: make(map[*http2serverConn]struct{})}
 
 	if s.TLSConfig == nil {
 		s.TLSConfig = new(tls.Config)
@@ -2604,6 +2683,7 @@ func http2ConfigureServer(s *Server, conf *http2Server) error {
 	}
 	s.TLSNextProto[http2NextProtoTLS] = protoHandler
 	s.TLSNextProto["h2-14"] = protoHandler
+	s.RegisterOnShutdown(conf.state.startGracefulShutdown)
 	return nil
 }
 
@@ -2666,6 +2746,7 @@ func (s *http2Server) ServeConn(c net.Conn, opts *http2ServeConnOpts) {
 		wroteFrameCh:     make(chan http2frameWriteResult, 1),
 		bodyReadCh:       make(chan http2bodyReadMsg),
 		doneServing:      make(chan struct{}),
+		shutdownCh:       make(chan struct{}),
 		advMaxStreams:    s.maxConcurrentStreams(),
 		writeSched: http2writeScheduler{
 			maxFrameSize: http2initialMaxFrameSize,
@@ -2705,6 +2786,9 @@ func (s *http2Server) ServeConn(c net.Conn, opts *http2ServeConnOpts) {
 		}
 	}
 
+	s.state.registerConn(sc)
+	defer s.state.unregisterConn(sc)
+
 	if hook := http2testHookGetServerConn; hook != nil {
 		hook(sc)
 	}
@@ -2750,6 +2834,8 @@ type http2serverConn struct {
 	framer           *http2Framer
 	hpackDecoder     *hpack.Decoder
 	doneServing      chan struct{}              // closed when serverConn.serve ends
+	shutdownOnce     sync.Once                  // guards close of shutdownCh
+	shutdownCh       chan struct{}              // closed to start a graceful shutdown
 	readFrameCh      chan http2readFrameResult  // written by serverConn.readFrames
 	wantWriteFrameCh chan http2frameWriteMsg    // from handlers -> serve
 	wroteFrameCh     chan http2frameWriteResult // from writeFrameAsync -> serve, tickles more frame writes
@@ -2855,6 +2941,8 @@ type http2stream struct {
 
 	trailer    Header // accumulated trailers
 	reqTrailer Header // handler's Request.Trailer
+
+	cancelCtx func() // cancels the handler's Request context
 }
 
 func (sc *http2serverConn) Framer() *http2Framer { return sc.framer }
@@ -3157,6 +3245,7 @@ func (sc *http2serverConn) serve() {
 	go sc.readFrames()
 
 	settingsTimer := time.NewTimer(http2firstSettingsTimeout)
+	shutdownCh := sc.shutdownCh
 	loopNum := 0
 	for {
 		loopNum++
@@ -3182,10 +3271,47 @@ func (sc *http2serverConn) serve() {
 		case <-sc.shutdownTimerCh:
 			sc.vlogf("GOAWAY close timer fired; closing conn from %v", sc.conn.RemoteAddr())
 			return
+		case <-shutdownCh:
+			shutdownCh = nil
+			sc.startGracefulShutdownInternal()
 		case fn := <-sc.testHookCh:
 			fn(loopNum)
 		}
+
+		// Once a graceful GOAWAY has been written and all open
+		// streams have completed, give the client a moment to
+		// read the GOAWAY and then close the connection.
+		sentGoAway := sc.inGoAway && !sc.needToSendGoAway && !sc.writingFrame
+		if sentGoAway && sc.goAwayCode == http2ErrCodeNo && sc.shutdownTimer == nil && sc.curOpenStreams == 0 {
+			sc.shutDownIn(http2goAwayTimeout)
+		}
+	}
+}
+
+// goAwayTimeout is how long a connection that has sent a graceful
+// GOAWAY stays open after its last stream completes.
+var http2goAwayTimeout = 1 * time.Second
+
+// startGracefulShutdown gracefully shuts down a connection. This
+// sends GOAWAY with ErrCodeNo to tell the client we're gracefully
+// shutting down. The connection isn't closed until all current
+// streams are done.
+//
+// startGracefulShutdown returns immediately; it does not wait until
+// the connection has shut down.
+func (sc *http2serverConn) startGracefulShutdown() {
+	sc.shutdownOnce.Do(func() { close(sc.shutdownCh) })
+}
+
+func (sc *http2serverConn) startGracefulShutdownInternal() {
+	sc.serveG.check()
+	if sc.inGoAway {
+		return
 	}
+	sc.inGoAway = true
+	sc.needToSendGoAway = true
+	sc.goAwayCode = http2ErrCodeNo
+	sc.scheduleFrameWrite()
 }
 
 // readPreface reads the ClientPreface greeting from the peer
@@ -3405,7 +3531,7 @@ func (sc *http2serverConn) scheduleFrameWrite() {
 		sc.startFrameWrite(http2frameWriteMsg{write: http2writeSettingsAck{}})
 		return
 	}
-	if !sc.inGoAway {
+	if !sc.inGoAway || sc.goAwayCode == http2ErrCodeNo {
 		if wm, ok := sc.writeSched.take(); ok {
 			sc.startFrameWrite(wm)
 			return
@@ -3598,6 +3724,9 @@ func (sc *http2serverConn) closeStream(st *http2stream, err error) {
 	if p := st.body; p != nil {
 		p.CloseWithError(err)
 	}
+	if st.cancelCtx != nil {
+		st.cancelCtx()
+	}
 	st.cw.Close()
 	sc.writeSched.forgetStream(st.id)
 }
@@ -4012,6 +4141,9 @@ func (sc *http2serverConn) newWriterAndRequest() (*http2responseWriter, *Request
 		Body:       body,
 		Trailer:    trailer,
 	}
+	ctx := context.WithValue(context.Background(), ServerContextKey, sc.hs)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, sc.conn.LocalAddr())
+	req.ctx, rp.stream.cancelCtx = context.WithCancel(ctx)
 	if bodyOpen {
 		body.pipe = &http2pipe{
 			b: &http2fixedBuffer{buf: make([]byte, http2initialWindowSize)},
@@ -4700,6 +4832,8 @@ type http2clientStream struct {
 	bufPipe       http2pipe // buffered pipe with the flow-controlled response payload
 	requestedGzip bool
 
+	trace *httptrace.ClientTrace // or nil
+
 	flow        http2flow // guarded by cc.mu
 	inflow      http2flow // guarded by cc.mu
 	bytesRemain int64     // -1 means unknown; owned by transportResponseBody.Read
@@ -4712,6 +4846,7 @@ type http2clientStream struct {
 	done chan struct{} // closed when stream remove from cc.streams map; close calls guarded by cc.mu
 
 	// owned by clientConnReadLoop:
+	firstByte    bool // got the first response byte
 	pastHeaders  bool // got HEADERS w/ END_HEADERS
 	pastTrailers bool // got second HEADERS frame w/ END_HEADERS
 
@@ -4724,14 +4859,18 @@ type http2clientStream struct {
 // Request.Cancel channel), or for the request to be done (any way it
 // might be removed from the cc.streams map: peer reset, successful
 // completion, TCP connection breakage, etc)
-func (cs *http2clientStream) awaitRequestCancel(cancel <-chan struct{}) {
-	if cancel == nil {
+func (cs *http2clientStream) awaitRequestCancel(req *Request) {
+	ctx := http2reqContext(req)
+	if req.Cancel == nil && ctx.Done() == nil {
 		return
 	}
 	select {
-	case <-cancel:
+	case <-req.Cancel:
 		cs.bufPipe.CloseWithError(http2errRequestCanceled)
 		cs.cc.writeStreamReset(cs.ID, http2ErrCodeCancel, nil)
+	case <-ctx.Done():
+		cs.bufPipe.CloseWithError(ctx.Err())
+		cs.cc.writeStreamReset(cs.ID, http2ErrCodeCancel, nil)
 	case <-cs.done:
 	}
 }
@@ -4809,6 +4948,7 @@ func (t *http2Transport) RoundTripOpt(req *Request, opt http2RoundTripOpt) (*Res
 			t.vlogf("http2: Transport failed to get client conn for %s: %v", addr, err)
 			return nil, err
 		}
+		http2traceGotConn(req, cc)
 		res, err := cc.RoundTrip(req)
 		if http2shouldRetryRequest(req, err) {
 			continue
@@ -5131,6 +5271,7 @@ func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
 
 	cs := cc.newStream()
 	cs.req = req
+	cs.trace = http2requestTrace(req)
 	hasBody := body != nil
 
 	if !cc.t.disableCompression() &&
@@ -5154,8 +5295,10 @@ func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
 		}
 		cc.forgetStreamID(cs.ID)
 
+		http2traceWroteRequest(cs.trace, werr)
 		return nil, werr
 	}
+	http2traceWroteHeaders(cs.trace)
 
 	var respHeaderTimer <-chan time.Time
 	var bodyCopyErrc chan error // result of body copy
@@ -5165,6 +5308,7 @@ func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
 			bodyCopyErrc <- cs.writeRequestBody(body, req.Body)
 		}()
 	} else {
+		http2traceWroteRequest(cs.trace, nil)
 		if d := cc.responseHeaderTimeout(); d != 0 {
 			timer := time.NewTimer(d)
 			defer timer.Stop()
@@ -5174,6 +5318,7 @@ func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
 
 	readLoopResCh := cs.resc
 	requestCanceledCh := http2requestCancel(req)
+	ctx := http2reqContext(req)
 	bodyWritten := false
 
 	for {
@@ -5207,10 +5352,19 @@ func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
 				cs.abortRequestBodyWrite(http2errStopReqBodyWriteAndCancel)
 			}
 			return nil, http2errRequestCanceled
+		case <-ctx.Done():
+			cc.forgetStreamID(cs.ID)
+			if !hasBody || bodyWritten {
+				cc.writeStreamReset(cs.ID, http2ErrCodeCancel, nil)
+			} else {
+				cs.abortRequestBodyWrite(http2errStopReqBodyWriteAndCancel)
+			}
+			return nil, ctx.Err()
 		case <-cs.peerReset:
 
 			return nil, cs.resetErr
 		case err := <-bodyCopyErrc:
+			http2traceWroteRequest(cs.trace, err)
 			if err != nil {
 				return nil, err
 			}
@@ -5658,6 +5812,10 @@ func (rl *http2clientConnReadLoop) processHeaderBlockFragment(frag []byte, strea
 
 		return nil
 	}
+	if !cs.firstByte {
+		http2traceFirstResponseByte(cs.trace)
+		cs.firstByte = true
+	}
 	if cs.pastHeaders {
 		rl.hdec.SetEmitFunc(func(f hpack.HeaderField) { rl.onNewTrailerField(cs, f) })
 	} else {
@@ -5728,7 +5886,7 @@ func (rl *http2clientConnReadLoop) processHeaderBlockFragment(frag []byte, strea
 		cs.bufPipe = http2pipe{b: buf}
 		cs.bytesRemain = res.ContentLength
 		res.Body = http2transportResponseBody{cs}
-		go cs.awaitRequestCancel(http2requestCancel(cs.req))
+		go cs.awaitRequestCancel(cs.req)
 
 		if cs.requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
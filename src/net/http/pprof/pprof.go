@@ -203,6 +203,10 @@ func (name handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Unknown profile: %s\n", name)
 		return
 	}
+	if debug == 0 {
+		// The profile is in the compressed proto format.
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
 	gc, _ := strconv.Atoi(r.FormValue("gc"))
 	if name == "heap" && gc > 0 {
 		runtime.GC()
@@ -7,6 +7,7 @@ package http_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -343,6 +344,28 @@ var newRequestHostTests = []struct {
 	{"http://[fe80::1%25en0]:8080/", "[fe80::1%en0]:8080"},
 }
 
+func TestRequestWithContext(t *testing.T) {
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Context() != context.Background() {
+		t.Errorf("Context = %v; want context.Background()", req.Context())
+	}
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	req2 := req.WithContext(ctx)
+	if req2 == req {
+		t.Fatal("WithContext returned the same Request")
+	}
+	if got := req2.Context().Value(key{}); got != "value" {
+		t.Errorf("req2.Context().Value = %v; want %q", got, "value")
+	}
+	if req.Context() != context.Background() {
+		t.Error("WithContext modified the original Request")
+	}
+}
+
 func TestNewRequestHost(t *testing.T) {
 	for i, tt := range newRequestHostTests {
 		req, err := NewRequest("GET", tt.in, nil)
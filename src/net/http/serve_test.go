@@ -9,6 +9,7 @@ package http_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -3522,6 +3523,174 @@ func TestServerConnStateNew(t *testing.T) {
 	}
 }
 
+func TestServerRequestContextCancel_ServeHTTPDone(t *testing.T) {
+	defer afterTest(t)
+	ctxc := make(chan context.Context, 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		ctx := r.Context()
+		select {
+		case <-ctx.Done():
+			t.Error("should not be Done in ServeHTTP")
+		default:
+		}
+		ctxc <- ctx
+	}))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ctx := <-ctxc
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("context should be done after ServeHTTP completes")
+	}
+}
+
+func TestServerContext_ServerContextKey(t *testing.T) {
+	defer afterTest(t)
+	addrc := make(chan net.Addr, 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		ctx := r.Context()
+		got := ctx.Value(ServerContextKey)
+		if _, ok := got.(*Server); !ok {
+			t.Errorf("context value = %T; want *http.Server", got)
+		}
+		addr, _ := ctx.Value(LocalAddrContextKey).(net.Addr)
+		addrc <- addr
+	}))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if addr := <-addrc; addr == nil || addr.String() != ts.Listener.Addr().String() {
+		t.Errorf("local addr = %v; want %v", addr, ts.Listener.Addr())
+	}
+}
+
+func TestServerShutdown_h1(t *testing.T) { testServerShutdown(t, h1Mode) }
+func TestServerShutdown_h2(t *testing.T) { testServerShutdown(t, h2Mode) }
+
+func testServerShutdown(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	var doShutdown func() // set later
+	var shutdownRes = make(chan error, 1)
+	var gotOnShutdown = make(chan struct{}, 1)
+	handler := HandlerFunc(func(w ResponseWriter, r *Request) {
+		go doShutdown()
+		// Shutdown is graceful, so it should not interrupt
+		// this in-flight response. Add a tiny sleep here to
+		// increase the odds of a failure if shutdown has
+		// bugs.
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, r.RemoteAddr)
+	})
+	cst := newClientServerTest(t, h2, handler)
+	defer cst.close()
+	cst.ts.Config.RegisterOnShutdown(func() { gotOnShutdown <- struct{}{} })
+
+	doShutdown = func() {
+		shutdownRes <- cst.ts.Config.Shutdown(context.Background())
+	}
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if err := <-shutdownRes; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case <-gotOnShutdown:
+	case <-time.After(5 * time.Second):
+		t.Errorf("onShutdown callback not called, RegisterOnShutdown broken?")
+	}
+
+	res, err = cst.c.Get(cst.ts.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("second request should fail. server should be shut down")
+	}
+}
+
+// Shutdown should return the context's error if active
+// connections do not become idle before the deadline.
+func TestServerShutdownContextDeadline(t *testing.T) {
+	defer afterTest(t)
+	unblock := make(chan bool)
+	inHandler := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		inHandler <- true
+		<-unblock
+	}))
+	defer ts.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		res, err := Get(ts.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}()
+	<-inHandler
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ts.Config.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v; want %v", err, context.DeadlineExceeded)
+	}
+	close(unblock)
+	if err := <-errc; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+}
+
+func TestServerCloseReturnsErrServerClosed(t *testing.T) {
+	defer afterTest(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inHandler := make(chan bool)
+	unblock := make(chan bool)
+	defer close(unblock)
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		inHandler <- true
+		<-unblock
+	})}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	clientErr := make(chan error, 1)
+	go func() {
+		res, err := Get("http://" + ln.Addr().String())
+		if err == nil {
+			res.Body.Close()
+		}
+		clientErr <- err
+	}()
+	<-inHandler
+
+	if err := srv.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if err := <-serveErr; err != ErrServerClosed {
+		t.Errorf("Serve = %v; want %v", err, ErrServerClosed)
+	}
+	if err := <-clientErr; err == nil {
+		t.Error("request to closed server succeeded; want error")
+	}
+}
+
 type closeWriteTestConn struct {
 	rwTestConn
 	didCloseWrite bool
@@ -13,6 +13,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
@@ -23,6 +24,7 @@ import (
 	"net"
 	. "net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/http/internal"
 	"net/url"
@@ -1648,6 +1650,80 @@ func TestCancelRequestWithChannelBeforeDo(t *testing.T) {
 	}
 }
 
+func TestCancelRequestWithContext(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "Hello")
+		w.(Flusher).Flush() // send headers and some body
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req = req.WithContext(ctx)
+
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != ExportErrRequestCanceled {
+		t.Errorf("Body.Read error = %v; want errRequestCanceled", err)
+	}
+	if string(body) != "Hello" {
+		t.Errorf("Body = %q; want Hello", body)
+	}
+	// Verify no outstanding requests after readLoop/writeLoop
+	// goroutines shut down.
+	for tries := 5; tries > 0; tries-- {
+		n := tr.NumPendingRequestsForTesting()
+		if n == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+		if tries == 1 {
+			t.Errorf("pending requests = %d; want 0", n)
+		}
+	}
+}
+
+func TestCancelRequestWithContextBeforeDo(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req = req.WithContext(ctx)
+
+	_, err := c.Do(req)
+	if ue, ok := err.(*url.Error); !ok || ue.Err != context.Canceled {
+		t.Errorf("Do error = %v; want %v", err, context.Canceled)
+	}
+}
+
 // Issue 11020. The returned error message should be errRequestCanceled
 func TestTransportCancelBeforeResponseHeaders(t *testing.T) {
 	defer afterTest(t)
@@ -3120,3 +3196,90 @@ var rgz = []byte{
 	0x00, 0x00, 0x3d, 0xb1, 0x20, 0x85, 0xfa, 0x00,
 	0x00, 0x00,
 }
+
+func TestTransportEventTrace_h1(t *testing.T) { testTransportEventTrace(t, h1Mode) }
+func TestTransportEventTrace_h2(t *testing.T) { testTransportEventTrace(t, h2Mode) }
+
+func testTransportEventTrace(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	const resBody = "some body"
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			t.Error(err)
+		}
+		io.WriteString(w, resBody)
+	}))
+	defer cst.close()
+
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	logf := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteByte('\n')
+	}
+
+	req, _ := NewRequest("POST", cst.ts.URL, strings.NewReader("some body"))
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(hostPort string) { logf("Getting conn for %v ...", hostPort) },
+		GotConn:              func(ci httptrace.GotConnInfo) { logf("got conn: %+v", ci) },
+		GotFirstResponseByte: func() { logf("first response byte") },
+		PutIdleConn:          func(err error) { logf("PutIdleConn = %v", err) },
+		ConnectStart:         func(network, addr string) { logf("ConnectStart: Connecting to %s %s ...", network, addr) },
+		ConnectDone: func(network, addr string, err error) {
+			logf("ConnectDone: connected to %s %s = %v", network, addr, err)
+		},
+		TLSHandshakeStart: func() { logf("TLSHandshakeStart") },
+		TLSHandshakeDone:  func(cs tls.ConnectionState, err error) { logf("TLSHandshakeDone: err = %v", err) },
+		WroteHeaders:      func() { logf("WroteHeaders") },
+		WroteRequest:      func(e httptrace.WroteRequestInfo) { logf("WroteRequest: %+v", e) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+
+	res, err := cst.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slurp, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(slurp) != resBody || res.StatusCode != 200 {
+		t.Fatalf("Got %q, %v; want %q, 200 OK", slurp, res.Status, resBody)
+	}
+
+	mu.Lock()
+	got := buf.String()
+	mu.Unlock()
+
+	addr := strings.TrimPrefix(cst.ts.URL, "http://")
+	addr = strings.TrimPrefix(addr, "https://")
+	wantOnce := func(sub string) {
+		if strings.Count(got, sub) != 1 {
+			t.Errorf("expected substring %q exactly once in output.", sub)
+		}
+	}
+	wantOnceOrMore := func(sub string) {
+		if strings.Count(got, sub) == 0 {
+			t.Errorf("expected substring %q at least once in output.", sub)
+		}
+	}
+	wantOnce("Getting conn for " + addr)
+	wantOnceOrMore("ConnectStart: Connecting to tcp " + addr)
+	wantOnceOrMore("ConnectDone: connected to tcp " + addr + " = <nil>")
+	wantOnce("got conn: {")
+	wantOnce("WroteHeaders")
+	wantOnce("WroteRequest: {Err:<nil>}")
+	wantOnce("first response byte")
+	if h2 {
+		wantOnce("TLSHandshakeStart")
+		wantOnce("TLSHandshakeDone: err = <nil>")
+	} else {
+		wantOnce("PutIdleConn = <nil>")
+	}
+	if t.Failed() {
+		t.Errorf("Output:\n%s", got)
+	}
+}
@@ -4,6 +4,8 @@
 
 package net
 
+import "context"
+
 // IPAddr represents the address of an IP end point.
 type IPAddr struct {
 	IP   IP
@@ -54,7 +56,7 @@ func ResolveIPAddr(net, addr string) (*IPAddr, error) {
 	default:
 		return nil, UnknownNetworkError(net)
 	}
-	addrs, err := internetAddrList(afnet, addr, noDeadline)
+	addrs, err := DefaultResolver.internetAddrList(context.Background(), afnet, addr, noDeadline)
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,8 @@
 package net
 
 import (
+	"context"
+	"internal/nettrace"
 	"internal/singleflight"
 	"time"
 )
@@ -25,6 +27,109 @@ var protocols = map[string]int{
 // LookupHost looks up the given host using the local resolver.
 // It returns an array of that host's addresses.
 func LookupHost(host string) (addrs []string, err error) {
+	return DefaultResolver.LookupHost(context.Background(), host)
+}
+
+// LookupIP looks up host using the local resolver.
+// It returns an array of that host's IPv4 and IPv6 addresses.
+func LookupIP(host string) (ips []IP, err error) {
+	addrs, err := DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return nil, err
+	}
+	ips = make([]IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+// LookupPort looks up the port for the given network and service.
+func LookupPort(network, service string) (port int, err error) {
+	return DefaultResolver.LookupPort(context.Background(), network, service)
+}
+
+// LookupCNAME returns the canonical DNS host for the given name.
+// Callers that do not care about the canonical name can call
+// LookupHost or LookupIP directly; both take care of resolving
+// the canonical name as part of the lookup.
+func LookupCNAME(name string) (cname string, err error) {
+	return DefaultResolver.LookupCNAME(context.Background(), name)
+}
+
+// LookupSRV tries to resolve an SRV query of the given service,
+// protocol, and domain name. The proto is "tcp" or "udp".
+// The returned records are sorted by priority and randomized
+// by weight within a priority.
+//
+// LookupSRV constructs the DNS name to look up following RFC 2782.
+// That is, it looks up _service._proto.name. To accommodate services
+// publishing SRV records under non-standard names, if both service
+// and proto are empty strings, LookupSRV looks up name directly.
+func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return DefaultResolver.LookupSRV(context.Background(), service, proto, name)
+}
+
+// LookupMX returns the DNS MX records for the given domain name sorted by preference.
+func LookupMX(name string) (mxs []*MX, err error) {
+	return DefaultResolver.LookupMX(context.Background(), name)
+}
+
+// LookupNS returns the DNS NS records for the given domain name.
+func LookupNS(name string) (nss []*NS, err error) {
+	return DefaultResolver.LookupNS(context.Background(), name)
+}
+
+// LookupTXT returns the DNS TXT records for the given domain name.
+func LookupTXT(name string) (txts []string, err error) {
+	return DefaultResolver.LookupTXT(context.Background(), name)
+}
+
+// LookupAddr performs a reverse lookup for the given address, returning a list
+// of names mapping to that address.
+func LookupAddr(addr string) (names []string, err error) {
+	return DefaultResolver.LookupAddr(context.Background(), addr)
+}
+
+// DefaultResolver is the resolver used by the package-level Lookup
+// functions and by Dialers without a specified Resolver.
+var DefaultResolver = &Resolver{}
+
+// A Resolver looks up names and numbers.
+//
+// A nil *Resolver is equivalent to a zero Resolver.
+type Resolver struct {
+	// PreferGo controls whether Go's built-in DNS resolver is
+	// preferred on platforms where it's available. It is
+	// equivalent to setting GODEBUG=netdns=go, but scoped to
+	// just this resolver.
+	PreferGo bool
+
+	// Dial optionally specifies an alternate dialer for use by
+	// Go's built-in DNS resolver to make TCP and UDP connections
+	// to DNS services. The host in the address parameter will
+	// always be a literal IP address and not a host name, and the
+	// port in the address parameter will be a literal port number
+	// and not a service name.
+	// If the Conn returned is also a PacketConn, sent and received DNS
+	// messages must adhere to RFC 1035 section 4.2.1, "UDP usage".
+	// Otherwise, DNS messages transmitted over Conn must adhere
+	// to RFC 7766 section 5, "Transport Protocol Selection".
+	// If nil, the default dialer is used.
+	Dial func(ctx context.Context, network, address string) (Conn, error)
+}
+
+func (r *Resolver) preferGo() bool { return r != nil && r.PreferGo }
+
+// isDefault reports whether r behaves like DefaultResolver, so its
+// lookups may be coalesced with those of other default resolvers.
+func (r *Resolver) isDefault() bool {
+	return r == nil || !r.PreferGo && r.Dial == nil
+}
+
+// LookupHost looks up the given host using the local resolver.
+// It returns an array of that host's addresses.
+func (r *Resolver) LookupHost(ctx context.Context, host string) (addrs []string, err error) {
 	// Make sure that no matter what we do later, host=="" is rejected.
 	// ParseIP, for example, does accept empty strings.
 	if host == "" {
@@ -33,43 +138,25 @@ func LookupHost(host string) (addrs []string, err error) {
 	if ip := ParseIP(host); ip != nil {
 		return []string{host}, nil
 	}
-	return lookupHost(host)
+	return r.lookupHost(ctx, host)
 }
 
-// LookupIP looks up host using the local resolver.
+// LookupIPAddr looks up host using the local resolver.
 // It returns an array of that host's IPv4 and IPv6 addresses.
-func LookupIP(host string) (ips []IP, err error) {
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, error) {
 	// Make sure that no matter what we do later, host=="" is rejected.
 	// ParseIP, for example, does accept empty strings.
 	if host == "" {
 		return nil, &DNSError{Err: errNoSuchHost.Error(), Name: host}
 	}
 	if ip := ParseIP(host); ip != nil {
-		return []IP{ip}, nil
-	}
-	addrs, err := lookupIPMerge(host)
-	if err != nil {
-		return
-	}
-	ips = make([]IP, len(addrs))
-	for i, addr := range addrs {
-		ips[i] = addr.IP
+		return []IPAddr{{IP: ip}}, nil
 	}
-	return
+	return r.lookupIPAddr(ctx, host, noDeadline)
 }
 
 var lookupGroup singleflight.Group
 
-// lookupIPMerge wraps lookupIP, but makes sure that for any given
-// host, only one lookup is in-flight at a time. The returned memory
-// is always owned by the caller.
-func lookupIPMerge(host string) (addrs []IPAddr, err error) {
-	addrsi, err, shared := lookupGroup.Do(host, func() (interface{}, error) {
-		return testHookLookupIP(lookupIP, host)
-	})
-	return lookupIPReturn(addrsi, err, shared)
-}
-
 // lookupIPReturn turns the return values from singleflight.Do into
 // the return values from LookupIP.
 func lookupIPReturn(addrsi interface{}, err error, shared bool) ([]IPAddr, error) {
@@ -87,42 +174,109 @@ func lookupIPReturn(addrsi interface{}, err error, shared bool) ([]IPAddr, error
 
 // lookupIPDeadline looks up a hostname with a deadline.
 func lookupIPDeadline(host string, deadline time.Time) (addrs []IPAddr, err error) {
-	if deadline.IsZero() {
-		return lookupIPMerge(host)
+	return DefaultResolver.lookupIPAddr(context.Background(), host, deadline)
+}
+
+// lookupIPAddr looks up a hostname with a deadline, giving up early
+// if ctx is canceled. It reports the lookup to the nettrace hooks
+// attached to ctx, if any.
+func (r *Resolver) lookupIPAddr(ctx context.Context, host string, deadline time.Time) (addrs []IPAddr, err error) {
+	trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(host)
+	}
+	addrs, shared, err := r.lookupIPShared(ctx, host, deadline)
+	if trace != nil && trace.DNSDone != nil {
+		addrsi := make([]interface{}, len(addrs))
+		for i, v := range addrs {
+			addrsi[i] = v
+		}
+		trace.DNSDone(addrsi, shared, err)
+	}
+	return addrs, err
+}
+
+// lookupIPShared is like lookupIPAddr without the tracing, but also
+// reports whether the result was shared with another in-flight lookup
+// of the same host.
+func (r *Resolver) lookupIPShared(ctx context.Context, host string, deadline time.Time) (addrs []IPAddr, shared bool, err error) {
+	if !r.isDefault() {
+		// Lookups through a customized Resolver are not merged
+		// with anybody else's, as they may be using different
+		// settings. The lookup itself observes ctx.
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		addrs, err := testHookLookupIP(func(host string) ([]IPAddr, error) {
+			return r.lookupIP(ctx, host)
+		}, host)
+		if err != nil {
+			return nil, false, mapErr(err)
+		}
+		return addrs, false, nil
+	}
+
+	// Merged lookups run on behalf of several callers, so they
+	// don't observe any one caller's context; each caller gives
+	// up on its own below.
+	lookupIP := func(host string) ([]IPAddr, error) {
+		return r.lookupIP(context.Background(), host)
+	}
+
+	if deadline.IsZero() && ctx.Done() == nil {
+		addrsi, err, shared := lookupGroup.Do(host, func() (interface{}, error) {
+			return testHookLookupIP(lookupIP, host)
+		})
+		addrs, err = lookupIPReturn(addrsi, err, shared)
+		return addrs, shared, err
 	}
 
 	// We could push the deadline down into the name resolution
 	// functions. However, the most commonly used implementation
 	// calls getaddrinfo, which has no timeout.
 
-	timeout := deadline.Sub(time.Now())
-	if timeout <= 0 {
-		return nil, errTimeout
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := deadline.Sub(time.Now())
+		if d <= 0 {
+			return nil, false, errTimeout
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
 	}
-	t := time.NewTimer(timeout)
-	defer t.Stop()
 
 	ch := lookupGroup.DoChan(host, func() (interface{}, error) {
 		return testHookLookupIP(lookupIP, host)
 	})
 
 	select {
-	case <-t.C:
+	case <-timeout:
 		// The DNS lookup timed out for some reason. Force
 		// future requests to start the DNS lookup again
 		// rather than waiting for the current lookup to
 		// complete. See issue 8602.
 		lookupGroup.Forget(host)
 
-		return nil, errTimeout
+		return nil, false, errTimeout
+
+	case <-ctx.Done():
+		// As above, but the caller gave up rather than the
+		// deadline expiring.
+		lookupGroup.Forget(host)
+
+		return nil, false, mapErr(ctx.Err())
 
 	case r := <-ch:
-		return lookupIPReturn(r.Val, r.Err, r.Shared)
+		addrs, err := lookupIPReturn(r.Val, r.Err, r.Shared)
+		return addrs, r.Shared, err
 	}
 }
 
 // LookupPort looks up the port for the given network and service.
-func LookupPort(network, service string) (port int, err error) {
+func (r *Resolver) LookupPort(ctx context.Context, network, service string) (port int, err error) {
 	if service == "" {
 		// Lock in the legacy behavior that an empty string
 		// means port 0. See Issue 13610.
@@ -130,7 +284,7 @@ func LookupPort(network, service string) (port int, err error) {
 	}
 	port, _, ok := dtoi(service, 0)
 	if !ok && port != big && port != -big {
-		port, err = lookupPort(network, service)
+		port, err = r.lookupPort(ctx, network, service)
 		if err != nil {
 			return 0, err
 		}
@@ -145,8 +299,8 @@ func LookupPort(network, service string) (port int, err error) {
 // Callers that do not care about the canonical name can call
 // LookupHost or LookupIP directly; both take care of resolving
 // the canonical name as part of the lookup.
-func LookupCNAME(name string) (cname string, err error) {
-	return lookupCNAME(name)
+func (r *Resolver) LookupCNAME(ctx context.Context, name string) (cname string, err error) {
+	return r.lookupCNAME(ctx, name)
 }
 
 // LookupSRV tries to resolve an SRV query of the given service,
@@ -158,27 +312,27 @@ func LookupCNAME(name string) (cname string, err error) {
 // That is, it looks up _service._proto.name. To accommodate services
 // publishing SRV records under non-standard names, if both service
 // and proto are empty strings, LookupSRV looks up name directly.
-func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
-	return lookupSRV(service, proto, name)
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return r.lookupSRV(ctx, service, proto, name)
 }
 
 // LookupMX returns the DNS MX records for the given domain name sorted by preference.
-func LookupMX(name string) (mxs []*MX, err error) {
-	return lookupMX(name)
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*MX, error) {
+	return r.lookupMX(ctx, name)
 }
 
 // LookupNS returns the DNS NS records for the given domain name.
-func LookupNS(name string) (nss []*NS, err error) {
-	return lookupNS(name)
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*NS, error) {
+	return r.lookupNS(ctx, name)
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
-func LookupTXT(name string) (txts []string, err error) {
-	return lookupTXT(name)
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.lookupTXT(ctx, name)
 }
 
 // LookupAddr performs a reverse lookup for the given address, returning a list
 // of names mapping to that address.
-func LookupAddr(addr string) (names []string, err error) {
-	return lookupAddr(addr)
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) (names []string, err error) {
+	return r.lookupAddr(ctx, addr)
 }
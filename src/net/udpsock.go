@@ -4,6 +4,8 @@
 
 package net
 
+import "context"
+
 // UDPAddr represents the address of a UDP end point.
 type UDPAddr struct {
 	IP   IP
@@ -53,7 +55,7 @@ func ResolveUDPAddr(net, addr string) (*UDPAddr, error) {
 	default:
 		return nil, UnknownNetworkError(net)
 	}
-	addrs, err := internetAddrList(net, addr, noDeadline)
+	addrs, err := DefaultResolver.internetAddrList(context.Background(), net, addr, noDeadline)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +39,14 @@
 // and the goroutine is now in charge of flushing the data left in the hash table
 // to the log and returning that data.
 //
+// The log records are in the legacy pprof binary format, with one
+// extension for profiler labels: a record with a zero count and the
+// two-word stack 0, n precedes a record of samples taken while the
+// goroutine had the labels numbered n in the profile's tag table.
+// The tag table holds the label pointers seen during the profile,
+// so that the garbage collector keeps them alive until the profile
+// has been written.
+//
 // The handoff field is manipulated using atomic operations.
 // For the most part, the manipulation of handoff is orderly: if handoff == 0
 // then the signal handler owns it and can change it to non-zero.
@@ -52,6 +60,7 @@ package runtime
 
 import (
 	"runtime/internal/atomic"
+	"runtime/internal/sys"
 	"unsafe"
 )
 
@@ -60,10 +69,12 @@ const (
 	logSize         = 1 << 17
 	assoc           = 4
 	maxCPUProfStack = 64
+	maxCPUProfTags  = 1 << 12
 )
 
 type cpuprofEntry struct {
 	count uintptr
+	tag   uintptr // 1 + number of the labels in cpuprofTags, or 0 for none
 	depth int
 	stack [maxCPUProfStack]uintptr
 }
@@ -75,6 +86,13 @@ type cpuProfile struct {
 	evicts uintptr // eviction count
 	lost   uintptr // lost ticks that need to be logged
 
+	// Index of label pointers in cpuprofTags, by hash of the pointer.
+	ntag    uint32
+	tagHash [2 * maxCPUProfTags]struct {
+		labels uintptr
+		tag    uintptr
+	}
+
 	// Active recent stack traces.
 	hash [numBuckets]struct {
 		entry [assoc]cpuprofEntry
@@ -101,6 +119,11 @@ var (
 	cpuprofLock mutex
 	cpuprof     *cpuProfile
 
+	// cpuprofTags holds the labels recorded by the current CPU profile.
+	// It is allocated in the heap, not in cpuprof, so that the garbage
+	// collector scans it.
+	cpuprofTags *[maxCPUProfTags]unsafe.Pointer
+
 	eod = [3]uintptr{0, 1, 0}
 )
 
@@ -130,6 +153,10 @@ func SetCPUProfileRate(hz int) {
 	if hz > 1000000 {
 		hz = 1000000
 	}
+	var tags *[maxCPUProfTags]unsafe.Pointer
+	if hz > 0 {
+		tags = new([maxCPUProfTags]unsafe.Pointer)
+	}
 
 	lock(&cpuprofLock)
 	if hz > 0 {
@@ -148,6 +175,9 @@ func SetCPUProfileRate(hz int) {
 		}
 
 		cpuprof.on = true
+		cpuprofTags = tags
+		cpuprof.ntag = 0
+		memclr(unsafe.Pointer(&cpuprof.tagHash), unsafe.Sizeof(cpuprof.tagHash))
 		// pprof binary header format.
 		// http://code.google.com/p/google-perftools/source/browse/trunk/src/profiledata.cc#117
 		p := &cpuprof.log[0]
@@ -188,18 +218,20 @@ func SetCPUProfileRate(hz int) {
 	unlock(&cpuprofLock)
 }
 
-// add adds the stack trace to the profile.
+// add adds the stack trace, taken while the goroutine had the given
+// profiler labels, to the profile.
 // It is called from signal handlers and other limited environments
 // and cannot allocate memory or acquire locks that might be
 // held at the time of the signal, nor can it use substantial amounts
 // of stack. It is allowed to call evict.
-func (p *cpuProfile) add(pc []uintptr) {
+func (p *cpuProfile) add(pc []uintptr, labels unsafe.Pointer) {
 	if len(pc) > maxCPUProfStack {
 		pc = pc[:maxCPUProfStack]
 	}
+	tag := p.addTag(labels)
 
 	// Compute hash.
-	h := uintptr(0)
+	h := tag
 	for _, x := range pc {
 		h = h<<8 | (h >> (8 * (unsafe.Sizeof(h) - 1)))
 		h += x * 41
@@ -211,7 +243,7 @@ func (p *cpuProfile) add(pc []uintptr) {
 Assoc:
 	for i := range b.entry {
 		e := &b.entry[i]
-		if e.depth != len(pc) {
+		if e.depth != len(pc) || e.tag != tag {
 			continue
 		}
 		for j := range pc {
@@ -241,10 +273,46 @@ Assoc:
 
 	// Reuse the newly evicted entry.
 	e.depth = len(pc)
+	e.tag = tag
 	e.count = 1
 	copy(e.stack[:], pc)
 }
 
+// addTag returns the tag of the entries for samples with the given
+// profiler labels, adding the labels to cpuprofTags if necessary.
+// It returns 0 for no labels, or if the table is full.
+// Like add, it is called from the signal handler.
+func (p *cpuProfile) addTag(labels unsafe.Pointer) uintptr {
+	if labels == nil {
+		return 0
+	}
+	x := uintptr(labels)
+	h := x / sys.PtrSize
+	for i := range p.tagHash {
+		t := &p.tagHash[(h+uintptr(i))%uintptr(len(p.tagHash))]
+		if t.labels == x {
+			return t.tag
+		}
+		if t.labels != 0 {
+			continue
+		}
+		if p.ntag == maxCPUProfTags {
+			break
+		}
+		// There is no write barrier here: we are in a signal handler.
+		// The labels are those of the interrupted goroutine, which keeps
+		// them alive at least until the garbage collector next scans it
+		// (see setProfLabel), and the table then keeps them alive until
+		// the next profile.
+		*(*uintptr)(unsafe.Pointer(&cpuprofTags[p.ntag])) = x
+		p.ntag++
+		t.labels = x
+		t.tag = uintptr(p.ntag)
+		return t.tag
+	}
+	return 0
+}
+
 // evict copies the given entry's data into the log, so that
 // the entry can be reused.  evict is called from add, which
 // is called from the profiling signal handler, so it must not
@@ -254,6 +322,9 @@ Assoc:
 func (p *cpuProfile) evict(e *cpuprofEntry) bool {
 	d := e.depth
 	nslot := d + 2
+	if e.tag != 0 {
+		nslot += 4
+	}
 	log := &p.log[p.toggle]
 	if p.nlog+nslot > len(log) {
 		if !p.flushlog() {
@@ -263,6 +334,14 @@ func (p *cpuProfile) evict(e *cpuprofEntry) bool {
 	}
 
 	q := p.nlog
+	if e.tag != 0 {
+		// Labels record.
+		log[q] = 0
+		log[q+1] = 2
+		log[q+2] = 0
+		log[q+3] = e.tag - 1
+		q += 4
+	}
 	log[q] = e.count
 	q++
 	log[q] = uintptr(d)
@@ -392,6 +471,7 @@ Flush:
 
 	// Finally done. Clean up and return nil.
 	p.flushing = false
+	cpuprofTags = nil
 	if !atomic.Cas(&p.handoff, p.handoff, 0) {
 		print("runtime: profile flush racing with something\n")
 	}
@@ -421,6 +501,22 @@ func CPUProfile() []byte {
 	return cpuprof.getprofile()
 }
 
+// runtime_pprof_runtime_cpuProfileLabels returns the labels numbered n
+// in the current CPU profile's tag table, for use in interpreting the
+// labels records returned by CPUProfile. It must be called before the
+// end of the profile.
+//go:linkname runtime_pprof_runtime_cpuProfileLabels runtime/pprof.runtime_cpuProfileLabels
+func runtime_pprof_runtime_cpuProfileLabels(n uintptr) unsafe.Pointer {
+	tags := cpuprofTags
+	if tags == nil || n >= uintptr(len(tags)) {
+		return nil
+	}
+	if raceenabled {
+		raceacquire(unsafe.Pointer(&labelSync))
+	}
+	return tags[n]
+}
+
 //go:linkname runtime_pprof_runtime_cyclesPerSecond runtime/pprof.runtime_cyclesPerSecond
 func runtime_pprof_runtime_cyclesPerSecond() int64 {
 	return tickspersecond()
@@ -100,6 +100,26 @@ func SetGCPercent(percent int) int {
 	return int(old)
 }
 
+// SetMemoryLimit sets a soft limit, in bytes, on the memory used by
+// the runtime: the Go heap, goroutine stacks and runtime metadata,
+// not counting heap memory returned to the operating system.
+// As memory use nears the limit, the garbage collector runs more
+// often and idle memory is returned to the operating system sooner.
+// This is so even if garbage collection is disabled by SetGCPercent,
+// which makes it possible to collect garbage only under memory pressure.
+//
+// The limit is soft: the garbage collector uses at most about half
+// of the CPU time to meet it, and a program whose live data does not
+// fit exceeds it.
+//
+// SetMemoryLimit returns the previous setting. A negative limit leaves
+// the setting unchanged, so SetMemoryLimit(-1) queries it.
+// The initial setting is the value of the GOMEMLIMIT environment
+// variable at startup, or math.MaxInt64 (no limit) if it is not set.
+func SetMemoryLimit(limit int64) int64 {
+	return setMemoryLimit(limit)
+}
+
 // FreeOSMemory forces a garbage collection followed by an
 // attempt to return as much memory to the operating system
 // as possible. (Even if this is not called, the runtime gradually
@@ -118,3 +118,35 @@ func TestSetGCPercent(t *testing.T) {
 		t.Errorf("SetGCPercent(123); SetGCPercent(x) = %d, want 123", new)
 	}
 }
+
+func TestSetMemoryLimit(t *testing.T) {
+	old := SetMemoryLimit(-1)
+	defer SetMemoryLimit(old)
+	defer SetGCPercent(SetGCPercent(-1))
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	limit := int64(ms.Sys-ms.HeapReleased) + 64<<20
+	if got := SetMemoryLimit(limit); got != old {
+		t.Errorf("SetMemoryLimit(%d) = %d, want %d", limit, got, old)
+	}
+	if got := SetMemoryLimit(-1); got != limit {
+		t.Errorf("SetMemoryLimit(-1) = %d, want %d", got, limit)
+	}
+
+	// With GOGC=off, only the memory limit keeps the heap in check.
+	numGC := ms.NumGC
+	for i := 0; i < 256; i++ {
+		sink = make([]byte, 1<<20)
+	}
+	sink = nil
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC == numGC {
+		t.Errorf("no GC while allocating 256 MB with a limit of 64 MB more than in use")
+	}
+	if used := ms.Sys - ms.HeapReleased; used > uint64(limit) {
+		t.Errorf("%d bytes in use, over the memory limit of %d", used, limit)
+	}
+}
+
+var sink []byte
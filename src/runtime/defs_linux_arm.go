@@ -4,6 +4,7 @@ package runtime
 const (
 	_EINTR  = 0x4
 	_ENOMEM = 0xc
+	_EINVAL = 0x16
 	_EAGAIN = 0xb
 
 	_PROT_NONE  = 0
@@ -16,6 +17,7 @@ const (
 	_MAP_FIXED   = 0x10
 
 	_MADV_DONTNEED   = 0x4
+	_MADV_FREE       = 0x8
 	_MADV_HUGEPAGE   = 0xe
 	_MADV_NOHUGEPAGE = 0xf
 
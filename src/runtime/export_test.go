@@ -32,6 +32,8 @@ var FuncPC = funcPC
 
 var Fastlog2 = fastlog2
 
+var ParseByteCount = parseByteCount
+
 type LFNode struct {
 	Next    uint64
 	Pushcnt uintptr
@@ -135,3 +137,9 @@ func SetTracebackEnv(level string) {
 	setTraceback(level)
 	traceback_env = traceback_cache
 }
+
+// SetGCPercentNoGC is like runtime/debug.SetGCPercent, but it does
+// not run a GC, so the next GC is whatever setGCPercent leaves.
+func SetGCPercentNoGC(percent int32) int32 {
+	return setGCPercent(percent)
+}
@@ -21,12 +21,24 @@ is GOGC=100. Setting GOGC=off disables the garbage collector entirely.
 The runtime/debug package's SetGCPercent function allows changing this
 percentage at run time. See https://golang.org/pkg/runtime/debug/#SetGCPercent.
 
+The GOMEMLIMIT variable sets a soft limit on the memory used by the runtime,
+as a number of bytes with an optional unit suffix: B, KiB, MiB, GiB or TiB.
+As memory use nears the limit, the garbage collector runs more often, even
+with GOGC=off. The default is GOMEMLIMIT=off, meaning no limit.
+The runtime/debug package's SetMemoryLimit function allows changing the limit
+at run time. See https://golang.org/pkg/runtime/debug/#SetMemoryLimit.
+
 The GODEBUG variable controls debugging variables within the runtime.
 It is a comma-separated list of name=val pairs setting these named variables:
 
 	allocfreetrace: setting allocfreetrace=1 causes every allocation to be
 	profiled and a stack trace printed on each object's allocation and free.
 
+	asyncpreemptoff: setting asyncpreemptoff=1 disables signal-based
+	asynchronous goroutine preemption. This makes some loops
+	non-preemptible for long periods, which may delay GC and
+	goroutine scheduling.
+
 	cgocheck: setting cgocheck=0 disables all checks for packages
 	using cgo to incorrectly pass Go pointers to non-Go code.
 	Setting cgocheck=1 (the default) enables relatively cheap
@@ -92,15 +104,34 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	This should only be used as a temporary workaround to diagnose buggy code.
 	The real fix is to not store integers in pointer-typed locations.
 
+	madvfree: setting madvfree=1 on Linux makes the runtime return unused heap
+	memory to the OS with MADV_FREE rather than MADV_DONTNEED. The kernel then
+	reclaims the memory only under memory pressure, which is cheaper, but the
+	memory keeps counting towards the RSS of the process until it does.
+
 	sbrk: setting sbrk=1 replaces the memory allocator and garbage collector
 	with a trivial allocator that obtains memory from the operating system and
 	never reclaims any memory.
 
 	scavenge: scavenge=1 enables debugging mode of heap scavenger.
 
+	scavtrace: setting scavtrace=1 causes the background scavenger to emit a
+	single line to standard error each time it finishes returning memory to the
+	OS after a garbage collection, summarizing the memory released and the
+	memory the heap retains. The format of this line is subject to change.
+	Currently, it is:
+		scav #: # KB released, # MB retained, # MB goal, # MB released to OS
+	where the fields are as follows:
+		scav #             the number of times the scavenger goal has been set
+		# KB released      memory returned to the OS since the scavenger woke up
+		# MB retained      heap memory obtained from the OS and not returned to it
+		# MB goal          retained heap memory the scavenger aims for
+		# MB released...   heap memory currently returned to the OS
+
 	scheddetail: setting schedtrace=X and scheddetail=1 causes the scheduler to emit
 	detailed multiline info every X milliseconds, describing state of the scheduler,
-	processors, threads and goroutines.
+	processors, threads and goroutines, including the estimated time goroutines
+	have spent runnable (waiting to run) and running, per processor and per goroutine.
 
 	schedtrace: setting schedtrace=X causes the scheduler to emit a single line to standard
 	error every X milliseconds, summarizing the scheduler state.
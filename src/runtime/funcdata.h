@@ -11,6 +11,7 @@
 // symtab.go also contains a copy of these constants.
 
 #define PCDATA_StackMapIndex 0
+#define PCDATA_UnsafePoint 1
 
 #define FUNCDATA_ArgsPointerMaps 0 /* garbage collector blocks */
 #define FUNCDATA_LocalsPointerMaps 1
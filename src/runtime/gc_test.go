@@ -184,6 +184,21 @@ func TestPeriodicGC(t *testing.T) {
 	}
 }
 
+func TestSetGCPercentAfterOff(t *testing.T) {
+	// A GC that ends with GOGC=off leaves no next GC.
+	// Turning GOGC back on must schedule one again.
+	old := debug.SetGCPercent(-1)
+	defer debug.SetGCPercent(old)
+	runtime.GC()
+	runtime.SetGCPercentNoGC(100)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.NextGC == ^uint64(0) {
+		t.Errorf("NextGC = %#x after turning GOGC back on, want finite", ms.NextGC)
+	}
+}
+
 func BenchmarkSetTypePtr(b *testing.B) {
 	benchSetType(b, new(*byte))
 }
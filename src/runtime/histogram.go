@@ -0,0 +1,47 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+)
+
+// timeHistNumBuckets is the number of buckets of a timeHistogram:
+// one for durations under 1ns and one for each power of two
+// nanoseconds up to 2^63ns.
+const timeHistNumBuckets = 64
+
+// timeHistogram is a cumulative histogram of durations in
+// exponentially sized buckets: bucket 0 counts durations under 1ns,
+// and bucket i > 0 counts durations in [2^(i-1), 2^i) nanoseconds.
+//
+// Recording is lock-free, so a timeHistogram can be updated from
+// any context, and read without stopping the world. A reader may
+// see a count that is slightly out of date.
+type timeHistogram struct {
+	counts [timeHistNumBuckets]uint64
+}
+
+// record adds the given duration, in nanoseconds, to the distribution.
+//
+//go:nosplit
+func (h *timeHistogram) record(duration int64) {
+	bucket := 0
+	for d := duration; d > 0; d >>= 1 {
+		bucket++
+	}
+	atomic.Xadd64(&h.counts[bucket], 1)
+}
+
+// timeHistogramBuckets returns the bucket boundaries of a
+// timeHistogram in seconds, in the form used by runtime/metrics:
+// bucket i spans [b[i], b[i+1]).
+func timeHistogramBuckets() []float64 {
+	b := make([]float64, timeHistNumBuckets+1)
+	for i := 1; i < len(b); i++ {
+		b[i] = float64(uint64(1)<<uint(i-1)) / 1e9
+	}
+	return b
+}
@@ -74,6 +74,37 @@ func TestMemStats(t *testing.T) {
 	}
 }
 
+var scavengeSink [][]byte
+
+func TestBackgroundScavenger(t *testing.T) {
+	// Grow the heap, then drop it, and check that the scavenger
+	// returns most of it to the OS without being forced to.
+	for i := 0; i < 64; i++ {
+		scavengeSink = append(scavengeSink, make([]byte, 1<<20))
+	}
+	var st MemStats
+	ReadMemStats(&st)
+	released := st.TotalReleased
+	scavengeSink = nil
+	GC()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		ReadMemStats(&st)
+		if st.TotalReleased-released >= 32<<20 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scavenger released %d bytes in 10s, want at least %d; HeapSys=%d HeapReleased=%d NextGC=%d",
+				st.TotalReleased-released, 32<<20, st.HeapSys, st.HeapReleased, st.NextGC)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.HeapReleased > st.HeapIdle {
+		t.Fatalf("HeapReleased(%d) > HeapIdle(%d)", st.HeapReleased, st.HeapIdle)
+	}
+}
+
 func TestStringConcatenationAllocs(t *testing.T) {
 	n := testing.AllocsPerRun(1e3, func() {
 		b := make([]byte, 10)
@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"runtime/internal/atomic"
 	"runtime/internal/sys"
 	"unsafe"
 )
@@ -14,6 +15,10 @@ const (
 	_EACCES    = 13
 )
 
+// madvFreeBroken is set once MADV_FREE has failed with EINVAL,
+// which it does on kernels older than Linux 4.5.
+var madvFreeBroken uint32
+
 // NOTE: vec must be just 1 byte long here.
 // Mincore returns ENOMEM if any of the pages are unmapped,
 // but we want to know that all of the pages are unmapped.
@@ -132,6 +137,18 @@ func sysUnused(v unsafe.Pointer, n uintptr) {
 		}
 	}
 
+	// With GODEBUG=madvfree=1, let the kernel reclaim the pages
+	// lazily, when it comes under memory pressure. This is cheaper
+	// for both the scavenger and the next user of the pages, but
+	// the pages still count towards the RSS until reclaimed.
+	if debug.madvfree != 0 && atomic.Load(&madvFreeBroken) == 0 {
+		if madvise(v, n, _MADV_FREE) != -_EINVAL {
+			// ignore other failures - maybe pages are locked
+			return
+		}
+		atomic.Store(&madvFreeBroken, 1)
+	}
+	// ignore failure - maybe pages are locked
 	madvise(v, n, _MADV_DONTNEED)
 }
 
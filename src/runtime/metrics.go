@@ -0,0 +1,455 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Metrics implementation exported to runtime/metrics.
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+var (
+	// metricsSema protects metrics and serializes calls to readMetrics.
+	metricsSema uint32 = 1
+	metricsInit bool
+	metrics     map[string]metricData
+
+	// timeHistBuckets are the bucket boundaries of every
+	// timeHistogram metric. They are shared with callers, who
+	// must not modify them.
+	timeHistBuckets []float64
+)
+
+type metricData struct {
+	// deps is the set of aggregates this metric is computed from.
+	deps statDepSet
+
+	// compute sets out to the value of the metric, given the
+	// aggregates in deps. It must not modify in.
+	compute func(in *statAggregate, out *metricValue)
+}
+
+// initMetrics builds the table of supported metrics. The names and
+// kinds must match the descriptions in runtime/metrics.
+// metricsSema must be held.
+func initMetrics() {
+	if metricsInit {
+		return
+	}
+	timeHistBuckets = timeHistogramBuckets()
+	metrics = map[string]metricData{
+		"/gc/cycles/total:gc-cycles": {
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(atomic.Load(&memstats.numgc))
+			},
+		},
+		"/gc/cpu/total:cpu-seconds": {
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindFloat64
+				out.scalar = float64bits(float64(work.totaltime) / 1e9)
+			},
+		},
+		"/gc/gogc:percent": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = 0
+				if in.heapStats.gcPercent >= 0 {
+					out.scalar = uint64(in.heapStats.gcPercent)
+				}
+			},
+		},
+		"/gc/gomemlimit:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(in.heapStats.memoryLimit)
+			},
+		},
+		"/gc/heap/goal:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapGoal
+			},
+		},
+		"/gc/heap/live:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapMarked
+			},
+		},
+		"/gc/pauses:seconds": {
+			compute: func(in *statAggregate, out *metricValue) {
+				hist := out.float64HistOrInit(timeHistBuckets)
+				for i := range hist.counts {
+					hist.counts[i] = atomic.Load64(&gcPauseDist.counts[i])
+				}
+			},
+		},
+		"/memory/classes/heap/free:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapFree
+			},
+		},
+		"/memory/classes/heap/in-use:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapInUse
+			},
+		},
+		"/memory/classes/heap/released:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapReleased
+			},
+		},
+		"/memory/classes/heap/stacks:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.heapStacks
+			},
+		},
+		"/memory/classes/metadata:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.metadata
+			},
+		},
+		"/memory/classes/os-stacks:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.osStacks
+			},
+		},
+		"/memory/classes/other:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.other
+			},
+		},
+		"/memory/classes/profiling/buckets:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.heapStats.profBuckets
+			},
+		},
+		"/memory/classes/total:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				a := &in.heapStats
+				out.kind = metricKindUint64
+				out.scalar = a.heapFree + a.heapInUse + a.heapReleased + a.heapStacks +
+					a.metadata + a.osStacks + a.other + a.profBuckets
+			},
+		},
+		"/sched/gomaxprocs:threads": {
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(gomaxprocs)
+			},
+		},
+		"/sched/goroutines:goroutines": {
+			deps: makeStatDepSet(schedStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				a := &in.schedStats
+				out.kind = metricKindUint64
+				out.scalar = a.runnable + a.running + a.syscall + a.waiting
+			},
+		},
+		"/sched/goroutines/runnable:goroutines": {
+			deps: makeStatDepSet(schedStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.schedStats.runnable
+			},
+		},
+		"/sched/goroutines/running:goroutines": {
+			deps: makeStatDepSet(schedStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.schedStats.running
+			},
+		},
+		"/sched/goroutines/syscall:goroutines": {
+			deps: makeStatDepSet(schedStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.schedStats.syscall
+			},
+		},
+		"/sched/goroutines/waiting:goroutines": {
+			deps: makeStatDepSet(schedStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = in.schedStats.waiting
+			},
+		},
+		"/sched/latencies:seconds": {
+			compute: func(in *statAggregate, out *metricValue) {
+				hist := out.float64HistOrInit(timeHistBuckets)
+				for i := range hist.counts {
+					hist.counts[i] = atomic.Load64(&schedLatencyDist.counts[i])
+				}
+			},
+		},
+		"/sched/time/runnable:seconds": {
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindFloat64
+				out.scalar = float64bits(float64(atomic.Load64(&schedTime.runnable)) / 1e9)
+			},
+		},
+		"/sched/time/running:seconds": {
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindFloat64
+				out.scalar = float64bits(float64(atomic.Load64(&schedTime.running)) / 1e9)
+			},
+		},
+	}
+	metricsInit = true
+}
+
+// statDep is a dependency on a group of statistics
+// that a metric might have.
+type statDep uint
+
+const (
+	heapStatsDep  statDep = iota // corresponds to heapStatsAggregate
+	schedStatsDep                // corresponds to schedStatsAggregate
+	numStatsDeps
+)
+
+// statDepSet is a set of statDeps.
+type statDepSet uint
+
+// makeStatDepSet creates a new statDepSet from a list of statDeps.
+func makeStatDepSet(deps ...statDep) statDepSet {
+	var s statDepSet
+	for _, d := range deps {
+		s |= 1 << d
+	}
+	return s
+}
+
+// has reports whether d is in s.
+func (s statDepSet) has(d statDep) bool {
+	return s&(1<<d) != 0
+}
+
+// heapStatsAggregate is a consistent snapshot of the heap
+// statistics, taken under the heap lock.
+type heapStatsAggregate struct {
+	gcPercent   int32
+	memoryLimit int64
+	heapGoal    uint64
+	heapMarked  uint64
+
+	// The memory classes, which add up to all the
+	// memory mapped by the runtime.
+	heapFree     uint64 // idle heap memory not released to the OS
+	heapInUse    uint64 // heap spans in use, other than stacks
+	heapReleased uint64 // idle heap memory released to the OS
+	heapStacks   uint64 // stack spans allocated from the heap
+	metadata     uint64 // mspan, mcache and GC metadata
+	osStacks     uint64 // stacks allocated by the OS
+	other        uint64
+	profBuckets  uint64
+}
+
+// compute populates the heapStatsAggregate with values from the runtime.
+func (a *heapStatsAggregate) compute() {
+	systemstack(func() {
+		lock(&mheap_.lock)
+		a.gcPercent = gcpercent
+		a.memoryLimit = memoryLimit
+		a.heapGoal = gcController.heapGoal
+		if gcphase == _GCoff {
+			// Between cycles, report the goal of the next
+			// cycle. It is never under the trigger.
+			a.heapGoal = gcController.computeHeapGoal()
+			if a.heapGoal < memstats.next_gc {
+				a.heapGoal = memstats.next_gc
+			}
+		}
+		a.heapMarked = memstats.heap_marked
+		a.heapFree = memstats.heap_idle - memstats.heap_released
+		a.heapInUse = memstats.heap_inuse - memstats.stacks_inuse
+		a.heapReleased = memstats.heap_released
+		a.heapStacks = memstats.stacks_inuse
+		a.metadata = atomic.Load64(&memstats.mspan_sys) + atomic.Load64(&memstats.mcache_sys) +
+			atomic.Load64(&memstats.gc_sys)
+		a.osStacks = atomic.Load64(&memstats.stacks_sys)
+		a.other = atomic.Load64(&memstats.other_sys)
+		a.profBuckets = atomic.Load64(&memstats.buckhash_sys)
+		unlock(&mheap_.lock)
+	})
+}
+
+// schedStatsAggregate counts the user goroutines by state.
+type schedStatsAggregate struct {
+	runnable uint64
+	running  uint64
+	syscall  uint64
+	waiting  uint64
+}
+
+// compute populates the schedStatsAggregate with values from the runtime.
+// The states of goroutines change concurrently, so the counts are
+// only approximately consistent with each other.
+func (a *schedStatsAggregate) compute() {
+	systemstack(func() {
+		lock(&allglock)
+		for _, gp := range allgs {
+			if isSystemGoroutine(gp) {
+				continue
+			}
+			switch readgstatus(gp) &^ _Gscan {
+			case _Grunnable:
+				a.runnable++
+			case _Grunning:
+				a.running++
+			case _Gsyscall:
+				a.syscall++
+			case _Gwaiting:
+				a.waiting++
+			}
+		}
+		unlock(&allglock)
+	})
+}
+
+// statAggregate is the set of aggregates that the metrics of one
+// readMetrics call are computed from.
+type statAggregate struct {
+	ensured    statDepSet
+	heapStats  heapStatsAggregate
+	schedStats schedStatsAggregate
+}
+
+// ensure computes the aggregates in deps that have not been
+// computed yet.
+func (a *statAggregate) ensure(deps *statDepSet) {
+	missing := *deps &^ a.ensured
+	if missing == 0 {
+		return
+	}
+	for i := statDep(0); i < numStatsDeps; i++ {
+		if !missing.has(i) {
+			continue
+		}
+		switch i {
+		case heapStatsDep:
+			a.heapStats.compute()
+		case schedStatsDep:
+			a.schedStats.compute()
+		}
+	}
+	a.ensured |= missing
+}
+
+// metricKind is a runtime copy of runtime/metrics.ValueKind and
+// must be kept structurally identical to that type.
+type metricKind int
+
+const (
+	// These values must be kept identical to their corresponding Kind* values
+	// in the runtime/metrics package.
+	metricKindBad metricKind = iota
+	metricKindUint64
+	metricKindFloat64
+	metricKindFloat64Histogram
+)
+
+// metricSample is a runtime copy of runtime/metrics.Sample and
+// must be kept structurally identical to that type.
+type metricSample struct {
+	name  string
+	value metricValue
+}
+
+// metricValue is a runtime copy of runtime/metrics.Value and
+// must be kept structurally identical to that type.
+type metricValue struct {
+	kind    metricKind
+	scalar  uint64         // contains scalar values for scalar Kinds.
+	pointer unsafe.Pointer // contains non-scalar values.
+}
+
+// float64HistOrInit tries to pull out an existing float64Histogram
+// from the value, but if none exists, then it allocates one with
+// the given buckets.
+func (v *metricValue) float64HistOrInit(buckets []float64) *metricFloat64Histogram {
+	var hist *metricFloat64Histogram
+	if v.kind == metricKindFloat64Histogram && v.pointer != nil {
+		hist = (*metricFloat64Histogram)(v.pointer)
+	} else {
+		v.kind = metricKindFloat64Histogram
+		hist = new(metricFloat64Histogram)
+		v.pointer = unsafe.Pointer(hist)
+	}
+	hist.buckets = buckets
+	if len(hist.counts) != len(hist.buckets)-1 {
+		hist.counts = make([]uint64, len(buckets)-1)
+	}
+	return hist
+}
+
+// metricFloat64Histogram is a runtime copy of runtime/metrics.Float64Histogram
+// and must be kept structurally identical to that type.
+type metricFloat64Histogram struct {
+	counts  []uint64
+	buckets []float64
+}
+
+// agg is used by readMetrics, and is protected by metricsSema.
+//
+// Managed as a global variable because its pointer will be
+// an argument to a dynamically-defined function, and we'd
+// like to avoid it escaping to the heap.
+var agg statAggregate
+
+// readMetrics is the implementation of runtime/metrics.Read.
+//
+//go:linkname readMetrics runtime/metrics.runtime_readMetrics
+func readMetrics(samplesp unsafe.Pointer, len int, cap int) {
+	// Construct a slice from the args.
+	sl := slice{samplesp, len, cap}
+	samples := *(*[]metricSample)(unsafe.Pointer(&sl))
+
+	semacquire(&metricsSema, 0)
+	initMetrics()
+
+	// Clear agg defensively.
+	agg = statAggregate{}
+
+	for i := range samples {
+		sample := &samples[i]
+		data, ok := metrics[sample.name]
+		if !ok {
+			sample.value.kind = metricKindBad
+			continue
+		}
+		// Ensure we have all the stats we need.
+		// agg is populated lazily.
+		agg.ensure(&data.deps)
+
+		// Compute the value based on the stats we have.
+		data.compute(&agg, &sample.value)
+	}
+
+	semrelease(&metricsSema)
+}
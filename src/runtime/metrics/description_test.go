@@ -0,0 +1,80 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"bufio"
+	"os"
+	"runtime/metrics"
+	"strings"
+	"testing"
+)
+
+func TestDescriptionNameFormat(t *testing.T) {
+	for _, desc := range metrics.All() {
+		i := strings.Index(desc.Name, ":")
+		if !strings.HasPrefix(desc.Name, "/") || i < 0 || i != strings.LastIndex(desc.Name, ":") {
+			t.Errorf("metric %q: bad name format", desc.Name)
+			continue
+		}
+		if unit := desc.Name[i+1:]; unit == "" || strings.ContainsAny(unit, " ") {
+			t.Errorf("metric %q: bad unit %q", desc.Name, unit)
+		}
+	}
+}
+
+func TestDescriptionSorted(t *testing.T) {
+	all := metrics.All()
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name >= all[i].Name {
+			t.Errorf("metric %q is listed after %q, want sorted by name", all[i].Name, all[i-1].Name)
+		}
+	}
+}
+
+// TestDescriptionDocs checks that doc.go documents every metric
+// with its description.
+func TestDescriptionDocs(t *testing.T) {
+	f, err := os.Open("doc.go")
+	if err != nil {
+		t.Fatalf("failed to open doc.go: %v", err)
+	}
+	defer f.Close()
+
+	docs := make(map[string]string)
+	var name string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "\t\t"):
+			if name != "" {
+				docs[name] += " " + strings.TrimSpace(line)
+			}
+		case strings.HasPrefix(line, "\t/"):
+			name = strings.TrimSpace(line)
+			docs[name] = ""
+		default:
+			name = ""
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to read doc.go: %v", err)
+	}
+	for _, desc := range metrics.All() {
+		doc, ok := docs[desc.Name]
+		if !ok {
+			t.Errorf("metric %q is not documented in doc.go", desc.Name)
+			continue
+		}
+		if doc = strings.TrimSpace(doc); doc != desc.Description {
+			t.Errorf("metric %q: doc.go has description\n\t%s\nwant\n\t%s", desc.Name, doc, desc.Description)
+		}
+		delete(docs, desc.Name)
+	}
+	for name := range docs {
+		t.Errorf("doc.go documents unknown metric %q", name)
+	}
+}
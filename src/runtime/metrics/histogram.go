@@ -0,0 +1,23 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+// Float64Histogram represents a distribution of float64 values.
+type Float64Histogram struct {
+	// Counts contains the weights for each histogram bucket.
+	//
+	// Given N buckets, Counts[n] is the weight of the range
+	// [Buckets[n], Buckets[n+1]), for 0 <= n < N.
+	Counts []uint64
+
+	// Buckets contains the boundaries of the histogram buckets, in
+	// increasing order. len(Buckets) is always len(Counts)+1.
+	//
+	// For a given metric name, the value of Buckets is guaranteed
+	// not to change between calls until program exit. It may be
+	// shared with the runtime and between calls of Read, so it
+	// must not be modified.
+	Buckets []float64
+}
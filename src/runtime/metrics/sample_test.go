@@ -0,0 +1,182 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+)
+
+func prepareAllMetricsSamples() (map[string]metrics.Description, []metrics.Sample) {
+	all := metrics.All()
+	samples := make([]metrics.Sample, len(all))
+	descs := make(map[string]metrics.Description)
+	for i := range all {
+		samples[i].Name = all[i].Name
+		descs[all[i].Name] = all[i]
+	}
+	return descs, samples
+}
+
+func TestReadMetrics(t *testing.T) {
+	// Run a GC so that the GC metrics are non-zero.
+	runtime.GC()
+
+	var mstats runtime.MemStats
+	runtime.ReadMemStats(&mstats)
+
+	descs, samples := prepareAllMetricsSamples()
+	metrics.Read(samples)
+
+	for i := range samples {
+		name := samples[i].Name
+		v := samples[i].Value
+		if v.Kind() != descs[name].Kind {
+			t.Errorf("metric %q: kind is %v, want %v", name, v.Kind(), descs[name].Kind)
+			continue
+		}
+		switch name {
+		case "/gc/cycles/total:gc-cycles":
+			if v.Uint64() < uint64(mstats.NumGC) {
+				t.Errorf("%s: got %d, want at least %d", name, v.Uint64(), mstats.NumGC)
+			}
+		case "/gc/heap/goal:bytes":
+			if v.Uint64() == 0 {
+				t.Errorf("%s: got zero", name)
+			}
+		case "/gc/pauses:seconds":
+			h := v.Float64Histogram()
+			if len(h.Buckets) != len(h.Counts)+1 {
+				t.Errorf("%s: %d buckets for %d counts", name, len(h.Buckets), len(h.Counts))
+				break
+			}
+			var n uint64
+			for _, c := range h.Counts {
+				n += c
+			}
+			// There is at least one pause per cycle.
+			if n < uint64(mstats.NumGC) {
+				t.Errorf("%s: %d pauses, want at least %d", name, n, mstats.NumGC)
+			}
+			for j := 1; j < len(h.Buckets); j++ {
+				if h.Buckets[j] <= h.Buckets[j-1] {
+					t.Errorf("%s: buckets are not increasing at %d", name, j)
+					break
+				}
+			}
+		case "/memory/classes/total:bytes":
+			if v.Uint64() != mstats.Sys {
+				// Sys may change while reading the
+				// metrics, but not by much.
+				if v.Uint64() < mstats.Sys/2 || v.Uint64() > mstats.Sys*2 {
+					t.Errorf("%s: got %d, want about %d", name, v.Uint64(), mstats.Sys)
+				}
+			}
+		case "/sched/gomaxprocs:threads":
+			if v.Uint64() != uint64(runtime.GOMAXPROCS(-1)) {
+				t.Errorf("%s: got %d, want %d", name, v.Uint64(), runtime.GOMAXPROCS(-1))
+			}
+		case "/sched/goroutines:goroutines":
+			if v.Uint64() == 0 {
+				t.Errorf("%s: got zero", name)
+			}
+		case "/sched/goroutines/running:goroutines":
+			// At least this goroutine is running.
+			if v.Uint64() == 0 {
+				t.Errorf("%s: got zero", name)
+			}
+		}
+	}
+}
+
+func TestReadMetricsSchedLatency(t *testing.T) {
+	// Bounce a value between goroutines so that they are
+	// scheduled many times.
+	c := make(chan int)
+	done := make(chan bool)
+	go func() {
+		for v := range c {
+			c <- v
+		}
+		done <- true
+	}()
+	for i := 0; i < 10000; i++ {
+		c <- i
+		<-c
+	}
+	close(c)
+	<-done
+
+	samples := []metrics.Sample{
+		{Name: "/sched/latencies:seconds"},
+		{Name: "/sched/time/runnable:seconds"},
+		{Name: "/sched/time/running:seconds"},
+	}
+	metrics.Read(samples)
+
+	var n uint64
+	for _, c := range samples[0].Value.Float64Histogram().Counts {
+		n += c
+	}
+	if n == 0 {
+		t.Errorf("%s: no latencies recorded", samples[0].Name)
+	}
+	for _, s := range samples[1:] {
+		if s.Value.Float64() <= 0 {
+			t.Errorf("%s: got %v, want > 0", s.Name, s.Value.Float64())
+		}
+	}
+}
+
+// TestReadMetricsConsistency checks that the metrics that are the
+// sum of others agree with them.
+func TestReadMetricsConsistency(t *testing.T) {
+	_, samples := prepareAllMetricsSamples()
+	metrics.Read(samples)
+
+	var memTotal, memSum, gTotal, gSum uint64
+	for _, s := range samples {
+		switch {
+		case s.Name == "/memory/classes/total:bytes":
+			memTotal = s.Value.Uint64()
+		case strings.HasPrefix(s.Name, "/memory/classes/"):
+			memSum += s.Value.Uint64()
+		case s.Name == "/sched/goroutines:goroutines":
+			gTotal = s.Value.Uint64()
+		case strings.HasPrefix(s.Name, "/sched/goroutines/"):
+			gSum += s.Value.Uint64()
+		}
+	}
+	if memTotal != memSum {
+		t.Errorf("/memory/classes/total:bytes is %d, sum of /memory/classes is %d", memTotal, memSum)
+	}
+	if gTotal != gSum {
+		t.Errorf("/sched/goroutines:goroutines is %d, sum of /sched/goroutines is %d", gTotal, gSum)
+	}
+}
+
+func TestReadMetricsUnknown(t *testing.T) {
+	samples := []metrics.Sample{{Name: "/unknown:units"}}
+	metrics.Read(samples)
+	if k := samples[0].Value.Kind(); k != metrics.KindBad {
+		t.Errorf("unknown metric has kind %v, want KindBad", k)
+	}
+	metrics.Read(nil)
+}
+
+// TestReadMetricsReuse checks that a histogram passed back to Read
+// is reused.
+func TestReadMetricsReuse(t *testing.T) {
+	samples := []metrics.Sample{{Name: "/gc/pauses:seconds"}}
+	metrics.Read(samples)
+	h := samples[0].Value.Float64Histogram()
+	runtime.GC()
+	metrics.Read(samples)
+	if samples[0].Value.Float64Histogram() != h {
+		t.Errorf("Read allocated a new histogram")
+	}
+}
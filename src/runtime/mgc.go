@@ -117,6 +117,14 @@
 // (this mark is tracked in next_gc variable). This keeps the GC cost in linear
 // proportion to the allocation cost. Adjusting GOGC just changes the linear constant
 // (and also the amount of extra memory used).
+//
+// Memory limit.
+// The GOMEMLIMIT environment variable (or debug.SetMemoryLimit) sets a soft limit
+// on the total memory mapped by the runtime. As the memory use nears the limit,
+// the next GC is triggered earlier than GOGC alone would (even with GOGC=off),
+// and the scavenger returns idle heap memory to the OS without waiting for it to
+// age. The limit is soft: if the live heap does not fit, the GC backs off rather
+// than use more than gcCPULimit of the CPU, and the program exceeds the limit.
 
 package runtime
 
@@ -157,6 +165,17 @@ const defaultHeapMinimum = 4 << 20
 // Initialized from $GOGC.  GOGC=off means no GC.
 var gcpercent int32
 
+// memoryLimit is the soft limit on the memory mapped by the runtime,
+// in bytes. Initialized from $GOMEMLIMIT; maxMemoryLimit means no limit.
+var memoryLimit int64 = maxMemoryLimit
+
+const maxMemoryLimit = 1<<63 - 1
+
+// gcCPULimit is the fraction of CPU time spent marking above which
+// the GC relaxes the memory limit, so that a program whose live heap
+// does not fit in the limit does not spend all of its time in GC.
+const gcCPULimit = 0.5
+
 func gcinit() {
 	if unsafe.Sizeof(workbuf{}) != _WorkbufSize {
 		throw("size of Workbuf is suboptimal")
@@ -167,7 +186,8 @@ func gcinit() {
 		datap.gcdatamask = progToPointerMask((*byte)(unsafe.Pointer(datap.gcdata)), datap.edata-datap.data)
 		datap.gcbssmask = progToPointerMask((*byte)(unsafe.Pointer(datap.gcbss)), datap.ebss-datap.bss)
 	}
-	memstats.next_gc = heapminimum
+	memoryLimit = readgomemlimit()
+	gcController.setTrigger(gcController.computeGOGCTrigger())
 	work.startSema = 1
 	work.markDoneSema = 1
 }
@@ -183,12 +203,28 @@ func readgogc() int32 {
 	return int32(atoi(p))
 }
 
+func readgomemlimit() int64 {
+	p := gogetenv("GOMEMLIMIT")
+	if p == "" || p == "off" {
+		return maxMemoryLimit
+	}
+	n, ok := parseByteCount(p)
+	if !ok {
+		print("GOMEMLIMIT=", p, "\n")
+		throw("malformed GOMEMLIMIT; see `go doc runtime/debug.SetMemoryLimit`")
+	}
+	return n
+}
+
 // gcenable is called after the bulk of the runtime initialization,
 // just before we're about to start letting user code run.
-// It kicks off the background sweeper goroutine and enables GC.
+// It kicks off the background sweeper and scavenger goroutines and
+// enables GC.
 func gcenable() {
-	c := make(chan int, 1)
+	c := make(chan int, 2)
 	go bgsweep(c)
+	go bgscavenge(c)
+	<-c
 	<-c
 	memstats.enablegc = true // now that runtime is initialized, GC is okay
 }
@@ -201,9 +237,35 @@ func setGCPercent(in int32) (out int32) {
 		in = -1
 	}
 	gcpercent = in
-	heapminimum = defaultHeapMinimum * uint64(gcpercent) / 100
-	if gcController.triggerRatio > float64(gcpercent)/100 {
-		gcController.triggerRatio = float64(gcpercent) / 100
+	if gcpercent >= 0 {
+		// With GOGC=off, heapminimum and triggerRatio are
+		// unused; leave them as they are for when GOGC is
+		// turned back on.
+		heapminimum = defaultHeapMinimum * uint64(gcpercent) / 100
+		if gcController.triggerRatio > float64(gcpercent)/100 {
+			gcController.triggerRatio = float64(gcpercent) / 100
+		}
+	}
+	// Apply the new GOGC to the next GC right away: if a cycle
+	// ended with GOGC=off, the current trigger is ^uint64(0).
+	if gcphase == _GCoff {
+		gcController.setTrigger(gcController.computeGOGCTrigger())
+	}
+	unlock(&mheap_.lock)
+	return out
+}
+
+//go:linkname setMemoryLimit runtime/debug.setMemoryLimit
+func setMemoryLimit(in int64) (out int64) {
+	lock(&mheap_.lock)
+	out = memoryLimit
+	if in >= 0 {
+		memoryLimit = in
+		// Apply the new limit to the next GC right away:
+		// with GOGC=off, there may be no next GC otherwise.
+		if gcphase == _GCoff {
+			gcController.setTrigger(gcController.gogcTrigger)
+		}
 	}
 	unlock(&mheap_.lock)
 	return out
@@ -383,6 +445,19 @@ type gcControllerState struct {
 	// at the end of of each cycle.
 	triggerRatio float64
 
+	// gogcTrigger is the trigger heap size computed from GOGC at
+	// the end of the last cycle, before applying the memory limit.
+	gogcTrigger uint64
+
+	// limitSlack is added to the heap goal of the memory limit
+	// while the GC uses too much CPU to meet the limit. It is
+	// updated at the end of each cycle.
+	limitSlack uint64
+
+	// lastMarkDone is the time the previous concurrent mark
+	// phase ended.
+	lastMarkDone int64
+
 	_ [sys.CacheLineSize]byte
 
 	// fractionalMarkWorkersNeeded is the number of fractional
@@ -410,13 +485,13 @@ func (c *gcControllerState) startCycle() {
 	// real heap_marked may not have a meaningful value (on the
 	// first cycle) or may be much smaller (resulting in a large
 	// error response).
-	if memstats.next_gc <= heapminimum {
+	if memstats.next_gc <= heapminimum && gcpercent >= 0 {
 		memstats.heap_marked = uint64(float64(memstats.next_gc) / (1 + c.triggerRatio))
 		memstats.heap_reachable = memstats.heap_marked
 	}
 
-	// Compute the heap goal for this cycle
-	c.heapGoal = memstats.heap_reachable + memstats.heap_reachable*uint64(gcpercent)/100
+	// Compute the heap goal for this cycle.
+	c.heapGoal = c.computeHeapGoal()
 
 	// Ensure that the heap goal is at least a little larger than
 	// the current live heap size. This may not be the case if GC
@@ -518,6 +593,40 @@ func (c *gcControllerState) revise() {
 // endCycle updates the GC controller state at the end of the
 // concurrent part of the GC cycle.
 func (c *gcControllerState) endCycle() {
+	// Relax the memory limit if marking used more than
+	// gcCPULimit of the CPU time since the previous mark phase
+	// ended, and tighten it again once the GC backs off.
+	now := nanotime()
+	if c.lastMarkDone != 0 && now > c.lastMarkDone {
+		markTime := c.assistTime + c.dedicatedMarkTime + c.fractionalMarkTime
+		utilization := float64(markTime) / float64((now-c.lastMarkDone)*int64(gomaxprocs))
+		if utilization > gcCPULimit {
+			c.limitSlack *= 2
+			if c.limitSlack < defaultHeapMinimum {
+				c.limitSlack = defaultHeapMinimum
+			}
+			// Bound the slack by the larger of the limit
+			// and the heap: past that, more slack no longer
+			// changes how often the GC runs, and the goal
+			// could overflow.
+			max := uint64(memoryLimit)
+			if max < memstats.heap_live {
+				max = memstats.heap_live
+			}
+			if c.limitSlack > max {
+				c.limitSlack = max
+			}
+		} else if utilization < gcCPULimit/2 {
+			c.limitSlack /= 2
+		}
+	}
+	c.lastMarkDone = now
+
+	if gcpercent < 0 {
+		// There is no GOGC trigger to adjust.
+		return
+	}
+
 	h_t := c.triggerRatio // For debugging
 
 	// Proportional response gain for the trigger controller. Must
@@ -591,6 +700,99 @@ func (c *gcControllerState) endCycle() {
 	}
 }
 
+// setTrigger sets memstats.next_gc to gogcTrigger, the trigger
+// computed from GOGC, lowered if necessary to keep the heap under the
+// memory limit. The caller must hold mheap_.lock or stop the world.
+func (c *gcControllerState) setTrigger(gogcTrigger uint64) {
+	c.gogcTrigger = gogcTrigger
+	trigger := gogcTrigger
+	if goal := c.memoryLimitGoal(); goal != ^uint64(0) {
+		// Leave the cycle an eighth of the heap growth up to
+		// the goal, as the initial GOGC trigger ratio does.
+		limitTrigger := memstats.heap_marked
+		if goal > limitTrigger {
+			limitTrigger += (goal - limitTrigger) / 8 * 7
+		}
+		if limitTrigger < trigger {
+			trigger = limitTrigger
+		}
+	}
+
+	minTrigger := memstats.heap_live + sweepMinHeapDistance
+	if gcpercent >= 0 {
+		minTrigger = memstats.heap_live + sweepMinHeapDistance*uint64(gcpercent)/100
+	}
+	if trigger < minTrigger {
+		// The allocated heap is already past the trigger.
+		// This can happen if the triggerRatio is very low and
+		// the reachable heap estimate is less than the live
+		// heap size, or if the heap is near the memory limit.
+		//
+		// Concurrent sweep happens in the heap growth from
+		// heap_live to next_gc, so bump next_gc up to ensure
+		// that concurrent sweep has some heap growth in which
+		// to perform sweeping before we start the next GC
+		// cycle.
+		trigger = minTrigger
+	}
+	memstats.next_gc = trigger
+}
+
+// computeGOGCTrigger returns the heap size at which GOGC triggers the
+// next cycle given the current heap_reachable, before applying the
+// memory limit. It returns ^uint64(0) if GOGC=off.
+func (c *gcControllerState) computeGOGCTrigger() uint64 {
+	if gcpercent < 0 {
+		return ^uint64(0)
+	}
+	trigger := uint64(float64(memstats.heap_reachable) * (1 + c.triggerRatio))
+	if trigger < heapminimum {
+		trigger = heapminimum
+	}
+	return trigger
+}
+
+// computeHeapGoal returns the heap goal for a cycle that starts with
+// the current heap_reachable. The memory limit takes precedence over
+// GOGC. It returns ^uint64(0) if there is no goal.
+func (c *gcControllerState) computeHeapGoal() uint64 {
+	goal := ^uint64(0)
+	if gcpercent >= 0 {
+		goal = memstats.heap_reachable + memstats.heap_reachable*uint64(gcpercent)/100
+	}
+	if limitGoal := c.memoryLimitGoal(); limitGoal < goal {
+		goal = limitGoal
+	}
+	return goal
+}
+
+// memoryLimitGoal returns the heap_live at which the memory mapped
+// by the runtime reaches the memory limit, or ^uint64(0) if there is
+// no limit.
+func (c *gcControllerState) memoryLimitGoal() uint64 {
+	if memoryLimit == maxMemoryLimit {
+		return ^uint64(0)
+	}
+	// Leave a margin for fragmentation and for memory that is
+	// allocated outside the heap between GC cycles.
+	limit := uint64(memoryLimit)
+	limit -= limit / 20
+	// Idle heap memory does not count against the goal: the heap
+	// grows into it, and the scavenger returns the rest to the OS.
+	overhead := memstats.stacks_inuse + memstats.stacks_sys + memstats.mspan_sys +
+		memstats.mcache_sys + memstats.buckhash_sys + memstats.gc_sys + memstats.other_sys
+	var goal uint64
+	if limit > overhead {
+		goal = limit - overhead
+	}
+	if goal+c.limitSlack < goal {
+		// Saturate rather than wrap to a tiny goal;
+		// ^uint64(0) itself means there is no limit.
+		return ^uint64(0) - 1
+	}
+	return goal + c.limitSlack
+}
+
 // enlistWorker encourages another dedicated mark worker to start on
 // another P if there are spare worker slots. It is used by putfull
 // when more work is made available.
@@ -834,6 +1036,10 @@ var work struct {
 	heap0, heap1, heap2, heapGoal uint64
 }
 
+// gcPauseDist records the distribution of stop-the-world pauses
+// of the GC, for runtime/metrics.
+var gcPauseDist timeHistogram
+
 // GC runs a garbage collection and blocks the caller until the
 // garbage collection is complete. It may also block the entire
 // program.
@@ -857,7 +1063,7 @@ const (
 // If forceTrigger is true, it ignores the current heap size, but
 // checks all other conditions. In general this should be false.
 func gcShouldStart(forceTrigger bool) bool {
-	return gcphase == _GCoff && (forceTrigger || memstats.heap_live >= memstats.next_gc) && memstats.enablegc && panicking == 0 && gcpercent >= 0
+	return gcphase == _GCoff && (forceTrigger || memstats.heap_live >= memstats.next_gc) && memstats.enablegc && panicking == 0 && (gcpercent >= 0 || memoryLimit != maxMemoryLimit)
 }
 
 // gcStart transitions the GC from _GCoff to _GCmark (if mode ==
@@ -903,7 +1109,7 @@ func gcStart(mode gcMode, forceTrigger bool) {
 	// another thread.
 	useStartSema := mode == gcBackgroundMode
 	if useStartSema {
-		semacquire(&work.startSema, false)
+		semacquire(&work.startSema, 0)
 		// Re-check transition condition under transition lock.
 		if !gcShouldStart(forceTrigger) {
 			semrelease(&work.startSema)
@@ -924,7 +1130,7 @@ func gcStart(mode gcMode, forceTrigger bool) {
 	}
 
 	// Ok, we're doing it!  Stop everybody else
-	semacquire(&worldsema, false)
+	semacquire(&worldsema, 0)
 
 	if trace.enabled {
 		traceGCStart()
@@ -1008,6 +1214,7 @@ func gcStart(mode gcMode, forceTrigger bool) {
 		systemstack(startTheWorldWithSema)
 		now = nanotime()
 		work.pauseNS += now - work.pauseStart
+		gcPauseDist.record(now - work.pauseStart)
 		work.tMark = now
 	} else {
 		t := nanotime()
@@ -1040,7 +1247,7 @@ func gcStart(mode gcMode, forceTrigger bool) {
 // by mark termination.
 func gcMarkDone() {
 top:
-	semacquire(&work.markDoneSema, false)
+	semacquire(&work.markDoneSema, 0)
 
 	// Re-check transition condition under transition lock.
 	if !(gcphase == _GCmark && work.nwait == work.nproc && !gcMarkWorkAvailable(nil)) {
@@ -1232,6 +1439,7 @@ func gcMarkTermination() {
 	// Update timing memstats
 	now, unixNow := nanotime(), unixnanotime()
 	work.pauseNS += now - work.pauseStart
+	gcPauseDist.record(now - work.pauseStart)
 	work.tEnd = now
 	atomic.Store64(&memstats.last_gc, uint64(unixNow)) // must be Unix time to make sense to user
 	memstats.pause_ns[memstats.numgc%uint32(len(memstats.pause_ns))] = uint64(work.pauseNS)
@@ -1611,12 +1819,9 @@ func gcMark(start_time int64) {
 	// by triggerRatio over the reachable heap size. Assume that
 	// we're in steady state, so the reachable heap size is the
 	// same now as it was at the beginning of the GC cycle.
-	memstats.next_gc = uint64(float64(memstats.heap_reachable) * (1 + gcController.triggerRatio))
-	if memstats.next_gc < heapminimum {
-		memstats.next_gc = heapminimum
-	}
-	if int64(memstats.next_gc) < 0 {
-		print("next_gc=", memstats.next_gc, " bytesMarked=", work.bytesMarked, " heap_live=", memstats.heap_live, " initialHeapLive=", work.initialHeapLive, "\n")
+	trigger := gcController.computeGOGCTrigger()
+	if gcpercent >= 0 && int64(trigger) < 0 {
+		print("next_gc=", trigger, " bytesMarked=", work.bytesMarked, " heap_live=", memstats.heap_live, " initialHeapLive=", work.initialHeapLive, "\n")
 		throw("next_gc underflow")
 	}
 
@@ -1627,20 +1832,7 @@ func gcMark(start_time int64) {
 	memstats.heap_marked = work.bytesMarked
 	memstats.heap_scan = uint64(gcController.scanWork)
 
-	minNextGC := memstats.heap_live + sweepMinHeapDistance*uint64(gcpercent)/100
-	if memstats.next_gc < minNextGC {
-		// The allocated heap is already past the trigger.
-		// This can happen if the triggerRatio is very low and
-		// the reachable heap estimate is less than the live
-		// heap size.
-		//
-		// Concurrent sweep happens in the heap growth from
-		// heap_live to next_gc, so bump next_gc up to ensure
-		// that concurrent sweep has some heap growth in which
-		// to perform sweeping before we start the next GC
-		// cycle.
-		memstats.next_gc = minNextGC
-	}
+	gcController.setTrigger(trigger)
 
 	if trace.enabled {
 		traceHeapAlloc()
@@ -1660,6 +1852,10 @@ func gcSweep(mode gcMode) {
 	sweep.spanidx = 0
 	unlock(&mheap_.lock)
 
+	// The scavenger releases the memory swept spans free
+	// concurrently with sweeping.
+	gcSetScavengeGoal()
+
 	if !_ConcurrentSweep || mode == gcForceBlockMode {
 		// Special case synchronous sweep.
 		// Record that no proportional sweeping has to happen.
@@ -650,14 +650,30 @@ func scanstack(gp *g) {
 	var cache pcvalueCache
 	gcw := &getg().m.p.ptr().gcw
 	n := 0
+	// If gp is stopped at an asynchronous safe point, the frame of
+	// asyncPreempt, which holds the saved registers, and the frame
+	// it interrupted have no stack maps. Scan them conservatively,
+	// and don't install stack barriers in them, since they don't
+	// return normally.
+	conservative := false
 	scanframe := func(frame *stkframe, unused unsafe.Pointer) bool {
-		scanframeworker(frame, &cache, gcw)
+		isAsyncPreempt := frame.fn.entry == asyncPreemptPC
+		inAsync := conservative || isAsyncPreempt
+		if inAsync {
+			scanConservative(frame.sp, frame.fp-frame.sp, gcw)
+			if frame.arglen != 0 {
+				scanConservative(frame.argp, frame.arglen, gcw)
+			}
+		} else {
+			scanframeworker(frame, &cache, gcw)
+		}
+		conservative = isAsyncPreempt
 
 		if frame.fp > nextBarrier {
 			// We skip installing a barrier on bottom-most
 			// frame because on LR machines this LR is not
 			// on the stack.
-			if gcphase == _GCmark && n != 0 {
+			if gcphase == _GCmark && n != 0 && !inAsync {
 				if gcInstallStackBarrier(gp, frame) {
 					barrierOffset *= 2
 					nextBarrier = sp + barrierOffset
@@ -948,6 +964,76 @@ func scanblock(b0, n0 uintptr, ptrmask *uint8, gcw *gcWork) {
 	}
 }
 
+// scanConservative scans block [b, b+n) conservatively, treating
+// any pointer-aligned word that points into an allocated span as a
+// pointer to the object containing it.
+//go:nowritebarrier
+func scanConservative(b, n uintptr, gcw *gcWork) {
+	arena_start := mheap_.arena_start
+	arena_used := mheap_.arena_used
+
+	for i := uintptr(0); i < n; i += sys.PtrSize {
+		val := *(*uintptr)(unsafe.Pointer(b + i))
+		if val < arena_start || val >= arena_used {
+			continue
+		}
+		// Any word may look like a heap pointer here, so
+		// check the span before heapBitsForObject, which
+		// rejects pointers to free spans loudly.
+		s := h_spans[(val-arena_start)>>_PageShift]
+		if s == nil || s.state != mSpanInUse || val < s.base() || val >= s.limit {
+			continue
+		}
+		obj, hbits, span := heapBitsForObject(val, b, i)
+		if obj == 0 || span.isFree(obj) {
+			// A stale pointer to a free slot: its contents
+			// are garbage and must not be scanned.
+			continue
+		}
+		greyobject(obj, b, i, hbits, span, gcw)
+	}
+}
+
+// isFree reports whether obj, the start of an object in the in-use
+// span s, is on s's free list.
+//
+// It does not lock s, so another P may be allocating from s
+// concurrently and overwriting the links of the objects it takes.
+// During the mark phase the free list only shrinks from its head
+// (sweeping is done), so if the head is the same after the walk as
+// before it, every link the walk followed was still a free object.
+// This relies on the ordering of loads and stores on amd64, the only
+// architecture that scans stacks conservatively (see preempt.go).
+func (s *mspan) isFree(obj uintptr) bool {
+	if s.sizeclass == 0 {
+		// A large object span holds a single allocated object.
+		return false
+	}
+	head := (*uintptr)(unsafe.Pointer(&s.freelist))
+	nelems := (s.limit - s.base()) / s.elemsize
+	for {
+		first := atomic.Loaduintptr(head)
+		found := false
+		link := gclinkptr(first)
+		for n := uintptr(0); link != 0 && n < nelems; n++ {
+			if uintptr(link) < s.base() || uintptr(link) >= s.limit {
+				// A link overwritten by a racing allocation.
+				break
+			}
+			if uintptr(link) == obj {
+				found = true
+				break
+			}
+			link = link.ptr().next
+		}
+		if atomic.Loaduintptr(head) == first {
+			return found
+		}
+		// An object was allocated from s during the walk. Retry:
+		// s has finitely many free objects to allocate.
+	}
+}
+
 // scanobject scans the object starting at b, adding pointers to gcw.
 // b must point to the beginning of a heap object; scanobject consults
 // the GC bitmap for the pointer mask and the spans for the size of the
@@ -0,0 +1,201 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Garbage collector: background scavenging
+//
+// The background scavenger returns free heap memory to the OS so that
+// the memory retained by the heap (heap_sys - heap_released) follows
+// the heap goal down after the heap shrinks, instead of staying at
+// its peak until sysmon finds spans that have been unused for five
+// minutes.
+//
+// At the end of each GC, gcSweep sets the retained goal to
+// retainExtraPercent above the next GC trigger and wakes the
+// scavenger. The scavenger releases one free span at a time, preferring
+// spans not much larger than scavengeChunkPages, and sleeps after each
+// span in proportion to its size so that it releases at most about
+// 64 MB per second. Releasing memory a little at a time keeps the
+// scavenger off the heap lock and avoids a burst of page faults if the
+// heap grows again. The scavenger parks once the heap retains no more
+// than the goal.
+//
+// sysmon's scavenger and scavengeLimit still release memory that has
+// gone unused for a long time or that puts the program over its
+// memory limit.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"runtime/internal/sys"
+)
+
+var scavenge scavengedata
+
+// State of background scavenge.
+type scavengedata struct {
+	lock   mutex
+	g      *g
+	parked bool
+
+	// gen is incremented every time gcSweep sets goal. Protected
+	// by lock.
+	gen uint32
+
+	// goal is the number of bytes the heap may retain before the
+	// background scavenger releases memory. Protected by
+	// mheap_.lock.
+	goal uint64
+}
+
+const (
+	// retainExtraPercent is how much memory, as a percentage of
+	// the next GC trigger, the heap may retain on top of the
+	// trigger. It leaves the heap room to grow without faulting
+	// in released pages straight away.
+	retainExtraPercent = 10
+
+	// scavengeChunkPages is the most pages the background
+	// scavenger aims to release at a time.
+	scavengeChunkPages = (64 << 10) >> _PageShift
+
+	// scavengeChunkPeriod is the time in nanoseconds the
+	// background scavenger sleeps after releasing a full chunk.
+	scavengeChunkPeriod = 1e6
+)
+
+// gcSetScavengeGoal sets the background scavenger's goal from the
+// next GC trigger and wakes the scavenger. It is called by gcSweep.
+func gcSetScavengeGoal() {
+	lock(&mheap_.lock)
+	goal := memstats.next_gc + memstats.next_gc/100*retainExtraPercent
+	if goal < memstats.next_gc {
+		// With GOGC=off and no memory limit, next_gc is
+		// ^uint64(0). There is no goal to scavenge toward.
+		goal = ^uint64(0)
+	}
+	scavenge.goal = goal
+	unlock(&mheap_.lock)
+
+	lock(&scavenge.lock)
+	scavenge.gen++
+	if scavenge.parked {
+		scavenge.parked = false
+		ready(scavenge.g, 0)
+	}
+	unlock(&scavenge.lock)
+}
+
+func bgscavenge(c chan int) {
+	scavenge.g = getg()
+
+	lock(&scavenge.lock)
+	scavenge.parked = true
+	c <- 1
+	goparkunlock(&scavenge.lock, "GC scavenge wait", traceEvGoBlock, 1)
+
+	for {
+		lock(&scavenge.lock)
+		gen := scavenge.gen
+		unlock(&scavenge.lock)
+
+		var released, total uintptr
+		for {
+			var over bool
+			systemstack(func() {
+				lock(&mheap_.lock)
+				released = mheap_.scavengeChunk(scavenge.goal)
+				over = heapRetained() > scavenge.goal
+				unlock(&mheap_.lock)
+			})
+			if released == 0 {
+				if over && atomic.Load(&mheap_.sweepdone) == 0 {
+					// Sweeping may yet free spans we
+					// can release.
+					timeSleep(scavengeChunkPeriod)
+					continue
+				}
+				break
+			}
+			total += released
+			timeSleep(scavengeChunkPeriod * int64(released) / (scavengeChunkPages << _PageShift))
+		}
+
+		if debug.scavtrace > 0 && total > 0 {
+			systemstack(func() {
+				lock(&mheap_.lock)
+				print("scav ", gen, ": ", total>>10, " KB released, ",
+					heapRetained()>>20, " MB retained, ",
+					scavenge.goal>>20, " MB goal, ",
+					memstats.heap_released>>20, " MB released to OS\n")
+				unlock(&mheap_.lock)
+			})
+		}
+
+		lock(&scavenge.lock)
+		if scavenge.gen != gen {
+			// The goal changed while we were
+			// scavenging. Check it again.
+			unlock(&scavenge.lock)
+			continue
+		}
+		scavenge.parked = true
+		goparkunlock(&scavenge.lock, "GC scavenge wait", traceEvGoBlock, 1)
+	}
+}
+
+// heapRetained returns the heap memory obtained from the OS that has
+// not been released back to it.
+func heapRetained() uint64 {
+	return memstats.heap_sys - memstats.heap_released
+}
+
+// scavengeChunk releases a free span to the OS if the heap retains
+// more than goal bytes, and returns the number of bytes released.
+// h.lock must be held.
+//
+// It releases whole spans, so that npreleased counts exactly the pages
+// of a span that are released to the OS, even after spans coalesce.
+// To release little more than it needs to, it picks a span from the
+// smallest free list that has one whose unreleased pages cover the
+// excess (capped at scavengeChunkPages), and otherwise the span with
+// the most unreleased pages.
+func (h *mheap) scavengeChunk(goal uint64) uintptr {
+	if sys.PhysPageSize > _PageSize {
+		// See scavengelist.
+		return 0
+	}
+	retained := heapRetained()
+	if retained <= goal {
+		return 0
+	}
+	npages := uintptr(retained-goal+_PageSize-1) >> _PageShift
+	if npages > scavengeChunkPages {
+		npages = scavengeChunkPages
+	}
+	var fit, most *mspan
+	var nfit, nmost uintptr
+	for i := 1; i <= len(h.free) && fit == nil; i++ {
+		list := &h.freelarge
+		if i < len(h.free) {
+			list = &h.free[i]
+		}
+		for s := list.first; s != nil; s = s.next {
+			n := s.npages - s.npreleased
+			if n >= npages && (fit == nil || n < nfit) {
+				fit, nfit = s, n
+			}
+			if n > nmost {
+				most, nmost = s, n
+			}
+		}
+	}
+	if fit != nil {
+		return scavengeSpan(fit)
+	}
+	if most != nil {
+		return scavengeSpan(most)
+	}
+	return 0
+}
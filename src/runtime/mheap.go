@@ -45,6 +45,10 @@ type mheap struct {
 	nlargefree uint64                  // number of frees for large objects (>maxsmallsize)
 	nsmallfree [_NumSizeClasses]uint64 // number of frees for small objects (<=maxsmallsize)
 
+	// lastLimitScavenge is the time allocSpanLocked last called
+	// scavengeLimit after growing the heap. Protected by lock.
+	lastLimitScavenge int64
+
 	// range of addresses we might see in the heap
 	bitmap         uintptr
 	bitmap_mapped  uintptr
@@ -536,6 +540,7 @@ func (h *mheap) allocStack(npage uintptr) *mspan {
 func (h *mheap) allocSpanLocked(npage uintptr) *mspan {
 	var list *mSpanList
 	var s *mspan
+	grew := false
 
 	// Try in fixed-size lists up to max.
 	for i := int(npage); i < len(h.free); i++ {
@@ -557,6 +562,7 @@ func (h *mheap) allocSpanLocked(npage uintptr) *mspan {
 		if s == nil {
 			return nil
 		}
+		grew = true
 	}
 
 HaveSpan:
@@ -610,6 +616,16 @@ HaveSpan:
 	if s.inList() {
 		throw("still in list")
 	}
+	if grew && overMemoryLimit() {
+		// The heap may now be over the memory limit.
+		// Make up for it with idle memory, if any. While the
+		// heap stays over the limit, scavengeLimit walks all
+		// the free lists, so don't call it on every growth.
+		if now := nanotime(); now-h.lastLimitScavenge >= limitScavengePeriod {
+			h.lastLimitScavenge = now
+			h.scavengeLimit()
+		}
+	}
 	return s
 }
 
@@ -839,12 +855,8 @@ func scavengelist(list *mSpanList, now, limit uint64) uintptr {
 
 	var sumreleased uintptr
 	for s := list.first; s != nil; s = s.next {
-		if (now-uint64(s.unusedsince)) > limit && s.npreleased != s.npages {
-			released := (s.npages - s.npreleased) << _PageShift
-			memstats.heap_released += uint64(released)
-			sumreleased += released
-			s.npreleased = s.npages
-			sysUnused(unsafe.Pointer(s.start<<_PageShift), s.npages<<_PageShift)
+		if (now - uint64(s.unusedsince)) > limit {
+			sumreleased += scavengeSpan(s)
 		}
 	}
 	return sumreleased
@@ -869,6 +881,59 @@ func (h *mheap) scavenge(k int32, now, limit uint64) {
 	}
 }
 
+// mappedReady returns the memory mapped by the runtime, minus heap
+// memory returned to the OS. This is what the memory limit limits.
+func mappedReady() uint64 {
+	return memstats.heap_sys - memstats.heap_released + memstats.stacks_sys + memstats.mspan_sys +
+		memstats.mcache_sys + memstats.buckhash_sys + memstats.gc_sys + memstats.other_sys
+}
+
+// overMemoryLimit reports whether the memory mapped by the runtime
+// exceeds the memory limit, less the margin left by the GC.
+// It does not lock the heap, so the result is approximate.
+func overMemoryLimit() bool {
+	limit := memoryLimit
+	return limit != maxMemoryLimit && mappedReady() > uint64(limit-limit/20)
+}
+
+// limitScavengePeriod is the minimum time in nanoseconds between
+// calls to scavengeLimit when the heap grows.
+const limitScavengePeriod = 1e6
+
+// scavengeLimit returns idle heap memory to the OS, regardless of how
+// long it has been unused, until the memory mapped by the runtime is
+// under the memory limit (see memoryLimitGoal). h.lock must be held.
+func (h *mheap) scavengeLimit() {
+	if !overMemoryLimit() || sys.PhysPageSize > _PageSize {
+		// See scavengelist for the page size check.
+		return
+	}
+	// Release the largest spans first, to fragment the heap
+	// into as few mappings as possible.
+	for s := h.freelarge.first; s != nil && overMemoryLimit(); s = s.next {
+		scavengeSpan(s)
+	}
+	for i := len(h.free) - 1; i > 0 && overMemoryLimit(); i-- {
+		for s := h.free[i].first; s != nil && overMemoryLimit(); s = s.next {
+			scavengeSpan(s)
+		}
+	}
+}
+
+// scavengeSpan returns the pages of the free span s to the OS.
+// mheap_.lock must be held.
+func scavengeSpan(s *mspan) uintptr {
+	if s.npreleased == s.npages {
+		return 0
+	}
+	released := (s.npages - s.npreleased) << _PageShift
+	memstats.heap_released += uint64(released)
+	memstats.total_released += uint64(released)
+	s.npreleased = s.npages
+	sysUnused(unsafe.Pointer(s.start<<_PageShift), s.npages<<_PageShift)
+	return released
+}
+
 //go:linkname runtime_debug_freeOSMemory runtime/debug.freeOSMemory
 func runtime_debug_freeOSMemory() {
 	gcStart(gcForceBlockMode, false)
@@ -22,6 +22,8 @@ const (
 	// profile types
 	memProfile bucketType = 1 + iota
 	blockProfile
+	mutexProfile
+	schedLatencyProfile
 
 	// size of bucket hash table
 	buckHashSize = 179999
@@ -83,7 +85,9 @@ type memRecord struct {
 }
 
 // A blockRecord is the bucket data for a bucket of type blockProfile,
-// part of the blocking profile.
+// part of the blocking profile, of type mutexProfile, part of the
+// mutex contention profile, or of type schedLatencyProfile, part of
+// the scheduling latency profile.
 type blockRecord struct {
 	count  int64
 	cycles int64
@@ -92,6 +96,8 @@ type blockRecord struct {
 var (
 	mbuckets  *bucket // memory profile buckets
 	bbuckets  *bucket // blocking profile buckets
+	xbuckets  *bucket // mutex profile buckets
+	sbuckets  *bucket // scheduling latency profile buckets
 	buckhash  *[179999]*bucket
 	bucketmem uintptr
 )
@@ -104,7 +110,7 @@ func newBucket(typ bucketType, nstk int) *bucket {
 		throw("invalid profile bucket type")
 	case memProfile:
 		size += unsafe.Sizeof(memRecord{})
-	case blockProfile:
+	case blockProfile, mutexProfile, schedLatencyProfile:
 		size += unsafe.Sizeof(blockRecord{})
 	}
 
@@ -130,9 +136,10 @@ func (b *bucket) mp() *memRecord {
 	return (*memRecord)(data)
 }
 
-// bp returns the blockRecord associated with the blockProfile bucket b.
+// bp returns the blockRecord associated with the blockProfile,
+// mutexProfile or schedLatencyProfile bucket b.
 func (b *bucket) bp() *blockRecord {
-	if b.typ != blockProfile {
+	if b.typ != blockProfile && b.typ != mutexProfile && b.typ != schedLatencyProfile {
 		throw("bad use of bucket.bp")
 	}
 	data := add(unsafe.Pointer(b), unsafe.Sizeof(*b)+b.nstk*unsafe.Sizeof(uintptr(0)))
@@ -181,10 +188,17 @@ func stkbucket(typ bucketType, size uintptr, stk []uintptr, alloc bool) *bucket
 	b.size = size
 	b.next = buckhash[i]
 	buckhash[i] = b
-	if typ == memProfile {
+	switch typ {
+	case memProfile:
 		b.allnext = mbuckets
 		mbuckets = b
-	} else {
+	case mutexProfile:
+		b.allnext = xbuckets
+		xbuckets = b
+	case schedLatencyProfile:
+		b.allnext = sbuckets
+		sbuckets = b
+	default:
 		b.allnext = bbuckets
 		bbuckets = b
 	}
@@ -292,6 +306,12 @@ func blockevent(cycles int64, skip int) {
 	if rate <= 0 || (rate > cycles && int64(fastrand1())%rate > cycles) {
 		return
 	}
+	saveblockevent(cycles, skip+1, blockProfile)
+}
+
+// saveblockevent records a blocking or contention event of the given
+// duration in the profile of type which, charged to the caller's stack.
+func saveblockevent(cycles int64, skip int, which bucketType) {
 	gp := getg()
 	var nstk int
 	var stk [maxStack]uintptr
@@ -301,12 +321,88 @@ func blockevent(cycles int64, skip int) {
 		nstk = gcallers(gp.m.curg, skip, stk[:])
 	}
 	lock(&proflock)
-	b := stkbucket(blockProfile, 0, stk[:nstk], true)
+	b := stkbucket(which, 0, stk[:nstk], true)
 	b.bp().count++
 	b.bp().cycles += cycles
 	unlock(&proflock)
 }
 
+var mutexprofilerate uint64 // fraction sampled
+
+// SetMutexProfileFraction controls the fraction of mutex contention events
+// that are reported in the mutex profile. On average 1/rate events are
+// reported. The previous rate is returned.
+//
+// To turn off profiling entirely, pass rate 0.
+// To just read the current rate, pass rate -1.
+// (For n>1 the details of sampling may change.)
+func SetMutexProfileFraction(rate int) int {
+	if rate < 0 {
+		return int(atomic.Load64(&mutexprofilerate))
+	}
+	old := atomic.Xchg64(&mutexprofilerate, uint64(rate))
+	return int(old)
+}
+
+// mutexevent records that the calling goroutine released a sync.Mutex
+// for which other goroutines had been waiting for the given number of
+// cycles.
+func mutexevent(cycles int64, skip int) {
+	if cycles < 0 {
+		cycles = 0
+	}
+	rate := int64(atomic.Load64(&mutexprofilerate))
+	if rate > 0 && int64(fastrand1())%rate == 0 {
+		saveblockevent(cycles, skip+1, mutexProfile)
+	}
+}
+
+var schedlatencyprofilerate uint64 // in nanoseconds
+
+// SetSchedLatencyProfileRate controls the fraction of scheduling latency
+// events that are reported in the scheduling latency profile. A scheduling
+// latency event is the time a goroutine spends ready to run before it
+// starts running. The profiler aims to sample an average of one event per
+// rate nanoseconds goroutines spend waiting to run. The previous rate is
+// returned.
+//
+// The runtime only measures the scheduling latency of a fraction of
+// scheduling events, so not every event is a candidate for the profile.
+// The profile scales its counts and delays to account for this.
+//
+// To include every measured event in the profile, pass rate = 1.
+// To turn off profiling entirely, pass rate 0.
+// To just read the current rate, pass rate -1.
+func SetSchedLatencyProfileRate(rate int) int {
+	if rate < 0 {
+		return int(atomic.Load64(&schedlatencyprofilerate))
+	}
+	old := atomic.Xchg64(&schedlatencyprofilerate, uint64(rate))
+	return int(old)
+}
+
+// schedlatencyevent records that gp waited lat nanoseconds to run,
+// charged to the stack gp resumes running at. It is called by execute
+// for the scheduling cycles measured by trackSchedTime.
+func schedlatencyevent(gp *g, lat int64) {
+	if lat <= 0 {
+		lat = 1
+	}
+	rate := int64(atomic.Load64(&schedlatencyprofilerate))
+	if rate <= 0 || (rate > lat && int64(fastrand1())%rate > lat) {
+		return
+	}
+	var stk [maxStack]uintptr
+	nstk := gentraceback(^uintptr(0), ^uintptr(0), 0, gp, 0, &stk[0], len(stk), nil, nil, 0)
+	// convert ns to cycles, use float64 to prevent overflow during multiplication
+	cycles := int64(float64(lat) * float64(tickspersecond()) / (1000 * 1000 * 1000))
+	lock(&proflock)
+	b := stkbucket(schedLatencyProfile, 0, stk[:nstk], true)
+	b.bp().count += gTrackingPeriod
+	b.bp().cycles += cycles * gTrackingPeriod
+	unlock(&proflock)
+}
+
 // Go interface to profile data.
 
 // A StackRecord describes a single execution stack.
@@ -491,6 +587,68 @@ func BlockProfile(p []BlockProfileRecord) (n int, ok bool) {
 	return
 }
 
+// MutexProfile returns n, the number of records in the current mutex profile.
+// If len(p) >= n, MutexProfile copies the profile into p and returns n, true.
+// Otherwise, MutexProfile does not change p, and returns n, false.
+//
+// Most clients should use the runtime/pprof package
+// instead of calling MutexProfile directly.
+func MutexProfile(p []BlockProfileRecord) (n int, ok bool) {
+	lock(&proflock)
+	for b := xbuckets; b != nil; b = b.allnext {
+		n++
+	}
+	if n <= len(p) {
+		ok = true
+		for b := xbuckets; b != nil; b = b.allnext {
+			bp := b.bp()
+			r := &p[0]
+			r.Count = int64(bp.count)
+			r.Cycles = bp.cycles
+			i := copy(r.Stack0[:], b.stk())
+			for ; i < len(r.Stack0); i++ {
+				r.Stack0[i] = 0
+			}
+			p = p[1:]
+		}
+	}
+	unlock(&proflock)
+	return
+}
+
+// SchedLatencyProfile returns n, the number of records in the current
+// scheduling latency profile. If len(p) >= n, SchedLatencyProfile copies the
+// profile into p and returns n, true. Otherwise, SchedLatencyProfile does not
+// change p, and returns n, false.
+//
+// Each record is charged to the stack at which goroutines resumed running
+// after waiting to be scheduled.
+//
+// Most clients should use the runtime/pprof package
+// instead of calling SchedLatencyProfile directly.
+func SchedLatencyProfile(p []BlockProfileRecord) (n int, ok bool) {
+	lock(&proflock)
+	for b := sbuckets; b != nil; b = b.allnext {
+		n++
+	}
+	if n <= len(p) {
+		ok = true
+		for b := sbuckets; b != nil; b = b.allnext {
+			bp := b.bp()
+			r := &p[0]
+			r.Count = int64(bp.count)
+			r.Cycles = bp.cycles
+			i := copy(r.Stack0[:], b.stk())
+			for ; i < len(r.Stack0); i++ {
+				r.Stack0[i] = 0
+			}
+			p = p[1:]
+		}
+	}
+	unlock(&proflock)
+	return
+}
+
 // ThreadCreateProfile returns n, the number of records in the thread creation profile.
 // If len(p) >= n, ThreadCreateProfile copies the profile into p and returns n, true.
 // If len(p) < n, ThreadCreateProfile does not change p and returns n, false.
@@ -520,6 +678,20 @@ func ThreadCreateProfile(p []StackRecord) (n int, ok bool) {
 // Most clients should use the runtime/pprof package instead
 // of calling GoroutineProfile directly.
 func GoroutineProfile(p []StackRecord) (n int, ok bool) {
+	return goroutineProfileWithLabels(p, nil, getcallerpc(unsafe.Pointer(&p)), getcallersp(unsafe.Pointer(&p)))
+}
+
+// runtime_goroutineProfileWithLabels is like GoroutineProfile but
+// also records the profiler labels of each goroutine in labels,
+// which must be nil or as long as p.
+//go:linkname runtime_goroutineProfileWithLabels runtime/pprof.runtime_goroutineProfileWithLabels
+func runtime_goroutineProfileWithLabels(p []StackRecord, labels []unsafe.Pointer) (n int, ok bool) {
+	return goroutineProfileWithLabels(p, labels, getcallerpc(unsafe.Pointer(&p)), getcallersp(unsafe.Pointer(&p)))
+}
+
+// goroutineProfileWithLabels implements GoroutineProfile for a caller
+// whose own stack starts at pc, sp.
+func goroutineProfileWithLabels(p []StackRecord, labels []unsafe.Pointer, pc, sp uintptr) (n int, ok bool) {
 	gp := getg()
 
 	isOK := func(gp1 *g) bool {
@@ -539,15 +711,17 @@ func GoroutineProfile(p []StackRecord) (n int, ok bool) {
 
 	if n <= len(p) {
 		ok = true
-		r := p
+		r, lbl := p, labels
 
 		// Save current goroutine.
-		sp := getcallersp(unsafe.Pointer(&p))
-		pc := getcallerpc(unsafe.Pointer(&p))
 		systemstack(func() {
 			saveg(pc, sp, gp, &r[0])
 		})
 		r = r[1:]
+		if labels != nil {
+			lbl[0] = gp.labels
+			lbl = lbl[1:]
+		}
 
 		// Save other goroutines.
 		for _, gp1 := range allgs {
@@ -559,12 +733,19 @@ func GoroutineProfile(p []StackRecord) (n int, ok bool) {
 				}
 				saveg(^uintptr(0), ^uintptr(0), gp1, &r[0])
 				r = r[1:]
+				if labels != nil {
+					lbl[0] = gp1.labels
+					lbl = lbl[1:]
+				}
 			}
 		}
 	}
 
 	startTheWorld()
 
+	if raceenabled && labels != nil {
+		raceacquire(unsafe.Pointer(&labelSync))
+	}
 	return n, ok
 }
 
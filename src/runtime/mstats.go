@@ -25,12 +25,13 @@ type mstats struct {
 
 	// Statistics about malloc heap.
 	// protected by mheap.lock
-	heap_alloc    uint64 // bytes allocated and not yet freed (same as alloc above)
-	heap_sys      uint64 // bytes obtained from system
-	heap_idle     uint64 // bytes in idle spans
-	heap_inuse    uint64 // bytes in non-idle spans
-	heap_released uint64 // bytes released to the os
-	heap_objects  uint64 // total number of allocated objects
+	heap_alloc     uint64 // bytes allocated and not yet freed (same as alloc above)
+	heap_sys       uint64 // bytes obtained from system
+	heap_idle      uint64 // bytes in idle spans
+	heap_inuse     uint64 // bytes in non-idle spans
+	heap_released  uint64 // bytes released to the os
+	heap_objects   uint64 // total number of allocated objects
+	total_released uint64 // bytes released to the os (even if reused since)
 
 	// Statistics about allocation of low-level fixed-size structures.
 	// Protected by FixAlloc locks.
@@ -123,12 +124,13 @@ type MemStats struct {
 	Frees      uint64 // number of frees
 
 	// Main allocation heap statistics.
-	HeapAlloc    uint64 // bytes allocated and not yet freed (same as Alloc above)
-	HeapSys      uint64 // bytes obtained from system
-	HeapIdle     uint64 // bytes in idle spans
-	HeapInuse    uint64 // bytes in non-idle span
-	HeapReleased uint64 // bytes released to the OS
-	HeapObjects  uint64 // total number of allocated objects
+	HeapAlloc     uint64 // bytes allocated and not yet freed (same as Alloc above)
+	HeapSys       uint64 // bytes obtained from system
+	HeapIdle      uint64 // bytes in idle spans
+	HeapInuse     uint64 // bytes in non-idle span
+	HeapReleased  uint64 // bytes released to the OS
+	HeapObjects   uint64 // total number of allocated objects
+	TotalReleased uint64 // bytes released to the OS (even if reused since)
 
 	// Low-level fixed-size structure allocator statistics.
 	//	Inuse is bytes used now.
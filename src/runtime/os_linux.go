@@ -34,3 +34,6 @@ func raiseproc(sig int32)
 //go:noescape
 func sched_getaffinity(pid, len uintptr, buf *uintptr) int32
 func osyield()
+
+// madvise returns 0 or a negative errno.
+func madvise(addr unsafe.Pointer, n uintptr, flags int32) int32
@@ -5,7 +5,12 @@
 // Package pprof writes runtime profiling data in the format expected
 // by the pprof visualization tool.
 // For more information about pprof, see
-// http://code.google.com/p/google-perftools/.
+// https://github.com/google/pprof/.
+//
+// Profiles are written in the gzip-compressed protocol buffer format
+// described in https://github.com/google/pprof/blob/master/proto/profile.proto,
+// which includes symbol information and the memory mappings of the
+// process, so a profile can be analyzed without the program binary.
 package pprof
 
 import (
@@ -18,6 +23,8 @@ import (
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"time"
+	"unsafe"
 )
 
 // BUG(rsc): Profiles are only as good as the kernel support used to generate them.
@@ -37,6 +44,8 @@ import (
 //	heap         - a sampling of all heap allocations
 //	threadcreate - stack traces that led to the creation of new OS threads
 //	block        - stack traces that led to blocking on synchronization primitives
+//	mutex        - stack traces of holders of contended mutexes
+//	schedlatency - stack traces at which goroutines waited to be scheduled
 //
 // These predefined profiles maintain themselves and panic on an explicit
 // Add or Remove method call.
@@ -90,6 +99,18 @@ var blockProfile = &Profile{
 	write: writeBlock,
 }
 
+var mutexProfile = &Profile{
+	name:  "mutex",
+	count: countMutex,
+	write: writeMutex,
+}
+
+var schedLatencyProfile = &Profile{
+	name:  "schedlatency",
+	count: countSchedLatency,
+	write: writeSchedLatency,
+}
+
 func lockProfiles() {
 	profiles.mu.Lock()
 	if profiles.m == nil {
@@ -99,6 +120,8 @@ func lockProfiles() {
 			"threadcreate": threadcreateProfile,
 			"heap":         heapProfile,
 			"block":        blockProfile,
+			"mutex":        mutexProfile,
+			"schedlatency": schedLatencyProfile,
 		}
 	}
 }
@@ -220,9 +243,13 @@ func (p *Profile) Remove(value interface{}) {
 // Otherwise, WriteTo returns nil.
 //
 // The debug parameter enables additional output.
-// Passing debug=0 prints only the hexadecimal addresses that pprof needs.
-// Passing debug=1 adds comments translating addresses to function names
-// and line numbers, so that a programmer can read the profile without tools.
+// Passing debug=0 writes the gzip-compressed protocol buffer described
+// in https://github.com/google/pprof/blob/master/proto/profile.proto,
+// which includes the function names, file names and line numbers of
+// the addresses in the profile.
+// Passing debug=1 writes the legacy text format with comments
+// translating addresses to function names and line numbers,
+// so that a programmer can read the profile without tools.
 //
 // The predefined profiles may assign meaning to other debug values;
 // for example, when printing the "goroutine" profile, debug=2 means to
@@ -254,6 +281,7 @@ type stackProfile [][]uintptr
 
 func (x stackProfile) Len() int              { return len(x) }
 func (x stackProfile) Stack(i int) []uintptr { return x[i] }
+func (x stackProfile) Label(i int) *labelMap { return nil }
 func (x stackProfile) Swap(i, j int)         { x[i], x[j] = x[j], x[i] }
 func (x stackProfile) Less(i, j int) bool {
 	t, u := x[i], x[j]
@@ -266,16 +294,28 @@ func (x stackProfile) Less(i, j int) bool {
 }
 
 // A countProfile is a set of stack traces to be printed as counts
-// grouped by stack trace. There are multiple implementations:
-// all that matters is that we can find out how many traces there are
-// and obtain each trace in turn.
+// grouped by stack trace and profiler labels. There are multiple
+// implementations: all that matters is that we can find out how many
+// traces there are and obtain each trace and its labels in turn.
 type countProfile interface {
 	Len() int
 	Stack(i int) []uintptr
+	Label(i int) *labelMap
 }
 
 // printCountProfile prints a countProfile at the specified debug level.
+// The profile will be in compressed proto format unless debug is nonzero.
 func printCountProfile(w io.Writer, debug int, name string, p countProfile) error {
+	if debug == 0 {
+		pb := newProfileBuilder([]valueType{{name, "count"}}, valueType{name, "count"}, 1)
+		var locs []uint64
+		for i, n := 0, p.Len(); i < n; i++ {
+			locs = pb.appendLocsForStack(locs[:0], p.Stack(i), false)
+			pb.addSample(locs, []int64{1}, protoLabels(p.Label(i)))
+		}
+		return pb.build(w)
+	}
+
 	b := bufio.NewWriter(w)
 	var tw *tabwriter.Writer
 	w = b
@@ -286,14 +326,17 @@ func printCountProfile(w io.Writer, debug int, name string, p countProfile) erro
 
 	fmt.Fprintf(w, "%s profile: total %d\n", name, p.Len())
 
-	// Build count of each stack.
+	// Build count of each stack and label set.
 	var buf bytes.Buffer
-	key := func(stk []uintptr) string {
+	key := func(stk []uintptr, labels *labelMap) string {
 		buf.Reset()
 		fmt.Fprintf(&buf, "@")
 		for _, pc := range stk {
 			fmt.Fprintf(&buf, " %#x", pc)
 		}
+		if labels != nil && len(*labels) > 0 {
+			fmt.Fprintf(&buf, "\n# labels: %v", *labels)
+		}
 		return buf.String()
 	}
 	count := map[string]int{}
@@ -301,7 +344,7 @@ func printCountProfile(w io.Writer, debug int, name string, p countProfile) erro
 	var keys []string
 	n := p.Len()
 	for i := 0; i < n; i++ {
-		k := key(p.Stack(i))
+		k := key(p.Stack(i), p.Label(i))
 		if count[k] == 0 {
 			index[k] = i
 			keys = append(keys, k)
@@ -417,6 +460,10 @@ func writeHeap(w io.Writer, debug int) error {
 		// Profile grew; try again.
 	}
 
+	if debug == 0 {
+		return writeHeapProto(w, p, int64(runtime.MemProfileRate))
+	}
+
 	sort.Sort(byInUseBytes(p))
 
 	b := bufio.NewWriter(w)
@@ -494,6 +541,30 @@ func writeHeap(w io.Writer, debug int) error {
 	return b.Flush()
 }
 
+// writeHeapProto writes the heap profile records p to w
+// in the compressed proto format.
+func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64) error {
+	b := newProfileBuilder([]valueType{
+		{"alloc_objects", "count"},
+		{"alloc_space", "bytes"},
+		{"inuse_objects", "count"},
+		{"inuse_space", "bytes"},
+	}, valueType{"space", "bytes"}, rate)
+	var locs []uint64
+	for i := range p {
+		r := &p[i]
+		locs = b.appendLocsForStack(locs[:0], r.Stack(), false)
+		allocObjects, allocBytes := scaleHeapSample(r.AllocObjects, r.AllocBytes, rate)
+		inUseObjects, inUseBytes := scaleHeapSample(r.InUseObjects(), r.InUseBytes(), rate)
+		var labels []protoLabel
+		if r.AllocObjects > 0 {
+			labels = []protoLabel{{key: "bytes", num: r.AllocBytes / r.AllocObjects}}
+		}
+		b.addSample(locs, []int64{allocObjects, allocBytes, inUseObjects, inUseBytes}, labels)
+	}
+	return b.build(w)
+}
+
 // countThreadCreate returns the size of the current ThreadCreateProfile.
 func countThreadCreate() int {
 	n, _ := runtime.ThreadCreateProfile(nil)
@@ -502,7 +573,9 @@ func countThreadCreate() int {
 
 // writeThreadCreate writes the current runtime ThreadCreateProfile to w.
 func writeThreadCreate(w io.Writer, debug int) error {
-	return writeRuntimeProfile(w, debug, "threadcreate", runtime.ThreadCreateProfile)
+	return writeRuntimeProfile(w, debug, "threadcreate", func(p []runtime.StackRecord, _ []unsafe.Pointer) (n int, ok bool) {
+		return runtime.ThreadCreateProfile(p)
+	})
 }
 
 // countGoroutine returns the number of goroutines.
@@ -515,7 +588,7 @@ func writeGoroutine(w io.Writer, debug int) error {
 	if debug >= 2 {
 		return writeGoroutineStacks(w)
 	}
-	return writeRuntimeProfile(w, debug, "goroutine", runtime.GoroutineProfile)
+	return writeRuntimeProfile(w, debug, "goroutine", runtime_goroutineProfileWithLabels)
 }
 
 func writeGoroutineStacks(w io.Writer) error {
@@ -539,7 +612,7 @@ func writeGoroutineStacks(w io.Writer) error {
 	return err
 }
 
-func writeRuntimeProfile(w io.Writer, debug int, name string, fetch func([]runtime.StackRecord) (int, bool)) error {
+func writeRuntimeProfile(w io.Writer, debug int, name string, fetch func([]runtime.StackRecord, []unsafe.Pointer) (int, bool)) error {
 	// Find out how many records there are (fetch(nil)),
 	// allocate that many records, and get the data.
 	// There's a race—more records might be added between
@@ -547,27 +620,37 @@ func writeRuntimeProfile(w io.Writer, debug int, name string, fetch func([]runti
 	// and also try again if we're very unlucky.
 	// The loop should only execute one iteration in the common case.
 	var p []runtime.StackRecord
-	n, ok := fetch(nil)
+	var labels []unsafe.Pointer
+	n, ok := fetch(nil, nil)
 	for {
 		// Allocate room for a slightly bigger profile,
 		// in case a few more entries have been added
 		// since the call to ThreadProfile.
 		p = make([]runtime.StackRecord, n+10)
-		n, ok = fetch(p)
+		labels = make([]unsafe.Pointer, n+10)
+		n, ok = fetch(p, labels)
 		if ok {
 			p = p[0:n]
+			labels = labels[0:n]
 			break
 		}
 		// Profile grew; try again.
 	}
 
-	return printCountProfile(w, debug, name, runtimeProfile(p))
+	return printCountProfile(w, debug, name, &runtimeProfile{p, labels})
 }
 
-type runtimeProfile []runtime.StackRecord
+type runtimeProfile struct {
+	stk    []runtime.StackRecord
+	labels []unsafe.Pointer
+}
 
-func (p runtimeProfile) Len() int              { return len(p) }
-func (p runtimeProfile) Stack(i int) []uintptr { return p[i].Stack() }
+func (p *runtimeProfile) Len() int              { return len(p.stk) }
+func (p *runtimeProfile) Stack(i int) []uintptr { return p.stk[i].Stack() }
+func (p *runtimeProfile) Label(i int) *labelMap { return (*labelMap)(p.labels[i]) }
+
+// runtime_goroutineProfileWithLabels is defined in runtime/mprof.go.
+func runtime_goroutineProfileWithLabels(p []runtime.StackRecord, labels []unsafe.Pointer) (n int, ok bool)
 
 var cpu struct {
 	sync.Mutex
@@ -576,7 +659,8 @@ var cpu struct {
 }
 
 // StartCPUProfile enables CPU profiling for the current process.
-// While profiling, the profile will be buffered and written to w.
+// While profiling, the profile will be buffered and written to w
+// in the compressed proto format (see Profile.WriteTo).
 // StartCPUProfile returns an error if profiling is already enabled.
 //
 // On Unix-like systems, StartCPUProfile does not work by default for
@@ -608,22 +692,39 @@ func StartCPUProfile(w io.Writer) error {
 		return fmt.Errorf("cpu profiling already in use")
 	}
 	cpu.profiling = true
+	b := newProfileBuilder([]valueType{
+		{"samples", "count"},
+		{"cpu", "nanoseconds"},
+	}, valueType{"cpu", "nanoseconds"}, 0)
 	runtime.SetCPUProfileRate(hz)
-	go profileWriter(w)
+	go profileWriter(w, b)
 	return nil
 }
 
-func profileWriter(w io.Writer) {
+func profileWriter(w io.Writer, b *profileBuilder) {
+	var err error
 	for {
 		data := runtime.CPUProfile()
 		if data == nil {
 			break
 		}
-		w.Write(data)
+		if err == nil {
+			err = b.addCPUData(data)
+		}
 	}
+	if err != nil {
+		// The runtime should never produce an invalid or truncated profile.
+		// It drops records that can't fit into its log buffers.
+		panic("runtime/pprof: converting profile: " + err.Error())
+	}
+	b.end = time.Now()
+	b.build(w)
 	cpu.done <- true
 }
 
+// runtime_cpuProfileLabels is defined in runtime/cpuprof.go.
+func runtime_cpuProfileLabels(n uintptr) unsafe.Pointer
+
 // StopCPUProfile stops the current CPU profile, if any.
 // StopCPUProfile only returns after all the writes for the
 // profile have completed.
@@ -651,13 +752,43 @@ func countBlock() int {
 	return n
 }
 
+// countMutex returns the number of records in the mutex profile.
+func countMutex() int {
+	n, _ := runtime.MutexProfile(nil)
+	return n
+}
+
+// countSchedLatency returns the number of records in the scheduling
+// latency profile.
+func countSchedLatency() int {
+	n, _ := runtime.SchedLatencyProfile(nil)
+	return n
+}
+
 // writeBlock writes the current blocking profile to w.
 func writeBlock(w io.Writer, debug int) error {
+	return writeContention(w, debug, "contention", runtime.BlockProfile, 0)
+}
+
+// writeMutex writes the current mutex profile to w.
+func writeMutex(w io.Writer, debug int) error {
+	return writeContention(w, debug, "mutex", runtime.MutexProfile, int64(runtime.SetMutexProfileFraction(-1)))
+}
+
+// writeSchedLatency writes the current scheduling latency profile to w.
+func writeSchedLatency(w io.Writer, debug int) error {
+	return writeContention(w, debug, "schedlatency", runtime.SchedLatencyProfile, 0)
+}
+
+// writeContention writes the contention profile returned by fetch to w.
+// If period is positive, the profile recorded one in period events,
+// and the counts and delays are scaled up accordingly.
+func writeContention(w io.Writer, debug int, name string, fetch func([]runtime.BlockProfileRecord) (int, bool), period int64) error {
 	var p []runtime.BlockProfileRecord
-	n, ok := runtime.BlockProfile(nil)
+	n, ok := fetch(nil)
 	for {
 		p = make([]runtime.BlockProfileRecord, n+50)
-		n, ok = runtime.BlockProfile(p)
+		n, ok = fetch(p)
 		if ok {
 			p = p[:n]
 			break
@@ -666,6 +797,25 @@ func writeBlock(w io.Writer, debug int) error {
 
 	sort.Sort(byCycles(p))
 
+	if debug == 0 {
+		scale := period
+		if scale <= 0 {
+			scale = 1
+		}
+		pb := newProfileBuilder([]valueType{
+			{"contentions", "count"},
+			{"delay", "nanoseconds"},
+		}, valueType{"contentions", "count"}, scale)
+		cpuGHz := float64(runtime_cyclesPerSecond()) / 1e9
+		var locs []uint64
+		for i := range p {
+			r := &p[i]
+			locs = pb.appendLocsForStack(locs[:0], r.Stack(), false)
+			pb.addSample(locs, []int64{r.Count * scale, int64(float64(r.Cycles) / cpuGHz * float64(scale))}, nil)
+		}
+		return pb.build(w)
+	}
+
 	b := bufio.NewWriter(w)
 	var tw *tabwriter.Writer
 	w = b
@@ -674,8 +824,11 @@ func writeBlock(w io.Writer, debug int) error {
 		w = tw
 	}
 
-	fmt.Fprintf(w, "--- contention:\n")
+	fmt.Fprintf(w, "--- %s:\n", name)
 	fmt.Fprintf(w, "cycles/second=%v\n", runtime_cyclesPerSecond())
+	if period > 0 {
+		fmt.Fprintf(w, "sampling period=%d\n", period)
+	}
 	for i := range p {
 		r := &p[i]
 		fmt.Fprintf(w, "%v %v @", r.Cycles, r.Count)
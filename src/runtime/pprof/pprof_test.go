@@ -8,7 +8,9 @@ package pprof_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"internal/pprof/profile"
 	"internal/testenv"
 	"math/big"
 	"os"
@@ -20,7 +22,6 @@ import (
 	"sync"
 	"testing"
 	"time"
-	"unsafe"
 )
 
 func cpuHogger(f func(), dur time.Duration) {
@@ -86,38 +87,45 @@ func TestCPUProfileMultithreaded(t *testing.T) {
 	})
 }
 
-func parseProfile(t *testing.T, bytes []byte, f func(uintptr, []uintptr)) {
-	// Convert []byte to []uintptr.
-	l := len(bytes) / int(unsafe.Sizeof(uintptr(0)))
-	val := *(*[]uintptr)(unsafe.Pointer(&bytes))
-	val = val[:l]
-
-	// 5 for the header, 3 for the trailer.
-	if l < 5+3 {
-		t.Logf("profile too short: %#x", val)
-		if badOS[runtime.GOOS] {
-			t.Skipf("ignoring failure on %s; see golang.org/issue/13841", runtime.GOOS)
-			return
-		}
-		t.FailNow()
-	}
+func TestCPUProfileLabel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	testCPUProfile(t, []string{"runtime/pprof_test.cpuHog1;key=value", "runtime/pprof_test.cpuHog2;key=value"}, func(dur time.Duration) {
+		Do(context.Background(), Labels("key", "value"), func(context.Context) {
+			// The goroutine inherits the labels.
+			c := make(chan int)
+			go func() {
+				cpuHogger(cpuHog1, dur)
+				c <- 1
+			}()
+			cpuHogger(cpuHog2, dur)
+			<-c
+		})
+	})
+}
 
-	hd, val, tl := val[:5], val[5:l-3], val[l-3:]
-	if hd[0] != 0 || hd[1] != 3 || hd[2] != 0 || hd[3] != 1e6/100 || hd[4] != 0 {
-		t.Fatalf("unexpected header %#x", hd)
+// parseProfile calls f for each sample of the CPU profile in valBytes,
+// passing the sample's count, locations and profiler labels.
+func parseProfile(t *testing.T, valBytes []byte, f func(count uintptr, locs []*profile.Location, labels map[string][]string)) {
+	p, err := profile.Parse(bytes.NewReader(valBytes))
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	if tl[0] != 0 || tl[1] != 1 || tl[2] != 0 {
-		t.Fatalf("malformed end-of-data marker %#x", tl)
+	if pt := p.PeriodType; pt == nil || pt.Type != "cpu" || pt.Unit != "nanoseconds" || p.Period != 1e9/100 {
+		t.Fatalf("unexpected period %d %v", p.Period, pt)
 	}
+	for _, sample := range p.Sample {
+		f(uintptr(sample.Value[0]), sample.Location, sample.Label)
+	}
+}
 
-	for len(val) > 0 {
-		if len(val) < 2 || val[0] < 1 || val[1] < 1 || uintptr(len(val)) < 2+val[1] {
-			t.Fatalf("malformed profile.  leftover: %#x", val)
+// hasLabel reports whether labels include key=value.
+func hasLabel(labels map[string][]string, key, value string) bool {
+	for _, v := range labels[key] {
+		if v == value {
+			return true
 		}
-		f(val[0], val[2:2+val[1]])
-		val = val[2+val[1]:]
 	}
+	return false
 }
 
 func testCPUProfile(t *testing.T, need []string, f func(dur time.Duration)) {
@@ -191,21 +199,27 @@ func profileOk(t *testing.T, need []string, prof bytes.Buffer, duration time.Dur
 	// Check that profile is well formed and contains need.
 	have := make([]uintptr, len(need))
 	var samples uintptr
-	parseProfile(t, prof.Bytes(), func(count uintptr, stk []uintptr) {
+	parseProfile(t, prof.Bytes(), func(count uintptr, locs []*profile.Location, labels map[string][]string) {
 		samples += count
-		for _, pc := range stk {
-			f := runtime.FuncForPC(pc)
-			if f == nil {
-				continue
-			}
-			for i, name := range need {
-				if strings.Contains(f.Name(), name) {
-					have[i] += count
+		for _, loc := range locs {
+			for _, line := range loc.Line {
+				for i, name := range need {
+					// A need of the form name;key=value requires that label.
+					if j := strings.Index(name, ";"); j >= 0 {
+						kv := strings.SplitN(name[j+1:], "=", 2)
+						if !hasLabel(labels, kv[0], kv[1]) {
+							continue
+						}
+						name = name[:j]
+					}
+					if strings.Contains(line.Function.Name, name) {
+						have[i] += count
+					}
+				}
+				if strings.Contains(line.Function.Name, "stackBarrier") {
+					// The runtime should have unwound this.
+					t.Fatalf("profile includes stackBarrier")
 				}
-			}
-			if strings.Contains(f.Name(), "stackBarrier") {
-				// The runtime should have unwound this.
-				t.Fatalf("profile includes stackBarrier")
 			}
 		}
 	})
@@ -312,28 +326,26 @@ func TestGoroutineSwitch(t *testing.T) {
 
 		// Read profile to look for entries for runtime.gogo with an attempt at a traceback.
 		// The special entry
-		parseProfile(t, prof.Bytes(), func(count uintptr, stk []uintptr) {
+		parseProfile(t, prof.Bytes(), func(count uintptr, locs []*profile.Location, _ map[string][]string) {
 			// An entry with two frames with 'System' in its top frame
 			// exists to record a PC without a traceback. Those are okay.
-			if len(stk) == 2 {
-				f := runtime.FuncForPC(stk[1])
-				if f != nil && (f.Name() == "runtime._System" || f.Name() == "runtime._ExternalCode" || f.Name() == "runtime._GC") {
+			if len(locs) == 2 {
+				name := funcName(locs[1])
+				if name == "runtime._System" || name == "runtime._ExternalCode" || name == "runtime._GC" {
 					return
 				}
 			}
 
 			// Otherwise, should not see runtime.gogo.
 			// The place we'd see it would be the inner most frame.
-			f := runtime.FuncForPC(stk[0])
-			if f != nil && f.Name() == "runtime.gogo" {
+			if funcName(locs[0]) == "runtime.gogo" {
 				var buf bytes.Buffer
-				for _, pc := range stk {
-					f := runtime.FuncForPC(pc)
-					if f == nil {
-						fmt.Fprintf(&buf, "%#x ?:0\n", pc)
+				for _, loc := range locs {
+					if len(loc.Line) == 0 {
+						fmt.Fprintf(&buf, "%#x ?:0\n", loc.Address)
 					} else {
-						file, line := f.FileLine(pc)
-						fmt.Fprintf(&buf, "%#x %s:%d\n", pc, file, line)
+						line := loc.Line[0]
+						fmt.Fprintf(&buf, "%#x %s:%d\n", loc.Address, line.Function.Filename, line.Line)
 					}
 				}
 				t.Fatalf("found profile entry for runtime.gogo:\n%s", buf.String())
@@ -342,6 +354,14 @@ func TestGoroutineSwitch(t *testing.T) {
 	}
 }
 
+// funcName returns the name of the function at loc, if known.
+func funcName(loc *profile.Location) string {
+	if len(loc.Line) == 0 || loc.Line[0].Function == nil {
+		return ""
+	}
+	return loc.Line[0].Function.Name
+}
+
 // Test that profiling of division operations is okay, especially on ARM. See issue 6681.
 func TestMathBigDivide(t *testing.T) {
 	testCPUProfile(t, nil, func(duration time.Duration) {
@@ -579,6 +599,79 @@ func blockCond() {
 	mu.Unlock()
 }
 
+func TestMutexProfile(t *testing.T) {
+	old := runtime.SetMutexProfileFraction(1)
+	defer runtime.SetMutexProfileFraction(old)
+	if old != 0 {
+		t.Fatalf("need MutexProfileFraction 0, got %d", old)
+	}
+
+	blockMutex()
+
+	var w bytes.Buffer
+	Lookup("mutex").WriteTo(&w, 1)
+	prof := w.String()
+
+	if !strings.HasPrefix(prof, "--- mutex:\ncycles/second=") {
+		t.Fatalf("Bad profile header:\n%v", prof)
+	}
+	if !strings.Contains(prof, "\nsampling period=1\n") {
+		t.Fatalf("Bad sampling period:\n%v", prof)
+	}
+	re := `
+[0-9]+ 1 @ 0x[0-9,a-f]+ 0x[0-9,a-f]+ 0x[0-9,a-f]+
+#	0x[0-9,a-f]+	sync\.\(\*Mutex\)\.Unlock\+0x[0-9,a-f]+	.*/src/sync/mutex\.go:[0-9]+
+#	0x[0-9,a-f]+	runtime/pprof_test\.blockMutex\.func1\+0x[0-9,a-f]+	.*/src/runtime/pprof/pprof_test.go:[0-9]+
+`
+	if !regexp.MustCompile(strings.Replace(re, "\t", "\t+", -1)).MatchString(prof) {
+		t.Fatalf("Bad mutex entry, expect:\n%v\ngot:\n%v", re, prof)
+	}
+}
+
+func TestSchedLatencyProfile(t *testing.T) {
+	old := runtime.SetSchedLatencyProfileRate(1)
+	defer runtime.SetSchedLatencyProfileRate(old)
+	if old != 0 {
+		t.Fatalf("need SchedLatencyProfileRate 0, got %d", old)
+	}
+
+	schedPingPong()
+
+	var w bytes.Buffer
+	Lookup("schedlatency").WriteTo(&w, 1)
+	prof := w.String()
+
+	if !strings.HasPrefix(prof, "--- schedlatency:\ncycles/second=") {
+		t.Fatalf("Bad profile header:\n%v", prof)
+	}
+	re := `
+[0-9]+ [0-9]+ @( 0x[0-9,a-f]+)+
+(#	0x[0-9,a-f]+	.*\n)*#	0x[0-9,a-f]+	runtime/pprof_test\.schedPingPong(\.func1)?\+0x[0-9,a-f]+	.*/src/runtime/pprof/pprof_test.go:[0-9]+
+`
+	if !regexp.MustCompile(strings.Replace(re, "\t", "\t+", -1)).MatchString(prof) {
+		t.Fatalf("Bad schedlatency entry, expect:\n%v\ngot:\n%v", re, prof)
+	}
+}
+
+// schedPingPong bounces a value between two goroutines, so that each
+// waits to be scheduled many times.
+func schedPingPong() {
+	c := make(chan int)
+	done := make(chan bool)
+	go func() {
+		for v := range c {
+			c <- v
+		}
+		done <- true
+	}()
+	for i := 0; i < 1000; i++ {
+		c <- i
+		<-c
+	}
+	close(c)
+	<-done
+}
+
 func func1(c chan int) { <-c }
 func func2(c chan int) { <-c }
 func func3(c chan int) { <-c }
@@ -588,7 +681,9 @@ func TestGoroutineCounts(t *testing.T) {
 	c := make(chan int)
 	for i := 0; i < 100; i++ {
 		if i%10 == 0 {
-			go func1(c)
+			Do(context.Background(), Labels("label", "value"), func(context.Context) {
+				go func1(c)
+			})
 			continue
 		}
 		if i%2 == 0 {
@@ -606,6 +701,9 @@ func TestGoroutineCounts(t *testing.T) {
 	if !containsInOrder(prof, "\n50 @ ", "\n40 @", "\n10 @", "\n1 @") {
 		t.Errorf("expected sorted goroutine counts:\n%s", prof)
 	}
+	if !regexp.MustCompile(`\n10 @[ 0-9a-fx]+\n# labels: \{"label":"value"\}\n`).MatchString(prof) {
+		t.Errorf("expected labels on labeled goroutines:\n%s", prof)
+	}
 
 	close(c)
 
@@ -0,0 +1,493 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// This file writes profiles in the profile.proto format described in
+// https://github.com/google/pprof/blob/master/proto/profile.proto:
+// a gzip-compressed protocol buffer that carries the function names,
+// file names and line numbers of the program counters in the profile,
+// along with the memory mappings of the process, so that it can be
+// analyzed without access to the program binary.
+
+// Field numbers from profile.proto.
+const (
+	// message Profile
+	tagProfile_SampleType    = 1  // repeated ValueType
+	tagProfile_Sample        = 2  // repeated Sample
+	tagProfile_Mapping       = 3  // repeated Mapping
+	tagProfile_Location      = 4  // repeated Location
+	tagProfile_Function      = 5  // repeated Function
+	tagProfile_StringTable   = 6  // repeated string
+	tagProfile_TimeNanos     = 9  // int64
+	tagProfile_DurationNanos = 10 // int64
+	tagProfile_PeriodType    = 11 // ValueType
+	tagProfile_Period        = 12 // int64
+
+	// message ValueType
+	tagValueType_Type = 1 // int64 (string table index)
+	tagValueType_Unit = 2 // int64 (string table index)
+
+	// message Sample
+	tagSample_Location = 1 // repeated uint64
+	tagSample_Value    = 2 // repeated int64
+	tagSample_Label    = 3 // repeated Label
+
+	// message Label
+	tagLabel_Key = 1 // int64 (string table index)
+	tagLabel_Str = 2 // int64 (string table index)
+	tagLabel_Num = 3 // int64
+
+	// message Mapping
+	tagMapping_ID             = 1 // uint64
+	tagMapping_Start          = 2 // uint64
+	tagMapping_Limit          = 3 // uint64
+	tagMapping_Offset         = 4 // uint64
+	tagMapping_Filename       = 5 // int64 (string table index)
+	tagMapping_HasFunctions   = 7 // bool
+	tagMapping_HasFilenames   = 8 // bool
+	tagMapping_HasLineNumbers = 9 // bool
+
+	// message Location
+	tagLocation_ID        = 1 // uint64
+	tagLocation_MappingID = 2 // uint64
+	tagLocation_Address   = 3 // uint64
+	tagLocation_Line      = 4 // repeated Line
+
+	// message Line
+	tagLine_FunctionID = 1 // uint64
+	tagLine_Line       = 2 // int64
+
+	// message Function
+	tagFunction_ID         = 1 // uint64
+	tagFunction_Name       = 2 // int64 (string table index)
+	tagFunction_SystemName = 3 // int64 (string table index)
+	tagFunction_Filename   = 4 // int64 (string table index)
+)
+
+// A profileBuilder accumulates the samples of a profile,
+// symbolizing their stacks as it goes, and writes the result
+// in the profile.proto format.
+type profileBuilder struct {
+	start      time.Time
+	end        time.Time // end of a profile covering a time span; zero otherwise
+	sampleType []valueType
+	periodType valueType
+	period     int64
+
+	samples   []*protoSample
+	sampleKey map[string]*protoSample // samples by locations and labels
+	key       []byte                  // buffer for building sample keys
+
+	strings   []string
+	stringMap map[string]int
+	locs      []protoLocation
+	locMap    map[uintptr]uint64 // location ID by address
+	funcs     []protoFunction
+	funcMap   map[protoFunction]uint64 // function ID by name and file
+	mem       []memMap
+
+	// State of the conversion of CPU profile data (see addCPUData).
+	cpuHeader    bool
+	cpuLabels    []protoLabel
+	cpuLabelsMap map[uintptr][]protoLabel
+}
+
+type valueType struct {
+	typ, unit string
+}
+
+type protoSample struct {
+	locs   []uint64
+	values []int64
+	labels []protoLabel
+}
+
+// A protoLabel is a sample label with either a string or a numeric value.
+type protoLabel struct {
+	key string
+	str string
+	num int64
+}
+
+type protoLocation struct {
+	mapping  uint64 // mapping ID, or 0 if unknown
+	addr     uintptr
+	function uint64 // function ID, or 0 if unknown
+	line     int64
+}
+
+type protoFunction struct {
+	name, file string
+}
+
+// A memMap is an executable memory mapping of the process.
+type memMap struct {
+	start, end uintptr
+	offset     uint64
+	file       string
+
+	used         bool // some location is in the mapping
+	unsymbolized bool // some location in the mapping has no function
+}
+
+// newProfileBuilder returns a profileBuilder for a profile
+// with the given sample and period types.
+func newProfileBuilder(sampleType []valueType, periodType valueType, period int64) *profileBuilder {
+	b := &profileBuilder{
+		start:      time.Now(),
+		sampleType: sampleType,
+		periodType: periodType,
+		period:     period,
+		sampleKey:  make(map[string]*protoSample),
+		strings:    []string{""},
+		stringMap:  map[string]int{"": 0},
+		locMap:     make(map[uintptr]uint64),
+		funcMap:    make(map[protoFunction]uint64),
+	}
+	b.readMapping()
+	return b
+}
+
+// stringIndex returns the index of s in the profile's string table,
+// adding it if needed.
+func (b *profileBuilder) stringIndex(s string) int64 {
+	id, ok := b.stringMap[s]
+	if !ok {
+		id = len(b.strings)
+		b.strings = append(b.strings, s)
+		b.stringMap[s] = id
+	}
+	return int64(id)
+}
+
+// appendLocsForStack appends the location IDs for the stack stk to locs.
+// The addresses in stk are return addresses, except that the first one
+// is the address of the executing instruction if leafIsPC is set.
+func (b *profileBuilder) appendLocsForStack(locs []uint64, stk []uintptr, leafIsPC bool) []uint64 {
+	for i, addr := range stk {
+		if i > 0 || !leafIsPC {
+			// Use the address of the call instruction,
+			// so that the location has the line of the call.
+			addr--
+		}
+		locs = append(locs, b.locForPC(addr))
+	}
+	return locs
+}
+
+// locForPC returns the location ID for the instruction at addr,
+// symbolizing it if this is the first use of the address.
+func (b *profileBuilder) locForPC(addr uintptr) uint64 {
+	if id, ok := b.locMap[addr]; ok {
+		return id
+	}
+	loc := protoLocation{addr: addr}
+	if f := runtime.FuncForPC(addr); f != nil {
+		file, line := f.FileLine(addr)
+		fn := protoFunction{f.Name(), file}
+		id, ok := b.funcMap[fn]
+		if !ok {
+			b.funcs = append(b.funcs, fn)
+			id = uint64(len(b.funcs))
+			b.funcMap[fn] = id
+		}
+		loc.function = id
+		loc.line = int64(line)
+	}
+	for i := range b.mem {
+		m := &b.mem[i]
+		if m.start <= addr && addr < m.end {
+			m.used = true
+			if loc.function == 0 {
+				m.unsymbolized = true
+			}
+			loc.mapping = uint64(i + 1)
+			break
+		}
+	}
+	b.locs = append(b.locs, loc)
+	id := uint64(len(b.locs))
+	b.locMap[addr] = id
+	return id
+}
+
+// addSample adds a sample with the given locations, values and labels,
+// merging it with an earlier sample that has the same locations and labels.
+func (b *profileBuilder) addSample(locs []uint64, values []int64, labels []protoLabel) {
+	key := b.key[:0]
+	for _, id := range locs {
+		key = strconv.AppendUint(key, id, 16)
+		key = append(key, ' ')
+	}
+	for _, l := range labels {
+		key = strconv.AppendQuote(key, l.key)
+		key = strconv.AppendQuote(key, l.str)
+		key = strconv.AppendInt(key, l.num, 10)
+	}
+	b.key = key
+	if s := b.sampleKey[string(key)]; s != nil {
+		for i, v := range values {
+			s.values[i] += v
+		}
+		return
+	}
+	s := &protoSample{
+		locs:   append([]uint64(nil), locs...),
+		values: append([]int64(nil), values...),
+		labels: labels,
+	}
+	b.sampleKey[string(key)] = s
+	b.samples = append(b.samples, s)
+}
+
+// protoLabels returns the profiler labels l as sample labels,
+// sorted by key.
+func protoLabels(l *labelMap) []protoLabel {
+	if l == nil || len(*l) == 0 {
+		return nil
+	}
+	labels := make([]protoLabel, 0, len(*l))
+	for k, v := range *l {
+		labels = append(labels, protoLabel{key: k, str: v})
+	}
+	sort.Sort(protoLabelsByKey(labels))
+	return labels
+}
+
+type protoLabelsByKey []protoLabel
+
+func (x protoLabelsByKey) Len() int           { return len(x) }
+func (x protoLabelsByKey) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x protoLabelsByKey) Less(i, j int) bool { return x[i].key < x[j].key }
+
+// addCPUData adds a chunk of CPU profile data returned by
+// runtime.CPUProfile to the profile.
+//
+// The data is a sequence of records in the legacy pprof binary format:
+// a count, a stack length n and n stack words. The first record is a
+// header giving the sampling period in microseconds, a record with the
+// one-word stack 0 marks the end of the data, and a record with a zero
+// count and the two-word stack 0, n says that the next record was
+// sampled while the goroutine had the profiler labels numbered n
+// (see runtime/cpuprof.go).
+func (b *profileBuilder) addCPUData(data []byte) error {
+	const wordSize = int(unsafe.Sizeof(uintptr(0)))
+	if len(data) < wordSize {
+		return nil
+	}
+	words := (*[1 << 28 / unsafe.Sizeof(uintptr(0))]uintptr)(unsafe.Pointer(&data[0]))[:len(data)/wordSize]
+	if !b.cpuHeader {
+		// Header: 0, 3, 0, period in microseconds, 0.
+		if len(words) < 5 || words[0] != 0 || words[1] != 3 || words[2] != 0 {
+			return fmt.Errorf("malformed CPU profile header")
+		}
+		b.period = int64(words[3]) * 1000
+		b.cpuHeader = true
+		words = words[5:]
+	}
+	var locs []uint64
+	for len(words) > 0 {
+		if len(words) < 2 || words[1] > uintptr(len(words)-2) {
+			return fmt.Errorf("truncated CPU profile record")
+		}
+		count, stk := words[0], words[2:2+words[1]]
+		words = words[2+len(stk):]
+		if count == 0 && len(stk) > 0 && stk[0] == 0 {
+			switch len(stk) {
+			case 1:
+				// End of data.
+			case 2:
+				b.cpuLabels = b.cpuProfileLabels(stk[1])
+			}
+			continue
+		}
+		locs = b.appendLocsForStack(locs[:0], stk, true)
+		b.addSample(locs, []int64{int64(count), int64(count) * b.period}, b.cpuLabels)
+		b.cpuLabels = nil
+	}
+	return nil
+}
+
+// cpuProfileLabels returns the sample labels for the profiler labels
+// numbered n in the CPU profile.
+func (b *profileBuilder) cpuProfileLabels(n uintptr) []protoLabel {
+	if labels, ok := b.cpuLabelsMap[n]; ok {
+		return labels
+	}
+	labels := protoLabels((*labelMap)(runtime_cpuProfileLabels(n)))
+	if b.cpuLabelsMap == nil {
+		b.cpuLabelsMap = make(map[uintptr][]protoLabel)
+	}
+	b.cpuLabelsMap[n] = labels
+	return labels
+}
+
+// build writes the profile to w as a gzip-compressed protocol buffer.
+func (b *profileBuilder) build(w io.Writer) error {
+	var pb protobuf
+	for _, t := range b.sampleType {
+		b.pbValueType(&pb, tagProfile_SampleType, t)
+	}
+	for _, s := range b.samples {
+		start := pb.startMessage()
+		pb.uint64s(tagSample_Location, s.locs)
+		pb.int64s(tagSample_Value, s.values)
+		for _, l := range s.labels {
+			start := pb.startMessage()
+			pb.int64Opt(tagLabel_Key, b.stringIndex(l.key))
+			pb.int64Opt(tagLabel_Str, b.stringIndex(l.str))
+			pb.int64Opt(tagLabel_Num, l.num)
+			pb.endMessage(tagSample_Label, start)
+		}
+		pb.endMessage(tagProfile_Sample, start)
+	}
+	for i, m := range b.mem {
+		hasFunctions := m.used && !m.unsymbolized
+		start := pb.startMessage()
+		pb.uint64Opt(tagMapping_ID, uint64(i+1))
+		pb.uint64Opt(tagMapping_Start, uint64(m.start))
+		pb.uint64Opt(tagMapping_Limit, uint64(m.end))
+		pb.uint64Opt(tagMapping_Offset, m.offset)
+		pb.int64Opt(tagMapping_Filename, b.stringIndex(m.file))
+		pb.boolOpt(tagMapping_HasFunctions, hasFunctions)
+		pb.boolOpt(tagMapping_HasFilenames, hasFunctions)
+		pb.boolOpt(tagMapping_HasLineNumbers, hasFunctions)
+		pb.endMessage(tagProfile_Mapping, start)
+	}
+	for i, loc := range b.locs {
+		start := pb.startMessage()
+		pb.uint64Opt(tagLocation_ID, uint64(i+1))
+		pb.uint64Opt(tagLocation_MappingID, loc.mapping)
+		pb.uint64Opt(tagLocation_Address, uint64(loc.addr))
+		if loc.function != 0 {
+			start := pb.startMessage()
+			pb.uint64Opt(tagLine_FunctionID, loc.function)
+			pb.int64Opt(tagLine_Line, loc.line)
+			pb.endMessage(tagLocation_Line, start)
+		}
+		pb.endMessage(tagProfile_Location, start)
+	}
+	for i, fn := range b.funcs {
+		start := pb.startMessage()
+		pb.uint64Opt(tagFunction_ID, uint64(i+1))
+		pb.int64Opt(tagFunction_Name, b.stringIndex(fn.name))
+		pb.int64Opt(tagFunction_SystemName, b.stringIndex(fn.name))
+		pb.int64Opt(tagFunction_Filename, b.stringIndex(fn.file))
+		pb.endMessage(tagProfile_Function, start)
+	}
+	pb.int64Opt(tagProfile_TimeNanos, b.start.UnixNano())
+	if !b.end.IsZero() {
+		pb.int64Opt(tagProfile_DurationNanos, b.end.Sub(b.start).Nanoseconds())
+	}
+	b.pbValueType(&pb, tagProfile_PeriodType, b.periodType)
+	pb.int64Opt(tagProfile_Period, b.period)
+	// The string table goes last: encoding the other fields fills it.
+	for _, s := range b.strings {
+		pb.string(tagProfile_StringTable, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(pb.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (b *profileBuilder) pbValueType(pb *protobuf, tag int, t valueType) {
+	start := pb.startMessage()
+	pb.int64Opt(tagValueType_Type, b.stringIndex(t.typ))
+	pb.int64Opt(tagValueType_Unit, b.stringIndex(t.unit))
+	pb.endMessage(tag, start)
+}
+
+// readMapping reads the executable memory mappings of the process
+// from /proc/self/maps, where available. The mapping holding the
+// program's own code comes first, as pprof expects.
+func (b *profileBuilder) readMapping() {
+	data, _ := ioutil.ReadFile("/proc/self/maps")
+	b.mem = parseProcSelfMaps(data)
+
+	var pc [1]uintptr
+	if runtime.Callers(1, pc[:]) == 0 {
+		return
+	}
+	for i, m := range b.mem {
+		if m.start <= pc[0] && pc[0] < m.end {
+			copy(b.mem[1:i+1], b.mem[:i])
+			b.mem[0] = m
+			break
+		}
+	}
+}
+
+// parseProcSelfMaps parses the executable mappings in data,
+// which is in the format of /proc/self/maps:
+//
+//	00400000-0040b000 r-xp 00000000 fc:01 787766     /bin/cat
+func parseProcSelfMaps(data []byte) []memMap {
+	var mem []memMap
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		f := bytes.Fields(line)
+		if len(f) < 6 || len(f[1]) < 3 || f[1][2] != 'x' {
+			// Not executable, or anonymous.
+			continue
+		}
+		i := bytes.IndexByte(f[0], '-')
+		if i < 0 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(string(f[0][:i]), 16, 64)
+		end, err2 := strconv.ParseUint(string(f[0][i+1:]), 16, 64)
+		offset, err3 := strconv.ParseUint(string(f[2]), 16, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		mem = append(mem, memMap{
+			start:  uintptr(start),
+			end:    uintptr(end),
+			offset: offset,
+			file:   string(bytes.Join(f[5:], []byte(" "))),
+		})
+	}
+	return mem
+}
+
+// scaleHeapSample adjusts the data from a heap profile record to
+// estimate the allocations it represents. The heap profile samples
+// one allocation per rate bytes allocated on average, so an allocation
+// of size s is sampled with probability 1-exp(-s/rate).
+func scaleHeapSample(count, size, rate int64) (int64, int64) {
+	if count == 0 || size == 0 {
+		return 0, 0
+	}
+	if rate <= 1 {
+		// if rate==1 all samples were collected so no adjustment is needed.
+		// if rate<1 treat as unknown and skip scaling.
+		return count, size
+	}
+	avgSize := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avgSize/float64(rate)))
+	return int64(float64(count) * scale), int64(float64(size) * scale)
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof_test
+
+import (
+	"bytes"
+	"context"
+	"internal/pprof/profile"
+	"runtime"
+	. "runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readProto writes the named profile in the proto format
+// and parses the result.
+func readProto(t *testing.T, name string) *profile.Profile {
+	var buf bytes.Buffer
+	if err := Lookup(name).WriteTo(&buf, 0); err != nil {
+		t.Fatalf("writing %s profile: %v", name, err)
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("parsing %s profile: %v", name, err)
+	}
+	return p
+}
+
+func checkSampleTypes(t *testing.T, p *profile.Profile, want ...string) {
+	var have []string
+	for _, st := range p.SampleType {
+		have = append(have, st.Type+"/"+st.Unit)
+	}
+	if strings.Join(have, " ") != strings.Join(want, " ") {
+		t.Fatalf("sample types = %v, want %v", have, want)
+	}
+}
+
+// findSample returns the first sample of p whose stack
+// includes a function whose name contains fn.
+func findSample(p *profile.Profile, fn string) *profile.Sample {
+	for _, s := range p.Sample {
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if strings.Contains(line.Function.Name, fn) {
+					return s
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var protoMemSink []*[64]byte
+
+func allocateForProto() {
+	for i := range protoMemSink {
+		protoMemSink[i] = new([64]byte)
+	}
+}
+
+func TestHeapProfileProto(t *testing.T) {
+	oldRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() {
+		runtime.MemProfileRate = oldRate
+	}()
+	protoMemSink = make([]*[64]byte, 16)
+	allocateForProto()
+	runtime.GC() // materialize stats
+
+	p := readProto(t, "heap")
+	checkSampleTypes(t, p, "alloc_objects/count", "alloc_space/bytes", "inuse_objects/count", "inuse_space/bytes")
+	if p.Period != 1 {
+		t.Errorf("period = %d, want 1", p.Period)
+	}
+	s := findSample(p, "runtime/pprof_test.allocateForProto")
+	if s == nil {
+		t.Fatal("no sample for allocateForProto")
+	}
+	if s.Value[0] < 16 || s.Value[1] < 16*64 {
+		t.Errorf("allocateForProto allocated %d objects, %d bytes; want at least 16, %d", s.Value[0], s.Value[1], 16*64)
+	}
+	if size := s.NumLabel["bytes"]; len(size) != 1 || size[0] != 64 {
+		t.Errorf("allocateForProto bytes label = %v, want [64]", size)
+	}
+	for _, loc := range s.Location {
+		line := loc.Line[0]
+		if line.Function.Name == "runtime/pprof_test.allocateForProto" {
+			if !strings.HasSuffix(line.Function.Filename, "runtime/pprof/proto_test.go") || line.Line != 61 {
+				t.Errorf("allocateForProto location is %s:%d, want proto_test.go:61", line.Function.Filename, line.Line)
+			}
+		}
+	}
+	if runtime.GOOS == "linux" {
+		// The locations in the program are symbolized
+		// and belong to the program's mapping.
+		if len(p.Mapping) == 0 || !p.Mapping[0].HasFunctions {
+			t.Fatalf("missing or unsymbolized program mapping: %v", p.Mapping)
+		}
+		if m := s.Location[0].Mapping; m != p.Mapping[0] {
+			t.Errorf("allocation is in mapping %v, want %v", m, p.Mapping[0])
+		}
+	}
+}
+
+func TestGoroutineProfileProto(t *testing.T) {
+	c := make(chan int)
+	done := make(chan bool)
+	Do(context.Background(), Labels("key", "value"), func(context.Context) {
+		for i := 0; i < 5; i++ {
+			go func() {
+				<-c
+				done <- true
+			}()
+		}
+	})
+	time.Sleep(10 * time.Millisecond) // let goroutines block on channel
+
+	p := readProto(t, "goroutine")
+	close(c)
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+
+	checkSampleTypes(t, p, "goroutine/count")
+	s := findSample(p, "runtime/pprof_test.TestGoroutineProfileProto.func1.1")
+	if s == nil {
+		t.Fatal("no sample for the labeled goroutines")
+	}
+	if s.Value[0] != 5 {
+		t.Errorf("%d labeled goroutines, want 5", s.Value[0])
+	}
+	if !hasLabel(s.Label, "key", "value") {
+		t.Errorf("goroutine labels = %v, want key=value", s.Label)
+	}
+}
+
+func TestMutexProfileProto(t *testing.T) {
+	old := runtime.SetMutexProfileFraction(1)
+	defer runtime.SetMutexProfileFraction(old)
+
+	blockMutex()
+
+	p := readProto(t, "mutex")
+	checkSampleTypes(t, p, "contentions/count", "delay/nanoseconds")
+	s := findSample(p, "runtime/pprof_test.blockMutex.func1")
+	if s == nil {
+		t.Fatal("no sample for the unlock in blockMutex")
+	}
+	if s.Value[0] < 1 || s.Value[1] <= 0 {
+		t.Errorf("blockMutex sample values = %v, want positive", s.Value)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Goroutine preemption
+//
+// A goroutine can be preempted at any safe-point. Currently, there
+// are a few categories of safe-points:
+//
+// 1. A blocked safe-point occurs for the duration that a goroutine is
+//    descheduled, blocked on synchronization, or in a system call.
+//
+// 2. Synchronous safe-points occur when a running goroutine checks
+//    for a preemption request, in the stack check of a function
+//    prologue (see newstack).
+//
+// 3. Asynchronous safe-points occur at any instruction in user code
+//    where the goroutine can be safely paused and a conservative
+//    stack and register scan can find stack roots. The runtime can
+//    stop a goroutine at an async safe-point using a signal.
+//
+// At both blocked and synchronous safe-points, a goroutine's CPU
+// state is minimal and the garbage collector has complete
+// information about its entire stack. This makes it possible to
+// deschedule a goroutine with minimal space, and to precisely scan
+// a goroutine's stack.
+//
+// Synchronous safe-points are implemented by overloading the stack
+// bound check in function prologues. To preempt a goroutine at the
+// next synchronous safe-point, the runtime poisons the goroutine's
+// stack bound (see preemptone). A loop without function calls never
+// reaches one, and may delay a stop-the-world or starve other
+// goroutines indefinitely.
+//
+// Preemption at asynchronous safe-points is implemented by
+// suspending the thread using an OS mechanism (e.g., signals) and
+// inspecting its state to determine if the goroutine was at an
+// async safe-point. If so, the signal handler injects a call to
+// asyncPreempt, which saves all registers and enters the scheduler
+// as if the goroutine had called runtime.Gosched (see asyncPreempt2).
+//
+// The compiler marks code where preemption is unsafe, such as the
+// window between a check of writeBarrier.enabled and the store it
+// guards (see PCDATA_UnsafePoint). Assembly functions, function
+// prologues and the runtime are never preempted asynchronously.
+//
+// The frame of the interrupted function is not at a call, so the
+// compiler has no stack map for it. The GC scans it, and the
+// registers saved by asyncPreempt, conservatively (see scanstack).
+// Since it cannot adjust pointers into such a frame, the stack of a
+// goroutine stopped at an async safe-point is never moved.
+//
+// Asynchronous preemption is implemented only on linux/amd64, where
+// the SSA back end marks unsafe points. The old back end used by the
+// other architectures marks only write barriers.
+//
+// Setting GODEBUG=asyncpreemptoff=1 disables asynchronous preemption.
+
+package runtime
+
+import "runtime/internal/sys"
+
+// asyncPreemptStack is the bytes of stack space required to inject
+// an asyncPreempt call: the frame of asyncPreempt, and the nosplit
+// limit for asyncPreempt2 and what it calls.
+var asyncPreemptStack = ^uintptr(0)
+
+// preemptinit sets up asynchronous preemption.
+func preemptinit() {
+	f := findfunc(funcPC(asyncPreempt))
+	asyncPreemptStack = uintptr(funcMaxSPDelta(f)) + sys.MinFrameSize + _StackLimit
+}
+
+// asyncPreempt2 is called by asyncPreempt, once it has saved the
+// registers of the interrupted goroutine.
+//
+//go:nosplit
+func asyncPreempt2() {
+	gp := getg()
+	gp.asyncSafePoint = true
+	mcall(asyncPreempt_m)
+	gp.asyncSafePoint = false
+}
+
+// asyncPreempt_m preempts gp, like the preemption check in newstack.
+// It runs on g0.
+func asyncPreempt_m(gp *g) {
+	if gp.preemptscan {
+		// The GC only asked gp to scan its own stack.
+		casgstatus(gp, _Grunning, _Gwaiting)
+		gp.waitreason = "preempted"
+		preemptscan_m(gp)
+		casgstatus(gp, _Gwaiting, _Grunning)
+		gogo(&gp.sched) // never return
+	}
+	gopreempt_m(gp) // never return
+}
+
+// wantAsyncPreempt reports whether an asynchronous preemption of gp
+// is requested.
+func wantAsyncPreempt(gp *g) bool {
+	return gp.preempt && readgstatus(gp)&^_Gscan == _Grunning
+}
+
+// isAsyncSafePoint reports whether gp, interrupted at the given PC
+// and SP, is at an asynchronous safe point: that it is running user
+// code, that the instruction at pc is not marked unsafe, and that
+// there is room on the stack to inject a call to asyncPreempt.
+//
+// It runs in a signal handler, so it must not allocate or lock.
+//
+//go:nowritebarrierrec
+func isAsyncSafePoint(gp *g, pc, sp uintptr) bool {
+	mp := gp.m
+
+	// Only user Gs can have safe points. We check this first
+	// because it's extremely common that we'll catch mp in the
+	// scheduler processing this G preemption.
+	if mp.curg != gp {
+		return false
+	}
+
+	// Check M state, like newstack does.
+	if mp.p == 0 || mp.locks != 0 || mp.mallocing != 0 || mp.preemptoff != "" || mp.p.ptr().status != _Prunning {
+		return false
+	}
+
+	// Check stack space.
+	if sp < gp.stack.lo || sp-gp.stack.lo < asyncPreemptStack {
+		return false
+	}
+
+	// Check if PC is an unsafe-point.
+	f := findfunc(pc)
+	if f == nil {
+		// Not Go code.
+		return false
+	}
+	if pcdatavalue(f, _PCDATA_UnsafePoint, pc, nil) != _PCDATA_UnsafePointSafe {
+		return false
+	}
+	// The runtime and reflect have many invariants that do not
+	// hold between instructions, and are not marked unsafe.
+	name := funcname(f)
+	if hasprefix(name, "runtime.") || hasprefix(name, "runtime/internal/") || hasprefix(name, "reflect.") {
+		return false
+	}
+	return true
+}
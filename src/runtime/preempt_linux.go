@@ -0,0 +1,35 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64
+
+package runtime
+
+// preemptMSupported is true if preemptM is implemented.
+const preemptMSupported = true
+
+// sigPreempt is the signal used for asynchronous preemption.
+//
+// SIGURG is rarely used, and programs that use it don't mind
+// spurious deliveries, since they have to handle it for sockets
+// anyway. The runtime passes it on to os/signal as usual.
+const sigPreempt = _SIGURG
+
+// asyncPreempt saves all user registers and calls asyncPreempt2.
+// It is not called directly: the signal handler injects a call to
+// it at an asynchronous safe point (see preemptM).
+//
+// Implemented in assembly.
+func asyncPreempt()
+
+func getpid() int
+func tgkill(tgid, tid, sig int)
+
+// preemptM sends a preemption request to mp. mp may be running
+// code that is not at an asynchronous safe point, in which case
+// the request is ignored and the goroutine is preempted at the
+// next synchronous safe point instead.
+func preemptM(mp *m) {
+	tgkill(getpid(), int(mp.procid), sigPreempt)
+}
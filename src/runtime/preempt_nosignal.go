@@ -0,0 +1,20 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux !amd64
+
+package runtime
+
+// Asynchronous preemption is not implemented on this platform.
+
+const preemptMSupported = false
+
+const sigPreempt = 0
+
+func asyncPreempt() {
+	throw("asyncPreempt not implemented")
+}
+
+func preemptM(mp *m) {
+}
@@ -429,6 +429,7 @@ func schedinit() {
 
 	tracebackinit()
 	moduledataverify()
+	preemptinit()
 	stackinit()
 	mallocinit()
 	mcommoninit(_g_.m)
@@ -729,6 +730,9 @@ func casgstatus(gp *g, oldval, newval uint32) {
 	if newval == _Grunning {
 		gp.gcscanvalid = false
 	}
+	if gp.tracking || newval == _Grunnable {
+		trackSchedTime(gp, oldval, newval)
+	}
 }
 
 // casgstatus(gp, oldstatus, Gcopystack), assuming oldstatus is Gwaiting or Grunnable.
@@ -762,6 +766,10 @@ func scang(gp *g) {
 
 	gp.gcscandone = false
 
+	// The time at which to signal gp's M again, in case
+	// the previous signal missed an asynchronous safe point.
+	var nextPreemptM int64
+
 	// Endeavor to get gcscandone set to true,
 	// either by doing the stack scan ourselves or by coercing gp to scan itself.
 	// gp.gcscandone can transition from false to true when we're not looking
@@ -798,11 +806,12 @@ func scang(gp *g) {
 
 		case _Grunning:
 			// Goroutine running. Try to preempt execution so it can scan itself.
-			// The preemption handler (in newstack) does the actual scan.
+			// The preemption handler (in newstack or asyncPreempt) does the actual scan.
 
 			// Optimization: if there is already a pending preemption request
-			// (from the previous loop iteration), don't bother with the atomics.
-			if gp.preemptscan && gp.preempt && gp.stackguard0 == stackPreempt {
+			// (from the previous loop iteration), don't bother with the atomics,
+			// unless it is time to signal gp's M again.
+			if gp.preemptscan && gp.preempt && gp.stackguard0 == stackPreempt && nanotime() < nextPreemptM {
 				break
 			}
 
@@ -812,6 +821,11 @@ func scang(gp *g) {
 					gp.preemptscan = true
 					gp.preempt = true
 					gp.stackguard0 = stackPreempt
+					if preemptMSupported && debug.asyncpreemptoff == 0 {
+						// gp.m can't change while we hold the scan bit.
+						preemptM(gp.m)
+						nextPreemptM = nanotime() + 5*1000
+					}
 				}
 				casfrom_Gscanstatus(gp, _Gscanrunning, _Grunning)
 			}
@@ -854,7 +868,7 @@ func restartg(gp *g) {
 // in panic or being exited, this may not reliably stop all
 // goroutines.
 func stopTheWorld(reason string) {
-	semacquire(&worldsema, false)
+	semacquire(&worldsema, 0)
 	getg().m.preemptoff = reason
 	systemstack(stopTheWorldWithSema)
 }
@@ -877,7 +891,7 @@ var worldsema uint32 = 1
 // preemption first and then should stopTheWorldWithSema on the system
 // stack:
 //
-//	semacquire(&worldsema, false)
+//	semacquire(&worldsema, 0)
 //	m.preemptoff = "reason"
 //	systemstack(stopTheWorldWithSema)
 //
@@ -1732,6 +1746,10 @@ func execute(gp *g, inheritTime bool) {
 	gp.waitsince = 0
 	gp.preempt = false
 	gp.stackguard0 = gp.stack.lo + _StackGuard
+	if gp.schedLatency != 0 {
+		schedlatencyevent(gp, gp.schedLatency)
+		gp.schedLatency = 0
+	}
 	if !inheritTime {
 		_g_.m.p.ptr().schedtick++
 	}
@@ -2175,6 +2193,10 @@ func goexit0(gp *g) {
 	gp.writebuf = nil
 	gp.waitreason = ""
 	gp.param = nil
+	gp.tracking = false
+	gp.runnableTime = 0
+	gp.runningTime = 0
+	setProfLabel(gp, nil)
 
 	dropg()
 
@@ -2697,6 +2719,9 @@ func newproc1(fn *funcval, argp *uint8, narg int32, nret int32, callerpc uintptr
 	gostartcallfn(&newg.sched, fn)
 	newg.gopc = callerpc
 	newg.startpc = fn.fn
+	if _g_.m.curg != nil {
+		newg.labels = _g_.m.curg.labels
+	}
 	if isSystemGoroutine(newg) {
 		atomic.Xadd(&sched.ngsys, +1)
 	}
@@ -3063,7 +3088,11 @@ func sigprof(pc, sp, lr uintptr, gp *g, mp *m) {
 			osyield()
 		}
 		if prof.hz != 0 {
-			cpuprof.add(stk[:n])
+			var labels unsafe.Pointer
+			if mp.curg != nil {
+				labels = mp.curg.labels
+			}
+			cpuprof.add(stk[:n], labels)
 		}
 		atomic.Store(&prof.lock, 0)
 	}
@@ -3429,6 +3458,7 @@ func sysmon() {
 
 	lastscavenge := nanotime()
 	nscavenge := 0
+	lastlimitscavenge := int64(0)
 
 	lasttrace := int64(0)
 	idle := 0 // how many cycles in succession we had not wokeup somebody
@@ -3505,6 +3535,13 @@ func sysmon() {
 			lastscavenge = now
 			nscavenge++
 		}
+		// and every 10ms while over the memory limit
+		if lastlimitscavenge+10*1000*1000 < now && overMemoryLimit() {
+			lock(&mheap_.lock)
+			mheap_.scavengeLimit()
+			unlock(&mheap_.lock)
+			lastlimitscavenge = now
+		}
 		if debug.schedtrace > 0 && lasttrace+int64(debug.schedtrace)*1000000 <= now {
 			lasttrace = now
 			schedtrace(debug.scheddetail > 0)
@@ -3624,6 +3661,13 @@ func preemptone(_p_ *p) bool {
 	// Setting gp->stackguard0 to StackPreempt folds
 	// preemption into the normal stack overflow check.
 	gp.stackguard0 = stackPreempt
+
+	// A goroutine in a loop without calls never reaches the
+	// check above. Interrupt it in case it is at an
+	// asynchronous safe point.
+	if preemptMSupported && debug.asyncpreemptoff == 0 {
+		preemptM(mp)
+	}
 	return true
 }
 
@@ -3656,7 +3700,7 @@ func schedtrace(detailed bool) {
 			if mp != nil {
 				id = mp.id
 			}
-			print("  P", i, ": status=", _p_.status, " schedtick=", _p_.schedtick, " syscalltick=", _p_.syscalltick, " m=", id, " runqsize=", t-h, " gfreecnt=", _p_.gfreecnt, "\n")
+			print("  P", i, ": status=", _p_.status, " schedtick=", _p_.schedtick, " syscalltick=", _p_.syscalltick, " m=", id, " runqsize=", t-h, " gfreecnt=", _p_.gfreecnt, " runnabletime=", _p_.runnableTime/1e6, "ms runningtime=", _p_.runningTime/1e6, "ms\n")
 		} else {
 			// In non-detailed mode format lengths of per-P run queues as:
 			// [len1 len2 len3 len4]
@@ -3708,7 +3752,7 @@ func schedtrace(detailed bool) {
 		if lockedm != nil {
 			id2 = lockedm.id
 		}
-		print("  G", gp.goid, ": status=", readgstatus(gp), "(", gp.waitreason, ") m=", id1, " lockedm=", id2, "\n")
+		print("  G", gp.goid, ": status=", readgstatus(gp), "(", gp.waitreason, ") m=", id1, " lockedm=", id2, " runnabletime=", gp.runnableTime/1e6, "ms runningtime=", gp.runningTime/1e6, "ms\n")
 	}
 	unlock(&allglock)
 	unlock(&sched.lock)
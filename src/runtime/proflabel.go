@@ -0,0 +1,46 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// Profiler labels.
+//
+// The labels of a goroutine are an opaque pointer managed by
+// runtime/pprof. A new goroutine inherits the labels of its creator,
+// and the CPU profiler and goroutine profile record the labels of the
+// goroutines they observe.
+
+// labelSync is a race detector synchronization point: setting labels
+// happens before the goroutine profile reads them.
+var labelSync uintptr
+
+//go:linkname runtime_setProfLabel runtime/pprof.runtime_setProfLabel
+func runtime_setProfLabel(labels unsafe.Pointer) {
+	if raceenabled {
+		racereleasemerge(unsafe.Pointer(&labelSync))
+	}
+	setProfLabel(getg(), labels)
+}
+
+//go:linkname runtime_getProfLabel runtime/pprof.runtime_getProfLabel
+func runtime_getProfLabel() unsafe.Pointer {
+	return getg().labels
+}
+
+// setProfLabel sets the profiler labels of gp.
+//
+// The CPU profiler copies label pointers into its tag table from the
+// signal handler, without write barriers (see cpuProfile.addTag).
+// A label pointer stored there after the garbage collector scanned the
+// table must still be reachable from a goroutine when that goroutine is
+// scanned, so the labels being replaced are shaded as by a deletion
+// barrier.
+func setProfLabel(gp *g, labels unsafe.Pointer) {
+	if old := gp.labels; old != nil && writeBarrier.needed {
+		writebarrierptr_nostore1((*uintptr)(unsafe.Pointer(&gp.labels)), uintptr(old))
+	}
+	gp.labels = labels
+}
@@ -315,6 +315,7 @@ type dbgVar struct {
 // already have an initial value.
 var debug struct {
 	allocfreetrace    int32
+	asyncpreemptoff   int32
 	cgocheck          int32
 	efence            int32
 	gccheckmark       int32
@@ -325,8 +326,10 @@ var debug struct {
 	gcstoptheworld    int32
 	gctrace           int32
 	invalidptr        int32
+	madvfree          int32
 	sbrk              int32
 	scavenge          int32
+	scavtrace         int32
 	scheddetail       int32
 	schedtrace        int32
 	wbshadow          int32
@@ -334,6 +337,7 @@ var debug struct {
 
 var dbgvars = []dbgVar{
 	{"allocfreetrace", &debug.allocfreetrace},
+	{"asyncpreemptoff", &debug.asyncpreemptoff},
 	{"cgocheck", &debug.cgocheck},
 	{"efence", &debug.efence},
 	{"gccheckmark", &debug.gccheckmark},
@@ -344,8 +348,10 @@ var dbgvars = []dbgVar{
 	{"gcstoptheworld", &debug.gcstoptheworld},
 	{"gctrace", &debug.gctrace},
 	{"invalidptr", &debug.invalidptr},
+	{"madvfree", &debug.madvfree},
 	{"sbrk", &debug.sbrk},
 	{"scavenge", &debug.scavenge},
+	{"scavtrace", &debug.scavtrace},
 	{"scheddetail", &debug.scheddetail},
 	{"schedtrace", &debug.schedtrace},
 	{"wbshadow", &debug.wbshadow},
@@ -168,6 +168,7 @@ type sudog struct {
 	next        *sudog
 	prev        *sudog
 	elem        unsafe.Pointer // data element
+	acquiretime int64
 	releasetime int64
 	nrelease    int32  // -1 for acquire
 	waitlink    *sudog // g.waiting list
@@ -248,6 +249,7 @@ type g struct {
 	preemptscan    bool   // preempted g does scan for gc
 	gcscandone     bool   // g has scanned stack; protected by _Gscan bit in status
 	gcscanvalid    bool   // false at start of gc cycle, true if G has not run since last scan
+	asyncSafePoint bool   // g is stopped at an asynchronous safe point; its stack is scanned conservatively
 	throwsplit     bool   // must not split stack
 	raceignore     int8   // ignore race detection events
 	sysblocktraced bool   // StartTrace has emitted EvGoInSyscall about this goroutine
@@ -262,7 +264,17 @@ type g struct {
 	gopc           uintptr // pc of go statement that created this goroutine
 	startpc        uintptr // pc of goroutine function
 	racectx        uintptr
-	waiting        *sudog // sudog structures this g is waiting on (that have a valid elem ptr)
+	waiting        *sudog         // sudog structures this g is waiting on (that have a valid elem ptr)
+	labels         unsafe.Pointer // profiler labels
+
+	// Scheduling time accounting; see schedtime.go.
+	tracking      bool  // runnable and running times of the current scheduling cycle are measured
+	trackingSeq   uint8 // scheduling cycles of this g, modulo 256
+	runnableStamp int64 // nanotime when g became runnable, if tracking
+	runningStamp  int64 // nanotime when g started running, if tracking
+	runnableTime  int64 // estimated nanoseconds g has spent runnable
+	runningTime   int64 // estimated nanoseconds g has spent running
+	schedLatency  int64 // measured runnable time before g last started running, for the profile
 
 	// Per-G gcController state
 
@@ -385,6 +397,10 @@ type p struct {
 
 	palloc persistentAlloc // per-P to avoid mutex
 
+	// Scheduling time accounting; see schedtime.go.
+	runnableTime int64 // estimated nanoseconds goroutines waited before running on this P
+	runningTime  int64 // estimated nanoseconds goroutines ran on this P
+
 	// Per-P GC state
 	gcAssistTime     int64 // Nanoseconds in assistAlloc
 	gcBgMarkWorker   guintptr
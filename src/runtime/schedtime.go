@@ -0,0 +1,92 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Scheduling time accounting.
+//
+// The scheduler measures how long goroutines wait between becoming
+// runnable and starting to run (their scheduling latency), and how
+// long they then run. Reading the clock on every status change
+// would slow down the scheduler, so each goroutine is measured for
+// one in gTrackingPeriod of its scheduling cycles: the cycle from
+// becoming runnable until it next becomes runnable. Totals are
+// scaled by gTrackingPeriod to estimate the time spent by all
+// cycles.
+//
+// The estimates are accumulated per goroutine (g.runnableTime and
+// g.runningTime), per P (p.runnableTime and p.runningTime, charged
+// to the P the goroutine runs on) and for the whole program
+// (schedTime). The measured latencies are also recorded in the
+// schedLatencyDist histogram and, if enabled, in the scheduling
+// latency profile (see schedlatencyevent).
+
+package runtime
+
+import "runtime/internal/atomic"
+
+// gTrackingPeriod is the number of scheduling cycles of a goroutine
+// per cycle whose runnable and running times are measured.
+const gTrackingPeriod = 8
+
+// schedTime is the estimated time, in nanoseconds, that all
+// goroutines have spent runnable and running. Updated atomically.
+var schedTime struct {
+	runnable uint64
+	running  uint64
+}
+
+// schedLatencyDist records the distribution of measured scheduling
+// latencies.
+var schedLatencyDist timeHistogram
+
+// trackSchedTime updates the scheduling time accounting of gp for a
+// status change from oldval to newval. It is called by casgstatus
+// when gp is tracking or becomes runnable.
+//
+//go:nosplit
+func trackSchedTime(gp *g, oldval, newval uint32) {
+	var now int64
+	if oldval == _Grunning && gp.runningStamp != 0 {
+		now = nanotime()
+		d := (now - gp.runningStamp) * gTrackingPeriod
+		gp.runningStamp = 0
+		gp.runningTime += d
+		if pp := getg().m.p.ptr(); pp != nil {
+			pp.runningTime += d
+		}
+		atomic.Xadd64(&schedTime.running, d)
+	}
+
+	switch newval {
+	case _Grunnable:
+		// A new scheduling cycle starts.
+		gp.trackingSeq++
+		gp.tracking = gp.trackingSeq%gTrackingPeriod == 0
+		if gp.tracking {
+			if now == 0 {
+				now = nanotime()
+			}
+			gp.runnableStamp = now
+		}
+	case _Grunning:
+		if !gp.tracking {
+			break
+		}
+		if now == 0 {
+			now = nanotime()
+		}
+		if oldval == _Grunnable && gp.runnableStamp != 0 {
+			lat := now - gp.runnableStamp
+			gp.runnableStamp = 0
+			gp.schedLatency = lat
+			schedLatencyDist.record(lat)
+			d := lat * gTrackingPeriod
+			gp.runnableTime += d
+			if pp := getg().m.p.ptr(); pp != nil {
+				pp.runnableTime += d
+			}
+			atomic.Xadd64(&schedTime.runnable, d)
+		}
+		gp.runningStamp = now
+	}
+}
@@ -44,12 +44,17 @@ var semtable [semTabSize]struct {
 
 //go:linkname sync_runtime_Semacquire sync.runtime_Semacquire
 func sync_runtime_Semacquire(addr *uint32) {
-	semacquire(addr, true)
+	semacquire(addr, semaBlockProfile)
+}
+
+//go:linkname sync_runtime_SemacquireMutex sync.runtime_SemacquireMutex
+func sync_runtime_SemacquireMutex(addr *uint32) {
+	semacquire(addr, semaBlockProfile|semaMutexProfile)
 }
 
 //go:linkname net_runtime_Semacquire net.runtime_Semacquire
 func net_runtime_Semacquire(addr *uint32) {
-	semacquire(addr, true)
+	semacquire(addr, semaBlockProfile)
 }
 
 //go:linkname sync_runtime_Semrelease sync.runtime_Semrelease
@@ -62,8 +67,15 @@ func net_runtime_Semrelease(addr *uint32) {
 	semrelease(addr)
 }
 
+type semaProfileFlags int
+
+const (
+	semaBlockProfile semaProfileFlags = 1 << iota
+	semaMutexProfile
+)
+
 // Called from runtime.
-func semacquire(addr *uint32, profile bool) {
+func semacquire(addr *uint32, profile semaProfileFlags) {
 	gp := getg()
 	if gp != gp.m.curg {
 		throw("semacquire not on the G stack")
@@ -83,11 +95,18 @@ func semacquire(addr *uint32, profile bool) {
 	s := acquireSudog()
 	root := semroot(addr)
 	t0 := int64(0)
+	s.acquiretime = 0
 	s.releasetime = 0
-	if profile && blockprofilerate > 0 {
+	if profile&semaBlockProfile != 0 && blockprofilerate > 0 {
 		t0 = cputicks()
 		s.releasetime = -1
 	}
+	if profile&semaMutexProfile != 0 && mutexprofilerate > 0 {
+		if t0 == 0 {
+			t0 = cputicks()
+		}
+		s.acquiretime = t0
+	}
 	for {
 		lock(&root.lock)
 		// Add ourselves to nwait to disable "easy case" in semrelease.
@@ -139,6 +158,19 @@ func semrelease(addr *uint32) {
 			break
 		}
 	}
+	if s != nil && s.acquiretime != 0 {
+		// The woken goroutine waited on addr since s.acquiretime,
+		// and the other waiters have now waited for this release.
+		// Charge the wait to the releasing goroutine, and restart
+		// the clock of the goroutines that are still waiting.
+		t0 := cputicks()
+		for x := root.head; x != nil; x = x.next {
+			if x.elem == unsafe.Pointer(addr) && x.acquiretime != 0 {
+				x.acquiretime = t0
+			}
+		}
+		mutexevent(t0-s.acquiretime, 3)
+	}
 	unlock(&root.lock)
 	if s != nil {
 		if s.releasetime != 0 {
@@ -36,6 +36,17 @@ func dumpregs(c *sigctxt) {
 	print("gs     ", hex(c.gs()), "\n")
 }
 
+// pushCall makes it look like the interrupted instruction called
+// the function at targetPC, so that the function returns to it.
+func (c *sigctxt) pushCall(targetPC uintptr) {
+	pc := uintptr(c.rip())
+	sp := uintptr(c.rsp())
+	sp -= sys.PtrSize
+	*(*uintptr)(unsafe.Pointer(sp)) = pc
+	c.set_rsp(uint64(sp))
+	c.set_rip(uint64(targetPC))
+}
+
 var crashing int32
 
 // May run during STW, so write barriers are not allowed.
@@ -50,6 +61,14 @@ func sighandler(sig uint32, info *siginfo, ctxt unsafe.Pointer, gp *g) {
 		return
 	}
 
+	if sig == sigPreempt && preemptMSupported && debug.asyncpreemptoff == 0 {
+		// Might be a preemption signal (see preemptM).
+		if wantAsyncPreempt(gp) && isAsyncSafePoint(gp, uintptr(c.rip()), uintptr(c.rsp())) {
+			c.pushCall(funcPC(asyncPreempt))
+		}
+		// The signal may also be for the program, so fall through.
+	}
+
 	if GOOS == "darwin" {
 		// x86-64 has 48-bit virtual addresses. The top 16 bits must echo bit 47.
 		// The hardware delivers a different kind of fault for a malformed address
@@ -908,22 +908,8 @@ func newstack() {
 			throw("runtime: g is running but p is not")
 		}
 		if gp.preemptscan {
-			for !castogscanstatus(gp, _Gwaiting, _Gscanwaiting) {
-				// Likely to be racing with the GC as
-				// it sees a _Gwaiting and does the
-				// stack scan. If so, gcworkdone will
-				// be set and gcphasework will simply
-				// return.
-			}
-			if !gp.gcscandone {
-				scanstack(gp)
-				gp.gcscandone = true
-			}
-			gp.preemptscan = false
-			gp.preempt = false
-			casfrom_Gscanstatus(gp, _Gscanwaiting, _Gwaiting)
+			preemptscan_m(gp)
 			casgstatus(gp, _Gwaiting, _Grunning)
-			gp.stackguard0 = gp.stack.lo + _StackGuard
 			gogo(&gp.sched) // never return
 		}
 
@@ -1017,6 +1003,12 @@ func shrinkstack(gp *g) {
 	if sys.GoosWindows != 0 && gp.m != nil && gp.m.libcallsp != 0 {
 		return
 	}
+	// We can't copy the stack if gp is stopped at an asynchronous
+	// safe point. Its innermost frames have no stack maps, so
+	// pointers into them can't be adjusted.
+	if gp.asyncSafePoint {
+		return
+	}
 
 	if stackDebug > 0 {
 		print("shrinking stack ", oldsize, "->", newsize, "\n")
@@ -1060,6 +1052,27 @@ func freeStackSpans() {
 	unlock(&stackLarge.lock)
 }
 
+// preemptscan_m scans the stack of gp, which was preempted because
+// the GC asked it to scan its own stack, and clears the preemption
+// request. gp must be _Gwaiting.
+func preemptscan_m(gp *g) {
+	for !castogscanstatus(gp, _Gwaiting, _Gscanwaiting) {
+		// Likely to be racing with the GC as
+		// it sees a _Gwaiting and does the
+		// stack scan. If so, gcworkdone will
+		// be set and gcphasework will simply
+		// return.
+	}
+	if !gp.gcscandone {
+		scanstack(gp)
+		gp.gcscandone = true
+	}
+	gp.preemptscan = false
+	gp.preempt = false
+	casfrom_Gscanstatus(gp, _Gscanwaiting, _Gwaiting)
+	gp.stackguard0 = gp.stack.lo + _StackGuard
+}
+
 //go:nosplit
 func morestackc() {
 	systemstack(func() {
@@ -381,6 +381,34 @@ func atoi(s string) int {
 	return n
 }
 
+// parseByteCount parses a non-negative number of bytes with an
+// optional unit suffix: B, KiB, MiB, GiB or TiB.
+// It reports whether s is well-formed and its value fits in an int64.
+func parseByteCount(s string) (int64, bool) {
+	shift := uint(0)
+	for i, unit := range [...]string{"TiB", "GiB", "MiB", "KiB", "B"} {
+		if len(s) > len(unit) && s[len(s)-len(unit):] == unit {
+			s = s[:len(s)-len(unit)]
+			shift = 10 * uint(4-i)
+			break
+		}
+	}
+	if s == "" {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' || n > (1<<63-1)/10 {
+			return 0, false
+		}
+		n = n*10 + uint64(s[i]-'0')
+	}
+	if n > (1<<63-1)>>shift {
+		return 0, false
+	}
+	return int64(n << shift), true
+}
+
 //go:nosplit
 func findnull(s *byte) int {
 	if s == nil {
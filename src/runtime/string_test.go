@@ -248,3 +248,34 @@ func TestString2Slice(t *testing.T) {
 		t.Errorf("want cap of 4, got %d", cap(r))
 	}
 }
+
+func TestParseByteCount(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out int64
+		ok  bool
+	}{
+		{"", 0, false},
+		{"B", 0, false},
+		{"KiB", 0, false},
+		{"-1", 0, false},
+		{"1.5GiB", 0, false},
+		{"1GB", 0, false},
+		{"0", 0, true},
+		{"1024", 1024, true},
+		{"1024B", 1024, true},
+		{"4KiB", 4 << 10, true},
+		{"512MiB", 512 << 20, true},
+		{"2GiB", 2 << 30, true},
+		{"3TiB", 3 << 40, true},
+		{"9223372036854775807", 1<<63 - 1, true},
+		{"9223372036854775808", 0, false},
+		{"8388608TiB", 0, false},
+		{"8388607TiB", 8388607 << 40, true},
+	} {
+		out, ok := runtime.ParseByteCount(test.in)
+		if out != test.out || ok != test.ok {
+			t.Errorf("ParseByteCount(%q) = %v, %v, want %v, %v", test.in, out, ok, test.out, test.ok)
+		}
+	}
+}
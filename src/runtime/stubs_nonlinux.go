@@ -0,0 +1,11 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!plan9,!solaris,!windows,!nacl
+
+package runtime
+
+import "unsafe"
+
+func madvise(addr unsafe.Pointer, n uintptr, flags int32)
@@ -104,11 +104,18 @@ func (f *Func) raw() *_func {
 // funcdata.h
 const (
 	_PCDATA_StackMapIndex       = 0
+	_PCDATA_UnsafePoint         = 1
 	_FUNCDATA_ArgsPointerMaps   = 0
 	_FUNCDATA_LocalsPointerMaps = 1
 	_ArgsSizeUnknown            = -0x80000000
 )
 
+// PCDATA_UnsafePoint values.
+const (
+	_PCDATA_UnsafePointSafe   = 0  // safe for async preemption
+	_PCDATA_UnsafePointUnsafe = -2 // unsafe for async preemption
+)
+
 // moduledata records information about the layout of the executable
 // image. It is written by the linker. Any changes here must be
 // matched changes to the code in cmd/internal/ld/symtab.go:symtab.
@@ -445,6 +452,25 @@ func funcspdelta(f *_func, targetpc uintptr, cache *pcvalueCache) int32 {
 	return x
 }
 
+// funcMaxSPDelta returns the maximum spdelta at any point in f.
+func funcMaxSPDelta(f *_func) int32 {
+	datap := findmoduledatap(f.entry)
+	p := datap.pclntable[f.pcsp:]
+	pc := f.entry
+	val := int32(-1)
+	max := int32(0)
+	for {
+		var ok bool
+		p, ok = step(p, &pc, &val, pc == f.entry)
+		if !ok {
+			return max
+		}
+		if val > max {
+			max = val
+		}
+	}
+}
+
 func pcdatavalue(f *_func, table int32, targetpc uintptr, cache *pcvalueCache) int32 {
 	if table < 0 || table >= f.npcdata {
 		return -1
@@ -9,6 +9,14 @@
 // in a compact form. A precise nanosecond-precision timestamp and a stack
 // trace is captured for most events.
 // See https://golang.org/s/go15trace for more info.
+//
+// The trace is a sequence of generations. Each generation is
+// self-contained: it starts with a snapshot of all goroutines and
+// ends with its own stack table and footer, so the trace can be cut
+// at any generation boundary and still be parsed. A generation ends
+// when tracing stops or when traceAdvance is called, for example by
+// a flight recorder in runtime/trace that keeps only the most recent
+// generations.
 
 package runtime
 
@@ -57,7 +65,13 @@ const (
 	traceEvNextGC         = 34 // memstats.next_gc change [timestamp, next_gc]
 	traceEvTimerGoroutine = 35 // denotes timer goroutine [timer goroutine id]
 	traceEvFutileWakeup   = 36 // denotes that the previous wakeup of this goroutine was futile [timestamp]
-	traceEvCount          = 37
+	traceEvString         = 37 // string dictionary entry [ID, length, string]
+	traceEvUserTaskCreate = 38 // trace.NewTask [timestamp, task id, parent task id, name string id, stack]
+	traceEvUserTaskEnd    = 39 // end of a task [timestamp, task id, stack]
+	traceEvUserRegion     = 40 // trace.WithRegion [timestamp, task id, mode(0:start, 1:end), name string id, stack]
+	traceEvUserLog        = 41 // trace.Log [timestamp, task id, category string id, stack], followed by [length, message]
+	traceEvGeneration     = 42 // end of a generation [generation number]
+	traceEvCount          = 43
 )
 
 const (
@@ -97,13 +111,13 @@ var trace struct {
 	enabled       bool        // when set runtime traces events
 	shutdown      bool        // set when we are waiting for trace reader to finish after setting enabled to false
 	headerWritten bool        // whether ReadTrace has emitted trace header
-	footerWritten bool        // whether ReadTrace has emitted trace footer
 	shutdownSema  uint32      // used to wait for ReadTrace completion
-	seqStart      uint64      // sequence number when tracing was started
-	ticksStart    int64       // cputicks when tracing was started
-	ticksEnd      int64       // cputicks when tracing was stopped
-	timeStart     int64       // nanotime when tracing was started
-	timeEnd       int64       // nanotime when tracing was stopped
+	gen           uint64      // number of the current generation, starting at 1
+	seqStart      uint64      // sequence number when the generation was started
+	ticksStart    int64       // cputicks when the generation was started
+	ticksEnd      int64       // cputicks when the generation was ended
+	timeStart     int64       // nanotime when the generation was started
+	timeEnd       int64       // nanotime when the generation was ended
 	reading       traceBufPtr // buffer currently handed off to user
 	empty         traceBufPtr // stack of empty buffers
 	fullHead      traceBufPtr // queue of full buffers
@@ -111,6 +125,10 @@ var trace struct {
 	reader        *g              // goroutine that called ReadTrace, or nil
 	stackTab      traceStackTable // maps stack traces to unique ids
 
+	stringsLock mutex
+	strings     map[string]uint64 // maps strings to unique ids
+	stringSeq   uint64            // last assigned string id
+
 	bufLock mutex       // protects buf
 	buf     traceBufPtr // global trace buffer, used when running without a p
 }
@@ -142,6 +160,7 @@ type traceBufHeader struct {
 	lastSeq   uint64                  // sequence number of last event
 	lastTicks uint64                  // when we wrote the last event
 	pos       int                     // next write offset in arr
+	genEnd    bool                    // buffer holds the footer of a generation
 	stk       [traceStackSize]uintptr // scratch buffer for traceback
 }
 
@@ -187,10 +206,8 @@ func StartTrace() error {
 		return errorString("tracing is already enabled")
 	}
 
-	trace.seqStart, trace.ticksStart = tracestamp()
-	trace.timeStart = nanotime()
 	trace.headerWritten = false
-	trace.footerWritten = false
+	trace.gen = 1
 
 	// Can't set trace.enabled yet. While the world is stopped, exitsyscall could
 	// already emit a delayed event (see exitTicks in exitsyscall) if we set trace.enabled here.
@@ -201,22 +218,7 @@ func StartTrace() error {
 	// trace.enabled is set afterwards once we have emitted all preliminary events.
 	_g_ := getg()
 	_g_.m.startingtrace = true
-	for _, gp := range allgs {
-		status := readgstatus(gp)
-		if status != _Gdead {
-			traceGoCreate(gp, gp.startpc)
-		}
-		if status == _Gwaiting {
-			traceEvent(traceEvGoWaiting, -1, uint64(gp.goid))
-		}
-		if status == _Gsyscall {
-			traceEvent(traceEvGoInSyscall, -1, uint64(gp.goid))
-		} else {
-			gp.sysblocktraced = false
-		}
-	}
-	traceProcStart()
-	traceGoStart()
+	traceStartGen()
 	_g_.m.startingtrace = false
 	trace.enabled = true
 
@@ -243,36 +245,10 @@ func StopTrace() {
 	}
 
 	traceGoSched()
-
-	for _, p := range &allp {
-		if p == nil {
-			break
-		}
-		buf := p.tracebuf
-		if buf != 0 {
-			traceFullQueue(buf)
-			p.tracebuf = 0
-		}
-	}
-	if trace.buf != 0 && trace.buf.ptr().pos != 0 {
-		buf := trace.buf
-		trace.buf = 0
-		traceFullQueue(buf)
-	}
-
-	for {
-		trace.ticksEnd = cputicks()
-		trace.timeEnd = nanotime()
-		// Windows time can tick only every 15ms, wait for at least one tick.
-		if trace.timeEnd != trace.timeStart {
-			break
-		}
-		osyield()
-	}
+	traceEndGen()
 
 	trace.enabled = false
 	trace.shutdown = true
-	trace.stackTab.dump()
 
 	unlock(&trace.bufLock)
 
@@ -280,7 +256,7 @@ func StopTrace() {
 
 	// The world is started but we've set trace.shutdown, so new tracing can't start.
 	// Wait for the trace reader to flush pending buffers and stop.
-	semacquire(&trace.shutdownSema, false)
+	semacquire(&trace.shutdownSema, 0)
 	if raceenabled {
 		raceacquire(unsafe.Pointer(&trace.shutdownSema))
 	}
@@ -309,16 +285,138 @@ func StopTrace() {
 		trace.empty = buf.ptr().link
 		sysFree(unsafe.Pointer(buf), unsafe.Sizeof(*buf.ptr()), &memstats.other_sys)
 	}
+	trace.strings = nil
 	trace.shutdown = false
 	unlock(&trace.lock)
 }
 
+// traceAdvance ends the current trace generation and starts a new one.
+// It returns the number of the generation it ended,
+// or 0 if tracing is not enabled.
+func traceAdvance() uint64 {
+	stopTheWorld("advance tracing")
+
+	// See the comment in StartTrace.
+	lock(&trace.bufLock)
+
+	if !trace.enabled {
+		unlock(&trace.bufLock)
+		startTheWorld()
+		return 0
+	}
+
+	// Leave the current goroutine and P stopped at the end of the
+	// generation, as the next generation starts them again.
+	traceGoSched()
+	traceProcStop(getg().m.p.ptr())
+	traceEndGen()
+	gen := trace.gen
+	trace.gen++
+	traceStartGen()
+
+	unlock(&trace.bufLock)
+
+	startTheWorld()
+	return gen
+}
+
+// traceStartGen starts a trace generation with a snapshot of all
+// goroutines and the current goroutine running on the current P.
+// The world must be stopped and trace.bufLock held.
+func traceStartGen() {
+	trace.seqStart, trace.ticksStart = tracestamp()
+	trace.timeStart = nanotime()
+	trace.strings = make(map[string]uint64)
+	trace.stringSeq = 0
+
+	for _, gp := range allgs {
+		status := readgstatus(gp)
+		if status != _Gdead {
+			traceGoCreate(gp, gp.startpc)
+		}
+		if status == _Gwaiting {
+			traceEvent(traceEvGoWaiting, -1, uint64(gp.goid))
+		}
+		// A goroutine that has returned from a syscall but has not
+		// run since is still in the syscall as far as the trace is
+		// concerned: execute emits its GoSysExit.
+		if status == _Gsyscall || status == _Grunnable && gp.syscallsp != 0 {
+			traceEvent(traceEvGoInSyscall, -1, uint64(gp.goid))
+			gp.sysblocktraced = true
+		} else {
+			gp.sysblocktraced = false
+		}
+	}
+	traceProcStart()
+	traceGoStart()
+}
+
+// traceEndGen flushes the events of the current trace generation
+// and queues its stack table and footer.
+// The world must be stopped and trace.bufLock held.
+func traceEndGen() {
+	for _, p := range &allp {
+		if p == nil {
+			break
+		}
+		buf := p.tracebuf
+		if buf != 0 {
+			traceFullQueue(buf)
+			p.tracebuf = 0
+		}
+	}
+	if trace.buf != 0 && trace.buf.ptr().pos != 0 {
+		buf := trace.buf
+		trace.buf = 0
+		traceFullQueue(buf)
+	}
+
+	for {
+		trace.ticksEnd = cputicks()
+		trace.timeEnd = nanotime()
+		// Windows time can tick only every 15ms, wait for at least one tick.
+		if trace.timeEnd != trace.timeStart {
+			break
+		}
+		osyield()
+	}
+
+	trace.stackTab.dump()
+
+	// Write footer with timer frequency.
+	// Use float64 because (trace.ticksEnd - trace.ticksStart) * 1e9 can overflow int64.
+	freq := float64(trace.ticksEnd-trace.ticksStart) * 1e9 / float64(trace.timeEnd-trace.timeStart) / traceTickDiv
+	buf := traceFlush(0).ptr()
+	buf.byte(traceEvFrequency | 0<<traceArgCountShift)
+	buf.varint(uint64(freq))
+	buf.varint(0)
+	if timers.gp != nil {
+		buf.byte(traceEvTimerGoroutine | 0<<traceArgCountShift)
+		buf.varint(uint64(timers.gp.goid))
+		buf.varint(0)
+	}
+	buf.byte(traceEvGeneration | 0<<traceArgCountShift)
+	buf.varint(trace.gen)
+	buf.varint(0)
+	buf.genEnd = true
+	lock(&trace.lock)
+	traceFullQueue(traceBufPtrOf(buf))
+	unlock(&trace.lock)
+}
+
 // ReadTrace returns the next chunk of binary tracing data, blocking until data
 // is available. If tracing is turned off and all the data accumulated while it
 // was on has been returned, ReadTrace returns nil. The caller must copy the
 // returned data before calling ReadTrace again.
 // ReadTrace must be called from one goroutine at a time.
 func ReadTrace() []byte {
+	buf, _ := readTrace()
+	return buf
+}
+
+// readTrace is ReadTrace, but also reports whether
+// the returned chunk ends a trace generation.
+func readTrace() (buf []byte, genEnd bool) {
 	// This function may need to lock trace.lock recursively
 	// (goparkunlock -> traceGoPark -> traceEvent -> traceFlush).
 	// To allow this we use trace.lockOwner.
@@ -335,7 +433,7 @@ func ReadTrace() []byte {
 		trace.lockOwner = nil
 		unlock(&trace.lock)
 		println("runtime: ReadTrace called from multiple goroutines simultaneously")
-		return nil
+		return nil, false
 	}
 	// Recycle the old buffer.
 	if buf := trace.reading; buf != 0 {
@@ -348,7 +446,7 @@ func ReadTrace() []byte {
 		trace.headerWritten = true
 		trace.lockOwner = nil
 		unlock(&trace.lock)
-		return []byte("go 1.5 trace\x00\x00\x00\x00")
+		return []byte("go 1.8 trace\x00\x00\x00\x00"), false
 	}
 	// Wait for new data.
 	if trace.fullHead == 0 && !trace.shutdown {
@@ -362,25 +460,7 @@ func ReadTrace() []byte {
 		trace.reading = buf
 		trace.lockOwner = nil
 		unlock(&trace.lock)
-		return buf.ptr().arr[:buf.ptr().pos]
-	}
-	// Write footer with timer frequency.
-	if !trace.footerWritten {
-		trace.footerWritten = true
-		// Use float64 because (trace.ticksEnd - trace.ticksStart) * 1e9 can overflow int64.
-		freq := float64(trace.ticksEnd-trace.ticksStart) * 1e9 / float64(trace.timeEnd-trace.timeStart) / traceTickDiv
-		trace.lockOwner = nil
-		unlock(&trace.lock)
-		var data []byte
-		data = append(data, traceEvFrequency|0<<traceArgCountShift)
-		data = traceAppend(data, uint64(freq))
-		data = traceAppend(data, 0)
-		if timers.gp != nil {
-			data = append(data, traceEvTimerGoroutine|0<<traceArgCountShift)
-			data = traceAppend(data, uint64(timers.gp.goid))
-			data = traceAppend(data, 0)
-		}
-		return data
+		return buf.ptr().arr[:buf.ptr().pos], buf.ptr().genEnd
 	}
 	// Done.
 	if trace.shutdown {
@@ -394,13 +474,13 @@ func ReadTrace() []byte {
 		}
 		// trace.enabled is already reset, so can call traceable functions.
 		semrelease(&trace.shutdownSema)
-		return nil
+		return nil, false
 	}
 	// Also bad, but see the comment above.
 	trace.lockOwner = nil
 	unlock(&trace.lock)
 	println("runtime: spurious wakeup of trace reader")
-	return nil
+	return nil, false
 }
 
 // traceReader returns the trace reader that should be woken up, if any.
@@ -476,8 +556,17 @@ func traceEvent(ev byte, skip int, args ...uint64) {
 		traceReleaseBuffer(pid)
 		return
 	}
+	traceEventLocked(0, mp, pid, bufp, ev, skip, args...)
+	traceReleaseBuffer(pid)
+}
+
+// traceEventLocked writes a single event to the buffer *bufp acquired
+// with traceAcquireBuffer, leaving room for extraBytes after the event
+// for the caller to append to. skip is interpreted as in traceEvent.
+func traceEventLocked(extraBytes int, mp *m, pid int32, bufp *traceBufPtr, ev byte, skip int, args ...uint64) {
 	buf := (*bufp).ptr()
-	const maxSize = 2 + 5*traceBytesPerNumber // event type, length, sequence, timestamp, stack id and two add params
+	// event type, length, sequence, timestamp, stack id and two add params
+	maxSize := 2 + 5*traceBytesPerNumber + extraBytes
 	if buf == nil || len(buf.arr)-buf.pos < maxSize {
 		buf = traceFlush(traceBufPtrOf(buf)).ptr()
 		(*bufp).set(buf)
@@ -526,7 +615,7 @@ func traceEvent(ev byte, skip int, args ...uint64) {
 		gp := mp.curg
 		var nstk int
 		if gp == _g_ {
-			nstk = callers(skip, buf.stk[:])
+			nstk = callers(skip+1, buf.stk[:]) // +1 for traceEventLocked
 		} else if gp != nil {
 			gp = mp.curg
 			// This may happen when tracing a system call,
@@ -553,7 +642,6 @@ func traceEvent(ev byte, skip int, args ...uint64) {
 		// Fill in actual length.
 		*lenp = byte(evSize - 2)
 	}
-	traceReleaseBuffer(pid)
 }
 
 // traceAcquireBuffer returns trace buffer to use and, if necessary, locks it.
@@ -597,12 +685,44 @@ func traceFlush(buf traceBufPtr) traceBufPtr {
 	bufp.link.set(nil)
 	bufp.pos = 0
 	bufp.lastTicks = 0
+	bufp.genEnd = false
 	if dolock {
 		unlock(&trace.lock)
 	}
 	return buf
 }
 
+// traceString returns the id of string s in the trace string dictionary,
+// writing a dictionary entry to *bufp the first time s is seen.
+// The caller must hold the buffer as acquired by traceAcquireBuffer.
+func traceString(bufp *traceBufPtr, s string) uint64 {
+	if s == "" {
+		return 0
+	}
+	lock(&trace.stringsLock)
+	if id, ok := trace.strings[s]; ok {
+		unlock(&trace.stringsLock)
+		return id
+	}
+	trace.stringSeq++
+	id := trace.stringSeq
+	trace.strings[s] = id
+	unlock(&trace.stringsLock)
+
+	// The map insertion above may have allocated and emitted trace
+	// events, so load *bufp only now. Nothing below may allocate.
+	buf := (*bufp).ptr()
+	size := 1 + 2*traceBytesPerNumber + len(s)
+	if buf == nil || len(buf.arr)-buf.pos < size {
+		buf = traceFlush(traceBufPtrOf(buf)).ptr()
+		(*bufp).set(buf)
+	}
+	buf.byte(traceEvString)
+	buf.varint(id)
+	buf.str(s)
+	return id
+}
+
 // traceAppend appends v to buf in little-endian-base-128 encoding.
 func traceAppend(buf []byte, v uint64) []byte {
 	for ; v >= 0x80; v >>= 7 {
@@ -630,6 +750,16 @@ func (buf *traceBuf) byte(v byte) {
 	buf.pos++
 }
 
+// str appends the length of s and s itself to buf,
+// truncating s if it does not fit.
+func (buf *traceBuf) str(s string) {
+	if room := len(buf.arr) - buf.pos - traceBytesPerNumber; len(s) > room {
+		s = s[:room]
+	}
+	buf.varint(uint64(len(s)))
+	buf.pos += copy(buf.arr[buf.pos:], s)
+}
+
 // traceStackTable maps stack traces (arrays of PC's) to unique uint32 ids.
 // It is lock-free for reading.
 type traceStackTable struct {
@@ -904,3 +1034,76 @@ func traceHeapAlloc() {
 func traceNextGC() {
 	traceEvent(traceEvNextGC, -1, memstats.next_gc)
 }
+
+// The following functions implement the user annotations of runtime/trace.
+// They record the stack of the user code calling into runtime/trace.
+
+//go:linkname trace_userTaskCreate runtime/trace.userTaskCreate
+func trace_userTaskCreate(id, parentID uint64, taskType string) {
+	if !trace.enabled {
+		return
+	}
+	// Same as in traceEvent.
+	mp, pid, bufp := traceAcquireBuffer()
+	if !trace.enabled && !mp.startingtrace {
+		traceReleaseBuffer(pid)
+		return
+	}
+	typeID := traceString(bufp, taskType)
+	traceEventLocked(0, mp, pid, bufp, traceEvUserTaskCreate, 2, id, parentID, typeID)
+	traceReleaseBuffer(pid)
+}
+
+//go:linkname trace_userTaskEnd runtime/trace.userTaskEnd
+func trace_userTaskEnd(id uint64) {
+	if !trace.enabled {
+		return
+	}
+	traceEvent(traceEvUserTaskEnd, 3, id)
+}
+
+//go:linkname trace_userRegion runtime/trace.userRegion
+func trace_userRegion(id, mode uint64, name string) {
+	if !trace.enabled {
+		return
+	}
+	mp, pid, bufp := traceAcquireBuffer()
+	if !trace.enabled && !mp.startingtrace {
+		traceReleaseBuffer(pid)
+		return
+	}
+	nameID := traceString(bufp, name)
+	traceEventLocked(0, mp, pid, bufp, traceEvUserRegion, 2, id, mode, nameID)
+	traceReleaseBuffer(pid)
+}
+
+//go:linkname trace_userLog runtime/trace.userLog
+func trace_userLog(id uint64, category, message string) {
+	if !trace.enabled {
+		return
+	}
+	mp, pid, bufp := traceAcquireBuffer()
+	if !trace.enabled && !mp.startingtrace {
+		traceReleaseBuffer(pid)
+		return
+	}
+	categoryID := traceString(bufp, category)
+	// The message follows the event, outside of its encoded length.
+	// A message that does not fit in an empty buffer is truncated.
+	extraBytes := traceBytesPerNumber + len(message)
+	traceEventLocked(extraBytes, mp, pid, bufp, traceEvUserLog, 2, id, categoryID)
+	bufp.ptr().str(message)
+	traceReleaseBuffer(pid)
+}
+
+// The following functions implement the flight recorder of runtime/trace.
+
+//go:linkname trace_readTrace runtime/trace.readTrace
+func trace_readTrace() (buf []byte, genEnd bool) {
+	return readTrace()
+}
+
+//go:linkname trace_advance runtime/trace.advance
+func trace_advance() uint64 {
+	return traceAdvance()
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	_ "unsafe" // for go:linkname'd function bodies in runtime
+)
+
+type traceContextKey struct{}
+
+// NewTask creates a task of type taskType. If pctx carries a task,
+// the new task is its subtask. The returned context carries the new task.
+//
+// The taskType classifies tasks: analysis tools like 'go tool trace'
+// report the latency distribution of each task type and assume there
+// is a finite number of unique task types.
+//
+// A task may span several goroutines:
+//
+//	ctx, task := trace.NewTask(ctx, "handleRequest")
+//	trace.WithRegion(ctx, "parse", parse)
+//	go func() {
+//		defer task.End()
+//		trace.WithRegion(ctx, "respond", respond)
+//	}()
+func NewTask(pctx context.Context, taskType string) (ctx context.Context, task *Task) {
+	pid := fromContext(pctx).id
+	id := atomic.AddUint64(&lastTaskID, 1)
+	userTaskCreate(id, pid, taskType)
+	t := &Task{id: id}
+	return context.WithValue(pctx, traceContextKey{}, t), t
+}
+
+// fromContext returns the task carried by ctx, or the background task.
+func fromContext(ctx context.Context) *Task {
+	if t, ok := ctx.Value(traceContextKey{}).(*Task); ok {
+		return t
+	}
+	return &bgTask
+}
+
+// A Task is a logical operation, such as handling a request,
+// whose latency is traced from its creation by NewTask until End.
+type Task struct {
+	id uint64
+}
+
+// End marks the end of the task.
+// The trace tool measures the task latency up to the first call of End.
+func (t *Task) End() {
+	userTaskEnd(t.id)
+}
+
+// lastTaskID is the id of the most recently created task.
+// The background task has id 0.
+var lastTaskID uint64
+
+var bgTask = Task{id: 0}
+
+// Log emits a one-off event with the given category and message.
+// The event is associated with the task carried by ctx, if any.
+// The category may be empty; there should be only a handful of
+// unique categories.
+func Log(ctx context.Context, category, message string) {
+	id := fromContext(ctx).id
+	userLog(id, category, message)
+}
+
+// Logf is like Log, but formats the message with fmt.Sprintf.
+// The message is formatted only while tracing is enabled.
+func Logf(ctx context.Context, category, format string, args ...interface{}) {
+	if !IsEnabled() {
+		return
+	}
+	// Call userLog directly rather than Log so that
+	// the recorded stack starts at the caller of Logf.
+	id := fromContext(ctx).id
+	userLog(id, category, fmt.Sprintf(format, args...))
+}
+
+// Modes of the UserRegion event.
+const (
+	regionStartCode = uint64(0)
+	regionEndCode   = uint64(1)
+)
+
+// WithRegion starts a region of the calling goroutine, runs fn,
+// and ends the region. The region is associated with the task
+// carried by ctx, if any.
+//
+// The regionType classifies regions: there should be only a
+// handful of unique region types.
+func WithRegion(ctx context.Context, regionType string, fn func()) {
+	id := fromContext(ctx).id
+	userRegion(id, regionStartCode, regionType)
+	defer userRegion(id, regionEndCode, regionType)
+	fn()
+}
+
+// StartRegion starts a region of the calling goroutine and returns it.
+// The region's End method must be called from the same goroutine.
+// Regions of a goroutine must nest: a region started after this one
+// must end before this one ends. The usual pattern is
+//
+//	defer trace.StartRegion(ctx, "flush").End()
+func StartRegion(ctx context.Context, regionType string) *Region {
+	if !IsEnabled() {
+		return noopRegion
+	}
+	id := fromContext(ctx).id
+	userRegion(id, regionStartCode, regionType)
+	return &Region{id: id, regionType: regionType}
+}
+
+// A Region is a traced interval of a goroutine's execution,
+// started by StartRegion.
+type Region struct {
+	id         uint64
+	regionType string
+}
+
+// noopRegion is returned by StartRegion while tracing is disabled.
+var noopRegion = &Region{}
+
+// End marks the end of the region.
+func (r *Region) End() {
+	if r == noopRegion {
+		return
+	}
+	userRegion(r.id, regionEndCode, r.regionType)
+}
+
+// IsEnabled reports whether tracing is enabled.
+// The result is advisory: tracing may have been started
+// or stopped by the time IsEnabled returns.
+func IsEnabled() bool {
+	return atomic.LoadInt32(&tracing.enabled) == 1
+}
+
+// Implemented in the runtime.
+
+// userTaskCreate emits a UserTaskCreate event.
+func userTaskCreate(id, parentID uint64, taskType string)
+
+// userTaskEnd emits a UserTaskEnd event.
+func userTaskEnd(id uint64)
+
+// userRegion emits a UserRegion event.
+func userRegion(id, mode uint64, regionType string)
+
+// userLog emits a UserLog event.
+func userLog(id uint64, category, message string)
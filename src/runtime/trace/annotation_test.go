@@ -0,0 +1,154 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"internal/trace"
+	"reflect"
+	"runtime"
+	. "runtime/trace"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUserTaskRegion(t *testing.T) {
+	bgctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// StartRegion is a no-op while tracing is disabled,
+	// so use WithRegion for a region that starts before tracing.
+	buf := new(bytes.Buffer)
+	WithRegion(bgctx, "pre-existing region", func() {
+		if err := Start(buf); err != nil {
+			t.Fatalf("failed to start tracing: %v", err)
+		}
+		runTracedTask(bgctx)
+	})
+	postExistingRegion := StartRegion(bgctx, "post-existing region")
+
+	// End of traced execution.
+	Stop()
+
+	postExistingRegion.End()
+
+	checkUserTaskRegion(t, buf)
+}
+
+// runTracedTask runs a task with nested regions and a log in a new goroutine.
+func runTracedTask(bgctx context.Context) {
+	var wg sync.WaitGroup
+	ctx, task := NewTask(bgctx, "task0") // EvUserTaskCreate("task0")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer task.End() // EvUserTaskEnd("task0")
+
+		WithRegion(ctx, "region0", func() {
+			// EvUserRegion("region0", start)
+			WithRegion(ctx, "region1", func() {
+				Log(ctx, "key0", "0123456789abcdef") // EvUserLog("task0", "key0", "0....f")
+			})
+			// EvUserRegion("region0", end)
+		})
+	}()
+	wg.Wait()
+}
+
+func checkUserTaskRegion(t *testing.T, buf *bytes.Buffer) {
+	events, gs, err := parseTrace(t, buf)
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+
+	type testData struct {
+		typ  byte
+		args []string
+		seen bool
+	}
+	var got []testData
+	tasks := map[uint64]string{}
+	for _, e := range events {
+		switch typ := e.Type; typ {
+		case trace.EvUserTaskCreate:
+			taskName := e.SArgs[0]
+			got = append(got, testData{trace.EvUserTaskCreate, []string{taskName}, true})
+			if e.Link != nil && e.Link.Type != trace.EvUserTaskEnd {
+				t.Errorf("task %q is linked to %v event", taskName, trace.EventDescriptions[e.Link.Type].Name)
+			}
+			tasks[e.Args[0]] = taskName
+		case trace.EvUserLog:
+			key, val := e.SArgs[0], e.SArgs[1]
+			taskName := tasks[e.Args[0]]
+			got = append(got, testData{trace.EvUserLog, []string{taskName, key, val}, true})
+		case trace.EvUserTaskEnd:
+			taskName := tasks[e.Args[0]]
+			got = append(got, testData{trace.EvUserTaskEnd, []string{taskName}, true})
+		case trace.EvUserRegion:
+			taskName := tasks[e.Args[0]]
+			regionName := e.SArgs[0]
+			got = append(got, testData{trace.EvUserRegion, []string{taskName, regionName, fmt.Sprint(e.Args[1])}, e.Link != nil})
+			if e.Link != nil && (e.Link.Type != trace.EvUserRegion || e.Link.SArgs[0] != regionName) {
+				t.Errorf("region %q is linked to %v event", regionName, trace.EventDescriptions[e.Link.Type].Name)
+			}
+		}
+	}
+	want := []testData{
+		{trace.EvUserTaskCreate, []string{"task0"}, true},
+		{trace.EvUserRegion, []string{"task0", "region0", "0"}, true},
+		{trace.EvUserRegion, []string{"task0", "region1", "0"}, true},
+		{trace.EvUserLog, []string{"task0", "key0", "0123456789abcdef"}, true},
+		{trace.EvUserRegion, []string{"task0", "region1", "1"}, false},
+		{trace.EvUserRegion, []string{"task0", "region0", "1"}, false},
+		{trace.EvUserTaskEnd, []string{"task0"}, true},
+		{trace.EvUserRegion, []string{"", "pre-existing region", "1"}, false},
+		{trace.EvUserRegion, []string{"", "post-existing region", "0"}, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got user events\n%+v\nwant\n%+v", got, want)
+	}
+
+	// The stacks of user events start in the annotated code,
+	// not in runtime/trace.
+	for _, e := range events {
+		switch e.Type {
+		case trace.EvUserTaskCreate, trace.EvUserTaskEnd, trace.EvUserRegion, trace.EvUserLog:
+			name := trace.EventDescriptions[e.Type].Name
+			if len(e.Stk) == 0 {
+				t.Errorf("%v event has no stack", name)
+				continue
+			}
+			var top string
+			if fn := runtime.FuncForPC(uintptr(e.Stk[0].PC) - 1); fn != nil {
+				top = fn.Name()
+			}
+			if !strings.HasPrefix(top, "runtime/trace_test.") {
+				t.Errorf("%v event has stack starting at %q, want test code", name, top)
+			}
+		}
+	}
+
+	// The goroutine statistics break the goroutine's execution down by region.
+	var regions []string
+	for _, g := range gs {
+		for _, r := range g.Regions {
+			if r.TotalTime < 0 || r.ExecTime < 0 || r.ExecTime > r.TotalTime {
+				t.Errorf("region %q has bad statistics %+v", r.Name, r.GExecutionStat)
+			}
+			if r.Start != nil && r.End != nil && r.TotalTime != r.End.Ts-r.Start.Ts {
+				t.Errorf("region %q has total time %v, want %v", r.Name, r.TotalTime, r.End.Ts-r.Start.Ts)
+			}
+			regions = append(regions, r.Name)
+		}
+	}
+	sort.Strings(regions)
+	if got, want := strings.Join(regions, ","), "post-existing region,pre-existing region,region0,region1"; got != want {
+		t.Errorf("goroutine regions are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A FlightRecorder traces the program continuously, keeping only
+// the most recent part of the trace in memory. A snapshot of it can
+// be written out with WriteTo, for example when the program notices
+// that something went wrong, so that the trace shows what led up to it.
+//
+// The runtime splits the trace into self-contained generations, and
+// the flight recorder drops whole generations as they become too old
+// or too large, so the snapshot is a complete trace that can be
+// analyzed with 'go tool trace'.
+//
+// A flight recorder and Start cannot be used at the same time.
+type FlightRecorder struct {
+	period time.Duration
+	size   int
+
+	writing sync.Mutex // serializes WriteTo
+
+	mu      sync.Mutex
+	cond    sync.Cond // signaled when a generation is complete or reading stops
+	enabled bool
+	reading bool         // the trace reader is running
+	header  []byte       // trace header
+	gens    []generation // complete generations, oldest first
+	cur     []byte       // data of the generation being read
+	nbytes  int          // total size of gens
+	ngen    uint64       // number of complete generations read
+	stop    chan struct{}
+}
+
+// generation is the data of one complete trace generation.
+type generation struct {
+	data  []byte
+	start time.Time // when the previous generation was complete
+}
+
+// NewFlightRecorder returns a new flight recorder with the default
+// period of 10 seconds and size of 10 MB.
+func NewFlightRecorder() *FlightRecorder {
+	r := &FlightRecorder{
+		period: 10 * time.Second,
+		size:   10 << 20,
+	}
+	r.cond.L = &r.mu
+	return r
+}
+
+// SetPeriod sets the approximate length of time covered by the
+// recorded trace. The recorder may keep somewhat more.
+// SetPeriod must be called before Start.
+func (r *FlightRecorder) SetPeriod(d time.Duration) {
+	r.period = d
+}
+
+// SetSize sets the approximate number of bytes of trace data kept
+// by the recorder. It takes precedence over the period, but the
+// recorder always keeps the most recent generation.
+// SetSize must be called before Start.
+func (r *FlightRecorder) SetSize(bytes int) {
+	r.size = bytes
+}
+
+// Start starts the flight recorder.
+// It returns an error if tracing is already enabled.
+func (r *FlightRecorder) Start() error {
+	tracing.Lock()
+	defer tracing.Unlock()
+
+	if r.period <= 0 {
+		return errors.New("trace: flight recorder period must be positive")
+	}
+	if err := runtime.StartTrace(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.enabled = true
+	r.reading = true
+	r.header = nil
+	r.gens = nil
+	r.cur = nil
+	r.nbytes = 0
+	r.ngen = 0
+	r.stop = make(chan struct{})
+	r.mu.Unlock()
+
+	go r.read()
+	go r.advance(r.stop)
+	tracing.recorder = r
+	atomic.StoreInt32(&tracing.enabled, 1)
+	return nil
+}
+
+// Stop stops the flight recorder and discards the recorded trace.
+// Stop only returns after the recorder has stopped reading the trace.
+func (r *FlightRecorder) Stop() error {
+	tracing.Lock()
+	defer tracing.Unlock()
+
+	if tracing.recorder != r {
+		return errors.New("trace: flight recorder is not enabled")
+	}
+	tracing.recorder = nil
+	atomic.StoreInt32(&tracing.enabled, 0)
+
+	// Take the writing lock so that a concurrent WriteTo
+	// does not write out a trace that is being discarded.
+	r.writing.Lock()
+	defer r.writing.Unlock()
+	r.mu.Lock()
+	r.enabled = false
+	close(r.stop)
+	r.mu.Unlock()
+
+	runtime.StopTrace()
+
+	r.mu.Lock()
+	for r.reading {
+		r.cond.Wait()
+	}
+	r.header = nil
+	r.gens = nil
+	r.cur = nil
+	r.nbytes = 0
+	r.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether the flight recorder is running.
+func (r *FlightRecorder) Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+// WriteTo ends the current trace generation and writes the trace
+// recorded so far to w. It returns an error if the recorder is not
+// enabled. Only one WriteTo runs at a time.
+func (r *FlightRecorder) WriteTo(w io.Writer) (n int64, err error) {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+
+	if !r.Enabled() {
+		return 0, errors.New("trace: flight recorder is not enabled")
+	}
+	// End the current generation, so that the snapshot
+	// includes the most recent events, and wait for it.
+	gen := advance()
+	r.mu.Lock()
+	for r.reading && r.ngen < gen {
+		r.cond.Wait()
+	}
+	if gen == 0 || r.ngen < gen {
+		r.mu.Unlock()
+		return 0, errors.New("trace: flight recorder stopped during WriteTo")
+	}
+	header := r.header
+	gens := append([]generation(nil), r.gens...)
+	r.mu.Unlock()
+
+	m, err := w.Write(header)
+	n += int64(m)
+	if err != nil {
+		return n, err
+	}
+	for _, g := range gens {
+		m, err := w.Write(g.data)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// read reads the trace into r until tracing stops.
+func (r *FlightRecorder) read() {
+	start := time.Now()
+	for {
+		data, genEnd := readTrace()
+		if data == nil {
+			break
+		}
+		r.mu.Lock()
+		if r.header == nil {
+			r.header = append([]byte(nil), data...)
+			r.mu.Unlock()
+			continue
+		}
+		r.cur = append(r.cur, data...)
+		if genEnd {
+			r.gens = append(r.gens, generation{data: r.cur, start: start})
+			r.nbytes += len(r.cur)
+			r.cur = nil
+			r.ngen++
+			start = time.Now()
+			r.trim(start)
+			r.cond.Broadcast()
+		}
+		r.mu.Unlock()
+	}
+	r.mu.Lock()
+	r.reading = false
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// trim drops the oldest generations that are not needed to cover
+// the period before now, or that exceed the size.
+// r.mu must be held.
+func (r *FlightRecorder) trim(now time.Time) {
+	i := 0
+	for ; i < len(r.gens)-1; i++ {
+		if r.nbytes <= r.size && now.Sub(r.gens[i+1].start) < r.period {
+			break
+		}
+		r.nbytes -= len(r.gens[i].data)
+		r.gens[i] = generation{}
+	}
+	r.gens = r.gens[i:]
+}
+
+// advance starts a new trace generation every quarter period,
+// until stop is closed.
+func (r *FlightRecorder) advance(stop chan struct{}) {
+	d := r.period / 4
+	if d <= 0 {
+		d = r.period
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			advance()
+		}
+	}
+}
+
+// Implemented in the runtime.
+
+// readTrace is runtime.ReadTrace, but also reports whether
+// the returned chunk ends a trace generation.
+func readTrace() (buf []byte, genEnd bool)
+
+// advance ends the current trace generation and starts a new one.
+// It returns the number of the generation it ended,
+// or 0 if tracing is not enabled.
+func advance() uint64
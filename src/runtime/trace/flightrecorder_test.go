@@ -0,0 +1,185 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"internal/trace"
+	"os"
+	"runtime"
+	. "runtime/trace"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorderStartStop(t *testing.T) {
+	r := NewFlightRecorder()
+	if err := r.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	if err := r.Start(); err == nil {
+		t.Fatalf("succeeded to start flight recorder second time")
+	}
+	if err := Start(new(bytes.Buffer)); err == nil {
+		t.Fatalf("succeeded to start tracing while flight recorder is enabled")
+	}
+	Stop()
+	if !r.Enabled() || !IsEnabled() {
+		t.Fatalf("Stop stopped the flight recorder")
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatalf("failed to stop flight recorder: %v", err)
+	}
+	if r.Enabled() || IsEnabled() {
+		t.Fatalf("flight recorder is enabled after Stop")
+	}
+	if err := r.Stop(); err == nil {
+		t.Fatalf("succeeded to stop flight recorder second time")
+	}
+	if _, err := r.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Fatalf("succeeded to write stopped flight recorder")
+	}
+}
+
+// TestFlightRecorder checks that the snapshot is a valid trace
+// that covers the recent past but not the whole execution.
+func TestFlightRecorder(t *testing.T) {
+	r := NewFlightRecorder()
+	r.SetPeriod(100 * time.Millisecond)
+	if err := r.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer r.Stop()
+
+	// Log a sequence of numbers for several periods.
+	ctx := context.Background()
+	n := 0
+	for start := time.Now(); time.Since(start) < 500*time.Millisecond; n++ {
+		Log(ctx, "seq", strconv.Itoa(n))
+		time.Sleep(time.Millisecond)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := r.WriteTo(buf); err != nil {
+		t.Fatalf("failed to write flight recorder: %v", err)
+	}
+	events, _, err := parseTrace(t, buf)
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	var logged []int
+	for _, ev := range events {
+		if ev.Type == trace.EvUserLog && ev.SArgs[0] == "seq" {
+			i, err := strconv.Atoi(ev.SArgs[1])
+			if err != nil {
+				t.Fatalf("bad log message %q", ev.SArgs[1])
+			}
+			logged = append(logged, i)
+		}
+	}
+	if len(logged) == 0 {
+		t.Fatalf("trace has no log events")
+	}
+	for i := 1; i < len(logged); i++ {
+		if logged[i] != logged[i-1]+1 {
+			t.Fatalf("trace has log %v after %v", logged[i], logged[i-1])
+		}
+	}
+	if logged[0] == 0 {
+		t.Errorf("trace covers the whole execution, want only the recent past")
+	}
+	if last := logged[len(logged)-1]; last != n-1 {
+		t.Errorf("last log in trace is %v, want %v", last, n-1)
+	}
+}
+
+// TestFlightRecorderStress checks that goroutines blocked, sleeping
+// or in syscalls across generation boundaries are traced consistently.
+func TestFlightRecorderStress(t *testing.T) {
+	r := NewFlightRecorder()
+	r.SetPeriod(time.Hour)
+	if err := r.Start(); err != nil {
+		t.Fatalf("failed to start flight recorder: %v", err)
+	}
+	defer r.Stop()
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	rp, wp, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer rp.Close()
+	defer wp.Close()
+
+	// The readers stop when the pipe is closed after the other goroutines.
+	done := make(chan bool)
+	var wg, readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		wg.Add(2)
+		go func() {
+			defer readers.Done()
+			var b [1]byte
+			for {
+				if _, err := rp.Read(b[:]); err != nil {
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+					wp.Write([]byte{0})
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c := make(chan int)
+			go func() {
+				for i := 0; ; i++ {
+					select {
+					case c <- i:
+					case <-done:
+						return
+					}
+				}
+			}()
+			for {
+				select {
+				case <-c:
+					runtime.Gosched()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	// Each WriteTo ends a generation.
+	buf := new(bytes.Buffer)
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		buf.Reset()
+		if _, err := r.WriteTo(buf); err != nil {
+			t.Fatalf("failed to write flight recorder: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	wp.Close()
+	readers.Wait()
+
+	if _, _, err := parseTrace(t, buf); err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+}
@@ -9,17 +9,30 @@
 // in a compact form. A precise nanosecond-precision timestamp and a stack
 // trace is captured for most events. A trace can be analyzed later with
 // 'go tool trace' command.
+//
+// Programs can annotate the trace with application-level operations:
+// a Task, created by NewTask, is a logical operation such as an RPC
+// request that may span several goroutines; a Region, created by
+// StartRegion or WithRegion, is an interval of a goroutine's execution;
+// and Log records a one-off message. Tasks and their regions and logs
+// are linked through the context.Context passed to these functions.
+// 'go tool trace' reports the latency of tasks and regions by type.
 package trace
 
 import (
 	"io"
 	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
 // Start enables tracing for the current program.
 // While tracing, the trace will be buffered and written to w.
 // Start returns an error if tracing is already enabled.
 func Start(w io.Writer) error {
+	tracing.Lock()
+	defer tracing.Unlock()
+
 	if err := runtime.StartTrace(); err != nil {
 		return err
 	}
@@ -32,11 +45,26 @@ func Start(w io.Writer) error {
 			w.Write(data)
 		}
 	}()
+	atomic.StoreInt32(&tracing.enabled, 1)
 	return nil
 }
 
 // Stop stops the current tracing, if any.
 // Stop only returns after all the writes for the trace have completed.
+// Stop does not stop a FlightRecorder.
 func Stop() {
+	tracing.Lock()
+	defer tracing.Unlock()
+	if tracing.recorder != nil {
+		return
+	}
+	atomic.StoreInt32(&tracing.enabled, 0)
+
 	runtime.StopTrace()
 }
+
+var tracing struct {
+	sync.Mutex                 // serializes Start and Stop
+	enabled    int32           // whether tracing is enabled; accessed atomically
+	recorder   *FlightRecorder // the running flight recorder, if any
+}
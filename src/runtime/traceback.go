@@ -43,8 +43,10 @@ var (
 	mstartPC             uintptr
 	rt0_goPC             uintptr
 	sigpanicPC           uintptr
+	asyncPreemptPC       uintptr
 	runfinqPC            uintptr
 	bgsweepPC            uintptr
+	bgscavengePC         uintptr
 	forcegchelperPC      uintptr
 	timerprocPC          uintptr
 	gcBgMarkWorkerPC     uintptr
@@ -70,8 +72,10 @@ func tracebackinit() {
 	mstartPC = funcPC(mstart)
 	rt0_goPC = funcPC(rt0_go)
 	sigpanicPC = funcPC(sigpanic)
+	asyncPreemptPC = funcPC(asyncPreempt)
 	runfinqPC = funcPC(runfinq)
 	bgsweepPC = funcPC(bgsweep)
+	bgscavengePC = funcPC(bgscavenge)
 	forcegchelperPC = funcPC(forcegchelper)
 	timerprocPC = funcPC(timerproc)
 	gcBgMarkWorkerPC = funcPC(gcBgMarkWorker)
@@ -171,6 +175,7 @@ func gentraceback(pc0, sp0, lr0 uintptr, gp *g, skip int, pcbuf *uintptr, max in
 		frame.lr = lr0
 	}
 	waspanic := false
+	injectedCall := false // the call to this frame was injected by a signal handler
 	printing := pcbuf == nil && callback == nil
 	_defer := gp._defer
 
@@ -377,7 +382,7 @@ func gentraceback(pc0, sp0, lr0 uintptr, gp *g, skip int, pcbuf *uintptr, max in
 				//		/home/rsc/go/src/runtime/x.go:23 +0xf
 				//
 				tracepc := frame.pc // back up to CALL instruction for funcline.
-				if (n > 0 || flags&_TraceTrap == 0) && frame.pc > f.entry && !waspanic {
+				if (n > 0 || flags&_TraceTrap == 0) && frame.pc > f.entry && !injectedCall {
 					tracepc--
 				}
 				name := funcname(f)
@@ -413,6 +418,7 @@ func gentraceback(pc0, sp0, lr0 uintptr, gp *g, skip int, pcbuf *uintptr, max in
 
 	skipped:
 		waspanic = f.entry == sigpanicPC
+		injectedCall = waspanic || f.entry == asyncPreemptPC
 
 		// Do not unwind past the bottom of the stack.
 		if flr == nil {
@@ -428,8 +434,8 @@ func gentraceback(pc0, sp0, lr0 uintptr, gp *g, skip int, pcbuf *uintptr, max in
 		frame.argmap = nil
 
 		// On link register architectures, sighandler saves the LR on stack
-		// before faking a call to sigpanic.
-		if usesLR && waspanic {
+		// before faking a call to sigpanic or asyncPreempt.
+		if usesLR && injectedCall {
 			x := *(*uintptr)(unsafe.Pointer(frame.sp))
 			frame.sp += sys.MinFrameSize
 			if GOARCH == "arm64" {
@@ -735,6 +741,7 @@ func isSystemGoroutine(gp *g) bool {
 	pc := gp.startpc
 	return pc == runfinqPC && !fingRunning ||
 		pc == bgsweepPC ||
+		pc == bgscavengePC ||
 		pc == forcegchelperPC ||
 		pc == timerprocPC ||
 		pc == gcBgMarkWorkerPC
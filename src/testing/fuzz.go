@@ -0,0 +1,464 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	matchFuzz        = flag.String("test.fuzz", "", "run the fuzz target matching `regexp`")
+	fuzzDuration     = flag.Duration("test.fuzztime", 0, "time to spend fuzzing; default is to run until a failure is found")
+	minimizeDuration = flag.Duration("test.fuzzminimizetime", 60*time.Second, "time to spend minimizing a failing input")
+	fuzzCacheDir     = flag.String("test.fuzzcachedir", "", "directory in which to keep interesting inputs between runs")
+
+	haveFuzzTargets bool // are there fuzz targets?
+)
+
+// fuzzStatusInterval is how often progress is reported while fuzzing.
+const fuzzStatusInterval = 3 * time.Second
+
+// An internal type but exported because it is cross-package; part of the implementation
+// of the "go test" command.
+type InternalFuzzTarget struct {
+	Name string
+	Fn   func(f *F)
+}
+
+// F is a type passed to fuzz targets.
+//
+// A fuzz target adds inputs to the seed corpus with Add and then calls
+// Fuzz with the function to be run on each input. Methods such as Fatal
+// and Skip may be used in the fuzz target before calling Fuzz, but not
+// from within the fuzz function, which receives its own *T.
+type F struct {
+	common
+	context    *testContext
+	corpus     []corpusEntry
+	fuzzing    bool // whether to generate new inputs rather than run the corpus
+	fuzzCalled bool
+}
+
+// A corpusEntry is an input to a fuzz function.
+type corpusEntry struct {
+	name   string
+	values []interface{}
+}
+
+// Add adds the arguments to the seed corpus for the fuzz target.
+// The arguments must match the arguments of the fuzz function,
+// excluding the leading *T, and have one of the types accepted by Fuzz.
+func (f *F) Add(args ...interface{}) {
+	if f.fuzzCalled {
+		panic("testing: F.Add called after F.Fuzz")
+	}
+	for _, arg := range args {
+		if !supportedFuzzType(reflect.TypeOf(arg)) {
+			panic(fmt.Sprintf("testing: unsupported type to Add %T", arg))
+		}
+	}
+	f.corpus = append(f.corpus, corpusEntry{
+		name:   fmt.Sprintf("seed#%d", len(f.corpus)),
+		values: args,
+	})
+}
+
+// Fuzz runs the fuzz function ff on the corpus of inputs.
+//
+// ff must be a function with no return value whose first argument is
+// a *T and whose remaining arguments are the values to be fuzzed.
+// The fuzzed arguments may have the types []byte, string, bool, byte,
+// rune, float32, float64, int, int8, int16, int32, int64, uint, uint16,
+// uint32 and uint64.
+//
+// During an ordinary test run, ff is called once for each input in the
+// seed corpus: the inputs added with Add followed by the files in
+// testdata/fuzz/FuzzXxx. Each call runs as a subtest named for the input.
+// When fuzzing with the -test.fuzz flag, ff is also called on inputs
+// generated by mutating the corpus, guided by coverage instrumentation,
+// until an input fails or the -test.fuzztime limit is reached. A failing
+// input is minimized and written to testdata/fuzz/FuzzXxx, making it
+// part of the seed corpus for future test runs.
+//
+// ff must not call t.Parallel, and should be fast and deterministic:
+// each input may be run many times. Fuzz may be called only once.
+func (f *F) Fuzz(ff interface{}) {
+	if f.fuzzCalled {
+		panic("testing: F.Fuzz called more than once")
+	}
+	f.fuzzCalled = true
+
+	fn := reflect.ValueOf(ff)
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func {
+		panic("testing: F.Fuzz must receive a function")
+	}
+	if fnType.NumIn() < 2 || fnType.In(0) != reflect.TypeOf((*T)(nil)) {
+		panic("testing: fuzz function must receive at least two arguments, where the first argument is a *T")
+	}
+	if fnType.NumOut() != 0 {
+		panic("testing: fuzz function must not return a value")
+	}
+	var types []reflect.Type
+	for i := 1; i < fnType.NumIn(); i++ {
+		t := fnType.In(i)
+		if !supportedFuzzType(t) {
+			panic(fmt.Sprintf("testing: unsupported type for fuzzing %v", t))
+		}
+		types = append(types, t)
+	}
+
+	for _, e := range f.corpus {
+		if err := checkCorpusTypes(e.values, types); err != nil {
+			f.Fatalf("%s: %v", e.name, err)
+		}
+	}
+	entries, err := readCorpus(joinPath("testdata", "fuzz", f.name), types)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.corpus = append(f.corpus, entries...)
+
+	if f.fuzzing {
+		f.fuzz(fn, types)
+		return
+	}
+	for _, e := range f.corpus {
+		name, ok := f.context.match.fullName(&f.common, e.name)
+		if !ok {
+			continue
+		}
+		f.runInput(fn, name, e.values, true)
+	}
+}
+
+// runInput calls the fuzz function fn with values, as a test named name
+// running under f, and reports whether it succeeded. If report is false,
+// the test's output is discarded rather than added to f's.
+func (f *F) runInput(fn reflect.Value, name string, values []interface{}, report bool) bool {
+	parent := &f.common
+	if !report {
+		parent = &common{w: discard{}, name: f.name, level: f.level}
+	}
+	t := &T{
+		common: common{
+			barrier: make(chan bool),
+			signal:  make(chan bool),
+			name:    name,
+			parent:  parent,
+			level:   f.level + 1,
+			chatty:  report && f.chatty,
+		},
+		context: f.context,
+	}
+	t.w = indenter{&t.common}
+
+	if t.chatty {
+		root := t.parent
+		for ; root.parent != nil; root = root.parent {
+		}
+		root.mu.Lock()
+		fmt.Fprintf(root.w, "=== RUN   %s\n", t.name)
+		root.mu.Unlock()
+	}
+
+	// The fuzz function may modify its arguments;
+	// give it copies so that the corpus is unaffected.
+	args := []reflect.Value{reflect.ValueOf(t)}
+	for _, v := range copyValues(values) {
+		args = append(args, reflect.ValueOf(v))
+	}
+	go tRunner(t, func(t *T) {
+		if f.fuzzing {
+			// Report a panic as a failure of this input,
+			// so that fuzzing can minimize and record it.
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("panic: %v\n%s", err, debug.Stack())
+				}
+			}()
+		}
+		fn.Call(args)
+	})
+	<-t.signal
+	return !t.Failed()
+}
+
+// fuzz runs the fuzzing loop for f, mutating the inputs in f.corpus
+// until one fails or the time limit is reached.
+func (f *F) fuzz(fn reflect.Value, types []reflect.Type) {
+	var cacheDir string
+	if *fuzzCacheDir != "" {
+		cacheDir = joinPath(*fuzzCacheDir, f.name)
+		entries, err := readCorpus(cacheDir, types)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.corpus = append(f.corpus, entries...)
+	}
+	if len(f.corpus) == 0 {
+		f.corpus = append(f.corpus, corpusEntry{name: "zero", values: zeroValues(types)})
+	}
+	if len(cover.Counters) == 0 {
+		fmt.Fprintf(os.Stderr, "testing: warning: test binary built without coverage instrumentation; fuzzing is not coverage guided\n")
+	}
+
+	// Run the existing corpus first: a failure there needs no search,
+	// and the coverage it reaches is the baseline for new inputs.
+	var cov coverTracker
+	for _, e := range f.corpus {
+		if !f.runInput(fn, f.name, e.values, false) {
+			f.runInput(fn, f.name+"/"+e.name, e.values, true)
+			return
+		}
+		cov.update()
+	}
+
+	r := newFuzzRand(time.Now().UnixNano())
+	start := time.Now()
+	lastStatus := start
+	baseline := len(f.corpus)
+	var execs int64
+	for *fuzzDuration <= 0 || time.Since(start) < *fuzzDuration {
+		if time.Since(lastStatus) >= fuzzStatusInterval {
+			lastStatus = time.Now()
+			f.fuzzStatus(start, execs, len(f.corpus)-baseline)
+		}
+		e := f.corpus[r.Intn(len(f.corpus))]
+		values := mutateValues(r, e.values)
+		execs++
+		if !f.runInput(fn, f.name, values, false) {
+			f.fuzzStatus(start, execs, len(f.corpus)-baseline)
+			f.reportFailure(fn, f.minimize(fn, values))
+			return
+		}
+		if cov.update() {
+			name := corpusEntryName(values)
+			f.corpus = append(f.corpus, corpusEntry{name: name, values: values})
+			if cacheDir != "" {
+				// Losing an interesting input only slows down the next run.
+				writeCorpusFile(cacheDir, values)
+			}
+		}
+	}
+	f.fuzzStatus(start, execs, len(f.corpus)-baseline)
+}
+
+// fuzzStatus prints a progress line for the fuzzing run.
+func (f *F) fuzzStatus(start time.Time, execs int64, interesting int) {
+	elapsed := time.Since(start)
+	root := &f.common
+	for ; root.parent != nil; root = root.parent {
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	fmt.Fprintf(root.w, "fuzz: elapsed: %ds, execs: %d (%.0f/sec), new interesting: %d (total: %d)\n",
+		int(elapsed.Seconds()), execs, float64(execs)/elapsed.Seconds(), interesting, len(f.corpus))
+}
+
+// reportFailure records the failing input values in the seed corpus
+// and runs them once more so that their failure is reported under f.
+func (f *F) reportFailure(fn reflect.Value, values []interface{}) {
+	dir := joinPath("testdata", "fuzz", f.name)
+	name, err := writeCorpusFile(dir, values)
+	if err != nil {
+		f.Errorf("writing failing input: %v", err)
+		name = corpusEntryName(values)
+	}
+	f.runInput(fn, f.name+"/"+name, values, true)
+	if err == nil {
+		f.logRaw(fmt.Sprintf("Failing input written to %s\nTo re-run:\ngo test -run=%s/%s\n", joinPath(dir, name), f.name, name))
+	}
+}
+
+// minimize returns a smaller version of the failing input values
+// that still fails, within the -test.fuzzminimizetime limit.
+func (f *F) minimize(fn reflect.Value, values []interface{}) []interface{} {
+	deadline := time.Now().Add(*minimizeDuration)
+	values = copyValues(values)
+	for i := range values {
+		fails := func(v interface{}) bool {
+			if time.Now().After(deadline) {
+				return false
+			}
+			try := copyValues(values)
+			try[i] = v
+			return !f.runInput(fn, f.name, try, false)
+		}
+		switch v := values[i].(type) {
+		case []byte:
+			values[i] = minimizeBytes(v, func(b []byte) bool { return fails(b) })
+		case string:
+			values[i] = string(minimizeBytes([]byte(v), func(b []byte) bool { return fails(string(b)) }))
+		default:
+			if z := reflect.Zero(reflect.TypeOf(v)).Interface(); v != z && fails(z) {
+				values[i] = z
+			}
+		}
+	}
+	return values
+}
+
+// minimizeBytes removes ever smaller chunks of b for as long as
+// the result still fails.
+func minimizeBytes(b []byte, fails func([]byte) bool) []byte {
+	for chunk := (len(b) + 1) / 2; chunk >= 1; chunk /= 2 {
+		for i := 0; i+chunk <= len(b); {
+			try := append(append([]byte(nil), b[:i]...), b[i+chunk:]...)
+			if fails(try) {
+				b = try
+			} else {
+				i += chunk
+			}
+		}
+	}
+	return b
+}
+
+// logRaw adds the lines of s to the output of f
+// without the file and line prefix added by Log.
+func (f *F) logRaw(s string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n") {
+		f.output = append(f.output, "\t"+strings.TrimSuffix(line, "\n")+"\n"...)
+	}
+}
+
+// A coverTracker detects inputs that reach code not reached before,
+// using the counters of the coverage instrumentation.
+type coverTracker struct {
+	covered int
+}
+
+// update reports whether more blocks have been covered
+// since the last call.
+func (c *coverTracker) update() bool {
+	n := 0
+	for _, counters := range cover.Counters {
+		for i := range counters {
+			if atomic.LoadUint32(&counters[i]) != 0 {
+				n++
+			}
+		}
+	}
+	if n > c.covered {
+		c.covered = n
+		return true
+	}
+	return false
+}
+
+func fRunner(f *F, fn func(f *F)) {
+	defer func() {
+		f.duration += time.Since(f.start)
+		err := recover()
+		if !f.finished && err == nil {
+			err = fmt.Errorf("fuzz target executed panic(nil) or runtime.Goexit")
+		}
+		if err != nil {
+			f.Fail()
+			for c := &f.common; c.parent != nil; c = c.parent {
+				c.flushToParent("--- FAIL: %s (%s)\n", c.name, fmtDuration(c.duration))
+			}
+			panic(err)
+		}
+		f.report()
+
+		f.mu.Lock()
+		f.done = true
+		f.mu.Unlock()
+		f.signal <- true
+	}()
+
+	f.start = time.Now()
+	fn(f)
+	f.finished = true
+}
+
+// runFuzzTarget runs the fuzz target ft under root and reports whether it succeeded.
+func runFuzzTarget(root *common, ctx *testContext, ft InternalFuzzTarget, fuzzing bool) bool {
+	name, ok := ctx.match.fullName(root, ft.Name)
+	if !ok && !fuzzing {
+		return true
+	}
+	f := &F{
+		common: common{
+			signal: make(chan bool),
+			name:   name,
+			parent: root,
+			level:  root.level + 1,
+			chatty: root.chatty,
+		},
+		context: ctx,
+		fuzzing: fuzzing,
+	}
+	f.w = indenter{&f.common}
+	if f.chatty {
+		root.mu.Lock()
+		fmt.Fprintf(root.w, "=== RUN   %s\n", f.name)
+		root.mu.Unlock()
+	}
+	go fRunner(f, ft.Fn)
+	<-f.signal
+	return !f.Failed()
+}
+
+// runFuzzTests runs the fuzz targets selected by -test.run on their seed corpora.
+func runFuzzTests(matchString func(pat, str string) (bool, error), fuzzTargets []InternalFuzzTarget) (ok bool) {
+	ok = true
+	if len(fuzzTargets) == 0 {
+		return
+	}
+	for _, procs := range cpuList {
+		runtime.GOMAXPROCS(procs)
+		ctx := newTestContext(1, newMatcher(matchString, *match, "-test.run"))
+		root := &common{w: os.Stdout, chatty: *chatty}
+		for _, ft := range fuzzTargets {
+			if !runFuzzTarget(root, ctx, ft, false) {
+				ok = false
+			}
+		}
+	}
+	return
+}
+
+// runFuzzing runs the fuzz target selected by -test.fuzz, if any,
+// generating new inputs until one fails or -test.fuzztime elapses.
+func runFuzzing(matchString func(pat, str string) (bool, error), fuzzTargets []InternalFuzzTarget) (ok bool) {
+	if *matchFuzz == "" {
+		return true
+	}
+	m := newMatcher(matchString, *matchFuzz, "-test.fuzz")
+	var targets []InternalFuzzTarget
+	var names []string
+	for _, ft := range fuzzTargets {
+		if _, matched := m.fullName(nil, ft.Name); matched {
+			targets = append(targets, ft)
+			names = append(names, ft.Name)
+		}
+	}
+	switch len(targets) {
+	case 0:
+		fmt.Fprintln(os.Stderr, "testing: warning: no fuzz targets to fuzz")
+		return true
+	case 1:
+	default:
+		fmt.Fprintf(os.Stderr, "testing: will not fuzz, -test.fuzz matches more than one fuzz target: %v\n", names)
+		return false
+	}
+	// Names of inputs run while fuzzing are not filtered.
+	ctx := newTestContext(1, newMatcher(matchString, "", "-test.fuzz"))
+	root := &common{w: os.Stdout, chatty: *chatty}
+	return runFuzzTarget(root, ctx, targets[0], true)
+}
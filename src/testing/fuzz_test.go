@@ -0,0 +1,89 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+)
+
+func TestCorpusFileRoundTrip(t *T) {
+	values := []interface{}{
+		[]byte("a\x00\xff\n"),
+		"hello\t\"world\"",
+		true,
+		byte('x'),
+		byte(0),
+		rune('☺'),
+		int32(-1),
+		int32(0xD800), // not a valid rune
+		int(-42),
+		int8(math.MinInt8),
+		int16(math.MaxInt16),
+		int64(math.MinInt64),
+		uint(7),
+		uint16(math.MaxUint16),
+		uint32(math.MaxUint32),
+		uint64(math.MaxUint64),
+		float32(1.5),
+		float64(-0.1),
+		math.Inf(1),
+	}
+	data := marshalCorpusFile(values)
+	got, err := unmarshalCorpusFile(data)
+	if err != nil {
+		t.Fatalf("unmarshalCorpusFile(%q): %v", data, err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("round trip of %q:\nhave %#v\nwant %#v", data, got, values)
+	}
+}
+
+func TestCorpusFileErrors(t *T) {
+	for _, data := range []string{
+		"",
+		"go test fuzz v1\n",
+		"go test fuzz v2\nint(1)\n",
+		"go test fuzz v1\nint(1\n",
+		"go test fuzz v1\nint8(300)\n",
+		"go test fuzz v1\nstring(abc)\n",
+		"go test fuzz v1\nbyte('☺')\n",
+		"go test fuzz v1\ncomplex128(1)\n",
+	} {
+		if v, err := unmarshalCorpusFile([]byte(data)); err == nil {
+			t.Errorf("unmarshalCorpusFile(%q) = %v, want error", data, v)
+		}
+	}
+}
+
+func TestMutateValuesKeepsTypes(t *T) {
+	r := newFuzzRand(1)
+	seed := []interface{}{[]byte("abc"), "", false, int8(0), uint16(1), float32(2), uint64(3)}
+	var types []reflect.Type
+	for _, v := range seed {
+		types = append(types, reflect.TypeOf(v))
+	}
+	values := seed
+	for i := 0; i < 1000; i++ {
+		values = mutateValues(r, values)
+		if err := checkCorpusTypes(values, types); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []interface{}{[]byte("abc"), "", false, int8(0), uint16(1), float32(2), uint64(3)}; !reflect.DeepEqual(seed, want) {
+		t.Errorf("mutateValues modified its argument: have %#v, want %#v", seed, want)
+	}
+}
+
+func TestMinimizeBytes(t *T) {
+	b := []byte("aaaaXbbbbYcccc")
+	got := minimizeBytes(b, func(b []byte) bool {
+		return bytes.IndexByte(b, 'X') >= 0 && bytes.IndexByte(b, 'Y') >= 0
+	})
+	if string(got) != "XY" {
+		t.Errorf("minimizeBytes = %q, want %q", got, "XY")
+	}
+}
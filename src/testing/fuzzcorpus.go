@@ -0,0 +1,309 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Storage of fuzzing inputs.
+
+package testing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Each corpus file holds one input, as a header line followed by one
+// line per value in the form type(literal), using Go syntax:
+//
+//	go test fuzz v1
+//	[]byte("hello\x00")
+//	int(42)
+//
+// The file is named for a hash of its content.
+const corpusHeader = "go test fuzz v1"
+
+// supportedFuzzType reports whether values of type t can be fuzzed.
+func supportedFuzzType(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.PkgPath() == ""
+	case reflect.Slice:
+		return t == reflect.TypeOf([]byte(nil))
+	}
+	return false
+}
+
+// checkCorpusTypes checks that values can be passed to a fuzz function
+// taking arguments of the given types.
+func checkCorpusTypes(values []interface{}, types []reflect.Type) error {
+	if len(values) != len(types) {
+		return fmt.Errorf("wrong number of values: have %d, want %d", len(values), len(types))
+	}
+	for i, v := range values {
+		if t := reflect.TypeOf(v); t != types[i] {
+			return fmt.Errorf("value %d has type %v, want %v", i, t, types[i])
+		}
+	}
+	return nil
+}
+
+// zeroValues returns the zero values of types.
+func zeroValues(types []reflect.Type) []interface{} {
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		values[i] = reflect.Zero(t).Interface()
+		if t.Kind() == reflect.Slice {
+			values[i] = []byte{}
+		}
+	}
+	return values
+}
+
+// copyValues returns a copy of values that shares no memory with it.
+func copyValues(values []interface{}) []interface{} {
+	c := make([]interface{}, len(values))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = append([]byte{}, b...)
+		}
+		c[i] = v
+	}
+	return c
+}
+
+// joinPath joins path elements with the OS path separator.
+// Simple implementation to avoid pulling in path/filepath.
+func joinPath(elem ...string) string {
+	return strings.Join(elem, string(os.PathSeparator))
+}
+
+// readCorpus reads the corpus files in dir, checking that their values
+// match types. A missing directory is an empty corpus.
+func readCorpus(dir string, types []reflect.Type) ([]corpusEntry, error) {
+	d, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var entries []corpusEntry
+	for _, name := range names {
+		file := joinPath(dir, name)
+		data, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		values, err := unmarshalCorpusFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := checkCorpusTypes(values, types); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		entries = append(entries, corpusEntry{name: name, values: values})
+	}
+	return entries, nil
+}
+
+func readFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(f)
+	return buf.Bytes(), err
+}
+
+// writeCorpusFile writes values to a new corpus file in dir
+// and returns the name of the file.
+func writeCorpusFile(dir string, values []interface{}) (string, error) {
+	data := marshalCorpusFile(values)
+	name := corpusFileName(data)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	f, err := os.Create(joinPath(dir, name))
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return name, err
+}
+
+// corpusEntryName returns the name of the corpus file holding values.
+func corpusEntryName(values []interface{}) string {
+	return corpusFileName(marshalCorpusFile(values))
+}
+
+// corpusFileName returns the name of the corpus file holding data:
+// its 64-bit FNV-1a hash. Package testing cannot import hash/fnv,
+// whose tests import testing.
+func corpusFileName(data []byte) string {
+	h := uint64(14695981039346656037)
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return fmt.Sprintf("%016x", h)
+}
+
+// marshalCorpusFile encodes values in the corpus file format.
+func marshalCorpusFile(values []interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString(corpusHeader + "\n")
+	for _, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			fmt.Fprintf(&b, "[]byte(%q)\n", v)
+		case string:
+			fmt.Fprintf(&b, "string(%q)\n", v)
+		case byte:
+			fmt.Fprintf(&b, "byte(%q)\n", v)
+		case rune:
+			if utf8.ValidRune(v) {
+				fmt.Fprintf(&b, "rune(%q)\n", v)
+			} else {
+				fmt.Fprintf(&b, "int32(%d)\n", v)
+			}
+		case float32:
+			fmt.Fprintf(&b, "float32(%s)\n", strconv.FormatFloat(float64(v), 'g', -1, 32))
+		case float64:
+			fmt.Fprintf(&b, "float64(%s)\n", strconv.FormatFloat(v, 'g', -1, 64))
+		default:
+			// bool and the remaining integer types.
+			fmt.Fprintf(&b, "%T(%v)\n", v, v)
+		}
+	}
+	return b.Bytes()
+}
+
+// unmarshalCorpusFile decodes the values in a corpus file.
+func unmarshalCorpusFile(data []byte) ([]interface{}, error) {
+	lines := strings.Split(string(data), "\n")
+	if strings.TrimSpace(lines[0]) != corpusHeader {
+		return nil, fmt.Errorf("missing %q header", corpusHeader)
+	}
+	var values []interface{}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		v, err := parseCorpusValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("malformed line %q: %v", line, err)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no values")
+	}
+	return values, nil
+}
+
+// parseCorpusValue parses a single type(literal) line of a corpus file.
+func parseCorpusValue(line string) (interface{}, error) {
+	i := strings.Index(line, "(")
+	if i < 0 || !strings.HasSuffix(line, ")") {
+		return nil, errors.New("want type(literal)")
+	}
+	typ, lit := line[:i], line[i+1:len(line)-1]
+	switch typ {
+	case "[]byte":
+		s, err := unquoteString(lit)
+		return []byte(s), err
+	case "string":
+		return unquoteString(lit)
+	case "bool":
+		return strconv.ParseBool(lit)
+	case "byte", "uint8":
+		v, err := parseChar(lit, 8, false)
+		return uint8(v), err
+	case "rune", "int32":
+		v, err := parseChar(lit, 32, true)
+		return int32(v), err
+	case "int":
+		v, err := strconv.ParseInt(lit, 0, strconv.IntSize)
+		return int(v), err
+	case "int8":
+		v, err := strconv.ParseInt(lit, 0, 8)
+		return int8(v), err
+	case "int16":
+		v, err := strconv.ParseInt(lit, 0, 16)
+		return int16(v), err
+	case "int64":
+		return strconv.ParseInt(lit, 0, 64)
+	case "uint":
+		v, err := strconv.ParseUint(lit, 0, strconv.IntSize)
+		return uint(v), err
+	case "uint16":
+		v, err := strconv.ParseUint(lit, 0, 16)
+		return uint16(v), err
+	case "uint32":
+		v, err := strconv.ParseUint(lit, 0, 32)
+		return uint32(v), err
+	case "uint64":
+		return strconv.ParseUint(lit, 0, 64)
+	case "float32":
+		v, err := strconv.ParseFloat(lit, 32)
+		return float32(v), err
+	case "float64":
+		return strconv.ParseFloat(lit, 64)
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// unquoteString unquotes a Go string literal.
+func unquoteString(lit string) (string, error) {
+	if lit == "" || lit[0] != '"' && lit[0] != '`' {
+		return "", errors.New("want string literal")
+	}
+	return strconv.Unquote(lit)
+}
+
+// parseChar parses an integer or character literal of the given size.
+func parseChar(lit string, bits int, signed bool) (int64, error) {
+	if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		if signed {
+			return strconv.ParseInt(lit, 0, bits)
+		}
+		v, err := strconv.ParseUint(lit, 0, bits)
+		return int64(v), err
+	}
+	r, _, tail, err := strconv.UnquoteChar(lit[1:len(lit)-1], '\'')
+	if err != nil {
+		return 0, err
+	}
+	if tail != "" {
+		return 0, errors.New("invalid character literal")
+	}
+	if !signed && r >= 1<<uint(bits) {
+		return 0, errors.New("character out of range")
+	}
+	return int64(r), nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Mutation of fuzzing inputs.
+
+package testing
+
+import "math"
+
+// maxMutatedLen is the length beyond which mutation
+// of a []byte or string no longer grows it.
+const maxMutatedLen = 1 << 16
+
+// fuzzRand is a xorshift64* pseudo-random number generator.
+// Package testing cannot use math/rand, whose tests import testing.
+type fuzzRand struct {
+	state uint64
+}
+
+func newFuzzRand(seed int64) *fuzzRand {
+	r := &fuzzRand{uint64(seed)}
+	if r.state == 0 {
+		r.state = 1
+	}
+	return r
+}
+
+// Uint64 returns a pseudo-random 64-bit value.
+func (r *fuzzRand) Uint64() uint64 {
+	r.state ^= r.state >> 12
+	r.state ^= r.state << 25
+	r.state ^= r.state >> 27
+	return r.state * 2685821657736338717
+}
+
+// Intn returns a pseudo-random number in [0, n). It panics if n <= 0.
+func (r *fuzzRand) Intn(n int) int {
+	if n <= 0 {
+		panic("testing: invalid argument to Intn")
+	}
+	return int(r.Uint64() % uint64(n))
+}
+
+// Float64 returns a pseudo-random number in [0.0, 1.0).
+func (r *fuzzRand) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// interestingBytes are byte values likely to reach edge cases.
+var interestingBytes = []byte{0, 1, '0', 'a', 0x7f, 0x80, 0xfe, 0xff}
+
+// mutateValues returns a copy of values with one of them changed at random.
+func mutateValues(r *fuzzRand, values []interface{}) []interface{} {
+	values = copyValues(values)
+	i := r.Intn(len(values))
+	switch v := values[i].(type) {
+	case []byte:
+		values[i] = mutateBytes(r, v)
+	case string:
+		values[i] = string(mutateBytes(r, []byte(v)))
+	case bool:
+		values[i] = !v
+	case int:
+		values[i] = int(mutateInt(r, int64(v), 64))
+	case int8:
+		values[i] = int8(mutateInt(r, int64(v), 8))
+	case int16:
+		values[i] = int16(mutateInt(r, int64(v), 16))
+	case int32:
+		values[i] = int32(mutateInt(r, int64(v), 32))
+	case int64:
+		values[i] = mutateInt(r, v, 64)
+	case uint:
+		values[i] = uint(mutateUint(r, uint64(v), 64))
+	case uint8:
+		values[i] = uint8(mutateUint(r, uint64(v), 8))
+	case uint16:
+		values[i] = uint16(mutateUint(r, uint64(v), 16))
+	case uint32:
+		values[i] = uint32(mutateUint(r, uint64(v), 32))
+	case uint64:
+		values[i] = mutateUint(r, v, 64)
+	case float32:
+		values[i] = float32(mutateFloat(r, float64(v)))
+	case float64:
+		values[i] = mutateFloat(r, v)
+	}
+	return values
+}
+
+// mutateBytes applies a few random edits to b, which it may modify.
+func mutateBytes(r *fuzzRand, b []byte) []byte {
+	for n := 1 + r.Intn(3); n > 0; n-- {
+		switch op := r.Intn(8); {
+		case len(b) == 0 || op == 0:
+			// Insert a random byte.
+			if len(b) >= maxMutatedLen {
+				continue
+			}
+			i := r.Intn(len(b) + 1)
+			b = append(b, 0)
+			copy(b[i+1:], b[i:])
+			b[i] = byte(r.Intn(256))
+		case op == 1:
+			// Delete a range.
+			i := r.Intn(len(b))
+			j := i + 1 + r.Intn(len(b)-i)
+			b = append(b[:i], b[j:]...)
+		case op == 2:
+			// Flip a bit.
+			b[r.Intn(len(b))] ^= 1 << uint(r.Intn(8))
+		case op == 3:
+			// Set a random byte.
+			b[r.Intn(len(b))] = byte(r.Intn(256))
+		case op == 4:
+			// Set an interesting byte.
+			b[r.Intn(len(b))] = interestingBytes[r.Intn(len(interestingBytes))]
+		case op == 5:
+			// Duplicate a range.
+			if len(b) >= maxMutatedLen {
+				continue
+			}
+			i := r.Intn(len(b))
+			j := i + 1 + r.Intn(len(b)-i)
+			at := r.Intn(len(b) + 1)
+			dup := append([]byte(nil), b[i:j]...)
+			b = append(b[:at], append(dup, b[at:]...)...)
+		case op == 6:
+			// Swap two bytes.
+			i, j := r.Intn(len(b)), r.Intn(len(b))
+			b[i], b[j] = b[j], b[i]
+		default:
+			// Add or subtract a small amount.
+			b[r.Intn(len(b))] += byte(r.Intn(33) - 16)
+		}
+	}
+	return b
+}
+
+// mutateInt returns a mutation of the bits-sized signed integer v.
+func mutateInt(r *fuzzRand, v int64, bits uint) int64 {
+	switch r.Intn(4) {
+	case 0:
+		v += int64(1 + r.Intn(16))
+	case 1:
+		v -= int64(1 + r.Intn(16))
+	case 2:
+		v ^= 1 << uint(r.Intn(int(bits)))
+	default:
+		switch r.Intn(4) {
+		case 0:
+			v = 0
+		case 1:
+			v = -1
+		case 2:
+			v = -1 << (bits - 1)
+		default:
+			v = 1<<(bits-1) - 1
+		}
+	}
+	// Sign-extend to keep v in range.
+	shift := 64 - bits
+	return v << shift >> shift
+}
+
+// mutateUint returns a mutation of the bits-sized unsigned integer v.
+func mutateUint(r *fuzzRand, v uint64, bits uint) uint64 {
+	switch r.Intn(4) {
+	case 0:
+		v += uint64(1 + r.Intn(16))
+	case 1:
+		v -= uint64(1 + r.Intn(16))
+	case 2:
+		v ^= 1 << uint(r.Intn(int(bits)))
+	default:
+		switch r.Intn(3) {
+		case 0:
+			v = 0
+		case 1:
+			v = 1
+		default:
+			v = math.MaxUint64
+		}
+	}
+	return v & (math.MaxUint64 >> (64 - bits))
+}
+
+// mutateFloat returns a mutation of v.
+func mutateFloat(r *fuzzRand, v float64) float64 {
+	switch r.Intn(5) {
+	case 0:
+		return v + float64(r.Intn(33)-16)
+	case 1:
+		return v * (4*r.Float64() - 2)
+	case 2:
+		return -v
+	case 3:
+		return math.Float64frombits(math.Float64bits(v) ^ 1<<uint(r.Intn(64)))
+	}
+	switch r.Intn(4) {
+	case 0:
+		return 0
+	case 1:
+		return math.Inf(1)
+	case 2:
+		return math.Inf(-1)
+	}
+	return math.NaN()
+}